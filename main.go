@@ -12,6 +12,7 @@ import (
 	"sip-monitor/src/config"
 	"sip-monitor/src/model"
 	"sip-monitor/src/pkg/rtcp"
+	"sip-monitor/src/pkg/siprocket"
 
 	"strings"
 
@@ -34,6 +35,11 @@ func main() {
 
 	logger := logrus.New()
 
+	// SIP解析相关配置
+	siprocket.SetSessionIDHeader(cfg.HeaderSessionIDName)
+	siprocket.SetCustomHeaders(strings.Split(cfg.CustomHeaders, ","))
+	siprocket.SetCorrelationHeaders(strings.Split(cfg.CorrelationHeaders, ","))
+
 	// 初始化数据库
 	repository, err := model.InitRepository(&cfg)
 	if err != nil {
@@ -43,8 +49,69 @@ func main() {
 	repository.CreateDefaultAdminUser(context.Background())
 
 	rtcpService := rtcp.NewRTCPReportService(logger)
+	// 入库过滤规则
+	ingestFilter := services.NewIngestFilter(logger, repository, cfg.DiscardMethods)
+	// 多个采集节点上报同一消息时去重
+	dedup, err := services.NewDeduplicator(time.Duration(cfg.DedupWindowMillis)*time.Millisecond, cfg.DedupMode)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create deduplicator")
+		return
+	}
+	// 经过B2BUA的呼叫腿关联
+	correlator, err := services.NewCorrelator(logger, repository, &cfg)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create correlator")
+		return
+	}
 	// 初始化保存服务
-	saveService := services.NewSaveService(logger, repository, rtcpService)
+	saveService := services.NewSaveService(logger, repository, rtcpService, ingestFilter, dedup, correlator)
+
+	// 中继健康检查，根据OPTIONS判断网关状态
+	trunkHealth := services.NewTrunkHealthService(logger, repository,
+		time.Duration(cfg.TrunkOptionsTimeoutSeconds)*time.Second, cfg.TrunkFailureThreshold)
+	saveService.AddObserver(trunkHealth)
+
+	// 呼叫入库后累加到统计汇总表
+	statService := services.NewStatService(repository)
+	saveService.AddCallListener(statService.ApplyCall)
+	saveService.AddCallStateListener(statService)
+	saveService.AddReportListener(statService.ApplyReport)
+
+	// 网关、节点并发统计
+	concurrency := services.NewConcurrencyService(logger, repository, statService, cfg.ChannelWarnPercent)
+	saveService.AddCallStateListener(concurrency)
+
+	// 告警规则，指标来自入库的呼叫、RTCP报告和SIP消息
+	alertService := services.NewAlertService(logger, repository, services.NewAlertNotifiers(&cfg),
+		saveService.DroppedCount, time.Duration(cfg.AlertEvalIntervalSeconds)*time.Second)
+	saveService.AddObserver(alertService)
+	saveService.AddCallListener(alertService.OnCallSaved)
+	saveService.AddReportListener(alertService.OnRTCPReport)
+
+	// 呼叫、RTCP报告和告警实时推送到消息总线
+	eventSinks, err := services.NewEventSinks(&cfg)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create event sinks")
+		return
+	}
+	if len(eventSinks) > 0 {
+		eventPublisher, err := services.NewEventPublisher(logger, eventSinks, cfg.EventTypes, cfg.EventSpoolDir, cfg.EventSpoolMaxMB<<20)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to create event publisher")
+			return
+		}
+		defer eventPublisher.Close()
+		saveService.AddCallListener(eventPublisher.OnCallSaved)
+		saveService.AddReportListener(eventPublisher.OnRTCPReport)
+		alertService.AddHistoryListener(eventPublisher.OnAlert)
+	}
+	// 监听器全部注册后再开始评估告警
+	alertService.Start()
+
+	if err := siprocket.RegisterTransportProtocolIDs(cfg.HEPTransportProtocolIDs); err != nil {
+		logrus.WithError(err).Error("HEPTransportProtocolIDs配置错误")
+		return
+	}
 
 	//启动HepServer
 	hepServer, err := services.NewHepServer(logger, &cfg, saveService, rtcpService)
@@ -52,6 +119,15 @@ func main() {
 		logrus.WithError(err).Error("Failed to create hep server")
 		return
 	}
+	// 转发到上游采集器
+	if cfg.HEPRelayTargets != "" {
+		hepRelay, err := services.NewHepRelay(logger, cfg.HEPRelayTargets)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to create hep relay")
+			return
+		}
+		hepServer.AddForwarder(hepRelay)
+	}
 	go hepServer.Start()
 
 	// 初始化认证服务
@@ -60,7 +136,15 @@ func main() {
 	authMiddleware := services.NewAuthMiddleware(logger, authService)
 
 	// 启动HTTP Handle
-	handleHttp := services.NewHandleHttp(logger, &cfg, repository)
+	handleHttp := services.NewHandleHttp(logger, &cfg, repository, ingestFilter, trunkHealth, statService, concurrency, alertService, correlator)
+
+	handleHttp.AddGatewayReloader(saveService)
+	handleHttp.AddGatewayReloader(trunkHealth)
+	handleHttp.AddGatewayReloader(statService)
+	handleHttp.AddGatewayReloader(concurrency)
+	handleHttp.AddGatewayReloader(alertService)
+	handleHttp.AddIngestStatsSource(saveService)
+	handleHttp.AddIngestStatsSource(hepServer)
 
 	// 初始化gin
 	gin.SetMode(gin.ReleaseMode)
@@ -80,7 +164,9 @@ func main() {
 
 	// 记录相关API
 	authorized.GET("/record/call", handleHttp.CallList)
+	authorized.GET("/record/call/export", handleHttp.CallExport)
 	authorized.GET("/record/details", handleHttp.CallDetails)
+	authorized.GET("/record/ladder", handleHttp.CallLadder)
 	authorized.GET("/record/raw/:id", handleHttp.RecordRaw)
 
 	// 用户管理API
@@ -97,8 +183,44 @@ func main() {
 	authorized.PUT("/gateways/:id", handleHttp.GatewayUpdate)
 	authorized.DELETE("/gateways/:id", handleHttp.GatewayDelete)
 
+	// 运营商相关API
+	authorized.GET("/carriers", handleHttp.CarrierList)
+	authorized.GET("/carriers/:id", handleHttp.CarrierGetByID)
+	authorized.POST("/carriers", handleHttp.CarrierCreate)
+	authorized.PUT("/carriers/:id", handleHttp.CarrierUpdate)
+	authorized.DELETE("/carriers/:id", handleHttp.CarrierDelete)
+	authorized.POST("/carriers/:id/stats", handleHttp.CarrierStats)
+	authorized.POST("/stat/sla", handleHttp.CarrierSLA)
+
+	// 中继健康状态API
+	authorized.GET("/trunks/status", handleHttp.TrunkStatus)
+	authorized.GET("/trunks/:id/uptime", handleHttp.TrunkUptime)
+	authorized.GET("/trunks/:id/history", handleHttp.TrunkHistory)
+
+	// 入库过滤规则API，修改后立即生效
+	authorized.GET("/filters", handleHttp.FilterRuleList)
+	authorized.GET("/filters/:id", handleHttp.FilterRuleGetByID)
+	authorized.POST("/filters", handleHttp.FilterRuleCreate)
+	authorized.PUT("/filters/:id", handleHttp.FilterRuleUpdate)
+	authorized.DELETE("/filters/:id", handleHttp.FilterRuleDelete)
+
 	// 统计相关API
 	authorized.POST("/stat/call", handleHttp.CallStat)
+	authorized.POST("/stat/kpi", handleHttp.CallKPI)
+	authorized.POST("/stat/concurrency", handleHttp.ConcurrencyReport)
+	authorized.POST("/stat/busy-hour", handleHttp.BusyHour)
+	authorized.GET("/concurrency/live", handleHttp.ConcurrencyLive)
+	authorized.GET("/stat/ingest", handleHttp.IngestStats)
+
+	// 告警相关API
+	authorized.GET("/alerts/rules", handleHttp.AlertRuleList)
+	authorized.GET("/alerts/rules/:id", handleHttp.AlertRuleGetByID)
+	authorized.POST("/alerts/rules", handleHttp.AlertRuleCreate)
+	authorized.PUT("/alerts/rules/:id", handleHttp.AlertRuleUpdate)
+	authorized.DELETE("/alerts/rules/:id", handleHttp.AlertRuleDelete)
+	authorized.POST("/alerts/rules/:id/silence", handleHttp.AlertRuleSilence)
+	authorized.GET("/alerts/active", handleHttp.AlertActive)
+	authorized.GET("/alerts/history", handleHttp.AlertHistory)
 
 	//前端资源
 	r.Use(ServerStatic("web/dist", dist))
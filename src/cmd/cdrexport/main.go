@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"sip-monitor/src/config"
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+	"sip-monitor/src/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 直接从数据库导出话单，条件与 /api/record/call/export 相同
+// 用法: cdrexport -begin 2025-04-01 -end 2025-05-01 -format xlsx -o cdr-202504.xlsx
+func main() {
+	begin := flag.String("begin", "", "开始时间，如 2025-04-01 或 2025-04-01 08:00:00")
+	end := flag.String("end", "", "结束时间，默认当前时间")
+	format := flag.String("format", entity.ExportFormatCSV, "导出格式 csv/jsonl/xlsx")
+	columns := flag.String("columns", "", "导出的列，逗号分隔，自定义属性写为 attr.名称，为空时导出默认列")
+	timeZone := flag.String("tz", "", "时间的时区，如 Asia/Shanghai，默认本机时区")
+	output := flag.String("o", "", "输出文件，默认标准输出")
+
+	var params entity.SearchParams
+	flag.StringVar(&params.FromUser, "from", "", "主叫号码，模糊匹配")
+	flag.StringVar(&params.ToUser, "to", "", "被叫号码，模糊匹配")
+	flag.StringVar(&params.HangupCode, "hangup-code", "", "挂断码")
+	flag.StringVar(&params.Direction, "direction", "", "呼叫方向 inbound/outbound/internal")
+	flag.StringVar(&params.Transport, "transport", "", "传输方式 udp/tcp/tls/sctp/ws/wss")
+	flag.Int64Var(&params.IngressGatewayID, "ingress-gateway", 0, "入口网关ID")
+	flag.Int64Var(&params.EgressGatewayID, "egress-gateway", 0, "出口网关ID")
+	flag.Parse()
+
+	location := time.Local
+	if *timeZone != "" {
+		var err error
+		location, err = time.LoadLocation(*timeZone)
+		if err != nil {
+			logrus.WithError(err).Error("时区错误")
+			return
+		}
+	}
+	beginTime, err := parseExportTime(*begin, location)
+	if err != nil {
+		logrus.WithError(err).Error("开始时间格式错误")
+		return
+	}
+	endTime := time.Now()
+	if *end != "" {
+		endTime, err = parseExportTime(*end, location)
+		if err != nil {
+			logrus.WithError(err).Error("结束时间格式错误")
+			return
+		}
+	}
+	if !beginTime.Before(endTime) {
+		logrus.Error("开始时间必须早于结束时间")
+		return
+	}
+	params.BeginTime = &beginTime
+	params.EndTime = &endTime
+
+	cfg, err := config.ParseConfig()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to parse config")
+		return
+	}
+	repository, err := model.InitRepository(&cfg)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create repository")
+		return
+	}
+	exporter, err := services.NewCDRExporter(repository, *format, *columns, *timeZone)
+	if err != nil {
+		logrus.WithError(err).Error("导出参数错误")
+		return
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			logrus.WithError(err).Error("创建输出文件失败")
+			return
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+
+	count, err := exporter.Export(context.Background(), params, buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("count", count).Error("导出话单失败")
+		return
+	}
+	logrus.WithField("count", count).Info("导出话单完成")
+}
+
+func parseExportTime(value string, location *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateTime, value, location); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, value, location)
+}
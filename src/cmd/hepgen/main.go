@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"sip-monitor/src/config"
+	"sip-monitor/src/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+const usage = `HEP流量生成与回放工具
+
+用法:
+  hepgen gen    [-addr udp://127.0.0.1:9060] [-cps 10] [-calls 100] [-scenarios answered,busy,cancelled,forked] [-rtcp]
+  hepgen replay [-addr udp://127.0.0.1:9060] -call <Call-ID>[,<Call-ID>...]   从数据库回放呼叫(使用服务的环境变量配置)
+  hepgen replay [-addr udp://127.0.0.1:9060] -pcap capture.pcap [-speed 2]
+
+运行 hepgen <命令> -h 查看命令的参数
+`
+
+// senderFlags 两个命令共用的采集器参数
+type senderFlags struct {
+	addr      *string
+	captureID *uint
+	authKey   *string
+	nodeName  *string
+}
+
+func addSenderFlags(fs *flag.FlagSet) senderFlags {
+	return senderFlags{
+		addr:      fs.String("addr", "udp://127.0.0.1:9060", "采集器地址，udp://host:port 或 tcp://host:port"),
+		captureID: fs.Uint("capture-id", 2001, "HEP采集节点ID"),
+		authKey:   fs.String("auth-key", "", "HEP认证密钥"),
+		nodeName:  fs.String("node-name", "", "HEP节点名称"),
+	}
+}
+
+func (f senderFlags) dial() (*hepSender, error) {
+	return newHepSender(*f.addr, uint32(*f.captureID), *f.authKey, *f.nodeName)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "gen":
+		err = runGen(ctx, os.Args[2:])
+	case "replay":
+		err = runReplay(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil && err != context.Canceled {
+		logrus.WithError(err).Error("hepgen失败")
+		os.Exit(1)
+	}
+}
+
+// runGen 按CPS发起呼叫，每个呼叫在自己的goroutine中按时间发送消息
+func runGen(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	senderArgs := addSenderFlags(fs)
+	cps := fs.Float64("cps", 10, "每秒发起的呼叫数")
+	calls := fs.Int("calls", 0, "呼叫总数，0为不限制，直到 -duration 或 Ctrl-C")
+	duration := fs.Duration("duration", 0, "发起呼叫的时长，0为不限制")
+	scenarioList := fs.String("scenarios", strings.Join(scenarioNames, ","), "场景列表，逗号分隔，按顺序轮流使用")
+	ringing := fs.Duration("ringing", 3*time.Second, "振铃时长")
+	talk := fs.Duration("talk", 30*time.Second, "通话时长")
+	withRTCP := fs.Bool("rtcp", false, "通话期间每5秒发送RTCP报告")
+	fs.Parse(args)
+
+	if *cps <= 0 {
+		return fmt.Errorf("cps必须大于0")
+	}
+	scenarios, err := parseScenarios(*scenarioList)
+	if err != nil {
+		return err
+	}
+	opts := scenarioOptions{Ringing: *ringing, Talk: *talk, RTCP: *withRTCP}
+	sender, err := senderArgs.dial()
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	logrus.WithFields(logrus.Fields{
+		"addr":      *senderArgs.addr,
+		"cps":       *cps,
+		"calls":     *calls,
+		"scenarios": scenarios,
+	}).Info("开始生成呼叫")
+
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *cps))
+	defer ticker.Stop()
+	report := time.NewTicker(10 * time.Second)
+	defer report.Stop()
+
+	started := 0
+loop:
+	for *calls == 0 || started < *calls {
+		messages, err := buildCall(scenarios[started%len(scenarios)], started, opts)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			playCall(sender, messages)
+		}()
+		started++
+
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-report.C:
+			logrus.WithFields(logrus.Fields{"calls": started, "messages": sender.sent.Load()}).Info("生成进度")
+		case <-ticker.C:
+		}
+	}
+
+	// 已发起的呼叫发送完后退出，再次Ctrl-C时直接退出
+	logrus.WithField("calls", started).Info("停止发起呼叫，等待进行中的呼叫结束")
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	interrupt, stopInterrupt := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopInterrupt()
+	select {
+	case <-done:
+	case <-interrupt.Done():
+	}
+	logrus.WithFields(logrus.Fields{"calls": started, "messages": sender.sent.Load()}).Info("生成完成")
+	return nil
+}
+
+func playCall(sender *hepSender, messages []genMessage) {
+	begin := time.Now()
+	for _, item := range messages {
+		time.Sleep(time.Until(begin.Add(item.offset)))
+		if err := sender.Send(item.msg, time.Now()); err != nil {
+			logrus.WithError(err).Warn("发送HEP失败")
+			return
+		}
+	}
+}
+
+// runReplay 回放数据库中的呼叫或pcap文件
+func runReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	senderArgs := addSenderFlags(fs)
+	callIDs := fs.String("call", "", "回放数据库中的呼叫，Call-ID逗号分隔")
+	pcapFile := fs.String("pcap", "", "回放pcap文件中的SIP消息")
+	speed := fs.Float64("speed", 1, "回放速度倍数")
+	keepTime := fs.Bool("keep-time", false, "使用原始时间戳，默认使用发送时间")
+	fs.Parse(args)
+
+	if (*callIDs == "") == (*pcapFile == "") {
+		return fmt.Errorf("需要指定 -call 或 -pcap 其中一个")
+	}
+	if *speed <= 0 {
+		return fmt.Errorf("speed必须大于0")
+	}
+
+	var messages []replayMessage
+	var err error
+	if *pcapFile != "" {
+		messages, err = loadPcap(*pcapFile)
+	} else {
+		var cfg config.Config
+		cfg, err = config.ParseConfig()
+		if err != nil {
+			return err
+		}
+		var repository model.Repository
+		repository, err = model.InitRepository(&cfg)
+		if err != nil {
+			return err
+		}
+		var ids []string
+		for _, id := range strings.Split(*callIDs, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		messages, err = loadStoredCalls(ctx, repository, ids)
+	}
+	if err != nil {
+		return err
+	}
+
+	sender, err := senderArgs.dial()
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+	logrus.WithFields(logrus.Fields{
+		"addr":     *senderArgs.addr,
+		"messages": len(messages),
+		"duration": messages[len(messages)-1].at.Sub(messages[0].at).String(),
+		"speed":    *speed,
+	}).Info("开始回放")
+	if err := replay(ctx, sender, messages, *speed, *keepTime); err != nil {
+		return err
+	}
+	logrus.WithField("messages", sender.sent.Load()).Info("回放完成")
+	return nil
+}
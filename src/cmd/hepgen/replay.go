@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"sip-monitor/src/model"
+	"sip-monitor/src/pkg/hep"
+	"sip-monitor/src/pkg/pcap"
+)
+
+// replayMessage 回放的消息，at为原始抓包时间
+type replayMessage struct {
+	at  time.Time
+	msg hep.HepMsg
+}
+
+// loadStoredCalls 从数据库读取呼叫的SIP消息和RTCP报告
+func loadStoredCalls(ctx context.Context, repository model.Repository, callIDs []string) ([]replayMessage, error) {
+	records, err := repository.GetRecordsBySIPCallIDs(ctx, callIDs)
+	if err != nil {
+		return nil, err
+	}
+	var messages []replayMessage
+	for _, record := range records {
+		raw, err := repository.GetRecordRawByID(ctx, record.ID)
+		if err != nil || raw == nil || raw.Raw == "" {
+			continue
+		}
+		at := record.CreateTime
+		if record.TimestampMicro > 0 {
+			at = time.UnixMicro(record.TimestampMicro)
+		}
+		msg := hep.HepMsg{IPProtocolID: pcap.ProtocolUDP, ProtocolType: hep.ProtocolTypeSIP, Body: []byte(raw.Raw)}
+		setAddresses(&msg, record.SrcAddr, record.DstAddr)
+		messages = append(messages, replayMessage{at: at, msg: msg})
+	}
+
+	for _, callID := range callIDs {
+		reports, err := repository.GetRtcpReportRawByBySIPCallID(ctx, callID)
+		if err != nil {
+			return nil, err
+		}
+		for _, report := range reports {
+			msg := hep.HepMsg{
+				IPProtocolID:          pcap.ProtocolUDP,
+				ProtocolType:          hep.ProtocolTypeRTCP,
+				InternalCorrelationID: callID,
+				Body:                  []byte(report.Raw),
+			}
+			setAddresses(&msg, report.SrcAddr, report.DstAddr)
+			messages = append(messages, replayMessage{at: report.CreateTime, msg: msg})
+		}
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("没有找到呼叫的原始消息")
+	}
+	sortReplay(messages)
+	return messages, nil
+}
+
+// loadPcap 读取pcap中的SIP消息，UDP中的HEP包原样回放
+// TCP只取以SIP起始行开头的数据段，跨多个数据段的消息不做重组
+func loadPcap(path string) ([]replayMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := pcap.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []replayMessage
+	for {
+		packet, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if len(messages) > 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+				break // 抓包被中断时最后一个包不完整
+			}
+			return nil, err
+		}
+		frame, ok := pcap.Decode(reader.LinkType, packet.Data)
+		if !ok || len(frame.Payload) == 0 {
+			continue
+		}
+		if frame.Protocol == pcap.ProtocolUDP && bytes.HasPrefix(frame.Payload, []byte("HEP3")) {
+			if msg, err := hep.NewHepMsg(frame.Payload); err == nil {
+				messages = append(messages, replayMessage{at: packet.Time, msg: *msg})
+			}
+			continue
+		}
+		if !isSIP(frame.Payload) {
+			continue
+		}
+		msg := hep.HepMsg{
+			IPProtocolID:    frame.Protocol,
+			SourcePort:      frame.SrcPort,
+			DestinationPort: frame.DstPort,
+			ProtocolType:    hep.ProtocolTypeSIP,
+			Body:            append([]byte(nil), frame.Payload...),
+		}
+		if ip4 := frame.SrcIP.To4(); ip4 != nil {
+			msg.IP4SourceAddress = ip4.String()
+			msg.IP4DestinationAddress = frame.DstIP.String()
+		} else {
+			msg.IP6SourceAddress = frame.SrcIP.String()
+			msg.IP6DestinationAddress = frame.DstIP.String()
+		}
+		messages = append(messages, replayMessage{at: packet.Time, msg: msg})
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("pcap中没有SIP消息")
+	}
+	sortReplay(messages)
+	return messages, nil
+}
+
+// isSIP 首行为 "SIP/2.0 xxx" 或以 "SIP/2.0" 结尾的请求行
+func isSIP(payload []byte) bool {
+	line := payload
+	if i := bytes.IndexByte(payload, '\n'); i >= 0 {
+		line = payload[:i]
+	}
+	line = bytes.TrimRight(line, "\r")
+	return bytes.HasPrefix(line, []byte("SIP/2.0 ")) || bytes.HasSuffix(line, []byte(" SIP/2.0"))
+}
+
+// setAddresses 地址格式为 ip:port
+func setAddresses(msg *hep.HepMsg, src, dst string) {
+	srcIP, srcPort := splitAddr(src)
+	dstIP, dstPort := splitAddr(dst)
+	msg.SourcePort, msg.DestinationPort = srcPort, dstPort
+	if ip := net.ParseIP(srcIP); ip != nil && ip.To4() == nil {
+		msg.IP6SourceAddress, msg.IP6DestinationAddress = srcIP, dstIP
+		return
+	}
+	msg.IP4SourceAddress, msg.IP4DestinationAddress = srcIP, dstIP
+}
+
+func splitAddr(addr string) (string, uint16) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	value, _ := strconv.ParseUint(port, 10, 16)
+	return host, uint16(value)
+}
+
+func sortReplay(messages []replayMessage) {
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].at.Before(messages[j].at)
+	})
+}
+
+// replay 按原始间隔(除以speed)发送，keepTime为true时保留原始时间戳，否则使用发送时间
+func replay(ctx context.Context, sender *hepSender, messages []replayMessage, speed float64, keepTime bool) error {
+	begin := time.Now()
+	first := messages[0].at
+	for _, item := range messages {
+		offset := time.Duration(float64(item.at.Sub(first)) / speed)
+		if wait := time.Until(begin.Add(offset)); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		at := time.Now()
+		if keepTime {
+			at = item.at
+		}
+		if err := sender.Send(item.msg, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sip-monitor/src/pkg/hep"
+	"sip-monitor/src/pkg/rtcp"
+)
+
+const (
+	ScenarioAnswered  = "answered"  // 接通后正常挂断
+	ScenarioBusy      = "busy"      // 被叫忙 486
+	ScenarioCancelled = "cancelled" // 振铃中主叫取消 487
+	ScenarioForked    = "forked"    // 分叉到两个被叫，一个接通，另一个被取消
+
+	rtcpInterval = 5 * time.Second
+)
+
+var scenarioNames = []string{ScenarioAnswered, ScenarioBusy, ScenarioCancelled, ScenarioForked}
+
+// parseScenarios 逗号分隔的场景列表，呼叫按顺序轮流使用
+func parseScenarios(value string) ([]string, error) {
+	var scenarios []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, known := range scenarioNames {
+			found = found || known == name
+		}
+		if !found {
+			return nil, fmt.Errorf("未知的场景：%s，可选 %s", name, strings.Join(scenarioNames, ","))
+		}
+		scenarios = append(scenarios, name)
+	}
+	if len(scenarios) == 0 {
+		return nil, fmt.Errorf("至少需要一个场景")
+	}
+	return scenarios, nil
+}
+
+type scenarioOptions struct {
+	Ringing time.Duration // 振铃时长
+	Talk    time.Duration // 通话时长
+	RTCP    bool          // 通话期间发送RTCP报告
+}
+
+// genMessage 呼叫中的一个消息，offset为相对呼叫开始的时间
+type genMessage struct {
+	offset time.Duration
+	msg    hep.HepMsg
+}
+
+type endpoint struct {
+	ip   string
+	port uint16
+}
+
+func (e endpoint) String() string {
+	return net.JoinHostPort(e.ip, strconv.Itoa(int(e.port)))
+}
+
+// sipCall 一个呼叫，所有请求都由主叫(uac)发出
+type sipCall struct {
+	callID  string
+	caller  string
+	callee  string
+	fromTag string
+	uac     endpoint
+	media   endpoint
+
+	messages []genMessage
+}
+
+// buildCall 生成第n个呼叫的全部消息，按offset排序
+func buildCall(scenario string, n int, opts scenarioOptions) ([]genMessage, error) {
+	call := &sipCall{
+		callID:  fmt.Sprintf("%s-%d@hepgen", randomHex(8), n),
+		caller:  fmt.Sprintf("1380000%04d", n%10000),
+		callee:  fmt.Sprintf("1390000%04d", n%10000),
+		fromTag: randomHex(6),
+		uac:     endpoint{ip: hostIP(10, n), port: 5060},
+		media:   endpoint{ip: hostIP(10, n), port: mediaPort(n)},
+	}
+	uas := endpoint{ip: hostIP(20, n), port: 5060}
+	uasMedia := endpoint{ip: hostIP(20, n), port: mediaPort(n)}
+	ringing := opts.Ringing
+
+	switch scenario {
+	case ScenarioAnswered:
+		toTag, branch := randomHex(6), newBranch()
+		call.request(0, uas, "INVITE", 1, branch, "", call.sdp(call.media))
+		call.response(20*time.Millisecond, uas, 100, "Trying", "INVITE", 1, branch, "", "")
+		call.response(150*time.Millisecond, uas, 180, "Ringing", "INVITE", 1, branch, toTag, "")
+		call.response(ringing, uas, 200, "OK", "INVITE", 1, branch, toTag, call.sdp(uasMedia))
+		call.request(ringing+30*time.Millisecond, uas, "ACK", 1, newBranch(), toTag, "")
+		if opts.RTCP {
+			call.rtcpReports(ringing, opts.Talk, uasMedia)
+		}
+		byeBranch := newBranch()
+		call.request(ringing+opts.Talk, uas, "BYE", 2, byeBranch, toTag, "")
+		call.response(ringing+opts.Talk+20*time.Millisecond, uas, 200, "OK", "BYE", 2, byeBranch, toTag, "")
+	case ScenarioBusy:
+		toTag, branch := randomHex(6), newBranch()
+		call.request(0, uas, "INVITE", 1, branch, "", call.sdp(call.media))
+		call.response(20*time.Millisecond, uas, 100, "Trying", "INVITE", 1, branch, "", "")
+		call.response(300*time.Millisecond, uas, 486, "Busy Here", "INVITE", 1, branch, toTag, "")
+		call.request(320*time.Millisecond, uas, "ACK", 1, branch, toTag, "")
+	case ScenarioCancelled:
+		toTag, branch := randomHex(6), newBranch()
+		call.request(0, uas, "INVITE", 1, branch, "", call.sdp(call.media))
+		call.response(20*time.Millisecond, uas, 100, "Trying", "INVITE", 1, branch, "", "")
+		call.response(150*time.Millisecond, uas, 180, "Ringing", "INVITE", 1, branch, toTag, "")
+		call.request(ringing, uas, "CANCEL", 1, branch, "", "")
+		call.response(ringing+20*time.Millisecond, uas, 200, "OK", "CANCEL", 1, branch, toTag, "")
+		call.response(ringing+30*time.Millisecond, uas, 487, "Request Terminated", "INVITE", 1, branch, toTag, "")
+		call.request(ringing+50*time.Millisecond, uas, "ACK", 1, branch, toTag, "")
+	case ScenarioForked:
+		// 主叫为代理，INVITE同时发往两个被叫，第一个接通后取消第二个
+		second := endpoint{ip: hostIP(21, n), port: 5060}
+		toTag, secondTag := randomHex(6), randomHex(6)
+		branch, secondBranch := newBranch(), newBranch()
+		call.request(0, uas, "INVITE", 1, branch, "", call.sdp(call.media))
+		call.request(time.Millisecond, second, "INVITE", 1, secondBranch, "", call.sdp(call.media))
+		call.response(20*time.Millisecond, uas, 100, "Trying", "INVITE", 1, branch, "", "")
+		call.response(25*time.Millisecond, second, 100, "Trying", "INVITE", 1, secondBranch, "", "")
+		call.response(150*time.Millisecond, uas, 180, "Ringing", "INVITE", 1, branch, toTag, "")
+		call.response(170*time.Millisecond, second, 180, "Ringing", "INVITE", 1, secondBranch, secondTag, "")
+		call.response(ringing, uas, 200, "OK", "INVITE", 1, branch, toTag, call.sdp(uasMedia))
+		call.request(ringing+10*time.Millisecond, second, "CANCEL", 1, secondBranch, "", "")
+		call.response(ringing+30*time.Millisecond, second, 200, "OK", "CANCEL", 1, secondBranch, secondTag, "")
+		call.request(ringing+30*time.Millisecond, uas, "ACK", 1, newBranch(), toTag, "")
+		call.response(ringing+40*time.Millisecond, second, 487, "Request Terminated", "INVITE", 1, secondBranch, secondTag, "")
+		call.request(ringing+60*time.Millisecond, second, "ACK", 1, secondBranch, secondTag, "")
+		if opts.RTCP {
+			call.rtcpReports(ringing, opts.Talk, uasMedia)
+		}
+		byeBranch := newBranch()
+		call.request(ringing+opts.Talk, uas, "BYE", 2, byeBranch, toTag, "")
+		call.response(ringing+opts.Talk+20*time.Millisecond, uas, 200, "OK", "BYE", 2, byeBranch, toTag, "")
+	default:
+		return nil, fmt.Errorf("未知的场景：%s", scenario)
+	}
+
+	sort.SliceStable(call.messages, func(i, j int) bool {
+		return call.messages[i].offset < call.messages[j].offset
+	})
+	return call.messages, nil
+}
+
+// request 主叫发往uas的请求，ACK/CANCEL的CSeq与INVITE相同
+func (c *sipCall) request(offset time.Duration, uas endpoint, method string, cseq int, branch, toTag, body string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s sip:%s@%s SIP/2.0\r\n", method, c.callee, uas)
+	c.writeHeaders(&b, uas, method, cseq, branch, toTag)
+	b.WriteString("Max-Forwards: 70\r\n")
+	b.WriteString("User-Agent: hepgen\r\n")
+	if method == "INVITE" {
+		fmt.Fprintf(&b, "Contact: <sip:%s@%s>\r\n", c.caller, c.uac)
+	}
+	writeBody(&b, body)
+	c.add(offset, c.uac, uas, b.String())
+}
+
+// response uas回复主叫的响应
+func (c *sipCall) response(offset time.Duration, uas endpoint, code int, reason, method string, cseq int, branch, toTag, body string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SIP/2.0 %d %s\r\n", code, reason)
+	c.writeHeaders(&b, uas, method, cseq, branch, toTag)
+	if method == "INVITE" && code > 100 && code < 300 {
+		fmt.Fprintf(&b, "Contact: <sip:%s@%s>\r\n", c.callee, uas)
+	}
+	writeBody(&b, body)
+	c.add(offset, uas, c.uac, b.String())
+}
+
+func (c *sipCall) writeHeaders(b *strings.Builder, uas endpoint, method string, cseq int, branch, toTag string) {
+	fmt.Fprintf(b, "Via: SIP/2.0/UDP %s;branch=%s\r\n", c.uac, branch)
+	fmt.Fprintf(b, "From: <sip:%s@%s>;tag=%s\r\n", c.caller, c.uac.ip, c.fromTag)
+	if toTag != "" {
+		fmt.Fprintf(b, "To: <sip:%s@%s>;tag=%s\r\n", c.callee, uas.ip, toTag)
+	} else {
+		fmt.Fprintf(b, "To: <sip:%s@%s>\r\n", c.callee, uas.ip)
+	}
+	fmt.Fprintf(b, "Call-ID: %s\r\n", c.callID)
+	fmt.Fprintf(b, "CSeq: %d %s\r\n", cseq, method)
+}
+
+func writeBody(b *strings.Builder, body string) {
+	if body != "" {
+		b.WriteString("Content-Type: application/sdp\r\n")
+	}
+	fmt.Fprintf(b, "Content-Length: %d\r\n\r\n", len(body))
+	b.WriteString(body)
+}
+
+func (c *sipCall) sdp(media endpoint) string {
+	return strings.Join([]string{
+		"v=0",
+		fmt.Sprintf("o=hepgen %d 1 IN IP4 %s", rand.Uint32(), media.ip),
+		"s=hepgen",
+		"c=IN IP4 " + media.ip,
+		"t=0 0",
+		fmt.Sprintf("m=audio %d RTP/AVP 0 8 101", media.port),
+		"a=rtpmap:0 PCMU/8000",
+		"a=rtpmap:8 PCMA/8000",
+		"a=rtpmap:101 telephone-event/8000",
+		"a=sendrecv",
+		"",
+	}, "\r\n")
+}
+
+func (c *sipCall) add(offset time.Duration, src, dst endpoint, sip string) {
+	c.messages = append(c.messages, genMessage{offset: offset, msg: hep.HepMsg{
+		IPProtocolID:          17,
+		IP4SourceAddress:      src.ip,
+		IP4DestinationAddress: dst.ip,
+		SourcePort:            src.port,
+		DestinationPort:       dst.port,
+		ProtocolType:          hep.ProtocolTypeSIP,
+		Body:                  []byte(sip),
+	}})
+}
+
+// rtcpReports 通话期间双方每5秒发送一个SR，报告块中为对方媒体流的丢包和抖动
+func (c *sipCall) rtcpReports(begin, talk time.Duration, remote endpoint) {
+	localSSRC, remoteSSRC := rand.Uint32(), rand.Uint32()
+	for elapsed := rtcpInterval; elapsed < talk; elapsed += rtcpInterval {
+		c.addRTCP(begin+elapsed, c.media, remote, localSSRC, remoteSSRC, elapsed)
+		c.addRTCP(begin+elapsed+10*time.Millisecond, remote, c.media, remoteSSRC, localSSRC, elapsed)
+	}
+}
+
+func (c *sipCall) addRTCP(offset time.Duration, src, dst endpoint, ssrc, sourceSSRC uint32, elapsed time.Duration) {
+	// 20ms打包，每秒50个包，每包160字节
+	packets := uint64(elapsed / (20 * time.Millisecond))
+	lost := uint64(rand.IntN(3))
+	packet := rtcp.RTCPPacket{
+		SSRC:       ssrc,
+		PacketType: rtcp.RTCPPacketTypeSR,
+		SenderInfo: &rtcp.SenderInformation{
+			RTPTimestamp: packets * 160,
+			Packets:      packets,
+			Octets:       packets * 160,
+		},
+		ReportCount: 1,
+		ReportBlocks: []rtcp.ReportBlock{{
+			SourceSSRC:   sourceSSRC,
+			FractionLost: uint8(lost * 256 / uint64(rtcpInterval/(20*time.Millisecond))),
+			PacketsLost:  lost,
+			HighestSeqNo: packets,
+			IAJitter:     uint64(10 + rand.IntN(40)),
+		}},
+	}
+	body, _ := json.Marshal(&packet)
+	c.messages = append(c.messages, genMessage{offset: offset, msg: hep.HepMsg{
+		IPProtocolID:          17,
+		IP4SourceAddress:      src.ip,
+		IP4DestinationAddress: dst.ip,
+		SourcePort:            src.port + 1,
+		DestinationPort:       dst.port + 1,
+		ProtocolType:          hep.ProtocolTypeRTCP,
+		InternalCorrelationID: c.callID,
+		Body:                  body,
+	}})
+}
+
+// hostIP 10.<network>.x.y，同一个n总是得到相同的地址
+func hostIP(network, n int) string {
+	return fmt.Sprintf("10.%d.%d.%d", network, n/250%250, n%250+1)
+}
+
+func mediaPort(n int) uint16 {
+	return uint16(20000 + n%20000*2)
+}
+
+func newBranch() string {
+	return "z9hG4bK" + randomHex(8)
+}
+
+func randomHex(n int) string {
+	const digits = "0123456789abcdef"
+	b := make([]byte, n*2)
+	for i := range b {
+		b[i] = digits[rand.IntN(len(digits))]
+	}
+	return string(b)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"sip-monitor/src/pkg/hep"
+	"sip-monitor/src/pkg/siprocket"
+)
+
+func TestBuildCall(t *testing.T) {
+	opts := scenarioOptions{Ringing: 2 * time.Second, Talk: 12 * time.Second, RTCP: true}
+	cases := []struct {
+		scenario string
+		finals   []int // INVITE的最终响应
+		bye      bool
+		rtcp     int
+	}{
+		{ScenarioAnswered, []int{200}, true, 4},
+		{ScenarioBusy, []int{486}, false, 0},
+		{ScenarioCancelled, []int{487}, false, 0},
+		{ScenarioForked, []int{200, 487}, true, 4},
+	}
+	for _, c := range cases {
+		messages, err := buildCall(c.scenario, 7, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var callID string
+		var finals []int
+		var bye bool
+		var rtcpCount int
+		var last time.Duration
+		for _, item := range messages {
+			if item.offset < last {
+				t.Errorf("%s: 消息未按时间排序", c.scenario)
+			}
+			last = item.offset
+			if item.msg.ProtocolType == hep.ProtocolTypeRTCP {
+				rtcpCount++
+				continue
+			}
+			sip := siprocket.ParseSIP(item.msg.Body)
+			if sip.CallID == "" || (callID != "" && sip.CallID != callID) {
+				t.Fatalf("%s: Call-ID错误：%q", c.scenario, sip.CallID)
+			}
+			callID = sip.CallID
+			if !sip.IsRequest && sip.CSeqMethod == "INVITE" && sip.ResponseCode >= 200 {
+				finals = append(finals, sip.ResponseCode)
+			}
+			bye = bye || (sip.IsRequest && sip.Title == "BYE")
+		}
+		if len(finals) != len(c.finals) {
+			t.Fatalf("%s: 最终响应为%v，期望%v", c.scenario, finals, c.finals)
+		}
+		for i := range finals {
+			if finals[i] != c.finals[i] {
+				t.Errorf("%s: 最终响应为%v，期望%v", c.scenario, finals, c.finals)
+			}
+		}
+		if bye != c.bye || rtcpCount != c.rtcp {
+			t.Errorf("%s: bye=%v rtcp=%d", c.scenario, bye, rtcpCount)
+		}
+	}
+
+	if _, err := parseScenarios("answered,unknown"); err == nil {
+		t.Error("未知场景应返回错误")
+	}
+}
+
+func TestIsSIP(t *testing.T) {
+	for payload, want := range map[string]bool{
+		"INVITE sip:1001@10.0.0.1 SIP/2.0\r\nVia: x\r\n": true,
+		"SIP/2.0 180 Ringing\r\n":                        true,
+		"HTTP/1.1 200 OK\r\n":                            false,
+		"\x80\xc8\x00\x06":                               false,
+	} {
+		if got := isSIP([]byte(payload)); got != want {
+			t.Errorf("isSIP(%q) = %v", payload, got)
+		}
+	}
+}
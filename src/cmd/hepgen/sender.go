@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sip-monitor/src/pkg/hep"
+)
+
+// hepSender 编码为HEP3发送到采集器，UDP每个消息一个包，TCP连续写入
+type hepSender struct {
+	captureID uint32
+	authKey   string
+	nodeName  string
+
+	mu   sync.Mutex
+	conn net.Conn
+	sent atomic.Int64
+}
+
+// newHepSender 地址格式为 udp://host:port 或 tcp://host:port，不带协议时使用udp
+func newHepSender(addr string, captureID uint32, authKey, nodeName string) (*hepSender, error) {
+	network := "udp"
+	if scheme, rest, ok := strings.Cut(addr, "://"); ok {
+		network, addr = strings.ToLower(scheme), rest
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("不支持的协议：%s", network)
+	}
+	conn, err := net.DialTimeout(network, addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &hepSender{conn: conn, captureID: captureID, authKey: authKey, nodeName: nodeName}, nil
+}
+
+// Send 时间戳设为at，未指定采集节点ID时使用发送器的配置
+func (s *hepSender) Send(msg hep.HepMsg, at time.Time) error {
+	msg.Timestamp = uint32(at.Unix())
+	msg.TimestampMicro = uint32(at.Nanosecond() / 1000)
+	if msg.CaptureAgentID == 0 {
+		msg.CaptureAgentID = s.captureID
+	}
+	if s.authKey != "" {
+		msg.AuthenticateKey = s.authKey
+	}
+	if msg.NodeName == "" {
+		msg.NodeName = s.nodeName
+	}
+	packet := hep.Encode(&msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.conn.Write(packet); err != nil {
+		return err
+	}
+	s.sent.Add(1)
+	return nil
+}
+
+func (s *hepSender) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"sip-monitor/src/config"
+	"sip-monitor/src/model"
+	"sip-monitor/src/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 根据呼叫明细重建统计汇总表，用于升级后补齐历史数据或修正汇总。
+// 回填会先删除每天的汇总再重新写入，运行中的服务仍在写入今天的汇总，所以只能回填今天之前的日期
+// 用法: rollup -begin 2025-04-01 -end 2025-04-11
+func main() {
+	begin := flag.String("begin", "", "开始日期，如 2025-04-01")
+	end := flag.String("end", time.Now().Format(time.DateOnly), "结束日期（不含），默认今天，不能晚于今天")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `根据呼叫明细重建统计汇总表
+用法: %s -begin 2025-04-01 -end 2025-04-11
+
+回填会先删除每天的汇总再按呼叫明细重新写入。运行中的服务仍在写入今天的汇总，
+同时回填同一天会重复或丢失计数，因此只能回填今天之前的日期（-end 不晚于今天）。
+
+`, os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	beginTime, err := time.ParseInLocation(time.DateOnly, *begin, time.Local)
+	if err != nil {
+		logrus.WithError(err).Error("开始日期格式错误")
+		return
+	}
+	endTime, err := time.ParseInLocation(time.DateOnly, *end, time.Local)
+	if err != nil {
+		logrus.WithError(err).Error("结束日期格式错误")
+		return
+	}
+	if !beginTime.Before(endTime) {
+		logrus.Error("开始日期必须早于结束日期")
+		return
+	}
+
+	cfg, err := config.ParseConfig()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to parse config")
+		return
+	}
+	repository, err := model.InitRepository(&cfg)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create repository")
+		return
+	}
+
+	count, err := services.NewStatService(repository).Backfill(context.Background(), beginTime, endTime)
+	if err != nil {
+		logrus.WithError(err).WithField("count", count).Error("回填汇总失败")
+		return
+	}
+	logrus.WithField("count", count).Info("回填汇总完成")
+}
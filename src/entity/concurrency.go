@@ -0,0 +1,49 @@
+package entity
+
+import "time"
+
+// ConcurrencyLiveVO 一个网关或节点当前的并发和呼叫速率
+type ConcurrencyLiveVO struct {
+	GroupBy   string `json:"group_by"`   // gateway 或 node
+	Group     string `json:"group"`      // 网关ID或节点IP
+	GroupName string `json:"group_name"` // 网关名
+
+	Current     int64   `json:"current"`      // 当前通话中的呼叫数
+	CPS         float64 `json:"cps"`          // 最近10秒的平均每秒呼叫数
+	MaxChannels int     `json:"max_channels"` // 网关通道上限，0表示不限制
+	Usage       float64 `json:"usage"`        // 通道占用率 %
+	Warning     bool    `json:"warning"`      // 是否接近通道上限
+}
+
+// ConcurrencyVO 一个分组在一个时间段内的并发和呼叫速率，根据呼叫的应答、结束时间重建
+type ConcurrencyVO struct {
+	BucketTime *time.Time `json:"bucket_time"`
+	Group      string     `json:"group"`
+	GroupName  string     `json:"group_name"`
+
+	PeakConcurrent int64   `json:"peak_concurrent"` // 并发峰值
+	AvgConcurrent  float64 `json:"avg_concurrent"`  // 平均并发，即话务量（Erlang）
+	Attempts       int64   `json:"attempts"`        // 呼叫次数
+	PeakCPS        int64   `json:"peak_cps"`        // 每秒呼叫数峰值
+	AvgCPS         float64 `json:"avg_cps"`         // 平均每秒呼叫数
+
+	MaxChannels int     `json:"max_channels"`
+	PeakUsage   float64 `json:"peak_usage"` // 并发峰值占通道上限的百分比
+	Warning     bool    `json:"warning"`
+}
+
+// BusyHourVO 一个分组在时间范围内话务量最大的小时
+type BusyHourVO struct {
+	Group     string `json:"group"`
+	GroupName string `json:"group_name"`
+
+	BusyHour       *time.Time `json:"busy_hour"` // 忙时开始时间
+	Erlangs        float64    `json:"erlangs"`   // 忙时话务量
+	PeakConcurrent int64      `json:"peak_concurrent"`
+	Attempts       int64      `json:"attempts"`
+	PeakCPS        int64      `json:"peak_cps"`
+
+	MaxChannels int     `json:"max_channels"`
+	PeakUsage   float64 `json:"peak_usage"`
+	Warning     bool    `json:"warning"`
+}
@@ -0,0 +1,81 @@
+package entity
+
+import "time"
+
+// 告警指标
+const (
+	AlertMetricASR        = "asr"         // 应答率 %
+	AlertMetricMOS        = "mos"         // 平均MOS
+	AlertMetricPDD        = "pdd"         // 平均接续时延（毫秒）
+	AlertMetric5xxRate    = "5xx_rate"    // 每分钟5xx挂断的呼叫数
+	AlertMetricNodeSilent = "node_silent" // 采集节点多少秒没有发来消息
+	AlertMetricQueueDrop  = "queue_drop"  // 窗口内处理队列满丢弃的消息数
+)
+
+// 告警状态
+const (
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// AlertRule 告警规则，在评估窗口内的指标值满足 Operator Threshold 时触发，
+// 越过阈值 Hysteresis 之后才恢复，避免指标在阈值附近时反复通知
+type AlertRule struct {
+	ID      int64  `gorm:"primaryKey;column:id;autoIncrement:true" bson:"_id" json:"id"`
+	Name    string `gorm:"column:name;type:varchar(120);default:''" bson:"name" json:"name"`
+	Enabled bool   `gorm:"column:enabled;default:true" bson:"enabled" json:"enabled"`
+
+	Metric string `gorm:"column:metric;type:varchar(20);default:''" bson:"metric" json:"metric"`
+	// 范围：指定网关或采集节点，都为空时为全局，节点静默规则不指定节点时检查所有节点
+	GatewayID int64  `gorm:"column:gateway_id;default:0" bson:"gateway_id" json:"gateway_id"`
+	NodeIP    string `gorm:"column:node_ip;type:varchar(64);default:''" bson:"node_ip" json:"node_ip"`
+
+	Operator      string  `gorm:"column:operator;type:varchar(4);default:'>'" bson:"operator" json:"operator"` // > >= < <=
+	Threshold     float64 `gorm:"column:threshold;default:0" bson:"threshold" json:"threshold"`
+	Hysteresis    float64 `gorm:"column:hysteresis;default:0" bson:"hysteresis" json:"hysteresis"`
+	WindowSeconds int     `gorm:"column:window_seconds;default:600" bson:"window_seconds" json:"window_seconds"`
+	MinSamples    int     `gorm:"column:min_samples;default:0" bson:"min_samples" json:"min_samples"` // 窗口内呼叫数少于此值时不评估
+
+	Notifiers    string     `gorm:"column:notifiers;type:varchar(120);default:''" bson:"notifiers" json:"notifiers"` // 通知渠道 webhook,email,syslog，为空时全部通知
+	SilenceUntil *time.Time `gorm:"column:silence_until" bson:"silence_until" json:"silence_until"`                  // 静默截止时间，静默期间只记录不通知
+
+	Remark   string     `gorm:"column:remark;type:varchar(255);default:''" bson:"remark" json:"remark"`
+	CreateAt *time.Time `gorm:"column:create_at" bson:"create_at" json:"create_at"`
+	UpdateAt *time.Time `gorm:"column:update_at" bson:"update_at" json:"update_at"`
+}
+
+func (AlertRule) TableName() string {
+	return "alert_rules"
+}
+
+// AlertHistory 告警触发和恢复的记录
+type AlertHistory struct {
+	ID        int64   `gorm:"primaryKey;column:id;type:bigint unsigned;autoIncrement:true" bson:"_id" json:"id"`
+	RuleID    int64   `gorm:"column:rule_id;index:idx_alert_history_rule_time" bson:"rule_id" json:"rule_id"`
+	RuleName  string  `gorm:"column:rule_name;type:varchar(120);default:''" bson:"rule_name" json:"rule_name"`
+	Metric    string  `gorm:"column:metric;type:varchar(20);default:''" bson:"metric" json:"metric"`
+	Scope     string  `gorm:"column:scope;type:varchar(80);default:''" bson:"scope" json:"scope"` // global、gateway:1、node:10.0.0.1
+	State     string  `gorm:"column:state;type:varchar(10);default:''" bson:"state" json:"state"`
+	Value     float64 `gorm:"column:value;default:0" bson:"value" json:"value"`
+	Threshold float64 `gorm:"column:threshold;default:0" bson:"threshold" json:"threshold"`
+	Message   string  `gorm:"column:message;type:varchar(255);default:''" bson:"message" json:"message"`
+	Silenced  bool    `gorm:"column:silenced;default:false" bson:"silenced" json:"silenced"`
+
+	CreateTime time.Time `gorm:"column:create_time;index:idx_alert_history_rule_time" bson:"create_time" json:"create_time"`
+}
+
+func (AlertHistory) TableName() string {
+	return "alert_history"
+}
+
+// ActiveAlertVO 正在触发的告警，只保存在内存中
+type ActiveAlertVO struct {
+	RuleID    int64     `json:"rule_id"`
+	RuleName  string    `json:"rule_name"`
+	Metric    string    `json:"metric"`
+	Scope     string    `json:"scope"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Since     time.Time `json:"since"`
+	Silenced  bool      `json:"silenced"`
+}
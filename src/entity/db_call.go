@@ -4,6 +4,13 @@ import (
 	"time"
 )
 
+// 呼叫方向，相对于网关
+const (
+	DirectionInbound  = "inbound"  // 网关呼入
+	DirectionOutbound = "outbound" // 呼出到网关
+	DirectionInternal = "internal" // 不经过网关的内部呼叫
+)
+
 type Call struct {
 	// ID field - primary key
 	ID int64 `gorm:"primaryKey;column:id;type:bigint unsigned;autoIncrement:true" bson:"_id" json:"id"`
@@ -21,8 +28,45 @@ type Call struct {
 	FromUser  string `gorm:"column:from_user;type:varchar(120);index;default:''" bson:"from_user" json:"from_user"`
 	UserAgent string `gorm:"column:user_agent;type:varchar(120);default:''" bson:"user_agent" json:"user_agent"` // User agent
 
-	SrcAddr string `gorm:"column:src_addr;type:varchar(25);default:''" bson:"src_addr" json:"src_addr"` // Source address
-	DstAddr string `gorm:"column:dst_addr;type:varchar(25);default:''" bson:"dst_addr" json:"dst_addr"` // Destination address
+	// Caller identity and redirection information
+	AssertedUser       string `gorm:"column:asserted_user;type:varchar(120);index;default:''" bson:"asserted_user" json:"asserted_user"`                      // P-Asserted-Identity / Remote-Party-ID user
+	AssertedName       string `gorm:"column:asserted_name;type:varchar(120);default:''" bson:"asserted_name" json:"asserted_name"`                            // P-Asserted-Identity / Remote-Party-ID display name
+	Privacy            string `gorm:"column:privacy;type:varchar(60);default:''" bson:"privacy" json:"privacy"`                                               // Privacy header values
+	OriginalCalledUser string `gorm:"column:original_called_user;type:varchar(120);index;default:''" bson:"original_called_user" json:"original_called_user"` // 原始被叫号码（Diversion / History-Info）
+	DiversionReason    string `gorm:"column:diversion_reason;type:varchar(30);default:''" bson:"diversion_reason" json:"diversion_reason"`                    // 转移原因
+	RedirectCount      int    `gorm:"column:redirect_count;type:int unsigned;default:0" bson:"redirect_count" json:"redirect_count"`                          // 转移次数
+
+	// 媒体协商信息（SDP offer/answer）
+	MediaTypes      string `gorm:"column:media_types;type:varchar(30);default:''" bson:"media_types" json:"media_types"`                      // 媒体类型，如 audio,video
+	OfferCodecs     string `gorm:"column:offer_codecs;type:varchar(255);default:''" bson:"offer_codecs" json:"offer_codecs"`                  // offer中的编码列表，按优先级排列
+	NegotiatedCodec string `gorm:"column:negotiated_codec;type:varchar(30);index;default:''" bson:"negotiated_codec" json:"negotiated_codec"` // 协商后的语音编码
+	OfferMediaAddr  string `gorm:"column:offer_media_addr;type:varchar(50);default:''" bson:"offer_media_addr" json:"offer_media_addr"`       // offer方媒体地址 ip:port
+	AnswerMediaAddr string `gorm:"column:answer_media_addr;type:varchar(50);default:''" bson:"answer_media_addr" json:"answer_media_addr"`    // answer方媒体地址 ip:port
+	SRTP            bool   `gorm:"column:srtp;default:false" bson:"srtp" json:"srtp"`                                                         // 是否使用SRTP
+	MediaDirection  string `gorm:"column:media_direction;type:varchar(10);default:''" bson:"media_direction" json:"media_direction"`          // 协商后的媒体方向 sendrecv/sendonly/recvonly/inactive
+
+	// SIP-I 中继的ISUP信息（IAM/REL）
+	IsupCalledNumber         string `gorm:"column:isup_called_number;type:varchar(40);index;default:''" bson:"isup_called_number" json:"isup_called_number"`
+	IsupCalledNature         string `gorm:"column:isup_called_nature;type:varchar(20);default:''" bson:"isup_called_nature" json:"isup_called_nature"` // 地址性质 national/international ...
+	IsupCallingNumber        string `gorm:"column:isup_calling_number;type:varchar(40);index;default:''" bson:"isup_calling_number" json:"isup_calling_number"`
+	IsupCallingNature        string `gorm:"column:isup_calling_nature;type:varchar(20);default:''" bson:"isup_calling_nature" json:"isup_calling_nature"`
+	IsupOriginalCalledNumber string `gorm:"column:isup_original_called_number;type:varchar(40);default:''" bson:"isup_original_called_number" json:"isup_original_called_number"`
+	IsupCause                int    `gorm:"column:isup_cause;type:int unsigned;default:0" bson:"isup_cause" json:"isup_cause"` // REL Q.850释放原因值
+	IsupCauseText            string `gorm:"column:isup_cause_text;type:varchar(60);default:''" bson:"isup_cause_text" json:"isup_cause_text"`
+
+	SrcAddr string `gorm:"column:src_addr;type:varchar(54);default:''" bson:"src_addr" json:"src_addr"` // Source address
+	DstAddr string `gorm:"column:dst_addr;type:varchar(54);default:''" bson:"dst_addr" json:"dst_addr"` // Destination address
+
+	// 写入时根据网关地址规则匹配，0表示不是网关
+	IngressGatewayID int64  `gorm:"column:ingress_gateway_id;default:0;index" bson:"ingress_gateway_id" json:"ingress_gateway_id"` // 入口网关（源地址）
+	EgressGatewayID  int64  `gorm:"column:egress_gateway_id;default:0;index" bson:"egress_gateway_id" json:"egress_gateway_id"`    // 出口网关（目的地址）
+	Direction        string `gorm:"column:direction;type:varchar(10);index;default:''" bson:"direction" json:"direction"`          // inbound/outbound/internal
+
+	// INVITE的传输方式，主叫Contact地址（WebSocket客户端的.invalid地址替换为实际来源地址）
+	Transport     string `gorm:"column:transport;type:varchar(10);index;default:''" bson:"transport" json:"transport"`
+	CallerContact string `gorm:"column:caller_contact;type:varchar(64);default:''" bson:"caller_contact" json:"caller_contact"`
+	// 任一消息使用WS/WSS传输，或SDP使用ICE和DTLS-SRTP时为WebRTC呼叫
+	WebRTC bool `gorm:"column:webrtc;default:false;index" bson:"webrtc" json:"webrtc"`
 
 	// Timestamp in microseconds
 	TimestampMicro int64 `gorm:"column:timestamp_micro;type:bigint unsigned;default:0" bson:"timestamp_micro" json:"timestamp_micro"`
@@ -43,6 +87,15 @@ type Call struct {
 	HangupCode  int    `gorm:"column:hangup_code;type:int unsigned;default:0" bson:"hangup_code" json:"hangup_code"`     // Hangup code
 	HangupCause string `gorm:"column:hangup_cause;type:varchar(120);default:''" bson:"hangup_cause" json:"hangup_cause"` // Hangup cause
 	HangupSide  string `gorm:"column:hangup_side;type:char(3);default:''" bson:"hangup_side" json:"hangup_side"`         // 挂机方:dst,src
+
+	// 自定义属性，SQL数据库中保存在call_records_attribute表
+	Attributes map[string]string `gorm:"-" bson:"attributes,omitempty" json:"attributes,omitempty"`
+
+	// 呼叫事件时间线，SQL数据库中保存在call_records_event表
+	Events []CallEvent `gorm:"-" bson:"events,omitempty" json:"events,omitempty"`
+
+	// 关联其他呼叫腿的键，SQL数据库中保存在call_records_link表
+	Links []CallLink `gorm:"-" bson:"links,omitempty" json:"links,omitempty"`
 }
 
 // TableName specifies the database table name for GORM
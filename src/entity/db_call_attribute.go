@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// 属性名和属性值的最大字符数，与字段长度一致
+const (
+	CallAttributeNameMaxLen  = 60
+	CallAttributeValueMaxLen = 255
+)
+
+// CallAttribute 呼叫的自定义属性（key/value），由配置的自定义Header头提取而来
+type CallAttribute struct {
+	ID        int64  `gorm:"primaryKey;column:id;type:bigint unsigned;autoIncrement:true" bson:"_id" json:"id"`
+	SIPCallID string `gorm:"column:sip_call_id;type:varchar(120);index;default:''" bson:"sip_call_id" json:"sip_call_id"`
+
+	Name  string `gorm:"column:name;type:varchar(60);index:idx_call_attribute_name_value,priority:1;default:''" bson:"name" json:"name"`
+	Value string `gorm:"column:value;type:varchar(255);index:idx_call_attribute_name_value,priority:2;default:''" bson:"value" json:"value"`
+
+	CreateTime *time.Time `gorm:"column:create_time;index" bson:"create_time" json:"create_time"`
+}
+
+func (CallAttribute) TableName() string {
+	return "call_records_attribute"
+}
@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+// 呼叫事件类型
+const (
+	CallEventEarlyMedia      = "early_media"       // 早期媒体（180/183携带SDP）
+	CallEventHold            = "hold"              // 呼叫保持（sendonly/inactive/0.0.0.0）
+	CallEventResume          = "resume"            // 恢复通话
+	CallEventCodecChange     = "codec_change"      // 通话中编码变更
+	CallEventMediaAddrChange = "media_addr_change" // 媒体地址变更（NAT重绑定等）
+	CallEventSessionRefresh  = "session_refresh"   // 会话定时器刷新（re-INVITE/UPDATE未修改SDP）
+	CallEventT38             = "t38"               // 切换到T.38传真
+)
+
+// CallEvent 呼叫过程中的事件，通过比较前后的SDP和响应得到
+type CallEvent struct {
+	ID        int64  `gorm:"primaryKey;column:id;type:bigint unsigned;autoIncrement:true" bson:"_id" json:"id"`
+	SIPCallID string `gorm:"column:sip_call_id;type:varchar(120);index;default:''" bson:"sip_call_id" json:"sip_call_id"`
+
+	EventType string `gorm:"column:event_type;type:varchar(30);default:''" bson:"event_type" json:"event_type"`
+	Method    string `gorm:"column:method;type:varchar(10);default:''" bson:"method" json:"method"` // 触发事件的SIP方法或响应码
+	Detail    string `gorm:"column:detail;type:varchar(255);default:''" bson:"detail" json:"detail"`
+
+	SrcAddr string `gorm:"column:src_addr;type:varchar(54);default:''" bson:"src_addr" json:"src_addr"` // Source address
+	DstAddr string `gorm:"column:dst_addr;type:varchar(54);default:''" bson:"dst_addr" json:"dst_addr"` // Destination address
+
+	CreateTime     time.Time `gorm:"column:create_time;index" bson:"create_time" json:"create_time"`
+	TimestampMicro int64     `gorm:"column:timestamp_micro;type:bigint unsigned;default:0" bson:"timestamp_micro" json:"timestamp_micro"`
+}
+
+func (CallEvent) TableName() string {
+	return "call_records_event"
+}
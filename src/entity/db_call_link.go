@@ -0,0 +1,28 @@
+package entity
+
+import "time"
+
+// 呼叫腿的关联策略，按配置CorrelationStrategies的顺序匹配
+const (
+	CorrelationSessionID  = "session_id"   // HeaderSessionIDName配置的会话ID相同
+	CorrelationHeader     = "header"       // 配置的Header头（如X-Orig-Call-ID）的值为另一条腿的Call-ID，或与另一条腿的值相同
+	CorrelationICID       = "icid"         // P-Charging-Vector的icid-value相同
+	CorrelationCallIDRule = "call_id_rule" // 去掉B2BUA添加的前缀/后缀后Call-ID相同
+	CorrelationHeuristic  = "heuristic"    // 主被叫号码相同且开始时间在时间窗口内
+)
+
+// CallLink 呼叫的关联键，入库时从INVITE中提取。
+// 两条腿的关联键值相同，或关联键值等于另一条腿的Call-ID时属于同一会话
+type CallLink struct {
+	ID        int64  `gorm:"primaryKey;column:id;type:bigint unsigned;autoIncrement:true" bson:"_id" json:"id"`
+	SIPCallID string `gorm:"column:sip_call_id;type:varchar(120);index;default:''" bson:"sip_call_id" json:"sip_call_id"`
+
+	Strategy string `gorm:"column:strategy;type:varchar(20);default:''" bson:"strategy" json:"strategy"`
+	Value    string `gorm:"column:value;type:varchar(255);index;default:''" bson:"value" json:"value"`
+
+	CreateTime *time.Time `gorm:"column:create_time;index" bson:"create_time" json:"create_time"`
+}
+
+func (CallLink) TableName() string {
+	return "call_records_link"
+}
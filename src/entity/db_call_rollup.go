@@ -0,0 +1,61 @@
+package entity
+
+import "time"
+
+// 汇总表的时间粒度
+const (
+	RollupMinute = "1m"
+	RollupHour   = "1h"
+	RollupDay    = "1d"
+)
+
+// CallRollup 呼叫汇总，按 时间粒度 × 时间段 × 网关 × 方向 × 挂断码类别 累加，写入呼叫时同步更新
+type CallRollup struct {
+	ID          int64     `gorm:"primaryKey;column:id;type:bigint unsigned;autoIncrement:true" bson:"-" json:"id"`
+	Granularity string    `gorm:"column:granularity;type:varchar(4);uniqueIndex:idx_call_rollup_key,priority:1" bson:"granularity" json:"granularity"`
+	BucketTime  time.Time `gorm:"column:bucket_time;uniqueIndex:idx_call_rollup_key,priority:2" bson:"bucket_time" json:"bucket_time"`
+	GatewayID   int64     `gorm:"column:gateway_id;default:0;uniqueIndex:idx_call_rollup_key,priority:3" bson:"gateway_id" json:"gateway_id"` // 呼出为出口网关，呼入为入口网关，0表示未匹配网关
+	Direction   string    `gorm:"column:direction;type:varchar(10);default:'';uniqueIndex:idx_call_rollup_key,priority:4" bson:"direction" json:"direction"`
+	HangupClass string    `gorm:"column:hangup_class;type:varchar(4);default:'';uniqueIndex:idx_call_rollup_key,priority:5" bson:"hangup_class" json:"hangup_class"` // 2xx/3xx/4xx/5xx/6xx，0表示无挂断码
+
+	Total       int64 `gorm:"column:total;default:0" bson:"total" json:"total"`
+	Answered    int64 `gorm:"column:answered;default:0" bson:"answered" json:"answered"`
+	Effective   int64 `gorm:"column:effective;default:0" bson:"effective" json:"effective"`
+	TalkSeconds int64 `gorm:"column:talk_seconds;default:0" bson:"talk_seconds" json:"talk_seconds"`
+	PDDMsSum    int64 `gorm:"column:pdd_ms_sum;default:0" bson:"pdd_ms_sum" json:"pdd_ms_sum"`
+	PDDCount    int64 `gorm:"column:pdd_count;default:0" bson:"pdd_count" json:"pdd_count"`
+	RingMsSum   int64 `gorm:"column:ring_ms_sum;default:0" bson:"ring_ms_sum" json:"ring_ms_sum"`
+	RingCount   int64 `gorm:"column:ring_count;default:0" bson:"ring_count" json:"ring_count"`
+
+	// 有RTCP报告的呼叫的MOS之和与呼叫数，RTCP报告在呼叫结束后保存，单独累加
+	MosSum   float64 `gorm:"column:mos_sum;default:0" bson:"mos_sum" json:"mos_sum"`
+	MosCount int64   `gorm:"column:mos_count;default:0" bson:"mos_count" json:"mos_count"`
+}
+
+func (CallRollup) TableName() string {
+	return "call_rollups"
+}
+
+// ConcurrencyRollup 并发峰值汇总，按 时间粒度 × 时间段 × 分组 取最大值。
+// 峰值不能按方向、挂断码类别拆开后再相加，因此不放在CallRollup中
+type ConcurrencyRollup struct {
+	ID          int64     `gorm:"primaryKey;column:id;type:bigint unsigned;autoIncrement:true" bson:"-" json:"id"`
+	Granularity string    `gorm:"column:granularity;type:varchar(4);uniqueIndex:idx_concurrency_rollup_key,priority:1" bson:"granularity" json:"granularity"`
+	BucketTime  time.Time `gorm:"column:bucket_time;uniqueIndex:idx_concurrency_rollup_key,priority:2" bson:"bucket_time" json:"bucket_time"`
+	GroupBy     string    `gorm:"column:group_by;type:varchar(10);default:'';uniqueIndex:idx_concurrency_rollup_key,priority:3" bson:"group_by" json:"group_by"`    // 空表示全部，gateway 或 carrier
+	GroupKey    string    `gorm:"column:group_key;type:varchar(32);default:'';uniqueIndex:idx_concurrency_rollup_key,priority:4" bson:"group_key" json:"group_key"` // 网关ID或运营商ID
+
+	Peak int64 `gorm:"column:peak;default:0" bson:"peak" json:"peak"`
+}
+
+func (ConcurrencyRollup) TableName() string {
+	return "call_concurrency_rollups"
+}
+
+// HangupClass 返回挂断码的类别，如 486 -> 4xx
+func HangupClass(code int) string {
+	if code < 100 || code > 699 {
+		return "0"
+	}
+	return string(rune('0'+code/100)) + "xx"
+}
@@ -0,0 +1,71 @@
+package entity
+
+import "time"
+
+// Carrier 运营商，一个运营商有多个网关，SLA按运营商签订
+type Carrier struct {
+	ID     int64  `gorm:"primaryKey;column:id;autoIncrement:true" bson:"_id" json:"id"`
+	Name   string `gorm:"column:name;type:varchar(120);default:''" bson:"name" json:"name"`
+	Remark string `gorm:"column:remark;type:varchar(255);default:''" bson:"remark" json:"remark"`
+
+	// SLA指标，0表示不考核
+	MinASR   float64 `gorm:"column:min_asr;default:0" bson:"min_asr" json:"min_asr"`          // 最低应答率 %
+	MaxPDDMs float64 `gorm:"column:max_pdd_ms;default:0" bson:"max_pdd_ms" json:"max_pdd_ms"` // 最大平均接续时延（毫秒）
+	MinMOS   float64 `gorm:"column:min_mos;default:0" bson:"min_mos" json:"min_mos"`          // 最低平均MOS
+
+	CreateAt *time.Time `gorm:"column:create_at" bson:"create_at" json:"create_at"`
+	UpdateAt *time.Time `gorm:"column:update_at" bson:"update_at" json:"update_at"`
+}
+
+func (Carrier) TableName() string {
+	return "carriers"
+}
+
+// SLA报表的考核周期
+const (
+	SLAPeriodDay   = "day"
+	SLAPeriodMonth = "month"
+)
+
+// SLA指标名
+const (
+	SLAMetricASR = "asr"
+	SLAMetricPDD = "pdd"
+	SLAMetricMOS = "mos"
+)
+
+// SLABreach 一项未达标的SLA指标
+type SLABreach struct {
+	Metric string  `json:"metric"` // asr/pdd/mos
+	Target float64 `json:"target"`
+	Actual float64 `json:"actual"`
+}
+
+// CarrierSLAVO 一个运营商在一个考核周期内的SLA达标情况
+type CarrierSLAVO struct {
+	CarrierID   int64      `json:"carrier_id"`
+	CarrierName string     `json:"carrier_name"`
+	Period      *time.Time `json:"period"` // 考核周期的开始时间
+
+	Total    int64   `json:"total"`
+	Answered int64   `json:"answered"`
+	ASR      float64 `json:"asr"`
+	AvgPDDMs float64 `json:"avg_pdd_ms"`
+	AvgMOS   float64 `json:"avg_mos"`
+
+	MinASR   float64 `json:"min_asr"`
+	MaxPDDMs float64 `json:"max_pdd_ms"`
+	MinMOS   float64 `json:"min_mos"`
+
+	Compliant bool        `json:"compliant"`
+	Breaches  []SLABreach `json:"breaches"`
+}
+
+// CarrierStatsVO 运营商看板：汇总、时间序列和SLA达标情况
+type CarrierStatsVO struct {
+	Carrier  *Carrier     `json:"carrier"`
+	Gateways []Gateway    `json:"gateways"`
+	Summary  *CallKPIVO   `json:"summary"`
+	Series   []*CallKPIVO `json:"series"`
+	Breaches []SLABreach  `json:"breaches"`
+}
@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+// 入库过滤规则的动作
+const (
+	FilterActionDrop     = "drop"     // 丢弃，不保存任何信息
+	FilterActionMetadata = "metadata" // 只保存消息记录和呼叫，不保存原始报文
+	FilterActionSample   = "sample"   // 按呼叫采样，SampleRate为保留的百分比
+)
+
+// FilterRule 入库过滤规则，非空的条件全部满足时规则命中，按Priority从小到大匹配，第一条命中的规则生效
+type FilterRule struct {
+	ID       int64  `gorm:"primaryKey;column:id;autoIncrement:true" bson:"_id" json:"id"`
+	Name     string `gorm:"column:name;type:varchar(120);default:''" bson:"name" json:"name"`
+	Enabled  bool   `gorm:"column:enabled;default:true" bson:"enabled" json:"enabled"`
+	Priority int    `gorm:"column:priority;default:0" bson:"priority" json:"priority"`
+
+	Methods       string `gorm:"column:methods;type:varchar(255);default:''" bson:"methods" json:"methods"`                      // CSeq方法，多个用逗号分隔，如 OPTIONS,REGISTER
+	ResponseCodes string `gorm:"column:response_codes;type:varchar(255);default:''" bson:"response_codes" json:"response_codes"` // 响应码，多个用逗号分隔，支持 4xx 形式
+	SrcCIDR       string `gorm:"column:src_cidr;type:varchar(255);default:''" bson:"src_cidr" json:"src_cidr"`                   // 源地址网段，多个用逗号分隔
+	DstCIDR       string `gorm:"column:dst_cidr;type:varchar(255);default:''" bson:"dst_cidr" json:"dst_cidr"`                   // 目的地址网段，多个用逗号分隔
+	UserAgent     string `gorm:"column:user_agent;type:varchar(255);default:''" bson:"user_agent" json:"user_agent"`             // User-Agent 正则表达式
+	FromUser      string `gorm:"column:from_user;type:varchar(120);default:''" bson:"from_user" json:"from_user"`                // 主叫，支持 * ? 通配符
+	ToUser        string `gorm:"column:to_user;type:varchar(120);default:''" bson:"to_user" json:"to_user"`                      // 被叫，支持 * ? 通配符
+	NodeID        string `gorm:"column:node_id;type:varchar(60);default:''" bson:"node_id" json:"node_id"`                       // 采集节点ID，多个用逗号分隔
+
+	Action     string `gorm:"column:action;type:varchar(20);default:'drop'" bson:"action" json:"action"`
+	SampleRate int    `gorm:"column:sample_rate;default:100" bson:"sample_rate" json:"sample_rate"` // 采样保留的百分比 0-100
+
+	Remark   string     `gorm:"column:remark;type:varchar(255);default:''" bson:"remark" json:"remark"`
+	CreateAt *time.Time `gorm:"column:create_at" bson:"create_at" json:"create_at"`
+	UpdateAt *time.Time `gorm:"column:update_at" bson:"update_at" json:"update_at"`
+}
+
+func (FilterRule) TableName() string {
+	return "ingest_filter_rules"
+}
@@ -3,14 +3,30 @@ package entity
 import "time"
 
 type Gateway struct {
-	ID       int64      `gorm:"primaryKey;column:id;autoIncrement:true" bson:"_id" json:"id"`
-	Name     string     `gorm:"column:name;type:varchar(120);default:''" bson:"name" json:"name"`
-	Addr     string     `gorm:"column:addr;type:varchar(25);default:''" bson:"addr" json:"addr"`
-	Remark   string     `gorm:"column:remark;type:varchar(255);default:''" bson:"remark" json:"remark"`
-	CreateAt *time.Time `gorm:"column:create_at" bson:"create_at" json:"create_at"`
-	UpdateAt *time.Time `gorm:"column:update_at" bson:"update_at" json:"update_at"`
+	ID          int64      `gorm:"primaryKey;column:id;autoIncrement:true" bson:"_id" json:"id"`
+	Name        string     `gorm:"column:name;type:varchar(120);default:''" bson:"name" json:"name"`
+	Addrs       []string   `gorm:"-" bson:"addrs" json:"addrs"` // 地址规则，保存在gateway_addrs表，支持IP、CIDR和端口范围，如 10.0.0.1、10.0.1.0/24:5060-5080
+	Remark      string     `gorm:"column:remark;type:varchar(255);default:''" bson:"remark" json:"remark"`
+	MaxChannels int        `gorm:"column:max_channels;default:0" bson:"max_channels" json:"max_channels"` // 合同约定的并发通道上限，0表示不限制
+	CarrierID   int64      `gorm:"column:carrier_id;default:0;index" bson:"carrier_id" json:"carrier_id"` // 所属运营商，0表示未分配
+	CreateAt    *time.Time `gorm:"column:create_at" bson:"create_at" json:"create_at"`
+	UpdateAt    *time.Time `gorm:"column:update_at" bson:"update_at" json:"update_at"`
 }
 
 func (Gateway) TableName() string {
 	return "gateways"
 }
+
+// 一条地址规则的最大长度
+const GatewayAddrMaxLen = 64
+
+// GatewayAddr 网关的一条地址规则
+type GatewayAddr struct {
+	ID        int64  `gorm:"primaryKey;column:id;autoIncrement:true" bson:"_id" json:"id"`
+	GatewayID int64  `gorm:"column:gateway_id;index" bson:"gateway_id" json:"gateway_id"`
+	Pattern   string `gorm:"column:pattern;type:varchar(64);default:''" bson:"pattern" json:"pattern"`
+}
+
+func (GatewayAddr) TableName() string {
+	return "gateway_addrs"
+}
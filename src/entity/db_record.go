@@ -7,16 +7,26 @@ type Record struct {
 
 	NodeIP string `gorm:"column:node_ip;type:varchar(25);default:''" bson:"node_ip" json:"node_ip"`
 
+	// 采集节点的HEP ID和名称，以及厂商chunk等额外的HEP元数据
+	NodeID   string            `gorm:"column:node_id;type:varchar(20);default:''" bson:"node_id" json:"node_id"`
+	NodeName string            `gorm:"column:node_name;type:varchar(64);default:''" bson:"node_name" json:"node_name"`
+	HepMeta  map[string]string `gorm:"column:hep_meta;type:text;serializer:json" bson:"hep_meta" json:"hep_meta,omitempty"`
+	// 多个采集节点上报了同一条消息时为全部节点IP，逗号分隔，见 DedupMode=mark
+	SeenBy string `gorm:"column:seen_by;type:varchar(255);default:''" bson:"seen_by" json:"seen_by"`
+
 	SIPCallID string `gorm:"column:sip_call_id;type:varchar(120);index;default:''" bson:"sip_call_id" json:"sip_call_id"`
 
 	Method       string `gorm:"column:method;type:varchar(10);default:''" bson:"method" json:"method"`
+	ResponseCode int    `gorm:"column:response_code;type:int unsigned;default:0" bson:"response_code" json:"response_code"`
 	ResponseDesc string `gorm:"column:response_desc;type:varchar(100);default:''" bson:"response_desc" json:"response_desc"`
 
 	ToUser   string `gorm:"column:to_user;type:varchar(120);default:''" bson:"to_user" json:"to_user"`
 	FromUser string `gorm:"column:from_user;type:varchar(120);default:''" bson:"from_user" json:"from_user"`
 
-	SrcAddr string `gorm:"column:src_addr;type:varchar(25);default:''" bson:"src_addr" json:"src_addr"` // Source address
-	DstAddr string `gorm:"column:dst_addr;type:varchar(25);default:''" bson:"dst_addr" json:"dst_addr"` // Destination address
+	SrcAddr string `gorm:"column:src_addr;type:varchar(54);default:''" bson:"src_addr" json:"src_addr"` // Source address
+	DstAddr string `gorm:"column:dst_addr;type:varchar(54);default:''" bson:"dst_addr" json:"dst_addr"` // Destination address
+
+	Transport string `gorm:"column:transport;type:varchar(10);default:''" bson:"transport" json:"transport"` // udp, tcp, tls, sctp, ws, wss
 
 	// CreateTime represents when the record was created
 	CreateTime     time.Time `gorm:"column:create_time;index" bson:"create_time" json:"create_time"`
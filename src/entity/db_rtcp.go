@@ -9,8 +9,8 @@ type RtcpReport struct {
 
 	SIPCallID string `gorm:"column:sip_call_id;type:varchar(120);index;default:''" bson:"sip_call_id" json:"sip_call_id"`
 
-	SrcAddr string `gorm:"column:src_addr;type:varchar(25);default:''" bson:"src_addr" json:"src_addr"` // Source address
-	DstAddr string `gorm:"column:dst_addr;type:varchar(25);default:''" bson:"dst_addr" json:"dst_addr"` // Destination address
+	SrcAddr string `gorm:"column:src_addr;type:varchar(54);default:''" bson:"src_addr" json:"src_addr"` // Source address
+	DstAddr string `gorm:"column:dst_addr;type:varchar(54);default:''" bson:"dst_addr" json:"dst_addr"` // Destination address
 
 	AlegMos            float64 `gorm:"column:aleg_mos;type:float;default:0" bson:"aleg_mos" json:"aleg_mos"`                                        // 平均MOS
 	AlegPacketLost     uint64  `gorm:"column:aleg_packet_lost;type:int unsigned;default:0" bson:"aleg_packet_lost" json:"aleg_packet_lost"`         // 总丢包数
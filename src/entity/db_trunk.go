@@ -0,0 +1,63 @@
+package entity
+
+import "time"
+
+// 中继状态
+const (
+	TrunkStateUnknown = "unknown"
+	TrunkStateUp      = "up"
+	TrunkStateDown    = "down"
+)
+
+// TrunkStateHistory 中继（网关）状态变化记录，根据OPTIONS探测结果生成
+type TrunkStateHistory struct {
+	ID          int64  `gorm:"primaryKey;column:id;type:bigint unsigned;autoIncrement:true" bson:"_id" json:"id"`
+	GatewayID   int64  `gorm:"column:gateway_id;index:idx_trunk_state_gateway_time" bson:"gateway_id" json:"gateway_id"`
+	GatewayName string `gorm:"column:gateway_name;type:varchar(120);default:''" bson:"gateway_name" json:"gateway_name"`
+	GatewayAddr string `gorm:"column:gateway_addr;type:varchar(255);default:''" bson:"gateway_addr" json:"gateway_addr"` // 逗号连接的地址规则
+
+	PrevState string `gorm:"column:prev_state;type:varchar(10);default:''" bson:"prev_state" json:"prev_state"`
+	State     string `gorm:"column:state;type:varchar(10);default:''" bson:"state" json:"state"`
+	Reason    string `gorm:"column:reason;type:varchar(100);default:''" bson:"reason" json:"reason"` // 如 200 OK、timeout、503 Service Unavailable
+
+	LatencyMs           int `gorm:"column:latency_ms;type:int unsigned;default:0" bson:"latency_ms" json:"latency_ms"`
+	ConsecutiveFailures int `gorm:"column:consecutive_failures;type:int unsigned;default:0" bson:"consecutive_failures" json:"consecutive_failures"`
+
+	CreateTime time.Time `gorm:"column:create_time;index:idx_trunk_state_gateway_time" bson:"create_time" json:"create_time"`
+}
+
+func (TrunkStateHistory) TableName() string {
+	return "trunk_state_history"
+}
+
+// TrunkStatus 中继当前的健康状态，只保存在内存中
+type TrunkStatus struct {
+	GatewayID   int64  `json:"gateway_id"`
+	GatewayName string `json:"gateway_name"`
+	GatewayAddr string `json:"gateway_addr"`
+	State       string `json:"state"`
+
+	LastResponseCode    int     `json:"last_response_code"`
+	LastLatencyMs       int     `json:"last_latency_ms"`
+	AvgLatencyMs        float64 `json:"avg_latency_ms"` // 指数加权平均
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+
+	Probes       int64 `json:"probes"`        // OPTIONS探测次数
+	FailedProbes int64 `json:"failed_probes"` // 失败次数（超时或5xx/6xx/408）
+
+	LastCheckTime  *time.Time `json:"last_check_time"`
+	LastChangeTime *time.Time `json:"last_change_time"`
+}
+
+// TrunkUptimeVO 中继在时间段内的可用率
+type TrunkUptimeVO struct {
+	GatewayID      int64     `json:"gateway_id"`
+	GatewayName    string    `json:"gateway_name"`
+	BeginTime      time.Time `json:"begin_time"`
+	EndTime        time.Time `json:"end_time"`
+	UpSeconds      int64     `json:"up_seconds"`
+	DownSeconds    int64     `json:"down_seconds"`
+	UnknownSeconds int64     `json:"unknown_seconds"`
+	UptimePercent  float64   `json:"uptime_percent"` // 可用率，不含状态未知的时间
+	Changes        int       `json:"changes"`        // 时间段内状态变化次数
+}
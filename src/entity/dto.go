@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"strings"
 	"time"
 )
 
@@ -19,10 +20,40 @@ type SearchParams struct {
 	FromUser string `form:"from_user" json:"from_user" query:"from_user"`
 	ToUser   string `form:"to_user" json:"to_user" query:"to_user"`
 
+	AssertedUser       string `form:"asserted_user" json:"asserted_user" query:"asserted_user"`
+	OriginalCalledUser string `form:"original_called_user" json:"original_called_user" query:"original_called_user"`
+	DiversionReason    string `form:"diversion_reason" json:"diversion_reason" query:"diversion_reason"`
+	Privacy            string `form:"privacy" json:"privacy" query:"privacy"`
+
 	SrcHost string `form:"src_host" json:"src_host" query:"src_host"`
 	DstHost string `form:"dst_host" json:"dst_host" query:"dst_host"`
 
 	HangupCode string `form:"hangup_code" json:"hangup_code" query:"hangup_code"`
+
+	IngressGatewayID int64  `form:"ingress_gateway_id" json:"ingress_gateway_id" query:"ingress_gateway_id"`
+	EgressGatewayID  int64  `form:"egress_gateway_id" json:"egress_gateway_id" query:"egress_gateway_id"`
+	Direction        string `form:"direction" json:"direction" query:"direction"`
+
+	// 传输方式 udp/tcp/tls/sctp/ws/wss，webrtc为true时只查WebRTC呼叫
+	Transport string `form:"transport" json:"transport" query:"transport"`
+	WebRTC    *bool  `form:"webrtc" json:"webrtc" query:"webrtc"`
+
+	// 自定义属性过滤，格式为 name=value，只有name时表示存在该属性
+	Attributes []string `form:"attribute" json:"attributes" query:"attribute"`
+}
+
+// AttributeFilters 解析自定义属性过滤条件，value为空表示只要求属性存在
+func (p SearchParams) AttributeFilters() map[string]string {
+	filters := make(map[string]string)
+	for _, item := range p.Attributes {
+		name, value, _ := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		filters[name] = strings.TrimSpace(value)
+	}
+	return filters
 }
 
 type CleanSipRecordDTO struct {
@@ -40,4 +71,57 @@ type AuthLogin struct {
 type CallStatDTO struct {
 	BeginTime *time.Time `json:"begin_time" form:"begin_time" time_format:"2006-01-02 15:04:05"`
 	EndTime   *time.Time `json:"end_time" form:"end_time" time_format:"2006-01-02 15:04:05"`
+
+	// KPI统计：分组维度 gateway/carrier/src/dst/node/cause，时间粒度 5m/1h/1d/1mo，为空时不分组、不分时间段
+	GroupBy  string `json:"group_by" form:"group_by"`
+	Interval string `json:"interval" form:"interval"`
+}
+
+// CarrierSLADTO SLA报表查询条件
+type CarrierSLADTO struct {
+	BeginTime *time.Time `json:"begin_time" form:"begin_time" time_format:"2006-01-02 15:04:05"`
+	EndTime   *time.Time `json:"end_time" form:"end_time" time_format:"2006-01-02 15:04:05"`
+
+	Period    string `json:"period" form:"period"`         // day/month，默认day
+	CarrierID int64  `json:"carrier_id" form:"carrier_id"` // 为0时查询所有运营商
+}
+
+// AlertHistoryDTO 告警历史查询条件
+type AlertHistoryDTO struct {
+	PageSize int64 `json:"page_size" form:"page_size"`
+	Page     int64 `json:"page" form:"page"`
+
+	BeginTime *time.Time `json:"begin_time" form:"begin_time" time_format:"2006-01-02 15:04:05"`
+	EndTime   *time.Time `json:"end_time" form:"end_time" time_format:"2006-01-02 15:04:05"`
+
+	RuleID int64  `json:"rule_id" form:"rule_id"`
+	State  string `json:"state" form:"state"` // firing/resolved
+}
+
+// AlertSilenceDTO 静默告警规则，Minutes为0时取消静默
+type AlertSilenceDTO struct {
+	Minutes int `json:"minutes" form:"minutes"`
+}
+
+// 话单导出格式
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSONL = "jsonl"
+	ExportFormatXLSX  = "xlsx"
+)
+
+// CallExportDTO 话单导出条件，查询条件与呼叫列表相同，不分页
+type CallExportDTO struct {
+	SearchParams
+
+	Format   string `json:"format" form:"format" query:"format"`          // csv/jsonl/xlsx，默认csv
+	Columns  string `json:"columns" form:"columns" query:"columns"`       // 导出的列，逗号分隔，为空时导出默认列，自定义属性写为 attr.名称
+	TimeZone string `json:"time_zone" form:"time_zone" query:"time_zone"` // 时间列的时区，如 Asia/Shanghai，默认服务器时区
+}
+
+// CallLadderDTO 呼叫时序图
+type CallLadderDTO struct {
+	SIPCallID string `json:"sip_call_id" form:"sip_call_id" query:"sip_call_id"`
+	Format    string `json:"format" form:"format" query:"format"`    // svg/png/mermaid/plantuml，默认svg
+	Related   bool   `json:"related" form:"related" query:"related"` // 包含关联的呼叫腿
 }
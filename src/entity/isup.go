@@ -0,0 +1,15 @@
+package entity
+
+// ISUP 是SIP-I消息中封装的ISUP消息摘要
+type ISUP struct {
+	MessageType string `json:"message_type"` // IAM, ACM, ANM, REL ...
+
+	CalledNumber         string `json:"called_number"`          // IAM 被叫号码
+	CalledNature         string `json:"called_nature"`          // 被叫号码地址性质 national/international ...
+	CallingNumber        string `json:"calling_number"`         // IAM 主叫号码
+	CallingNature        string `json:"calling_nature"`         // 主叫号码地址性质
+	OriginalCalledNumber string `json:"original_called_number"` // IAM 原被叫号码
+
+	Cause     int    `json:"cause"`      // REL Q.850释放原因值
+	CauseText string `json:"cause_text"` // 释放原因描述
+}
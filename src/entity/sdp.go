@@ -0,0 +1,139 @@
+package entity
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SDP 是SIP消息中SDP的摘要，用于呼叫的媒体协商记录
+type SDP struct {
+	SessionID      string     `json:"session_id"`      // o= sess-id
+	SessionVersion string     `json:"session_version"` // o= sess-version，每次修改SDP都会递增
+	Media          []SDPMedia `json:"media"`
+}
+
+// SDPMedia 是一个m=媒体流的摘要
+type SDPMedia struct {
+	MediaType string   `json:"media_type"` // audio, video, image ...
+	Addr      string   `json:"addr"`       // 媒体IP
+	Port      int      `json:"port"`       // 媒体端口，0表示该媒体流被拒绝/关闭
+	Proto     string   `json:"proto"`      // RTP/AVP, RTP/SAVP, udptl ...
+	Codecs    []string `json:"codecs"`     // 编码，按优先级排列
+	Direction string   `json:"direction"`  // sendrecv, sendonly, recvonly, inactive
+	SRTP      bool     `json:"srtp"`
+	ICE       bool     `json:"ice"`
+	DTLS      bool     `json:"dtls"` // a=fingerprint，DTLS-SRTP
+
+	Candidates []ICECandidate `json:"candidates,omitempty"` // a=candidate
+}
+
+// ICECandidate 是一个a=candidate的摘要（RFC 8839）
+type ICECandidate struct {
+	Foundation string `json:"foundation"`
+	Component  int    `json:"component"` // 1为RTP，2为RTCP
+	Transport  string `json:"transport"` // udp, tcp
+	Priority   uint32 `json:"priority"`
+	Addr       string `json:"addr"` // IP，或浏览器隐藏本机地址时的mDNS名称 xxx.local
+	Port       int    `json:"port"`
+	Type       string `json:"type"` // host, srflx, prflx, relay
+}
+
+// Endpoint 返回候选地址 ip:port
+func (c *ICECandidate) Endpoint() string {
+	return net.JoinHostPort(c.Addr, strconv.Itoa(c.Port))
+}
+
+// AudioMedia 返回第一个audio媒体流，没有时返回nil
+func (s *SDP) AudioMedia() *SDPMedia {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Media {
+		if s.Media[i].MediaType == "audio" {
+			return &s.Media[i]
+		}
+	}
+	return nil
+}
+
+// MediaTypes 返回所有媒体类型，如 audio,video
+func (s *SDP) MediaTypes() string {
+	if s == nil {
+		return ""
+	}
+	types := make([]string, 0, len(s.Media))
+	for _, media := range s.Media {
+		types = append(types, media.MediaType)
+	}
+	return strings.Join(types, ",")
+}
+
+// Endpoint 返回媒体地址 ip:port。
+// trickle ICE的offer中c=为0.0.0.0（RFC 8840），此时返回优先级最高的RTP候选地址
+func (m *SDPMedia) Endpoint() string {
+	if m == nil || m.Addr == "" {
+		return ""
+	}
+	if isUnspecifiedAddr(m.Addr) {
+		if candidate := m.PreferredCandidate(); candidate != nil {
+			return candidate.Endpoint()
+		}
+	}
+	return net.JoinHostPort(m.Addr, strconv.Itoa(m.Port))
+}
+
+// PreferredCandidate 返回优先级最高的RTP候选，忽略无法解析的mDNS地址，没有时返回nil
+func (m *SDPMedia) PreferredCandidate() *ICECandidate {
+	var preferred *ICECandidate
+	for i := range m.Candidates {
+		candidate := &m.Candidates[i]
+		if candidate.Component != 1 || net.ParseIP(candidate.Addr) == nil {
+			continue
+		}
+		if preferred == nil || candidate.Priority > preferred.Priority {
+			preferred = candidate
+		}
+	}
+	return preferred
+}
+
+// IsWebRTC 判断是否为WebRTC的媒体协商：ICE和DTLS-SRTP（RFC 8827）
+func (s *SDP) IsWebRTC() bool {
+	if s == nil {
+		return false
+	}
+	for _, media := range s.Media {
+		if media.ICE && media.DTLS {
+			return true
+		}
+	}
+	return false
+}
+
+func isUnspecifiedAddr(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// PrimaryCodec 返回第一个语音编码，忽略telephone-event、CN等非语音编码
+func (m *SDPMedia) PrimaryCodec() string {
+	if m == nil {
+		return ""
+	}
+	for _, codec := range m.Codecs {
+		if !IsAuxiliaryCodec(codec) {
+			return codec
+		}
+	}
+	return ""
+}
+
+// IsAuxiliaryCodec 判断是否为DTMF、舒适噪声、冗余等非语音编码
+func IsAuxiliaryCodec(codec string) bool {
+	switch strings.ToLower(codec) {
+	case "telephone-event", "cn", "red", "ulpfec", "rtx", "comfort-noise":
+		return true
+	}
+	return false
+}
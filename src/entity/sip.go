@@ -4,11 +4,30 @@ import (
 	"time"
 )
 
+// SIP传输方式
+const (
+	TransportUDP  = "udp"
+	TransportTCP  = "tcp"
+	TransportTLS  = "tls"
+	TransportSCTP = "sctp"
+	TransportWS   = "ws"  // SIP over WebSocket（RFC 7118）
+	TransportWSS  = "wss" // SIP over 安全WebSocket
+)
+
+// IsWebSocketTransport 判断是否为WS/WSS传输，WebRTC终端使用
+func IsWebSocketTransport(transport string) bool {
+	return transport == TransportWS || transport == TransportWSS
+}
+
 type SIP struct {
-	NodeID string `json:"node_id"`
-	NodeIP string `json:"node_ip"`
+	NodeID   string            `json:"node_id"`
+	NodeIP   string            `json:"node_ip"`
+	NodeName string            `json:"node_name"` // HEP节点名称 chunk 0x0013
+	HepMeta  map[string]string `json:"hep_meta"`  // 厂商chunk等额外的HEP元数据
+	SeenBy   []string          `json:"seen_by"`   // 去重时上报了同一消息的全部节点，只有一个节点时为空
 
-	Protocol int `json:"protocol"`
+	Protocol  int    `json:"protocol"`  // HEP上报的IP协议号
+	Transport string `json:"transport"` // udp, tcp, tls, sctp, ws, wss
 
 	CallID    string `json:"sip_call_id"`
 	SessionID string `json:"session_id"`
@@ -23,12 +42,37 @@ type SIP struct {
 
 	UserAgent string `json:"user_agent"`
 
+	SessionExpires int `json:"session_expires"` // Session-Expires头部的刷新间隔（秒）
+
 	FromUser string `json:"from_user"`
 	ToUser   string `json:"to_user"`
 
+	// Caller identity from P-Asserted-Identity / Remote-Party-ID / Privacy
+	AssertedUser string `json:"asserted_user"`
+	AssertedName string `json:"asserted_name"`
+	Privacy      string `json:"privacy"`
+
+	// Redirection information from Diversion / History-Info
+	OriginalCalledUser string `json:"original_called_user"`
+	DiversionReason    string `json:"diversion_reason"`
+	RedirectCount      int    `json:"redirect_count"`
+
+	// 配置的自定义Header头，key为配置的Header名称
+	CustomHeaders map[string]string `json:"custom_headers"`
+
+	// 关联B2BUA两侧呼叫腿：配置的关联Header头（key为配置的名称）和P-Charging-Vector的icid-value
+	CorrelationHeaders map[string]string `json:"correlation_headers"`
+	ICID               string            `json:"icid"`
+
 	SrcAddr string `json:"src_addr"`
 	DstAddr string `json:"dst_addr"`
 
+	// Contact地址 host[:port]，WebSocket客户端的.invalid地址替换为实际来源地址
+	ContactAddr string `json:"contact_addr"`
+
+	SDP  *SDP  `json:"sdp"`  // SDP摘要，消息不带SDP时为nil
+	ISUP *ISUP `json:"isup"` // SIP-I 消息体中的ISUP
+
 	CreateTime     time.Time `json:"create_time"`
 	TimestampMicro int64     `json:"timestamp_micro"`
 
@@ -0,0 +1,60 @@
+package entity
+
+import "time"
+
+// KPI统计的分组维度
+const (
+	StatGroupGateway = "gateway"
+	StatGroupCarrier = "carrier"
+	StatGroupSrc     = "src"
+	StatGroupDst     = "dst"
+	StatGroupNode    = "node"
+	StatGroupCause   = "cause"
+)
+
+// KPI统计的时间粒度
+const (
+	StatInterval5m  = "5m"
+	StatInterval1h  = "1h"
+	StatInterval1d  = "1d"
+	StatInterval1mo = "1mo"
+)
+
+// CallStatRow KPI统计需要的呼叫字段
+type CallStatRow struct {
+	CreateTime   *time.Time `gorm:"column:create_time" bson:"create_time"`
+	RingingTime  *time.Time `gorm:"column:ringing_time" bson:"ringing_time"`
+	AnswerTime   *time.Time `gorm:"column:answer_time" bson:"answer_time"`
+	EndTime      *time.Time `gorm:"column:end_time" bson:"end_time"`
+	TalkDuration int        `gorm:"column:talk_duration" bson:"talk_duration"`
+	HangupCode   int        `gorm:"column:hangup_code" bson:"hangup_code"`
+	SrcAddr      string     `gorm:"column:src_addr" bson:"src_addr"`
+	DstAddr      string     `gorm:"column:dst_addr" bson:"dst_addr"`
+	NodeIP       string     `gorm:"column:node_ip" bson:"node_ip"`
+
+	// 呼叫的RTCP报告中两个方向的MOS，没有报告时为0
+	AlegMos float64 `gorm:"column:aleg_mos" bson:"aleg_mos"`
+	BlegMos float64 `gorm:"column:bleg_mos" bson:"bleg_mos"`
+}
+
+// CallKPIVO 一个分组在一个时间段内的话务指标
+type CallKPIVO struct {
+	BucketTime *time.Time `json:"bucket_time"` // 时间段开始时间，不分时间段时为nil
+	Group      string     `json:"group"`       // 分组的值，如网关ID、节点IP、挂断码
+	GroupName  string     `json:"group_name"`  // 分组名称，按网关分组时为网关名
+
+	Total     int64 `json:"total"`     // 呼叫总数（占用次数）
+	Answered  int64 `json:"answered"`  // 应答次数
+	Effective int64 `json:"effective"` // 有效呼叫：应答、用户忙、无应答、拒接
+
+	TalkSeconds    int64   `json:"talk_seconds"`
+	ASR            float64 `json:"asr"`              // 应答率 %
+	NER            float64 `json:"ner"`              // 网络有效率 %
+	ACD            float64 `json:"acd"`              // 平均通话时长（秒）
+	AvgPDDMs       float64 `json:"avg_pdd_ms"`       // 平均接续时延：INVITE到第一个18x（毫秒）
+	AvgRingSeconds float64 `json:"avg_ring_seconds"` // 平均振铃时长（秒）
+	PeakConcurrent int64   `json:"peak_concurrent"`  // 并发呼叫峰值，只在按明细统计时计算
+	AvgMOS         float64 `json:"avg_mos"`          // 平均MOS，只在按明细统计时计算
+
+	Source string `json:"source"` // 数据来源：calls 为呼叫明细，rollup:1h 等为汇总表
+}
@@ -30,6 +30,45 @@ type CallDetailsVO struct {
 	Relevants   []Record         `json:"relevants"`
 	RtcpReport  *RtcpReport      `json:"rtcp_report"`
 	RTCPPackets []*RtcpReportRaw `json:"rtcp_packets"`
+	Events      []CallEvent      `json:"events"`
+	Graph       *SessionGraph    `json:"graph"` // 关联的全部呼叫腿
+}
+
+// SessionGraph 经过B2BUA的一个会话的全部呼叫腿和腿之间的关联
+type SessionGraph struct {
+	Root  string        `json:"root"` // 查询的呼叫
+	Legs  []SessionLeg  `json:"legs"` // 按开始时间排序
+	Links []SessionLink `json:"links"`
+}
+
+// SessionLeg 会话中的一条呼叫腿
+type SessionLeg struct {
+	SIPCallID  string     `json:"sip_call_id"`
+	FromUser   string     `json:"from_user"`
+	ToUser     string     `json:"to_user"`
+	SrcAddr    string     `json:"src_addr"`
+	DstAddr    string     `json:"dst_addr"`
+	Direction  string     `json:"direction"`
+	CreateTime *time.Time `json:"create_time"`
+	CallStatus int        `json:"call_status"`
+	HangupCode int        `json:"hangup_code"`
+}
+
+// SessionLink 两条呼叫腿的关联，From为较早开始的腿，Strategy为第一个匹配的策略
+type SessionLink struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Strategy string `json:"strategy"`
+	Value    string `json:"value"` // 匹配的键值，如Header的值、icid
+}
+
+// LegIDs 全部呼叫腿的Call-ID
+func (g *SessionGraph) LegIDs() []string {
+	ids := make([]string, 0, len(g.Legs))
+	for _, leg := range g.Legs {
+		ids = append(ids, leg.SIPCallID)
+	}
+	return ids
 }
 
 type CallStatVO struct {
@@ -7,6 +7,7 @@ import (
 	"sip-monitor/src/config"
 	"sip-monitor/src/entity"
 	"sip-monitor/src/model/sql"
+	"strings"
 	"time"
 
 	mongorepo "sip-monitor/src/model/mongo"
@@ -201,13 +202,64 @@ func (f *RepositoryFactory) openGormDB(dialector gorm.Dialector) (*gorm.DB, erro
 
 // migrateSchema migrates the database schema
 func (f *RepositoryFactory) migrateSchema(db *gorm.DB) error {
-	return db.AutoMigrate(
+	err := db.AutoMigrate(
 		&entity.Record{},
 		&entity.RecordRaw{},
 		&entity.Call{},
+		&entity.CallAttribute{},
+		&entity.CallEvent{},
+		&entity.CallLink{},
+		&entity.CallRollup{},
+		&entity.ConcurrencyRollup{},
+		&entity.FilterRule{},
+		&entity.TrunkStateHistory{},
+		&entity.AlertRule{},
+		&entity.AlertHistory{},
 		&entity.User{},
 		&entity.Gateway{},
+		&entity.GatewayAddr{},
+		&entity.Carrier{},
 		&entity.RtcpReport{},
 		&entity.RtcpReportRaw{},
 	)
+	if err != nil {
+		return err
+	}
+	return migrateGatewayAddrs(db)
+}
+
+// migrateGatewayAddrs moves the comma separated patterns of the legacy gateways.addr column
+// into gateway_addrs, one row per pattern, then drops the column
+func migrateGatewayAddrs(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&entity.Gateway{}, "addr") {
+		return nil
+	}
+	var gateways []struct {
+		ID   int64
+		Addr string
+	}
+	if err := db.Table(entity.Gateway{}.TableName()).Select("id, addr").Scan(&gateways).Error; err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, gateway := range gateways {
+			// 已迁移的网关不重复写入
+			var count int64
+			if err := tx.Model(&entity.GatewayAddr{}).Where("gateway_id = ?", gateway.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			for _, pattern := range strings.Split(gateway.Addr, ",") {
+				if pattern = strings.TrimSpace(pattern); pattern == "" {
+					continue
+				}
+				if err := tx.Create(&entity.GatewayAddr{GatewayID: gateway.ID, Pattern: pattern}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Migrator().DropColumn(&entity.Gateway{}, "addr")
+	})
 }
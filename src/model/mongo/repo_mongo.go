@@ -3,8 +3,11 @@ package mongo
 import (
 	"context"
 	"sip-monitor/src/entity"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // MongoRepository implements Repository for MongoDB
@@ -14,6 +17,8 @@ type MongoRepository struct {
 	recordCallCollection     *mongo.Collection
 	recordRegisterCollection *mongo.Collection
 	userCollection           *mongo.Collection
+	callRollupCollection     *mongo.Collection
+	concurrencyCollection    *mongo.Collection
 }
 
 // NewMongoRepository creates a new MongoDB repository
@@ -24,6 +29,8 @@ func NewMongoRepository(db *mongo.Database) *MongoRepository {
 		recordCallCollection:     db.Collection("call_records_call"),
 		recordRegisterCollection: db.Collection("call_records_register"),
 		userCollection:           db.Collection("users"),
+		callRollupCollection:     db.Collection("call_rollups"),
+		concurrencyCollection:    db.Collection("call_concurrency_rollups"),
 	}
 }
 
@@ -68,6 +75,16 @@ func (r *MongoRepository) GetCallList(ctx context.Context, params entity.SearchP
 	return nil, nil, nil
 }
 
+// IterateCalls reads the matching calls in batches
+func (r *MongoRepository) IterateCalls(ctx context.Context, params entity.SearchParams, batchSize int, fn func(calls []entity.Call) error) error {
+	return nil
+}
+
+// GetCallEventsBySIPCallID retrieves the event timeline of a call from MongoDB
+func (r *MongoRepository) GetCallEventsBySIPCallID(ctx context.Context, sipCallID string) ([]entity.CallEvent, error) {
+	return nil, nil
+}
+
 // DeleteCall deletes a call record from MongoDB
 func (r *MongoRepository) DeleteCall(ctx context.Context, id string) error {
 	return nil
@@ -111,6 +128,18 @@ func (r *MongoRepository) GetRecordsByCallIDs(ctx context.Context, callIDs []str
 	return nil, nil
 }
 
+func (r *MongoRepository) GetCallsBySIPCallIDs(ctx context.Context, sipCallIDs []string) ([]entity.Call, error) {
+	return nil, nil
+}
+
+func (r *MongoRepository) GetCallLinksBySIPCallIDs(ctx context.Context, sipCallIDs []string) ([]entity.CallLink, error) {
+	return nil, nil
+}
+
+func (r *MongoRepository) GetCallLinksByValues(ctx context.Context, values []string) ([]entity.CallLink, error) {
+	return nil, nil
+}
+
 func (r *MongoRepository) GetCallIDsBySessionID(ctx context.Context, sessionID string) ([]string, error) {
 
 	return nil, nil
@@ -124,6 +153,10 @@ func (r *MongoRepository) GetRecordRawByID(ctx context.Context, id int64) (*enti
 	return nil, nil
 }
 
+func (r *MongoRepository) GetRecordRawsByIDs(ctx context.Context, ids []int64) ([]entity.RecordRaw, error) {
+	return nil, nil
+}
+
 func (r *MongoRepository) DeleteRecordRaw(ctx context.Context, id int64) error {
 
 	return nil
@@ -148,6 +181,135 @@ func (r *MongoRepository) GetCallStat(ctx context.Context, params entity.CallSta
 	return nil, nil
 }
 
+// IterateCallStatRows reads the statistic fields of the calls created in the time range
+func (r *MongoRepository) IterateCallStatRows(ctx context.Context, beginTime, endTime time.Time, fn func(row entity.CallStatRow) error) error {
+	// MOS取呼叫的RTCP报告中的最大值，与SQL实现一致
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"create_time": bson.M{"$gte": beginTime, "$lt": endTime}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "rtcp_report",
+			"localField":   "sip_call_id",
+			"foreignField": "sip_call_id",
+			"as":           "rtcp",
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"create_time": 1, "ringing_time": 1, "answer_time": 1, "end_time": 1,
+			"talk_duration": 1, "hangup_code": 1, "src_addr": 1, "dst_addr": 1, "node_ip": 1,
+			"aleg_mos": bson.M{"$ifNull": bson.A{bson.M{"$max": "$rtcp.aleg_mos"}, 0}},
+			"bleg_mos": bson.M{"$ifNull": bson.A{bson.M{"$max": "$rtcp.bleg_mos"}, 0}},
+		}}},
+	}
+	cursor, err := r.recordCallCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var row entity.CallStatRow
+		if err := cursor.Decode(&row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// IncrCallRollups increments the rollup documents, inserting the missing ones
+func (r *MongoRepository) IncrCallRollups(ctx context.Context, rollups []entity.CallRollup) error {
+	for _, rollup := range rollups {
+		filter := bson.M{
+			"granularity":  rollup.Granularity,
+			"bucket_time":  rollup.BucketTime,
+			"gateway_id":   rollup.GatewayID,
+			"direction":    rollup.Direction,
+			"hangup_class": rollup.HangupClass,
+		}
+		update := bson.M{"$inc": bson.M{
+			"total":        rollup.Total,
+			"answered":     rollup.Answered,
+			"effective":    rollup.Effective,
+			"talk_seconds": rollup.TalkSeconds,
+			"pdd_ms_sum":   rollup.PDDMsSum,
+			"pdd_count":    rollup.PDDCount,
+			"ring_ms_sum":  rollup.RingMsSum,
+			"ring_count":   rollup.RingCount,
+			"mos_sum":      rollup.MosSum,
+			"mos_count":    rollup.MosCount,
+		}}
+		_, err := r.callRollupCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCallRollups retrieves the rollups of a granularity in the time range
+func (r *MongoRepository) GetCallRollups(ctx context.Context, granularity string, beginTime, endTime time.Time) ([]entity.CallRollup, error) {
+	filter := bson.M{
+		"granularity": granularity,
+		"bucket_time": bson.M{"$gte": beginTime, "$lt": endTime},
+	}
+	cursor, err := r.callRollupCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var rollups []entity.CallRollup
+	if err := cursor.All(ctx, &rollups); err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
+
+// DeleteCallRollups deletes the rollups and concurrency peaks of every granularity in the time range
+func (r *MongoRepository) DeleteCallRollups(ctx context.Context, beginTime, endTime time.Time) error {
+	filter := bson.M{"bucket_time": bson.M{"$gte": beginTime, "$lt": endTime}}
+	if _, err := r.callRollupCollection.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+	_, err := r.concurrencyCollection.DeleteMany(ctx, filter)
+	return err
+}
+
+// MaxConcurrencyRollups upserts the concurrency peaks, keeping the larger peak
+func (r *MongoRepository) MaxConcurrencyRollups(ctx context.Context, rollups []entity.ConcurrencyRollup) error {
+	for _, rollup := range rollups {
+		filter := bson.M{
+			"granularity": rollup.Granularity,
+			"bucket_time": rollup.BucketTime,
+			"group_by":    rollup.GroupBy,
+			"group_key":   rollup.GroupKey,
+		}
+		update := bson.M{"$max": bson.M{"peak": rollup.Peak}}
+		_, err := r.concurrencyCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetConcurrencyRollups retrieves the concurrency peaks of a granularity and group dimension in the time range
+func (r *MongoRepository) GetConcurrencyRollups(ctx context.Context, granularity, groupBy string, beginTime, endTime time.Time) ([]entity.ConcurrencyRollup, error) {
+	filter := bson.M{
+		"granularity": granularity,
+		"group_by":    groupBy,
+		"bucket_time": bson.M{"$gte": beginTime, "$lt": endTime},
+	}
+	cursor, err := r.concurrencyCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var rollups []entity.ConcurrencyRollup
+	if err := cursor.All(ctx, &rollups); err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
+
 func (r *MongoRepository) GatewayCreate(gateway *entity.Gateway) error {
 	return nil
 }
@@ -176,6 +338,98 @@ func (r *MongoRepository) GatewayGetByAddr(addr string) (*entity.Gateway, error)
 	return nil, nil
 }
 
+// Carrier operations
+
+func (r *MongoRepository) CarrierCreate(carrier *entity.Carrier) error {
+	return nil
+}
+
+func (r *MongoRepository) CarrierGetByID(id int64) (*entity.Carrier, error) {
+	return nil, nil
+}
+
+func (r *MongoRepository) CarrierList() ([]entity.Carrier, error) {
+	return nil, nil
+}
+
+func (r *MongoRepository) CarrierUpdate(carrier *entity.Carrier) error {
+	return nil
+}
+
+func (r *MongoRepository) CarrierDelete(id int64) error {
+	return nil
+}
+
+// Ingest filter rule operations
+
+func (r *MongoRepository) FilterRuleCreate(rule *entity.FilterRule) error {
+	return nil
+}
+
+func (r *MongoRepository) FilterRuleGetByID(id int64) (*entity.FilterRule, error) {
+	return nil, nil
+}
+
+func (r *MongoRepository) FilterRuleList() ([]entity.FilterRule, error) {
+	return nil, nil
+}
+
+func (r *MongoRepository) FilterRuleUpdate(rule *entity.FilterRule) error {
+	return nil
+}
+
+func (r *MongoRepository) FilterRuleDelete(id int64) error {
+	return nil
+}
+
+// Alert operations
+
+func (r *MongoRepository) AlertRuleCreate(rule *entity.AlertRule) error {
+	return nil
+}
+
+func (r *MongoRepository) AlertRuleGetByID(id int64) (*entity.AlertRule, error) {
+	return nil, nil
+}
+
+func (r *MongoRepository) AlertRuleList() ([]entity.AlertRule, error) {
+	return nil, nil
+}
+
+func (r *MongoRepository) AlertRuleUpdate(rule *entity.AlertRule) error {
+	return nil
+}
+
+func (r *MongoRepository) AlertRuleSilence(id int64, until *time.Time) error {
+	return nil
+}
+
+func (r *MongoRepository) AlertRuleDelete(id int64) error {
+	return nil
+}
+
+func (r *MongoRepository) CreateAlertHistory(ctx context.Context, history *entity.AlertHistory) error {
+	return nil
+}
+
+func (r *MongoRepository) GetAlertHistoryList(ctx context.Context, params entity.AlertHistoryDTO) ([]entity.AlertHistory, *entity.Meta, error) {
+	return nil, nil, nil
+}
+
+// Trunk health operations
+
+func (r *MongoRepository) CreateTrunkStateHistory(ctx context.Context, history *entity.TrunkStateHistory) error {
+	return nil
+}
+
+func (r *MongoRepository) GetTrunkStateHistory(ctx context.Context, gatewayID int64, beginTime, endTime time.Time) ([]entity.TrunkStateHistory, error) {
+	return nil, nil
+}
+
+func (r *MongoRepository) GetLastTrunkStateBefore(ctx context.Context, gatewayID int64, before time.Time) (*entity.TrunkStateHistory, error) {
+	return nil, nil
+}
+
 // RTCP Report operations
 
 func (r *MongoRepository) CreateRtcpReportRaws(ctx context.Context, records []*entity.RtcpReportRaw) error {
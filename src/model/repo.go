@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"sip-monitor/src/entity"
+	"time"
 )
 
 // Repository defines the interface for database operations
@@ -10,6 +11,7 @@ type Repository interface {
 	// Record raw operations
 	CreateRecordRaw(ctx context.Context, record *entity.RecordRaw) error
 	GetRecordRawByID(ctx context.Context, id int64) (*entity.RecordRaw, error)
+	GetRecordRawsByIDs(ctx context.Context, ids []int64) ([]entity.RecordRaw, error)
 	DeleteRecordRaw(ctx context.Context, id int64) error
 
 	// Record operations
@@ -22,7 +24,14 @@ type Repository interface {
 	GetCallByID(ctx context.Context, id string) (*entity.Call, error)
 	GetCallBySIPCallID(ctx context.Context, sipCallID string) (*entity.Call, error)
 	GetCallIDsBySessionID(ctx context.Context, sessionID string) ([]string, error)
+	GetCallsBySIPCallIDs(ctx context.Context, sipCallIDs []string) ([]entity.Call, error)
+	// 呼叫腿的关联键
+	GetCallLinksBySIPCallIDs(ctx context.Context, sipCallIDs []string) ([]entity.CallLink, error)
+	GetCallLinksByValues(ctx context.Context, values []string) ([]entity.CallLink, error)
 	GetCallList(ctx context.Context, params entity.SearchParams) ([]entity.Call, *entity.Meta, error)
+	// IterateCalls 分批读取符合条件的全部呼叫，用于导出
+	IterateCalls(ctx context.Context, params entity.SearchParams, batchSize int, fn func(calls []entity.Call) error) error
+	GetCallEventsBySIPCallID(ctx context.Context, sipCallID string) ([]entity.CallEvent, error)
 	DeleteCall(ctx context.Context, id string) error
 
 	// User operations
@@ -35,6 +44,16 @@ type Repository interface {
 	CreateDefaultAdminUser(ctx context.Context) error
 
 	GetCallStat(ctx context.Context, params entity.CallStatDTO) ([]*entity.CallStatVO, error)
+	IterateCallStatRows(ctx context.Context, beginTime, endTime time.Time, fn func(row entity.CallStatRow) error) error
+
+	// 呼叫汇总表
+	IncrCallRollups(ctx context.Context, rollups []entity.CallRollup) error
+	GetCallRollups(ctx context.Context, granularity string, beginTime, endTime time.Time) ([]entity.CallRollup, error)
+	// DeleteCallRollups 删除时间段内的呼叫汇总和并发峰值汇总
+	DeleteCallRollups(ctx context.Context, beginTime, endTime time.Time) error
+	// MaxConcurrencyRollups 写入并发峰值，已有的峰值取较大的一个
+	MaxConcurrencyRollups(ctx context.Context, rollups []entity.ConcurrencyRollup) error
+	GetConcurrencyRollups(ctx context.Context, granularity, groupBy string, beginTime, endTime time.Time) ([]entity.ConcurrencyRollup, error)
 
 	// Create 创建网关
 	GatewayCreate(gateway *entity.Gateway) error
@@ -51,6 +70,39 @@ type Repository interface {
 	// GetByAddr 根据地址获取网关
 	GatewayGetByAddr(addr string) (*entity.Gateway, error)
 
+	// 运营商
+	CarrierCreate(carrier *entity.Carrier) error
+	CarrierGetByID(id int64) (*entity.Carrier, error)
+	CarrierList() ([]entity.Carrier, error)
+	CarrierUpdate(carrier *entity.Carrier) error
+	// CarrierDelete 删除运营商，并解除其网关的归属
+	CarrierDelete(id int64) error
+
+	// 入库过滤规则
+	FilterRuleCreate(rule *entity.FilterRule) error
+	FilterRuleGetByID(id int64) (*entity.FilterRule, error)
+	FilterRuleList() ([]entity.FilterRule, error)
+	FilterRuleUpdate(rule *entity.FilterRule) error
+	FilterRuleDelete(id int64) error
+
+	// 告警规则
+	AlertRuleCreate(rule *entity.AlertRule) error
+	AlertRuleGetByID(id int64) (*entity.AlertRule, error)
+	AlertRuleList() ([]entity.AlertRule, error)
+	AlertRuleUpdate(rule *entity.AlertRule) error
+	// AlertRuleSilence 设置规则的静默截止时间，nil表示取消静默
+	AlertRuleSilence(id int64, until *time.Time) error
+	AlertRuleDelete(id int64) error
+
+	// 告警历史
+	CreateAlertHistory(ctx context.Context, history *entity.AlertHistory) error
+	GetAlertHistoryList(ctx context.Context, params entity.AlertHistoryDTO) ([]entity.AlertHistory, *entity.Meta, error)
+
+	// 中继健康状态变化
+	CreateTrunkStateHistory(ctx context.Context, history *entity.TrunkStateHistory) error
+	GetTrunkStateHistory(ctx context.Context, gatewayID int64, beginTime, endTime time.Time) ([]entity.TrunkStateHistory, error)
+	GetLastTrunkStateBefore(ctx context.Context, gatewayID int64, before time.Time) (*entity.TrunkStateHistory, error)
+
 	// RTCP Report operations
 	CreateRtcpReportRaw(ctx context.Context, record *entity.RtcpReportRaw) error
 	CreateRtcpReportRaws(ctx context.Context, records []*entity.RtcpReportRaw) error
@@ -0,0 +1,83 @@
+package sql
+
+import (
+	"context"
+	"sip-monitor/src/entity"
+	"time"
+)
+
+func (r *GormRepository) AlertRuleCreate(rule *entity.AlertRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *GormRepository) AlertRuleGetByID(id int64) (*entity.AlertRule, error) {
+	var rule entity.AlertRule
+	err := r.db.Where("id = ?", id).First(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *GormRepository) AlertRuleList() ([]entity.AlertRule, error) {
+	var rules []entity.AlertRule
+	err := r.db.Order("id").Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (r *GormRepository) AlertRuleUpdate(rule *entity.AlertRule) error {
+	return r.db.Select("Name", "Enabled", "Metric", "GatewayID", "NodeIP", "Operator", "Threshold", "Hysteresis",
+		"WindowSeconds", "MinSamples", "Notifiers", "Remark", "UpdateAt").Save(rule).Error
+}
+
+func (r *GormRepository) AlertRuleSilence(id int64, until *time.Time) error {
+	return r.db.Model(&entity.AlertRule{}).Where("id = ?", id).Update("silence_until", until).Error
+}
+
+func (r *GormRepository) AlertRuleDelete(id int64) error {
+	return r.db.Delete(&entity.AlertRule{}, id).Error
+}
+
+func (r *GormRepository) CreateAlertHistory(ctx context.Context, history *entity.AlertHistory) error {
+	return r.db.WithContext(ctx).Create(history).Error
+}
+
+// GetAlertHistoryList 分页查询告警历史，按时间倒序
+func (r *GormRepository) GetAlertHistoryList(ctx context.Context, params entity.AlertHistoryDTO) ([]entity.AlertHistory, *entity.Meta, error) {
+	query := r.db.WithContext(ctx).Model(&entity.AlertHistory{})
+	if params.RuleID > 0 {
+		query = query.Where("rule_id = ?", params.RuleID)
+	}
+	if params.State != "" {
+		query = query.Where("state = ?", params.State)
+	}
+	if params.BeginTime != nil {
+		query = query.Where("create_time >= ?", params.BeginTime)
+	}
+	if params.EndTime != nil {
+		query = query.Where("create_time <= ?", params.EndTime)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 20
+	}
+	var histories []entity.AlertHistory
+	err := query.Order("create_time DESC").Order("id DESC").
+		Offset(int((params.Page - 1) * params.PageSize)).Limit(int(params.PageSize)).
+		Find(&histories).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return histories, &entity.Meta{Page: params.Page, PageSize: params.PageSize, Total: total}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sip-monitor/src/entity"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -23,7 +24,121 @@ func (r *GormRepository) CreateCall(ctx context.Context, record *entity.Call) er
 		now := time.Now()
 		record.CreateTime = &now
 	}
-	return r.db.WithContext(ctx).Create(record).Error
+	if len(record.Attributes) == 0 && len(record.Events) == 0 && len(record.Links) == 0 {
+		return r.db.WithContext(ctx).Create(record).Error
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		if len(record.Attributes) > 0 {
+			attributes := make([]*entity.CallAttribute, 0, len(record.Attributes))
+			for name, value := range record.Attributes {
+				attributes = append(attributes, &entity.CallAttribute{
+					SIPCallID:  record.SIPCallID,
+					Name:       name,
+					Value:      value,
+					CreateTime: record.CreateTime,
+				})
+			}
+			if err := tx.Create(attributes).Error; err != nil {
+				return err
+			}
+		}
+		if len(record.Events) > 0 {
+			for i := range record.Events {
+				record.Events[i].SIPCallID = record.SIPCallID
+			}
+			if err := tx.Create(&record.Events).Error; err != nil {
+				return err
+			}
+		}
+		if len(record.Links) > 0 {
+			for i := range record.Links {
+				record.Links[i].SIPCallID = record.SIPCallID
+				record.Links[i].CreateTime = record.CreateTime
+			}
+			if err := tx.Create(&record.Links).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *GormRepository) GetCallsBySIPCallIDs(ctx context.Context, sipCallIDs []string) ([]entity.Call, error) {
+	var records []entity.Call
+	if len(sipCallIDs) == 0 {
+		return records, nil
+	}
+	err := r.db.WithContext(ctx).Where("sip_call_id IN ?", sipCallIDs).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (r *GormRepository) GetCallLinksBySIPCallIDs(ctx context.Context, sipCallIDs []string) ([]entity.CallLink, error) {
+	var links []entity.CallLink
+	if len(sipCallIDs) == 0 {
+		return links, nil
+	}
+	err := r.db.WithContext(ctx).Where("sip_call_id IN ?", sipCallIDs).Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (r *GormRepository) GetCallLinksByValues(ctx context.Context, values []string) ([]entity.CallLink, error) {
+	var links []entity.CallLink
+	if len(values) == 0 {
+		return links, nil
+	}
+	err := r.db.WithContext(ctx).Where("value IN ?", values).Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (r *GormRepository) GetCallEventsBySIPCallID(ctx context.Context, sipCallID string) ([]entity.CallEvent, error) {
+	var events []entity.CallEvent
+	err := r.db.WithContext(ctx).Where("sip_call_id = ?", sipCallID).Order("timestamp_micro").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// fillCallAttributes 查询并填充呼叫的自定义属性
+func (r *GormRepository) fillCallAttributes(ctx context.Context, records []entity.Call) error {
+	if len(records) == 0 {
+		return nil
+	}
+	sipCallIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		sipCallIDs = append(sipCallIDs, record.SIPCallID)
+	}
+
+	var attributes []entity.CallAttribute
+	err := r.db.WithContext(ctx).Where("sip_call_id IN ?", sipCallIDs).Find(&attributes).Error
+	if err != nil {
+		return err
+	}
+
+	attributeMap := make(map[string]map[string]string)
+	for _, attribute := range attributes {
+		if attributeMap[attribute.SIPCallID] == nil {
+			attributeMap[attribute.SIPCallID] = make(map[string]string)
+		}
+		attributeMap[attribute.SIPCallID][attribute.Name] = attribute.Value
+	}
+	for i := range records {
+		records[i].Attributes = attributeMap[records[i].SIPCallID]
+	}
+	return nil
 }
 
 func (r *GormRepository) GetCallByID(ctx context.Context, id string) (*entity.Call, error) {
@@ -35,7 +150,11 @@ func (r *GormRepository) GetCallByID(ctx context.Context, id string) (*entity.Ca
 		}
 		return nil, err
 	}
-	return &record, nil
+	records := []entity.Call{record}
+	if err := r.fillCallAttributes(ctx, records); err != nil {
+		return nil, err
+	}
+	return &records[0], nil
 }
 
 func (r *GormRepository) GetCallBySIPCallID(ctx context.Context, sipCallID string) (*entity.Call, error) {
@@ -44,13 +163,15 @@ func (r *GormRepository) GetCallBySIPCallID(ctx context.Context, sipCallID strin
 	if err != nil {
 		return nil, err
 	}
-	return &record, nil
+	records := []entity.Call{record}
+	if err := r.fillCallAttributes(ctx, records); err != nil {
+		return nil, err
+	}
+	return &records[0], nil
 }
 
-func (r *GormRepository) GetCallList(ctx context.Context, params entity.SearchParams) ([]entity.Call, *entity.Meta, error) {
-	var records []entity.Call
-	var totalCount int64
-
+// callListQuery 按查询条件构造呼叫查询，列表和导出共用
+func (r *GormRepository) callListQuery(ctx context.Context, params entity.SearchParams) *gorm.DB {
 	query := r.db.WithContext(ctx)
 
 	if params.BeginTime != nil && params.EndTime != nil {
@@ -73,6 +194,22 @@ func (r *GormRepository) GetCallList(ctx context.Context, params entity.SearchPa
 		query = query.Where("to_user LIKE ?", "%"+params.ToUser+"%")
 	}
 
+	if params.AssertedUser != "" {
+		query = query.Where("asserted_user LIKE ?", "%"+params.AssertedUser+"%")
+	}
+
+	if params.OriginalCalledUser != "" {
+		query = query.Where("original_called_user LIKE ?", "%"+params.OriginalCalledUser+"%")
+	}
+
+	if params.DiversionReason != "" {
+		query = query.Where("diversion_reason = ?", params.DiversionReason)
+	}
+
+	if params.Privacy != "" {
+		query = query.Where("privacy LIKE ?", "%"+params.Privacy+"%")
+	}
+
 	if params.SrcHost != "" {
 		query = query.Where("src_addr = ?", params.SrcHost)
 	}
@@ -85,6 +222,43 @@ func (r *GormRepository) GetCallList(ctx context.Context, params entity.SearchPa
 		query = query.Where("hangup_code = ?", params.HangupCode)
 	}
 
+	if params.IngressGatewayID > 0 {
+		query = query.Where("ingress_gateway_id = ?", params.IngressGatewayID)
+	}
+
+	if params.EgressGatewayID > 0 {
+		query = query.Where("egress_gateway_id = ?", params.EgressGatewayID)
+	}
+
+	if params.Direction != "" {
+		query = query.Where("direction = ?", params.Direction)
+	}
+
+	if params.Transport != "" {
+		query = query.Where("transport = ?", strings.ToLower(params.Transport))
+	}
+
+	if params.WebRTC != nil {
+		query = query.Where("webrtc = ?", *params.WebRTC)
+	}
+
+	for name, value := range params.AttributeFilters() {
+		subQuery := r.db.Model(&entity.CallAttribute{}).Select("sip_call_id").Where("name = ?", name)
+		if value != "" {
+			subQuery = subQuery.Where("value = ?", value)
+		}
+		query = query.Where("sip_call_id IN (?)", subQuery)
+	}
+
+	return query
+}
+
+func (r *GormRepository) GetCallList(ctx context.Context, params entity.SearchParams) ([]entity.Call, *entity.Meta, error) {
+	var records []entity.Call
+	var totalCount int64
+
+	query := r.callListQuery(ctx, params)
+
 	// Count total records
 	err := query.Model(&entity.Call{}).Count(&totalCount).Error
 	if err != nil {
@@ -115,12 +289,45 @@ func (r *GormRepository) GetCallList(ctx context.Context, params entity.SearchPa
 		return nil, nil, err
 	}
 
+	err = r.fillCallAttributes(ctx, records)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Calculate pagination metadata
 	meta := r.calculatePagination(totalCount, int(params.Page), int(params.PageSize))
 
 	return records, meta, nil
 }
 
+// IterateCalls 按ID顺序分批读取符合条件的呼叫，每批填充自定义属性后回调，避免一次性加载全部呼叫
+func (r *GormRepository) IterateCalls(ctx context.Context, params entity.SearchParams, batchSize int, fn func(calls []entity.Call) error) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	var lastID int64
+	for {
+		var records []entity.Call
+		err := r.callListQuery(ctx, params).Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&records).Error
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		if err := r.fillCallAttributes(ctx, records); err != nil {
+			return err
+		}
+		if err := fn(records); err != nil {
+			return err
+		}
+		if len(records) < batchSize {
+			return nil
+		}
+		lastID = records[len(records)-1].ID
+	}
+}
+
 func (r *GormRepository) DeleteCall(ctx context.Context, id string) error {
 	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&entity.Call{}).Error
 }
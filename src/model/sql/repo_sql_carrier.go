@@ -0,0 +1,42 @@
+package sql
+
+import (
+	"sip-monitor/src/entity"
+
+	"gorm.io/gorm"
+)
+
+func (r *GormRepository) CarrierCreate(carrier *entity.Carrier) error {
+	return r.db.Create(carrier).Error
+}
+
+func (r *GormRepository) CarrierGetByID(id int64) (*entity.Carrier, error) {
+	var carrier entity.Carrier
+	err := r.db.Where("id = ?", id).First(&carrier).Error
+	if err != nil {
+		return nil, err
+	}
+	return &carrier, nil
+}
+
+func (r *GormRepository) CarrierList() ([]entity.Carrier, error) {
+	var carriers []entity.Carrier
+	err := r.db.Order("id").Find(&carriers).Error
+	if err != nil {
+		return nil, err
+	}
+	return carriers, nil
+}
+
+func (r *GormRepository) CarrierUpdate(carrier *entity.Carrier) error {
+	return r.db.Select("Name", "Remark", "MinASR", "MaxPDDMs", "MinMOS", "UpdateAt").Save(carrier).Error
+}
+
+func (r *GormRepository) CarrierDelete(id int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.Gateway{}).Where("carrier_id = ?", id).Update("carrier_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entity.Carrier{}, id).Error
+	})
+}
@@ -0,0 +1,36 @@
+package sql
+
+import (
+	"sip-monitor/src/entity"
+)
+
+func (r *GormRepository) FilterRuleCreate(rule *entity.FilterRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *GormRepository) FilterRuleGetByID(id int64) (*entity.FilterRule, error) {
+	var rule entity.FilterRule
+	err := r.db.Where("id = ?", id).First(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *GormRepository) FilterRuleList() ([]entity.FilterRule, error) {
+	var rules []entity.FilterRule
+	err := r.db.Order("priority").Order("id").Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (r *GormRepository) FilterRuleUpdate(rule *entity.FilterRule) error {
+	return r.db.Select("Name", "Enabled", "Priority", "Methods", "ResponseCodes", "SrcCIDR", "DstCIDR",
+		"UserAgent", "FromUser", "ToUser", "NodeID", "Action", "SampleRate", "Remark", "UpdateAt").Save(rule).Error
+}
+
+func (r *GormRepository) FilterRuleDelete(id int64) error {
+	return r.db.Delete(&entity.FilterRule{}, id).Error
+}
@@ -2,10 +2,17 @@ package sql
 
 import (
 	"sip-monitor/src/entity"
+
+	"gorm.io/gorm"
 )
 
 func (r *GormRepository) GatewayCreate(gateway *entity.Gateway) error {
-	return r.db.Create(gateway).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(gateway).Error; err != nil {
+			return err
+		}
+		return createGatewayAddrs(tx, gateway)
+	})
 }
 
 func (r *GormRepository) GatewayGetByID(id int64) (*entity.Gateway, error) {
@@ -14,6 +21,9 @@ func (r *GormRepository) GatewayGetByID(id int64) (*entity.Gateway, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := r.loadGatewayAddrs([]*entity.Gateway{&gateway}); err != nil {
+		return nil, err
+	}
 	return &gateway, nil
 }
 
@@ -23,15 +33,37 @@ func (r *GormRepository) GatewayList() ([]entity.Gateway, error) {
 	if err != nil {
 		return nil, err
 	}
+	items := make([]*entity.Gateway, len(gateways))
+	for i := range gateways {
+		items[i] = &gateways[i]
+	}
+	if err := r.loadGatewayAddrs(items); err != nil {
+		return nil, err
+	}
 	return gateways, nil
 }
 
+// GatewayUpdate 更新网关，地址规则整体替换
 func (r *GormRepository) GatewayUpdate(gateway *entity.Gateway) error {
-	return r.db.Select("Name", "Addr", "Remark", "UpdateAt").Save(gateway).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Select("Name", "Remark", "MaxChannels", "CarrierID", "UpdateAt").Save(gateway).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("gateway_id = ?", gateway.ID).Delete(&entity.GatewayAddr{}).Error; err != nil {
+			return err
+		}
+		return createGatewayAddrs(tx, gateway)
+	})
 }
 
 func (r *GormRepository) GatewayDelete(id int64) error {
-	return r.db.Delete(&entity.Gateway{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("gateway_id = ?", id).Delete(&entity.GatewayAddr{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entity.Gateway{}, id).Error
+	})
 }
 
 func (r *GormRepository) GatewayGetByName(name string) (*entity.Gateway, error) {
@@ -40,14 +72,54 @@ func (r *GormRepository) GatewayGetByName(name string) (*entity.Gateway, error)
 	if err != nil {
 		return nil, err
 	}
+	if err := r.loadGatewayAddrs([]*entity.Gateway{&gateway}); err != nil {
+		return nil, err
+	}
 	return &gateway, nil
 }
 
+// GatewayGetByAddr 查找包含该地址规则的网关
 func (r *GormRepository) GatewayGetByAddr(addr string) (*entity.Gateway, error) {
-	var gateway entity.Gateway
-	err := r.db.Where("addr = ?", addr).First(&gateway).Error
+	var gatewayAddr entity.GatewayAddr
+	err := r.db.Where("pattern = ?", addr).First(&gatewayAddr).Error
 	if err != nil {
 		return nil, err
 	}
-	return &gateway, nil
+	return r.GatewayGetByID(gatewayAddr.GatewayID)
+}
+
+func createGatewayAddrs(tx *gorm.DB, gateway *entity.Gateway) error {
+	if len(gateway.Addrs) == 0 {
+		return nil
+	}
+	addrs := make([]entity.GatewayAddr, 0, len(gateway.Addrs))
+	for _, pattern := range gateway.Addrs {
+		addrs = append(addrs, entity.GatewayAddr{GatewayID: gateway.ID, Pattern: pattern})
+	}
+	return tx.Create(&addrs).Error
+}
+
+// loadGatewayAddrs 按写入顺序加载网关的地址规则
+func (r *GormRepository) loadGatewayAddrs(gateways []*entity.Gateway) error {
+	if len(gateways) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(gateways))
+	byID := make(map[int64]*entity.Gateway, len(gateways))
+	for _, gateway := range gateways {
+		gateway.Addrs = make([]string, 0)
+		ids = append(ids, gateway.ID)
+		byID[gateway.ID] = gateway
+	}
+
+	var addrs []entity.GatewayAddr
+	if err := r.db.Where("gateway_id IN ?", ids).Order("id").Find(&addrs).Error; err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if gateway, ok := byID[addr.GatewayID]; ok {
+			gateway.Addrs = append(gateway.Addrs, addr.Pattern)
+		}
+	}
+	return nil
 }
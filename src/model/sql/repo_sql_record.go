@@ -25,6 +25,18 @@ func (r *GormRepository) GetRecordRawByID(ctx context.Context, id int64) (*entit
 	return &record, nil
 }
 
+func (r *GormRepository) GetRecordRawsByIDs(ctx context.Context, ids []int64) ([]entity.RecordRaw, error) {
+	var records []entity.RecordRaw
+	if len(ids) == 0 {
+		return records, nil
+	}
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
 func (r *GormRepository) DeleteRecordRaw(ctx context.Context, id int64) error {
 	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&entity.RecordRaw{}).Error
 }
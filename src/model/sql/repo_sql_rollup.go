@@ -0,0 +1,102 @@
+package sql
+
+import (
+	"context"
+	"sip-monitor/src/entity"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IncrCallRollups 累加汇总行，不存在时插入
+func (r *GormRepository) IncrCallRollups(ctx context.Context, rollups []entity.CallRollup) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range rollups {
+			rollup := rollups[i]
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{
+					{Name: "granularity"}, {Name: "bucket_time"}, {Name: "gateway_id"}, {Name: "direction"}, {Name: "hangup_class"},
+				},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"total":        gorm.Expr("call_rollups.total + ?", rollup.Total),
+					"answered":     gorm.Expr("call_rollups.answered + ?", rollup.Answered),
+					"effective":    gorm.Expr("call_rollups.effective + ?", rollup.Effective),
+					"talk_seconds": gorm.Expr("call_rollups.talk_seconds + ?", rollup.TalkSeconds),
+					"pdd_ms_sum":   gorm.Expr("call_rollups.pdd_ms_sum + ?", rollup.PDDMsSum),
+					"pdd_count":    gorm.Expr("call_rollups.pdd_count + ?", rollup.PDDCount),
+					"ring_ms_sum":  gorm.Expr("call_rollups.ring_ms_sum + ?", rollup.RingMsSum),
+					"ring_count":   gorm.Expr("call_rollups.ring_count + ?", rollup.RingCount),
+					"mos_sum":      gorm.Expr("call_rollups.mos_sum + ?", rollup.MosSum),
+					"mos_count":    gorm.Expr("call_rollups.mos_count + ?", rollup.MosCount),
+				}),
+			}).Create(&rollup).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *GormRepository) GetCallRollups(ctx context.Context, granularity string, beginTime, endTime time.Time) ([]entity.CallRollup, error) {
+	var rollups []entity.CallRollup
+	err := r.db.WithContext(ctx).
+		Where("granularity = ? AND bucket_time >= ? AND bucket_time < ?", granularity, beginTime, endTime).
+		Find(&rollups).Error
+	if err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
+
+// DeleteCallRollups 删除时间段内所有粒度的汇总和并发峰值，用于重建
+func (r *GormRepository) DeleteCallRollups(ctx context.Context, beginTime, endTime time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("bucket_time >= ? AND bucket_time < ?", beginTime, endTime).
+			Delete(&entity.CallRollup{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("bucket_time >= ? AND bucket_time < ?", beginTime, endTime).
+			Delete(&entity.ConcurrencyRollup{}).Error
+	})
+}
+
+// MaxConcurrencyRollups 写入并发峰值，不存在时插入，已存在时保留较大的峰值
+func (r *GormRepository) MaxConcurrencyRollups(ctx context.Context, rollups []entity.ConcurrencyRollup) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range rollups {
+			rollup := rollups[i]
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{
+					{Name: "granularity"}, {Name: "bucket_time"}, {Name: "group_by"}, {Name: "group_key"},
+				},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"peak": gorm.Expr("CASE WHEN call_concurrency_rollups.peak < ? THEN ? ELSE call_concurrency_rollups.peak END", rollup.Peak, rollup.Peak),
+				}),
+			}).Create(&rollup).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *GormRepository) GetConcurrencyRollups(ctx context.Context, granularity, groupBy string, beginTime, endTime time.Time) ([]entity.ConcurrencyRollup, error) {
+	var rollups []entity.ConcurrencyRollup
+	err := r.db.WithContext(ctx).
+		Where("granularity = ? AND group_by = ? AND bucket_time >= ? AND bucket_time < ?", granularity, groupBy, beginTime, endTime).
+		Find(&rollups).Error
+	if err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
@@ -3,6 +3,7 @@ package sql
 import (
 	"context"
 	"sip-monitor/src/entity"
+	"time"
 )
 
 func (r *GormRepository) GetCallStat(ctx context.Context, params entity.CallStatDTO) ([]*entity.CallStatVO, error) {
@@ -25,3 +26,28 @@ func (r *GormRepository) GetCallStat(ctx context.Context, params entity.CallStat
 	}
 	return result, nil
 }
+
+// IterateCallStatRows 逐行读取时间段内呼叫的统计字段，避免一次性加载全部呼叫
+func (r *GormRepository) IterateCallStatRows(ctx context.Context, beginTime, endTime time.Time, fn func(row entity.CallStatRow) error) error {
+	rows, err := r.db.WithContext(ctx).Model(&entity.Call{}).
+		Select("create_time, ringing_time, answer_time, end_time, talk_duration, hangup_code, src_addr, dst_addr, node_ip, "+
+			"(SELECT MAX(aleg_mos) FROM rtcp_report WHERE rtcp_report.sip_call_id = call_records_call.sip_call_id) AS aleg_mos, "+
+			"(SELECT MAX(bleg_mos) FROM rtcp_report WHERE rtcp_report.sip_call_id = call_records_call.sip_call_id) AS bleg_mos").
+		Where("create_time >= ? AND create_time < ?", beginTime, endTime).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row entity.CallStatRow
+		if err := r.db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,43 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"sip-monitor/src/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r *GormRepository) CreateTrunkStateHistory(ctx context.Context, history *entity.TrunkStateHistory) error {
+	return r.db.WithContext(ctx).Create(history).Error
+}
+
+// GetTrunkStateHistory 获取网关在时间段内的状态变化，按时间排序
+func (r *GormRepository) GetTrunkStateHistory(ctx context.Context, gatewayID int64, beginTime, endTime time.Time) ([]entity.TrunkStateHistory, error) {
+	var histories []entity.TrunkStateHistory
+	err := r.db.WithContext(ctx).
+		Where("gateway_id = ? AND create_time >= ? AND create_time <= ?", gatewayID, beginTime, endTime).
+		Order("create_time").Order("id").
+		Find(&histories).Error
+	if err != nil {
+		return nil, err
+	}
+	return histories, nil
+}
+
+// GetLastTrunkStateBefore 获取网关在指定时间之前的最后一次状态变化，不存在时返回nil
+func (r *GormRepository) GetLastTrunkStateBefore(ctx context.Context, gatewayID int64, before time.Time) (*entity.TrunkStateHistory, error) {
+	var history entity.TrunkStateHistory
+	err := r.db.WithContext(ctx).
+		Where("gateway_id = ? AND create_time < ?", gatewayID, before).
+		Order("create_time DESC").Order("id DESC").
+		First(&history).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &history, nil
+}
@@ -0,0 +1,150 @@
+package hep
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+)
+
+/*
+ Vendor IDs (HEP3 rev12, section 3)
+
+    0x0000  generic chunks
+    0x0001  FreeSWITCH
+    0x0002  Kamailio / SER
+    0x0003  OpenSIPS
+    0x0004  Asterisk
+    0x0005  Homer
+    0x0006  SipXecs
+
+ Chunk types are defined per vendor, so a vendor chunk is only decoded when
+ a decoder is registered for its vendor and type.
+
+*/
+
+// ChunkKey identifies a chunk type of a vendor.
+type ChunkKey struct {
+	Vendor uint16
+	Type   uint16
+}
+
+func (k ChunkKey) String() string {
+	return fmt.Sprintf("0x%04x:0x%04x", k.Vendor, k.Type)
+}
+
+// ChunkDecoder turns the payload of a chunk into a readable value stored
+// under Name.
+type ChunkDecoder struct {
+	Name   string
+	Decode func(payload []byte) string
+}
+
+var chunkDecoders = map[ChunkKey]ChunkDecoder{
+	{0, SourceMAC}:       {"src_mac", decodeMAC},
+	{0, DestinationMAC}:  {"dst_mac", decodeMAC},
+	{0, EthernetType}:    {"ethernet_type", decodeHex},
+	{0, TCPFlag}:         {"tcp_flag", decodeUint},
+	{0, IPTOS}:           {"ip_tos", decodeUint},
+	{0, RFactor}:         {"r_factor", decodeUint},
+	{0, GeoLocation}:     {"geo_location", decodeString},
+	{0, Jitter}:          {"jitter", decodeUint},
+	{0, TranslationType}: {"translation_type", decodeString},
+	{0, PayloadJSONKeys}: {"payload_json_keys", decodeString},
+	{0, TagsValues}:      {"tags", decodeString},
+	{0, TagType}:         {"tag_type", decodeString},
+}
+
+// RegisterChunkDecoder adds or replaces the decoder of a chunk type.
+// It is not safe for concurrent use and is meant to be called at start up.
+func RegisterChunkDecoder(key ChunkKey, decoder ChunkDecoder) {
+	chunkDecoders[key] = decoder
+}
+
+// keepChunk 保存没有对应字段的chunk，同一类型出现多次时保留最后一个
+func (hepMsg *HepMsg) keepChunk(vendor, chunkType uint16, payload []byte) {
+	if hepMsg.Chunks == nil {
+		hepMsg.Chunks = make(map[ChunkKey][]byte)
+	}
+	hepMsg.Chunks[ChunkKey{Vendor: vendor, Type: chunkType}] = append([]byte(nil), payload...)
+}
+
+// Metadata returns the decoded values of Chunks. Chunks without a decoder
+// are hex encoded under their ChunkKey string, and the vendor name is added
+// when vendor chunks were received. It returns nil when there is nothing.
+func (hepMsg *HepMsg) Metadata() map[string]string {
+	if len(hepMsg.Chunks) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(hepMsg.Chunks)+1)
+	for key, payload := range hepMsg.Chunks {
+		if decoder, ok := chunkDecoders[key]; ok {
+			metadata[decoder.Name] = decoder.Decode(payload)
+		} else {
+			metadata[key.String()] = hex.EncodeToString(payload)
+		}
+	}
+	if hepMsg.Vendor != 0 {
+		metadata["vendor"] = hepMsg.VendorName()
+	}
+	return metadata
+}
+
+// PayloadTypeName returns the name of ProtocolType, such as "SIP" or "RTCP".
+func (hepMsg *HepMsg) PayloadTypeName() string {
+	if int(hepMsg.ProtocolType) < len(protocolTypes) {
+		return protocolTypes[hepMsg.ProtocolType]
+	}
+	return strconv.Itoa(int(hepMsg.ProtocolType))
+}
+
+// appendChunks 按vendor和类型排序写入Chunks，保证编码结果稳定
+func appendChunks(packet []byte, chunks map[ChunkKey][]byte) []byte {
+	keys := make([]ChunkKey, 0, len(chunks))
+	for key := range chunks {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Vendor != keys[j].Vendor {
+			return keys[i].Vendor < keys[j].Vendor
+		}
+		return keys[i].Type < keys[j].Type
+	})
+	for _, key := range keys {
+		packet = binary.BigEndian.AppendUint16(packet, key.Vendor)
+		packet = binary.BigEndian.AppendUint16(packet, key.Type)
+		packet = binary.BigEndian.AppendUint16(packet, uint16(chunkHeaderLength+len(chunks[key])))
+		packet = append(packet, chunks[key]...)
+	}
+	return packet
+}
+
+func decodeMAC(payload []byte) string {
+	return net.HardwareAddr(payload).String()
+}
+
+func decodeHex(payload []byte) string {
+	return "0x" + hex.EncodeToString(payload)
+}
+
+func decodeString(payload []byte) string {
+	return string(payload)
+}
+
+// decodeUint 按大端解析1/2/4/8字节的整数，其他长度按十六进制输出
+func decodeUint(payload []byte) string {
+	switch len(payload) {
+	case 1:
+		return strconv.FormatUint(uint64(payload[0]), 10)
+	case 2:
+		return strconv.FormatUint(uint64(binary.BigEndian.Uint16(payload)), 10)
+	case 4:
+		return strconv.FormatUint(uint64(binary.BigEndian.Uint32(payload)), 10)
+	case 8:
+		return strconv.FormatUint(binary.BigEndian.Uint64(payload), 10)
+	default:
+		return decodeHex(payload)
+	}
+}
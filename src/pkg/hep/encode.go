@@ -0,0 +1,120 @@
+package hep
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+/*
+ HEP3 packet layout
+
+    +----------------+----------------+
+    | "HEP3" (4)     | length (2)     |   length of the whole packet
+    +----------------+----------------+
+    | chunk | chunk | ...             |
+    +---------------------------------+
+
+ Each chunk:
+
+    +----------------+----------------+----------------+----------------+
+    | vendor id (2)  | type id (2)    | length (2)     | payload        |
+    +----------------+----------------+----------------+----------------+
+
+ The chunk length includes its 6 byte header. Generic chunks use vendor 0.
+
+*/
+
+const (
+	hep3HeaderLength  = 6
+	chunkHeaderLength = 6
+
+	// MaxPayloadLength 一个HEP3包能携带的最大负载，包长度字段只有2字节
+	MaxPayloadLength = 0xFFFF - 512
+)
+
+// IP protocol family of chunk 0x0001
+const (
+	FamilyIPv4 = 0x02
+	FamilyIPv6 = 0x0a
+)
+
+// Encode encodes the message as a HEP3 packet.
+// IPv6 chunks are used when IP6SourceAddress is set, otherwise IPv4. Empty
+// optional fields (keep alive, auth key, correlation id, vlan, node name,
+// MOS) are left out, Chunks are written as they are, and a Body longer than
+// MaxPayloadLength or the room left in the packet is truncated.
+func Encode(msg *HepMsg) []byte {
+	body := msg.Body
+	if len(body) > MaxPayloadLength {
+		body = body[:MaxPayloadLength]
+	}
+
+	packet := make([]byte, hep3HeaderLength, 128+len(body))
+	binary.BigEndian.PutUint32(packet, HEPID3)
+
+	if msg.IP6SourceAddress != "" {
+		packet = appendChunk(packet, IPProtocolFamily, []byte{FamilyIPv6})
+		packet = appendChunk(packet, IPProtocolID, []byte{msg.IPProtocolID})
+		packet = appendChunk(packet, IP6SourceAddress, ipBytes(msg.IP6SourceAddress, net.IPv6len))
+		packet = appendChunk(packet, IP6DestinationAddress, ipBytes(msg.IP6DestinationAddress, net.IPv6len))
+	} else {
+		packet = appendChunk(packet, IPProtocolFamily, []byte{FamilyIPv4})
+		packet = appendChunk(packet, IPProtocolID, []byte{msg.IPProtocolID})
+		packet = appendChunk(packet, IP4SourceAddress, ipBytes(msg.IP4SourceAddress, net.IPv4len))
+		packet = appendChunk(packet, IP4DestinationAddress, ipBytes(msg.IP4DestinationAddress, net.IPv4len))
+	}
+	packet = appendChunk(packet, SourcePort, binary.BigEndian.AppendUint16(nil, msg.SourcePort))
+	packet = appendChunk(packet, DestinationPort, binary.BigEndian.AppendUint16(nil, msg.DestinationPort))
+	packet = appendChunk(packet, Timestamp, binary.BigEndian.AppendUint32(nil, msg.Timestamp))
+	packet = appendChunk(packet, TimestampMicro, binary.BigEndian.AppendUint32(nil, msg.TimestampMicro))
+	packet = appendChunk(packet, ProtocolType, []byte{msg.ProtocolType})
+	packet = appendChunk(packet, CaptureAgentID, binary.BigEndian.AppendUint32(nil, msg.CaptureAgentID))
+	if msg.KeepAliveTimer != 0 {
+		packet = appendChunk(packet, KeepAliveTimer, binary.BigEndian.AppendUint16(nil, msg.KeepAliveTimer))
+	}
+	if msg.AuthenticateKey != "" {
+		packet = appendChunk(packet, AuthenticationKey, []byte(msg.AuthenticateKey))
+	}
+	if msg.InternalCorrelationID != "" {
+		packet = appendChunk(packet, InternalC, []byte(msg.InternalCorrelationID))
+	}
+	if msg.VlanID != 0 {
+		packet = appendChunk(packet, VlanID, binary.BigEndian.AppendUint16(nil, msg.VlanID))
+	}
+	if msg.NodeName != "" {
+		packet = appendChunk(packet, NodeName, []byte(msg.NodeName))
+	}
+	if msg.MOS != 0 {
+		packet = appendChunk(packet, MOSValue, binary.BigEndian.AppendUint16(nil, msg.MOS))
+	}
+	packet = appendChunks(packet, msg.Chunks)
+	if room := 0xFFFF - len(packet) - chunkHeaderLength; len(body) > room {
+		body = body[:max(room, 0)]
+	}
+	packet = appendChunk(packet, PacketPayload, body)
+
+	binary.BigEndian.PutUint16(packet[4:], uint16(len(packet)))
+	return packet
+}
+
+func appendChunk(packet []byte, chunkType uint16, payload []byte) []byte {
+	packet = binary.BigEndian.AppendUint16(packet, 0)
+	packet = binary.BigEndian.AppendUint16(packet, chunkType)
+	packet = binary.BigEndian.AppendUint16(packet, uint16(chunkHeaderLength+len(payload)))
+	return append(packet, payload...)
+}
+
+// ipBytes 地址无法解析时填0
+func ipBytes(addr string, size int) []byte {
+	ip := net.ParseIP(addr)
+	if size == net.IPv4len {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4
+		}
+		return make([]byte, net.IPv4len)
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return ip16
+	}
+	return make([]byte, net.IPv6len)
+}
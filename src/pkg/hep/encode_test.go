@@ -0,0 +1,63 @@
+package hep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestEncode_RoundTrip(t *testing.T) {
+	msg := &HepMsg{
+		IPProtocolID:          17,
+		IP4SourceAddress:      "10.0.0.1",
+		IP4DestinationAddress: "10.0.0.2",
+		SourcePort:            5060,
+		DestinationPort:       5080,
+		Timestamp:             1712800000,
+		TimestampMicro:        123456,
+		ProtocolType:          ProtocolTypeSIP,
+		CaptureAgentID:        70001,
+		AuthenticateKey:       "secret",
+		InternalCorrelationID: "abc@10.0.0.1",
+		VlanID:                100,
+		NodeName:              "sbc-1",
+		MOS:                   412,
+		Body:                  []byte("OPTIONS sip:10.0.0.2 SIP/2.0\r\n\r\n"),
+	}
+	packet := Encode(msg)
+	if string(packet[:4]) != "HEP3" || int(binary.BigEndian.Uint16(packet[4:6])) != len(packet) {
+		t.Fatalf("包头错误：%x", packet[:6])
+	}
+
+	got, err := NewHepMsg(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IPProtocolFamily != FamilyIPv4 || got.IPProtocolID != 17 ||
+		got.IP4SourceAddress != "10.0.0.1" || got.IP4DestinationAddress != "10.0.0.2" ||
+		got.SourcePort != 5060 || got.DestinationPort != 5080 ||
+		got.Timestamp != 1712800000 || got.TimestampMicro != 123456 ||
+		got.ProtocolType != ProtocolTypeSIP || got.CaptureAgentID != 70001 ||
+		got.AuthenticateKey != "secret" || got.InternalCorrelationID != "abc@10.0.0.1" ||
+		got.VlanID != 100 || got.NodeName != "sbc-1" || got.MOS != 412 ||
+		!bytes.Equal(got.Body, msg.Body) {
+		t.Errorf("解码结果与编码前不一致：%+v", got)
+	}
+}
+
+func TestEncode_IPv6(t *testing.T) {
+	packet := Encode(&HepMsg{
+		IPProtocolID:          6,
+		IP6SourceAddress:      "2001:db8::1",
+		IP6DestinationAddress: "2001:db8::2",
+		ProtocolType:          ProtocolTypeRTCP,
+		Body:                  []byte{0x80, 0xc8, 0x00, 0x06},
+	})
+	got, err := NewHepMsg(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IPProtocolFamily != FamilyIPv6 || got.IP6SourceAddress != "2001:db8::1" || got.IP4SourceAddress != "" {
+		t.Errorf("IPv6地址错误：%+v", got)
+	}
+}
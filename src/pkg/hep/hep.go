@@ -9,6 +9,7 @@ package hep
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"net"
 )
 
@@ -43,8 +44,57 @@ const (
 	PacketPayload
 	CompressedPayload
 	InternalC
+	VlanID
+	NodeName // Group ID, name of the capture node
 )
 
+// Extended Chunk Types
+const (
+	SourceMAC       = 0x0014
+	DestinationMAC  = 0x0015
+	EthernetType    = 0x0016
+	TCPFlag         = 0x0017
+	IPTOS           = 0x0018
+	MOSValue        = 0x0020
+	RFactor         = 0x0021
+	GeoLocation     = 0x0022
+	Jitter          = 0x0023
+	TranslationType = 0x0024
+	PayloadJSONKeys = 0x0025
+	TagsValues      = 0x0026
+	TagType         = 0x0027
+)
+
+// Parse errors. NewHepMsg returns a *ParseError wrapping one of these,
+// so callers can test the cause with errors.Is.
+var (
+	ErrTruncated      = errors.New("hep: truncated packet")
+	ErrBadLength      = errors.New("hep: bad length")
+	ErrUnknownVersion = errors.New("hep: unknown version")
+)
+
+// ParseError describes where a packet failed to parse.
+type ParseError struct {
+	Err    error  // ErrTruncated, ErrBadLength or ErrUnknownVersion
+	Offset int    // byte offset of the header field or chunk
+	Chunk  uint16 // chunk type, 0 for the packet header
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	if e.Chunk != 0 {
+		return fmt.Sprintf("%v: chunk 0x%04x at offset %d: %s", e.Err, e.Chunk, e.Offset, e.Msg)
+	}
+	if e.Offset != 0 {
+		return fmt.Sprintf("%v at offset %d: %s", e.Err, e.Offset, e.Msg)
+	}
+	return fmt.Sprintf("%v: %s", e.Err, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 var protocolFamilies []string
 var vendors []string
 var protocolTypes []string
@@ -112,11 +162,19 @@ type HepMsg struct {
 	Timestamp             uint32
 	TimestampMicro        uint32
 	ProtocolType          byte
-	CaptureAgentID        uint16
+	CaptureAgentID        uint32
 	KeepAliveTimer        uint16
 	AuthenticateKey       string
 	InternalCorrelationID string // 内部关联ID
+	VlanID                uint16
+	NodeName              string
+	MOS                   uint16 // MOS * 100
+	Vendor                uint16 // vendor ID of vendor chunks, 0 when only generic chunks were sent
 	Body                  []byte
+
+	// Chunks keeps vendor chunks and generic chunks without a field above,
+	// nil when there are none. See Metadata for the decoded values.
+	Chunks map[ChunkKey][]byte
 }
 
 // NewHepMsg returns a parsed message object. Takes a byte slice.
@@ -148,6 +206,9 @@ func NewMockHepMsgBySIPMsg(sipBody []byte) *HepMsg {
 }
 
 func (hepMsg *HepMsg) parse(udpPacket []byte) error {
+	if len(udpPacket) == 0 {
+		return &ParseError{Err: ErrTruncated, Msg: "empty packet"}
+	}
 	switch udpPacket[0] {
 	case 0x01:
 		return hepMsg.parseHep1(udpPacket)
@@ -156,69 +217,98 @@ func (hepMsg *HepMsg) parse(udpPacket []byte) error {
 	case 0x48:
 		return hepMsg.parseHep3(udpPacket)
 	default:
-		err := errors.New("Not a valid HEP packet - HEP ID does not match spec")
-		return err
+		return &ParseError{Err: ErrUnknownVersion, Msg: "HEP ID does not match spec"}
 	}
 }
 func (hepMsg *HepMsg) parseHep1(udpPacket []byte) error {
-	//var err error
 	if len(udpPacket) < 21 {
-		return errors.New("Found HEP ID for HEP v1, but length of packet is too short to be HEP1 or is NAT keepalive")
+		return &ParseError{Err: ErrTruncated, Msg: "packet too short to be HEP1 or is NAT keepalive"}
 	}
-	packetLength := len(udpPacket)
 	hepMsg.SourcePort = binary.BigEndian.Uint16(udpPacket[4:6])
 	hepMsg.DestinationPort = binary.BigEndian.Uint16(udpPacket[6:8])
 	hepMsg.IP4SourceAddress = net.IP(udpPacket[8:12]).String()
 	hepMsg.IP4DestinationAddress = net.IP(udpPacket[12:16]).String()
 	hepMsg.Body = udpPacket[16:]
-	if len(udpPacket[16:packetLength-4]) > 1 {
-		//SIP消息：udpPacket[16:packetLength]
-	} else {
-
-	}
-
 	return nil
 }
 
 func (hepMsg *HepMsg) parseHep2(udpPacket []byte) error {
-	//var err error
 	if len(udpPacket) < 31 {
-		return errors.New("Found HEP ID for HEP v2, but length of packet is too short to be HEP2 or is NAT keepalive")
+		return &ParseError{Err: ErrTruncated, Msg: "packet too short to be HEP2 or is NAT keepalive"}
 	}
-	packetLength := len(udpPacket)
 	hepMsg.SourcePort = binary.BigEndian.Uint16(udpPacket[4:6])
 	hepMsg.DestinationPort = binary.BigEndian.Uint16(udpPacket[6:8])
 	hepMsg.IP4SourceAddress = net.IP(udpPacket[8:12]).String()
 	hepMsg.IP4DestinationAddress = net.IP(udpPacket[12:16]).String()
 	hepMsg.Timestamp = binary.LittleEndian.Uint32(udpPacket[16:20])
 	hepMsg.TimestampMicro = binary.LittleEndian.Uint32(udpPacket[20:24])
-	hepMsg.CaptureAgentID = binary.BigEndian.Uint16(udpPacket[24:26])
+	hepMsg.CaptureAgentID = uint32(binary.BigEndian.Uint16(udpPacket[24:26]))
 	hepMsg.Body = udpPacket[28:]
-	if len(udpPacket[28:packetLength-4]) > 1 {
-		//SIP消息：udpPacket[16:packetLength]
-	} else {
-
-	}
-
 	return nil
 }
 
+// chunkMinLength is the payload size required by fixed size generic chunks.
+var chunkMinLength = map[uint16]int{
+	IPProtocolFamily:      1,
+	IPProtocolID:          1,
+	IP4SourceAddress:      net.IPv4len,
+	IP4DestinationAddress: net.IPv4len,
+	IP6SourceAddress:      net.IPv6len,
+	IP6DestinationAddress: net.IPv6len,
+	SourcePort:            2,
+	DestinationPort:       2,
+	Timestamp:             4,
+	TimestampMicro:        4,
+	ProtocolType:          1,
+	CaptureAgentID:        2,
+	KeepAliveTimer:        2,
+	VlanID:                2,
+	MOSValue:              2,
+}
+
 func (hepMsg *HepMsg) parseHep3(udpPacket []byte) error {
-	length := binary.BigEndian.Uint16(udpPacket[4:6])
-	currentByte := uint16(6)
+	if len(udpPacket) < hep3HeaderLength {
+		return &ParseError{Err: ErrTruncated, Msg: "packet shorter than the HEP3 header"}
+	}
+	if binary.BigEndian.Uint32(udpPacket) != HEPID3 {
+		return &ParseError{Err: ErrUnknownVersion, Msg: "HEP ID does not match spec"}
+	}
+	length := int(binary.BigEndian.Uint16(udpPacket[4:6]))
+	if length < hep3HeaderLength {
+		return &ParseError{Err: ErrBadLength, Offset: 4, Msg: fmt.Sprintf("packet length %d", length)}
+	}
+	if length > len(udpPacket) {
+		return &ParseError{Err: ErrTruncated, Offset: 4, Msg: fmt.Sprintf("packet length %d, received %d bytes", length, len(udpPacket))}
+	}
+	// Trailing bytes after the declared length are ignored
+	udpPacket = udpPacket[:length]
 
-	for currentByte < length {
-		hepChunk := udpPacket[currentByte:]
-		//chunkVendorId := binary.BigEndian.Uint16(hepChunk[:2])
+	for offset := hep3HeaderLength; offset < length; {
+		hepChunk := udpPacket[offset:]
+		if len(hepChunk) < chunkHeaderLength {
+			return &ParseError{Err: ErrTruncated, Offset: offset, Msg: "chunk header"}
+		}
+		chunkVendorID := binary.BigEndian.Uint16(hepChunk[:2])
 		chunkType := binary.BigEndian.Uint16(hepChunk[2:4])
-		chunkLength := binary.BigEndian.Uint16(hepChunk[4:6])
+		chunkLength := int(binary.BigEndian.Uint16(hepChunk[4:6]))
+		if chunkLength < chunkHeaderLength {
+			return &ParseError{Err: ErrBadLength, Offset: offset, Chunk: chunkType, Msg: fmt.Sprintf("chunk length %d", chunkLength)}
+		}
+		if chunkLength > len(hepChunk) {
+			return &ParseError{Err: ErrTruncated, Offset: offset, Chunk: chunkType, Msg: fmt.Sprintf("chunk length %d, %d bytes left", chunkLength, len(hepChunk))}
+		}
+		chunkBody := hepChunk[chunkHeaderLength:chunkLength]
+		offset += chunkLength
 
-		//todo::实际运行过程中，chunkLength会超过len(hepChunk)，导致下面报错
-		if int(chunkLength) > len(hepChunk) {
+		// Chunk types of other vendors have their own meaning
+		if chunkVendorID != 0 {
+			hepMsg.Vendor = chunkVendorID
+			hepMsg.keepChunk(chunkVendorID, chunkType, chunkBody)
 			continue
 		}
-
-		chunkBody := hepChunk[6:chunkLength]
+		if size, ok := chunkMinLength[chunkType]; ok && len(chunkBody) < size {
+			return &ParseError{Err: ErrBadLength, Offset: offset - chunkLength, Chunk: chunkType, Msg: fmt.Sprintf("chunk payload %d bytes, need %d", len(chunkBody), size)}
+		}
 
 		switch chunkType {
 		case IPProtocolFamily:
@@ -226,13 +316,13 @@ func (hepMsg *HepMsg) parseHep3(udpPacket []byte) error {
 		case IPProtocolID:
 			hepMsg.IPProtocolID = chunkBody[0]
 		case IP4SourceAddress:
-			hepMsg.IP4SourceAddress = net.IP(chunkBody).String()
+			hepMsg.IP4SourceAddress = net.IP(chunkBody[:net.IPv4len]).String()
 		case IP4DestinationAddress:
-			hepMsg.IP4DestinationAddress = net.IP(chunkBody).String()
+			hepMsg.IP4DestinationAddress = net.IP(chunkBody[:net.IPv4len]).String()
 		case IP6SourceAddress:
-			hepMsg.IP6SourceAddress = net.IP(chunkBody).String()
+			hepMsg.IP6SourceAddress = net.IP(chunkBody[:net.IPv6len]).String()
 		case IP6DestinationAddress:
-			hepMsg.IP4DestinationAddress = net.IP(chunkBody).String()
+			hepMsg.IP6DestinationAddress = net.IP(chunkBody[:net.IPv6len]).String()
 		case SourcePort:
 			hepMsg.SourcePort = binary.BigEndian.Uint16(chunkBody)
 		case DestinationPort:
@@ -244,7 +334,12 @@ func (hepMsg *HepMsg) parseHep3(udpPacket []byte) error {
 		case ProtocolType:
 			hepMsg.ProtocolType = chunkBody[0]
 		case CaptureAgentID:
-			hepMsg.CaptureAgentID = binary.BigEndian.Uint16(chunkBody)
+			// HEP3规定为4字节，部分旧版本代理发送2字节
+			if len(chunkBody) >= 4 {
+				hepMsg.CaptureAgentID = binary.BigEndian.Uint32(chunkBody)
+			} else {
+				hepMsg.CaptureAgentID = uint32(binary.BigEndian.Uint16(chunkBody))
+			}
 		case KeepAliveTimer:
 			hepMsg.KeepAliveTimer = binary.BigEndian.Uint16(chunkBody)
 		case AuthenticationKey:
@@ -254,9 +349,23 @@ func (hepMsg *HepMsg) parseHep3(udpPacket []byte) error {
 		case CompressedPayload:
 		case InternalC:
 			hepMsg.InternalCorrelationID = string(chunkBody)
+		case VlanID:
+			hepMsg.VlanID = binary.BigEndian.Uint16(chunkBody)
+		case NodeName:
+			hepMsg.NodeName = string(chunkBody)
+		case MOSValue:
+			hepMsg.MOS = binary.BigEndian.Uint16(chunkBody)
 		default:
+			hepMsg.keepChunk(chunkVendorID, chunkType, chunkBody)
 		}
-		currentByte += chunkLength
 	}
 	return nil
 }
+
+// VendorName returns the name of the vendor that sent vendor chunks, "None" for generic packets.
+func (hepMsg *HepMsg) VendorName() string {
+	if int(hepMsg.Vendor) < len(vendors) {
+		return vendors[hepMsg.Vendor]
+	}
+	return "Unknown"
+}
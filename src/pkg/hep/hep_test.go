@@ -0,0 +1,180 @@
+package hep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func samplePacket() []byte {
+	return Encode(&HepMsg{
+		IPProtocolID:          17,
+		IP4SourceAddress:      "10.0.0.1",
+		IP4DestinationAddress: "10.0.0.2",
+		SourcePort:            5060,
+		DestinationPort:       5060,
+		ProtocolType:          ProtocolTypeSIP,
+		CaptureAgentID:        2001,
+		Body:                  []byte("OPTIONS sip:10.0.0.2 SIP/2.0\r\n\r\n"),
+	})
+}
+
+// vendorChunk 返回指定厂商的chunk
+func vendorChunk(vendor, chunkType uint16, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint16(nil, vendor)
+	chunk = binary.BigEndian.AppendUint16(chunk, chunkType)
+	chunk = binary.BigEndian.AppendUint16(chunk, uint16(chunkHeaderLength+len(payload)))
+	return append(chunk, payload...)
+}
+
+// withChunk 在包末尾追加chunk并更新包长度
+func withChunk(packet, chunk []byte) []byte {
+	packet = append(append([]byte(nil), packet...), chunk...)
+	binary.BigEndian.PutUint16(packet[4:], uint16(len(packet)))
+	return packet
+}
+
+func TestNewHepMsg_Errors(t *testing.T) {
+	packet := samplePacket()
+
+	zeroLength := withChunk(packet, vendorChunk(0, NodeName, nil))
+	binary.BigEndian.PutUint16(zeroLength[len(packet)+4:], 0)
+
+	overLength := withChunk(packet, vendorChunk(0, NodeName, []byte("sbc")))
+	binary.BigEndian.PutUint16(overLength[len(packet)+4:], 200)
+
+	shortPort := withChunk(packet, vendorChunk(0, SourcePort, []byte{1}))
+
+	badPacketLength := append([]byte(nil), packet...)
+	binary.BigEndian.PutUint16(badPacketLength[4:], 3)
+
+	cases := []struct {
+		name   string
+		packet []byte
+		want   error
+	}{
+		{"空包", nil, ErrTruncated},
+		{"不足6字节", []byte("HEP3"), ErrTruncated},
+		{"HEP3标识错误", []byte("HEPX\x00\x06"), ErrUnknownVersion},
+		{"未知版本", []byte{0x05, 0, 0, 0, 0, 0}, ErrUnknownVersion},
+		{"包长度小于包头", badPacketLength, ErrBadLength},
+		{"包长度超过数据", packet[:len(packet)-5], ErrTruncated},
+		{"chunk长度为0", zeroLength, ErrBadLength},
+		{"chunk长度超过剩余数据", overLength, ErrTruncated},
+		{"定长chunk过短", shortPort, ErrBadLength},
+		{"HEP1过短", []byte{0x01, 0x10, 0, 0}, ErrTruncated},
+	}
+	for _, c := range cases {
+		_, err := NewHepMsg(c.packet)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: 期望%v，得到%v", c.name, c.want, err)
+		}
+		var parseErr *ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			t.Errorf("%s: 错误类型应为*ParseError", c.name)
+		}
+	}
+}
+
+func TestNewHepMsg_VendorChunks(t *testing.T) {
+	// 厂商chunk与通用chunk类型号相同时不能覆盖通用字段
+	packet := withChunk(samplePacket(), vendorChunk(0x0002, SourcePort, []byte{0xff, 0xff}))
+	// 声明长度之后的多余字节被忽略
+	packet = append(packet, 0xde, 0xad)
+
+	msg, err := NewHepMsg(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.SourcePort != 5060 || msg.Vendor != 0x0002 || msg.VendorName() != "Kamailio" ||
+		!bytes.Equal(msg.Chunks[ChunkKey{Vendor: 0x0002, Type: SourcePort}], []byte{0xff, 0xff}) {
+		t.Errorf("厂商chunk解析错误：port=%d vendor=%d", msg.SourcePort, msg.Vendor)
+	}
+	if !bytes.HasPrefix(msg.Body, []byte("OPTIONS")) {
+		t.Errorf("负载错误：%q", msg.Body)
+	}
+}
+
+func TestHepMsg_Metadata(t *testing.T) {
+	packet := samplePacket()
+	packet = withChunk(packet, vendorChunk(0, SourceMAC, []byte{0x00, 0x1b, 0x21, 0x3a, 0x4b, 0x5c}))
+	packet = withChunk(packet, vendorChunk(0, Jitter, []byte{0, 0, 0, 42}))
+	packet = withChunk(packet, vendorChunk(0x0003, 0x0001, []byte{0xca, 0xfe}))
+
+	msg, err := NewHepMsg(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := msg.Metadata()
+	want := map[string]string{
+		"src_mac":       "00:1b:21:3a:4b:5c",
+		"jitter":        "42",
+		"0x0003:0x0001": "cafe",
+		"vendor":        "OpenSIPS",
+	}
+	if len(metadata) != len(want) {
+		t.Errorf("元数据错误：%v", metadata)
+	}
+	for key, value := range want {
+		if metadata[key] != value {
+			t.Errorf("%s应为%q，得到%q", key, value, metadata[key])
+		}
+	}
+	if msg.PayloadTypeName() != "SIP" {
+		t.Errorf("负载类型错误：%s", msg.PayloadTypeName())
+	}
+
+	// 重新编码后保留厂商chunk
+	again, err := NewHepMsg(Encode(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Chunks[ChunkKey{Vendor: 0x0003, Type: 0x0001}], []byte{0xca, 0xfe}) || again.Vendor != 0x0003 {
+		t.Errorf("重新编码后厂商chunk丢失：%v", again.Chunks)
+	}
+	if NewMockHepMsgBySIPMsg(nil).Metadata() != nil {
+		t.Error("没有额外chunk时应返回nil")
+	}
+}
+
+func TestNewHepMsg_IPv6Destination(t *testing.T) {
+	msg, err := NewHepMsg(Encode(&HepMsg{IP6SourceAddress: "2001:db8::1", IP6DestinationAddress: "2001:db8::2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.IP6DestinationAddress != "2001:db8::2" || msg.IP4DestinationAddress != "" {
+		t.Errorf("IPv6目的地址错误：%q %q", msg.IP6DestinationAddress, msg.IP4DestinationAddress)
+	}
+}
+
+func FuzzNewHepMsg(f *testing.F) {
+	f.Add(samplePacket())
+	f.Add(Encode(&HepMsg{IP6SourceAddress: "::1", IP6DestinationAddress: "::2", NodeName: "n", MOS: 400, VlanID: 1}))
+	f.Add(withChunk(samplePacket(), vendorChunk(3, 1, []byte("x"))))
+	f.Add([]byte("HEP3\x00\x0c\x00\x00\x00\x01\x00\x00"))
+	f.Add([]byte{0x01, 0x10, 0x02, 0x11, 0x13, 0xc4, 0x13, 0xc4, 10, 0, 0, 1, 10, 0, 0, 2, 'S', 'I', 'P', '/', '2'})
+	f.Add([]byte{0x02, 0x1c, 0x02, 0x11, 0x13, 0xc4, 0x13, 0xc4, 10, 0, 0, 1, 10, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 'S', 'I', 'P'})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := NewHepMsg(data)
+		if err != nil {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("错误类型应为*ParseError：%v", err)
+			}
+			return
+		}
+		// 解析成功的消息重新编码后应得到相同的字段
+		if len(msg.Body) > MaxPayloadLength || data[0] != 0x48 || msg.IP6SourceAddress != "" {
+			return
+		}
+		again, err := NewHepMsg(Encode(msg))
+		if err != nil {
+			t.Fatalf("重新编码后解析失败：%v", err)
+		}
+		if again.SourcePort != msg.SourcePort || again.CaptureAgentID != msg.CaptureAgentID || !bytes.Equal(again.Body, msg.Body) {
+			t.Fatalf("重新编码后字段不一致：%+v %+v", msg, again)
+		}
+	})
+}
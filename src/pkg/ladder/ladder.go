@@ -0,0 +1,306 @@
+package ladder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+ SIP ladder (sequence) diagram
+
+ One column per host in order of first appearance, one row per message
+ in time order. Each row is an arrow from the sender column to the
+ receiver column, labelled with the method or response and the time
+ since the previous message:
+
+        gw-a            sbc             pbx
+     10.0.0.1        10.0.0.2        10.0.0.3
+         |               |               |
+  0.000s |--INVITE (SDP)>|               |
+  0.002s |               |--INVITE (SDP)>|
+  0.010s |<-100 Trying---|               |
+  2.310s |               |<-200 OK (SDP)-|
+
+ Requests are solid lines and responses dashed. Messages carrying SDP
+ are marked and the SDP summary is written under the arrow. When the
+ messages of several call legs are drawn together every leg gets its
+ own colour, listed in a legend under the title.
+
+ SVG and PNG share the same layout. PNG text uses the built-in 7x13
+ bitmap font, which only covers ASCII; other characters are drawn as '?',
+ and a host whose name is not ASCII is labelled with its address only.
+ PNG is drawn in memory, so diagrams with more than 500 rows or larger
+ than 4096 pixels wide or 32M pixels are refused with ErrPNGTooLarge.
+ Mermaid and PlantUML output the same diagram as text.
+
+*/
+
+// Format 输出格式
+type Format string
+
+const (
+	FormatSVG      Format = "svg"
+	FormatPNG      Format = "png"
+	FormatMermaid  Format = "mermaid"
+	FormatPlantUML Format = "plantuml"
+)
+
+var ErrNoMessages = errors.New("没有可绘制的消息")
+
+// ParseFormat 解析输出格式，为空时为svg
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(strings.ToLower(strings.TrimSpace(s))); format {
+	case "":
+		return FormatSVG, nil
+	case FormatSVG, FormatPNG, FormatMermaid, FormatPlantUML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("不支持的时序图格式：%s", s)
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatSVG:
+		return "image/svg+xml"
+	case FormatPNG:
+		return "image/png"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+func (f Format) Extension() string {
+	switch f {
+	case FormatMermaid:
+		return "mmd"
+	case FormatPlantUML:
+		return "puml"
+	default:
+		return string(f)
+	}
+}
+
+// Message 时序图中的一条消息
+type Message struct {
+	Time     time.Time
+	From     string // 发送方地址，相同地址画在同一列
+	To       string // 接收方地址
+	Label    string // 方法，或响应码和描述，如 200 OK
+	Response bool   // 响应画为虚线
+	SDP      string // SDP摘要，不为空时标记消息携带SDP
+	Leg      string // 所属的呼叫腿，如Call-ID，有多条腿时按腿区分颜色
+}
+
+// Diagram 一个呼叫或一组关联呼叫腿的时序图
+type Diagram struct {
+	Title    string
+	names    map[string]string
+	messages []Message
+}
+
+func New(title string) *Diagram {
+	return &Diagram{Title: title, names: make(map[string]string)}
+}
+
+// SetHostName 设置地址的显示名称，如网关名称，列头显示名称和地址
+func (d *Diagram) SetHostName(addr, name string) {
+	d.names[addr] = name
+}
+
+func (d *Diagram) Add(messages ...Message) {
+	d.messages = append(d.messages, messages...)
+}
+
+// Render 按格式输出时序图
+func (d *Diagram) Render(w io.Writer, format Format) error {
+	switch format {
+	case FormatSVG:
+		return d.WriteSVG(w)
+	case FormatPNG:
+		return d.WritePNG(w)
+	case FormatMermaid:
+		return d.WriteMermaid(w)
+	case FormatPlantUML:
+		return d.WritePlantUML(w)
+	default:
+		return fmt.Errorf("不支持的时序图格式：%s", format)
+	}
+}
+
+// 各呼叫腿的颜色，超过时循环使用
+var legColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#9467bd", "#ff7f0e", "#8c564b", "#e377c2", "#17becf"}
+
+type host struct {
+	addr string
+	name string
+}
+
+// title 列头的文字，有名称时为两行
+func (h host) title() []string {
+	if h.name == "" || h.name == h.addr {
+		return []string{h.addr}
+	}
+	return []string{h.name, h.addr}
+}
+
+type row struct {
+	Message
+	from   int // 发送方列
+	to     int // 接收方列
+	leg    int // 呼叫腿序号
+	offset time.Duration
+	delta  time.Duration
+}
+
+// text 箭头上的文字：标签、SDP标记和与上一条消息的时间差
+func (r row) text(first bool) string {
+	text := r.Label
+	if r.SDP != "" {
+		text += " (SDP)"
+	}
+	if !first {
+		text += " " + formatDelta(r.delta)
+	}
+	return text
+}
+
+// sequence 按时间排序后的列和行
+type sequence struct {
+	title string
+	hosts []host
+	legs  []string
+	rows  []row
+}
+
+func (d *Diagram) sequence() (*sequence, error) {
+	if len(d.messages) == 0 {
+		return nil, ErrNoMessages
+	}
+	messages := make([]Message, len(d.messages))
+	copy(messages, d.messages)
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Time.Before(messages[j].Time)
+	})
+
+	s := &sequence{title: d.Title}
+	hostIndex := make(map[string]int)
+	legIndex := make(map[string]int)
+	column := func(addr string) int {
+		if i, ok := hostIndex[addr]; ok {
+			return i
+		}
+		hostIndex[addr] = len(s.hosts)
+		s.hosts = append(s.hosts, host{addr: addr, name: d.names[addr]})
+		return len(s.hosts) - 1
+	}
+
+	start := messages[0].Time
+	for i, message := range messages {
+		r := row{Message: message, from: column(message.From), to: column(message.To)}
+		leg, ok := legIndex[message.Leg]
+		if !ok {
+			leg = len(s.legs)
+			legIndex[message.Leg] = leg
+			s.legs = append(s.legs, message.Leg)
+		}
+		r.leg = leg
+		r.offset = message.Time.Sub(start)
+		if i > 0 {
+			r.delta = message.Time.Sub(messages[i-1].Time)
+		}
+		s.rows = append(s.rows, r)
+	}
+	return s, nil
+}
+
+// multiLeg 有多条呼叫腿时显示图例并按腿区分颜色
+func (s *sequence) multiLeg() bool {
+	return len(s.legs) > 1
+}
+
+func (s *sequence) color(leg int) string {
+	if !s.multiLeg() {
+		return "#333333"
+	}
+	return legColors[leg%len(legColors)]
+}
+
+func formatDelta(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("+%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("+%.3fs", d.Seconds())
+}
+
+func formatOffset(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+// textWidth 文字的显示宽度，按等宽字体的字符数计算，中日韩等宽字符按两个字符计算
+func textWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if r >= 0x1100 {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// truncate 截断到指定的显示宽度，超出时以...结尾
+func truncate(s string, width int) string {
+	if textWidth(s) <= width {
+		return s
+	}
+	if width <= 3 {
+		return ""
+	}
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		w := 1
+		if r >= 0x1100 {
+			w = 2
+		}
+		if used+w > width-3 {
+			break
+		}
+		used += w
+		b.WriteRune(r)
+	}
+	b.WriteString("...")
+	return b.String()
+}
+
+// asciiOnly 非ASCII字符替换为?，用于只有ASCII字形的位图字体
+func asciiOnly(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,203 @@
+package ladder
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDiagram(multiLeg bool) *Diagram {
+	base := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	d := New("call-a 1001 -> 13800138000")
+	d.SetHostName("10.0.0.3", "运营商A")
+	legB := "call-a"
+	if multiLeg {
+		legB = "call-b"
+	}
+	// 故意乱序添加，输出时按时间排序
+	d.Add(
+		Message{Time: base.Add(2 * time.Millisecond), From: "10.0.0.2", To: "10.0.0.3", Label: "INVITE", SDP: "audio 10.0.0.2:4000 PCMA", Leg: legB},
+		Message{Time: base, From: "10.0.0.1", To: "10.0.0.2", Label: "INVITE", SDP: "audio 10.0.0.1:5000 PCMA;PCMU #1", Leg: "call-a"},
+		Message{Time: base.Add(10 * time.Millisecond), From: "10.0.0.2", To: "10.0.0.1", Label: "100 Trying", Response: true, Leg: "call-a"},
+		Message{Time: base.Add(2310 * time.Millisecond), From: "10.0.0.3", To: "10.0.0.2", Label: "200 OK", Response: true, SDP: "audio 10.0.0.3:6000 PCMA", Leg: legB},
+		Message{Time: base.Add(2311 * time.Millisecond), From: "10.0.0.2", To: "10.0.0.2", Label: "OPTIONS", Leg: "call-a"},
+	)
+	return d
+}
+
+func TestParseFormat(t *testing.T) {
+	for input, want := range map[string]Format{"": FormatSVG, "SVG": FormatSVG, "png": FormatPNG, "mermaid": FormatMermaid, " plantuml ": FormatPlantUML} {
+		if got, err := ParseFormat(input); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+	if FormatPlantUML.Extension() != "puml" || FormatPNG.ContentType() != "image/png" {
+		t.Error("扩展名或Content-Type错误")
+	}
+}
+
+func TestSequence(t *testing.T) {
+	s, err := testDiagram(true).sequence()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := make([]string, 0, len(s.hosts))
+	for _, h := range s.hosts {
+		hosts = append(hosts, strings.Join(h.title(), "/"))
+	}
+	if got := strings.Join(hosts, ","); got != "10.0.0.1,10.0.0.2,运营商A/10.0.0.3" {
+		t.Errorf("列 = %s", got)
+	}
+	if got := strings.Join(s.legs, ","); got != "call-a,call-b" {
+		t.Errorf("呼叫腿 = %s", got)
+	}
+
+	want := []string{"INVITE (SDP)", "INVITE (SDP) +2ms", "100 Trying +8ms", "200 OK (SDP) +2.300s", "OPTIONS +1ms"}
+	for i, r := range s.rows {
+		if got := r.text(i == 0); got != want[i] {
+			t.Errorf("rows[%d] = %q, want %q", i, got, want[i])
+		}
+	}
+	if s.rows[3].offset != 2310*time.Millisecond || s.rows[3].from != 2 || s.rows[3].to != 1 || s.rows[3].leg != 1 {
+		t.Errorf("rows[3] = %+v", s.rows[3])
+	}
+
+	if _, err := New("").sequence(); !errors.Is(err, ErrNoMessages) {
+		t.Errorf("没有消息时应返回ErrNoMessages，err = %v", err)
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testDiagram(true).Render(&buf, FormatSVG); err != nil {
+		t.Fatal(err)
+	}
+	// 必须是格式正确的XML
+	decoder := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("SVG不是有效的XML：%v", err)
+		}
+	}
+	svg := buf.String()
+	for _, want := range []string{"运营商A", "INVITE (SDP) +2ms", "audio 10.0.0.1:5000 PCMA;PCMU #1", "stroke-dasharray", legColors[1], "call-b"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG中没有 %q", want)
+		}
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	var buf bytes.Buffer
+	d := testDiagram(false)
+	d.SetHostName("10.0.0.3", strings.Repeat("运营商", 20))
+	if err := d.Render(&buf, FormatPNG); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("不是有效的PNG：%v", err)
+	}
+	// 非ASCII的名称不显示，列宽与没有名称时相同
+	delete(d.names, "10.0.0.3")
+	s, _ := d.sequence()
+	l := newLayout(s)
+	if img.Bounds().Dx() != l.width || img.Bounds().Dy() != l.height {
+		t.Errorf("图片大小 %v, want %dx%d", img.Bounds(), l.width, l.height)
+	}
+	// 第一行箭头的中点应该被画上
+	if r, g, b, _ := img.At((l.x(0)+l.x(1))/2, l.y(0)).RGBA(); r == 0xffff && g == 0xffff && b == 0xffff {
+		t.Error("箭头没有画出")
+	}
+}
+
+func TestWritePNG_TooLarge(t *testing.T) {
+	base := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	rows := New("")
+	for i := 0; i <= maxPNGRows; i++ {
+		rows.Add(Message{Time: base.Add(time.Duration(i) * time.Millisecond), From: "10.0.0.1", To: "10.0.0.2", Label: "OPTIONS"})
+	}
+	hosts := New("")
+	for i := 0; i < 40; i++ {
+		hosts.Add(Message{Time: base.Add(time.Duration(i) * time.Millisecond), From: "10.0.0.1", To: fmt.Sprintf("10.0.1.%d", i), Label: "OPTIONS"})
+	}
+	for name, d := range map[string]*Diagram{"rows": rows, "hosts": hosts} {
+		if err := d.Render(io.Discard, FormatPNG); !errors.Is(err, ErrPNGTooLarge) {
+			t.Errorf("%s: 超过上限应返回ErrPNGTooLarge，err = %v", name, err)
+		}
+		// 其他格式不受限制
+		if err := d.Render(io.Discard, FormatSVG); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testDiagram(true).Render(&buf, FormatMermaid); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"sequenceDiagram",
+		"    title call-a 1001 -> 13800138000",
+		"    participant H0 as 10.0.0.1",
+		"    participant H1 as 10.0.0.2",
+		"    participant H2 as 运营商A<br/>10.0.0.3",
+		"    Note over H0,H2: [1] call-a",
+		"    Note over H0,H2: [2] call-b",
+		"    H0->>H1: [1] INVITE (SDP)<br/>audio 10.0.0.1:5000 PCMA#59;PCMU #35;1",
+		"    H1->>H2: [2] INVITE (SDP) +2ms<br/>audio 10.0.0.2:4000 PCMA",
+		"    H1-->>H0: [1] 100 Trying +8ms",
+		"    H2-->>H1: [2] 200 OK (SDP) +2.300s<br/>audio 10.0.0.3:6000 PCMA",
+		"    H1->>H1: [1] OPTIONS +1ms",
+	}
+	if got := strings.TrimSpace(buf.String()); got != strings.Join(want, "\n") {
+		t.Errorf("Mermaid =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestWritePlantUML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testDiagram(false).Render(&buf, FormatPlantUML); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"@startuml",
+		"title call-a 1001 -> 13800138000",
+		`participant "10.0.0.1" as H0`,
+		`participant "10.0.0.2" as H1`,
+		`participant "运营商A\n10.0.0.3" as H2`,
+		`H0 -[#333333]> H1 : INVITE (SDP)\naudio 10.0.0.1:5000 PCMA;PCMU #1`,
+		`H1 -[#333333]> H2 : INVITE (SDP) +2ms\naudio 10.0.0.2:4000 PCMA`,
+		`H1 -[#333333]-> H0 : 100 Trying +8ms`,
+		`H2 -[#333333]-> H1 : 200 OK (SDP) +2.300s\naudio 10.0.0.3:6000 PCMA`,
+		`H1 -[#333333]> H1 : OPTIONS +1ms`,
+		"@enduml",
+	}
+	if got := strings.TrimSpace(buf.String()); got != strings.Join(want, "\n") {
+		t.Errorf("PlantUML =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("abcdefgh", 6); got != "abc..." {
+		t.Errorf("truncate = %q", got)
+	}
+	if got := truncate("运营商ABC", 7); got != "运营..." {
+		t.Errorf("truncate = %q", got)
+	}
+	if got := asciiOnly("运营商A"); got != "???A" {
+		t.Errorf("asciiOnly = %q", got)
+	}
+}
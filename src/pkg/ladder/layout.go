@@ -0,0 +1,164 @@
+package ladder
+
+// 布局尺寸，单位为像素，按7像素宽的等宽字体计算文字宽度
+const (
+	charWidth      = 7
+	lineHeight     = 16
+	margin         = 16
+	gutterWidth    = 64  // 左侧时间列
+	minColumnWidth = 150 // 列宽按最长的箭头文字和SDP摘要计算，不小于该宽度
+	maxColumnWidth = 360 // 超出时截断文字
+	boxHeight      = 40
+	boxPadding     = 8
+	rowHeight      = 44
+	selfLoopWidth  = 24
+	arrowLength    = 10
+	arrowHalfWidth = 4
+)
+
+const (
+	colorText     = "#222222"
+	colorMuted    = "#777777"
+	colorLifeline = "#bbbbbb"
+	colorBox      = "#f3f6fa"
+	colorBoxLine  = "#5b6b7b"
+)
+
+// 文字对齐方式
+const (
+	anchorStart = iota
+	anchorMiddle
+)
+
+// canvas SVG和PNG共用的绘图操作，y为文字的基线
+type canvas interface {
+	rect(x, y, w, h int, stroke, fill string)
+	line(x1, y1, x2, y2 int, color string, dashed bool)
+	// arrowHead 画箭头，尖端在(x, y)，left为true时指向左
+	arrowHead(x, y int, left bool, color string)
+	text(x, y int, s string, color string, anchor int, bold bool)
+}
+
+type layout struct {
+	seq         *sequence
+	columnWidth int
+	width       int
+	height      int
+	legendTop   int
+	boxTop      int
+	firstRow    int
+}
+
+func newLayout(s *sequence) *layout {
+	l := &layout{seq: s, columnWidth: minColumnWidth}
+	for _, h := range s.hosts {
+		for _, line := range h.title() {
+			l.columnWidth = max(l.columnWidth, textWidth(line)*charWidth+2*boxPadding+8)
+		}
+	}
+	for i, r := range s.rows {
+		span := max(abs(r.to-r.from), 1)
+		need := max(textWidth(r.text(i == 0)), textWidth(r.SDP))*charWidth + 24
+		l.columnWidth = max(l.columnWidth, (need+span-1)/span)
+	}
+	l.columnWidth = min(l.columnWidth, maxColumnWidth)
+
+	l.legendTop = margin
+	if s.title != "" {
+		l.legendTop += lineHeight + 8
+	}
+	l.boxTop = l.legendTop
+	if s.multiLeg() {
+		l.boxTop += len(s.legs)*lineHeight + 8
+	}
+	l.firstRow = l.boxTop + boxHeight + 28
+	l.width = 2*margin + gutterWidth + len(s.hosts)*l.columnWidth
+	l.height = l.firstRow + (len(s.rows)-1)*rowHeight + 24 + margin
+	return l
+}
+
+// x 列中线的横坐标
+func (l *layout) x(column int) int {
+	return margin + gutterWidth + column*l.columnWidth + l.columnWidth/2
+}
+
+// y 行箭头的纵坐标
+func (l *layout) y(row int) int {
+	return l.firstRow + row*rowHeight
+}
+
+func (l *layout) draw(c canvas) {
+	s := l.seq
+	c.rect(0, 0, l.width, l.height, "", "#ffffff")
+
+	if s.title != "" {
+		c.text(margin, margin+12, truncate(s.title, (l.width-2*margin)/charWidth), colorText, anchorStart, true)
+	}
+	if s.multiLeg() {
+		for i, leg := range s.legs {
+			y := l.legendTop + i*lineHeight
+			c.rect(margin, y+2, 10, 10, "", s.color(i))
+			c.text(margin+16, y+11, truncate(leg, (l.width-2*margin-16)/charWidth), colorText, anchorStart, false)
+		}
+	}
+
+	// 列头和生命线
+	bottom := l.height - margin
+	for i, h := range s.hosts {
+		x := l.x(i)
+		boxWidth := l.columnWidth - 2*boxPadding
+		c.line(x, l.boxTop+boxHeight, x, bottom, colorLifeline, true)
+		c.rect(x-boxWidth/2, l.boxTop, boxWidth, boxHeight, colorBoxLine, colorBox)
+		lines := h.title()
+		maxChars := (boxWidth - 8) / charWidth
+		if len(lines) == 1 {
+			c.text(x, l.boxTop+boxHeight/2+4, truncate(lines[0], maxChars), colorText, anchorMiddle, true)
+		} else {
+			c.text(x, l.boxTop+16, truncate(lines[0], maxChars), colorText, anchorMiddle, true)
+			c.text(x, l.boxTop+32, truncate(lines[1], maxChars), colorMuted, anchorMiddle, false)
+		}
+	}
+
+	for i, r := range s.rows {
+		y := l.y(i)
+		color := s.color(r.leg)
+		c.text(margin, y+4, formatOffset(r.offset), colorMuted, anchorStart, false)
+
+		x1, x2 := l.x(r.from), l.x(r.to)
+		label := r.text(i == 0)
+		if r.from == r.to {
+			// 发给自己的消息画为向右的环
+			right := x1 + selfLoopWidth
+			c.line(x1, y, right, y, color, r.Response)
+			c.line(right, y, right, y+10, color, r.Response)
+			c.line(right, y+10, x1+arrowLength, y+10, color, r.Response)
+			c.arrowHead(x1, y+10, true, color)
+			maxChars := (l.columnWidth - selfLoopWidth) / charWidth
+			c.text(x1+4, y-6, truncate(label, maxChars), color, anchorStart, false)
+			if r.SDP != "" {
+				c.text(right+6, y+14, truncate(r.SDP, maxChars), colorMuted, anchorStart, false)
+			}
+			continue
+		}
+
+		left := x2 < x1
+		tail := x2 - arrowLength
+		if left {
+			tail = x2 + arrowLength
+		}
+		c.line(x1, y, tail, y, color, r.Response)
+		c.arrowHead(x2, y, left, color)
+		maxChars := (abs(x2-x1) - 8) / charWidth
+		c.text((x1+x2)/2, y-6, truncate(label, maxChars), color, anchorMiddle, false)
+		if r.SDP != "" {
+			c.text((x1+x2)/2, y+14, truncate(r.SDP, maxChars), colorMuted, anchorMiddle, false)
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
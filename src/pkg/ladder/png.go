@@ -0,0 +1,143 @@
+package ladder
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// PNG在内存中按RGBA绘制，限制图片大小
+const (
+	maxPNGRows   = 500
+	maxPNGWidth  = 4096
+	maxPNGPixels = 32 << 20
+)
+
+var ErrPNGTooLarge = errors.New("时序图太大，无法输出PNG，请使用SVG或文本格式")
+
+// WritePNG 输出PNG图片，消息行数或图片大小超过上限时返回ErrPNGTooLarge
+func (d *Diagram) WritePNG(w io.Writer) error {
+	s, err := d.sequence()
+	if err != nil {
+		return err
+	}
+	// 位图字体只有ASCII字形，非ASCII的名称不显示，列头只显示地址
+	for i := range s.hosts {
+		if !isASCII(s.hosts[i].name) {
+			s.hosts[i].name = ""
+		}
+	}
+	if len(s.rows) > maxPNGRows {
+		return ErrPNGTooLarge
+	}
+	l := newLayout(s)
+	if l.width > maxPNGWidth || l.width*l.height > maxPNGPixels {
+		return ErrPNGTooLarge
+	}
+	c := &pngCanvas{img: image.NewRGBA(image.Rect(0, 0, l.width, l.height))}
+	l.draw(c)
+	return png.Encode(w, c.img)
+}
+
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+func (c *pngCanvas) fill(x, y, w, h int, col color.Color) {
+	draw.Draw(c.img, image.Rect(x, y, x+w, y+h), image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+func (c *pngCanvas) rect(x, y, w, h int, stroke, fill string) {
+	if fill != "" {
+		c.fill(x, y, w, h, parseColor(fill))
+	}
+	if stroke != "" {
+		col := parseColor(stroke)
+		c.fill(x, y, w, 1, col)
+		c.fill(x, y+h-1, w, 1, col)
+		c.fill(x, y, 1, h, col)
+		c.fill(x+w-1, y, 1, h, col)
+	}
+}
+
+// line Bresenham画线，虚线为画6个像素空4个像素
+func (c *pngCanvas) line(x1, y1, x2, y2 int, colorHex string, dashed bool) {
+	col := parseColor(colorHex)
+	dx, dy := abs(x2-x1), -abs(y2-y1)
+	sx, sy := 1, 1
+	if x1 > x2 {
+		sx = -1
+	}
+	if y1 > y2 {
+		sy = -1
+	}
+	e := dx + dy
+	for step := 0; ; step++ {
+		if !dashed || step%10 < 6 {
+			c.img.Set(x1, y1, col)
+		}
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x1 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y1 += sy
+		}
+	}
+}
+
+func (c *pngCanvas) arrowHead(x, y int, left bool, colorHex string) {
+	col := parseColor(colorHex)
+	dir := -1
+	if left {
+		dir = 1
+	}
+	for i := 0; i <= arrowLength; i++ {
+		half := i * arrowHalfWidth / arrowLength
+		c.fill(x+dir*i, y-half, 1, 2*half+1, col)
+	}
+}
+
+func (c *pngCanvas) text(x, y int, s string, colorHex string, anchor int, bold bool) {
+	s = asciiOnly(s)
+	if anchor == anchorMiddle {
+		x -= len(s) * charWidth / 2
+	}
+	d := &font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(parseColor(colorHex)),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+	if bold {
+		// 位图字体没有粗体，右移一个像素再画一次
+		d.Dot = fixed.P(x+1, y)
+		d.DrawString(s)
+	}
+}
+
+// parseColor 解析#rrggbb格式的颜色
+func parseColor(s string) color.Color {
+	if len(s) != 7 || s[0] != '#' {
+		return color.Black
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.Black
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
@@ -0,0 +1,74 @@
+package ladder
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteSVG 输出SVG图片
+func (d *Diagram) WriteSVG(w io.Writer) error {
+	s, err := d.sequence()
+	if err != nil {
+		return err
+	}
+	l := newLayout(s)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Menlo, Consolas, 'DejaVu Sans Mono', monospace" font-size="12">`+"\n",
+		l.width, l.height, l.width, l.height)
+	if s.title != "" {
+		fmt.Fprintf(bw, "<title>%s</title>\n", escapeXML(s.title))
+	}
+	l.draw(&svgCanvas{w: bw})
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+type svgCanvas struct {
+	w *bufio.Writer
+}
+
+func (c *svgCanvas) rect(x, y, w, h int, stroke, fill string) {
+	if stroke == "" {
+		stroke = "none"
+	}
+	fmt.Fprintf(c.w, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="%s" stroke="%s"/>`+"\n",
+		x, y, w, h, min(w, h)/8, fill, stroke)
+}
+
+func (c *svgCanvas) line(x1, y1, x2, y2 int, color string, dashed bool) {
+	dash := ""
+	if dashed {
+		dash = ` stroke-dasharray="6,4"`
+	}
+	fmt.Fprintf(c.w, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="1.5"%s/>`+"\n",
+		x1, y1, x2, y2, color, dash)
+}
+
+func (c *svgCanvas) arrowHead(x, y int, left bool, color string) {
+	base := x - arrowLength
+	if left {
+		base = x + arrowLength
+	}
+	fmt.Fprintf(c.w, `<polygon points="%d,%d %d,%d %d,%d" fill="%s"/>`+"\n",
+		x, y, base, y-arrowHalfWidth, base, y+arrowHalfWidth, color)
+}
+
+func (c *svgCanvas) text(x, y int, s string, color string, anchor int, bold bool) {
+	attrs := ""
+	if anchor == anchorMiddle {
+		attrs += ` text-anchor="middle"`
+	}
+	if bold {
+		attrs += ` font-weight="bold"`
+	}
+	fmt.Fprintf(c.w, `<text x="%d" y="%d" fill="%s"%s xml:space="preserve">%s</text>`+"\n", x, y, color, attrs, escapeXML(s))
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package ladder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// participantID 文本格式中列的标识，地址中的:和.不能直接作为标识
+func participantID(column int) string {
+	return fmt.Sprintf("H%d", column)
+}
+
+// WriteMermaid 输出Mermaid sequenceDiagram
+func (d *Diagram) WriteMermaid(w io.Writer) error {
+	s, err := d.sequence()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("sequenceDiagram\n")
+	if s.title != "" {
+		fmt.Fprintf(bw, "    title %s\n", escapeMermaid(s.title))
+	}
+	for i, h := range s.hosts {
+		lines := h.title()
+		for j := range lines {
+			lines[j] = escapeMermaid(lines[j])
+		}
+		fmt.Fprintf(bw, "    participant %s as %s\n", participantID(i), strings.Join(lines, "<br/>"))
+	}
+	if s.multiLeg() {
+		over := participantID(0)
+		if len(s.hosts) > 1 {
+			over += "," + participantID(len(s.hosts)-1)
+		}
+		for i, leg := range s.legs {
+			fmt.Fprintf(bw, "    Note over %s: [%d] %s\n", over, i+1, escapeMermaid(leg))
+		}
+	}
+	for i, r := range s.rows {
+		arrow := "->>"
+		if r.Response {
+			arrow = "-->>"
+		}
+		text := escapeMermaid(r.text(i == 0))
+		if s.multiLeg() {
+			text = fmt.Sprintf("[%d] %s", r.leg+1, text)
+		}
+		if r.SDP != "" {
+			text += "<br/>" + escapeMermaid(r.SDP)
+		}
+		fmt.Fprintf(bw, "    %s%s%s: %s\n", participantID(r.from), arrow, participantID(r.to), text)
+	}
+	return bw.Flush()
+}
+
+// escapeMermaid #和;在Mermaid中有特殊含义，用实体编码
+func escapeMermaid(s string) string {
+	return strings.NewReplacer("#", "#35;", ";", "#59;", "\r", "", "\n", " ").Replace(s)
+}
+
+// WritePlantUML 输出PlantUML时序图
+func (d *Diagram) WritePlantUML(w io.Writer) error {
+	s, err := d.sequence()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("@startuml\n")
+	if s.title != "" {
+		fmt.Fprintf(bw, "title %s\n", escapePlantUML(s.title))
+	}
+	for i, h := range s.hosts {
+		lines := h.title()
+		for j := range lines {
+			lines[j] = strings.ReplaceAll(escapePlantUML(lines[j]), `"`, `'`)
+		}
+		fmt.Fprintf(bw, "participant \"%s\" as %s\n", strings.Join(lines, `\n`), participantID(i))
+	}
+	if s.multiLeg() {
+		bw.WriteString("legend top left\n")
+		for i, leg := range s.legs {
+			fmt.Fprintf(bw, "<color:%s>[%d] %s</color>\n", s.color(i), i+1, escapePlantUML(leg))
+		}
+		bw.WriteString("endlegend\n")
+	}
+	for i, r := range s.rows {
+		arrow := ">"
+		if r.Response {
+			arrow = "->"
+		}
+		text := escapePlantUML(r.text(i == 0))
+		if s.multiLeg() {
+			text = fmt.Sprintf("[%d] %s", r.leg+1, text)
+		}
+		if r.SDP != "" {
+			text += `\n` + escapePlantUML(r.SDP)
+		}
+		fmt.Fprintf(bw, "%s -[%s]%s %s : %s\n", participantID(r.from), s.color(r.leg), arrow, participantID(r.to), text)
+	}
+	bw.WriteString("@enduml\n")
+	return bw.Flush()
+}
+
+// escapePlantUML 反斜杠在PlantUML中是转义符，换行会结束当前语句
+func escapePlantUML(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\r", "", "\n", " ").Replace(s)
+}
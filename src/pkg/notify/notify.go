@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// 通知的状态
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Message 一条告警通知，各通知渠道按自己的格式发送
+type Message struct {
+	Title  string            `json:"title"`
+	Text   string            `json:"text"`
+	State  string            `json:"state"` // firing/resolved
+	Labels map[string]string `json:"labels"`
+	Time   time.Time         `json:"time"`
+}
+
+// Notifier 告警通知渠道
+type Notifier interface {
+	// Name 渠道名称，告警规则按名称选择通知渠道
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testMessage() Message {
+	return Message{
+		Title:  "[告警] 网关ASR过低",
+		Text:   "网关 carrier-a 的ASR为20.00，低于阈值30.00",
+		State:  StateFiring,
+		Labels: map[string]string{"rule_id": "1", "metric": "asr"},
+		Time:   time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan Message, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("请求方法或类型错误：%s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("解析请求失败：%v", err)
+		}
+		received <- msg
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.URL)
+	if err := n.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("发送失败：%v", err)
+	}
+	msg := <-received
+	if msg.Title != testMessage().Title || msg.State != StateFiring || msg.Labels["metric"] != "asr" {
+		t.Errorf("收到的通知错误：%+v", msg)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if err := NewWebhookNotifier(failing.URL).Send(context.Background(), testMessage()); err == nil {
+		t.Errorf("非2xx响应应返回错误")
+	}
+}
+
+// 只实现发送邮件所需命令的SMTP服务器
+func startTestSMTPServer(t *testing.T) (string, chan string, chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	mails := make(chan string, 1)
+	rcpts := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP test")
+		var to []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM"):
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO"):
+				to = append(to, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					l, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				mails <- data.String()
+				rcpts <- to
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), mails, rcpts
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, mails, rcpts := startTestSMTPServer(t)
+
+	n := NewSMTPNotifier(addr, "", "", "monitor@example.com", []string{"ops@example.com", "noc@example.com"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := n.Send(ctx, testMessage()); err != nil {
+		t.Fatalf("发送失败：%v", err)
+	}
+
+	if to := <-rcpts; len(to) != 2 || to[0] != "ops@example.com" || to[1] != "noc@example.com" {
+		t.Errorf("收件人错误：%v", to)
+	}
+
+	mail := <-mails
+	header, body, ok := strings.Cut(mail, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("邮件格式错误：%q", mail)
+	}
+	var subject string
+	for _, line := range strings.Split(header, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "Subject: "); ok {
+			subject, _ = new(mime.WordDecoder).DecodeHeader(v)
+		}
+	}
+	if subject != testMessage().Title {
+		t.Errorf("邮件标题错误：%q", subject)
+	}
+	text, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\r\n", ""))
+	if err != nil || string(text) != testMessage().Text {
+		t.Errorf("邮件正文错误：%q %v", text, err)
+	}
+}
+
+func TestSyslogNotifier(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	n := NewSyslogNotifier("udp://"+conn.LocalAddr().String(), "")
+	if err := n.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("发送失败：%v", err)
+	}
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	size, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("未收到syslog消息：%v", err)
+	}
+	line := string(buf[:size])
+	// local0.warning
+	if !strings.HasPrefix(line, "<132>1 2025-04-11T10:00:00.000000Z ") {
+		t.Errorf("syslog头部错误：%q", line)
+	}
+	if !strings.Contains(line, " sip-monitor ") || !strings.Contains(line, " firing - [告警] 网关ASR过低 网关 carrier-a") {
+		t.Errorf("syslog内容错误：%q", line)
+	}
+
+	resolved := testMessage()
+	resolved.State = StateResolved
+	if got := n.format(resolved); !strings.HasPrefix(got, "<133>1 ") {
+		t.Errorf("恢复通知应为notice级别：%q", got)
+	}
+}
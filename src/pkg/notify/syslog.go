@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+ RFC 5424 - The Syslog Protocol
+
+    SYSLOG-MSG = HEADER SP STRUCTURED-DATA [SP MSG]
+    HEADER     = PRI VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID
+    PRI        = "<" facility * 8 + severity ">"
+
+ eg:
+ <132>1 2025-04-11T10:00:00.000000+08:00 monitor sip-monitor 1234 firing - [告警] 网关ASR过低
+
+ Messages are sent over UDP as one datagram each (RFC 5426), over TCP
+ they are framed with octet counting (RFC 6587 section 3.4.1).
+
+*/
+
+const (
+	syslogFacilityLocal0  = 16
+	syslogSeverityWarning = 4
+	syslogSeverityNotice  = 5
+)
+
+// SyslogNotifier 以RFC 5424格式发送告警到syslog服务器
+type SyslogNotifier struct {
+	network  string // udp/tcp
+	addr     string
+	appName  string
+	hostname string
+}
+
+// NewSyslogNotifier 地址格式为 udp://host:514 或 tcp://host:514，不带协议时使用udp
+func NewSyslogNotifier(addr, appName string) *SyslogNotifier {
+	network := "udp"
+	if scheme, rest, ok := strings.Cut(addr, "://"); ok {
+		network = strings.ToLower(scheme)
+		addr = rest
+	}
+	if appName == "" {
+		appName = "sip-monitor"
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogNotifier{
+		network:  network,
+		addr:     addr,
+		appName:  appName,
+		hostname: hostname,
+	}
+}
+
+func (n *SyslogNotifier) Name() string {
+	return "syslog"
+}
+
+func (n *SyslogNotifier) Send(ctx context.Context, msg Message) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, n.network, n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	line := n.format(msg)
+	if n.network == "tcp" {
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+	_, err = conn.Write([]byte(line))
+	return err
+}
+
+func (n *SyslogNotifier) format(msg Message) string {
+	severity := syslogSeverityWarning
+	if msg.State == StateResolved {
+		severity = syslogSeverityNotice
+	}
+	sendTime := msg.Time
+	if sendTime.IsZero() {
+		sendTime = time.Now()
+	}
+	msgID := msg.State
+	if msgID == "" {
+		msgID = "-"
+	}
+
+	text := msg.Title
+	if msg.Text != "" {
+		text += " " + msg.Text
+	}
+	// 一条syslog消息不能换行
+	text = strings.ReplaceAll(text, "\n", " ")
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		syslogFacilityLocal0*8+severity,
+		sendTime.Format("2006-01-02T15:04:05.000000Z07:00"),
+		n.hostname, n.appName, os.Getpid(), msgID, text)
+}
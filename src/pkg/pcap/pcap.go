@@ -0,0 +1,237 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+/*
+ libpcap file format
+
+ Global header (24 bytes):
+
+    magic_number  uint32  0xa1b2c3d4 (microseconds) or 0xa1b23c4d (nanoseconds),
+                          byte swapped when written on the other endianness
+    version_major uint16
+    version_minor uint16
+    thiszone      int32
+    sigfigs       uint32
+    snaplen       uint32
+    network       uint32  link-layer header type
+
+ Record header (16 bytes) before each packet:
+
+    ts_sec   uint32
+    ts_usec  uint32  microseconds, or nanoseconds for the nanosecond magic
+    incl_len uint32  bytes saved in the file
+    orig_len uint32  length of the packet on the wire
+
+ pcapng files are not supported.
+
+*/
+
+// Link-layer header types
+const (
+	LinkTypeNull     = 0
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLinuxSLL = 113
+)
+
+// IP protocol numbers
+const (
+	ProtocolTCP = 6
+	ProtocolUDP = 17
+)
+
+const (
+	magicMicro  = 0xa1b2c3d4
+	magicNano   = 0xa1b23c4d
+	magicPcapNG = 0x0a0d0d0a
+
+	maxSnapLen = 256 << 10
+)
+
+var ErrPcapNG = errors.New("不支持pcapng格式，请先转换为pcap：editcap -F pcap in.pcapng out.pcap")
+
+// Packet 文件中的一个数据包
+type Packet struct {
+	Time time.Time
+	Data []byte
+}
+
+// Reader 按顺序读取pcap文件中的数据包
+type Reader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nano     bool
+	LinkType uint32
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	reader := &Reader{r: r}
+	switch magic := binary.LittleEndian.Uint32(header); {
+	case magic == magicMicro || magic == magicNano:
+		reader.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == magicMicro || binary.BigEndian.Uint32(header) == magicNano:
+		reader.order = binary.BigEndian
+	case magic == magicPcapNG:
+		return nil, ErrPcapNG
+	default:
+		return nil, fmt.Errorf("不是pcap文件，magic为%#x", magic)
+	}
+	reader.nano = reader.order.Uint32(header) == magicNano
+	reader.LinkType = reader.order.Uint32(header[20:])
+	return reader, nil
+}
+
+// Next 读取下一个数据包，文件结束时返回io.EOF
+func (r *Reader) Next() (Packet, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		return Packet{}, err
+	}
+	sec := r.order.Uint32(header)
+	frac := r.order.Uint32(header[4:])
+	length := r.order.Uint32(header[8:])
+	if length > maxSnapLen {
+		return Packet{}, fmt.Errorf("数据包长度错误：%d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Packet{}, io.ErrUnexpectedEOF
+	}
+
+	nsec := int64(frac) * 1000
+	if r.nano {
+		nsec = int64(frac)
+	}
+	return Packet{Time: time.Unix(int64(sec), nsec), Data: data}, nil
+}
+
+// Frame 解析出的传输层数据
+type Frame struct {
+	SrcIP    net.IP
+	DstIP    net.IP
+	SrcPort  uint16
+	DstPort  uint16
+	Protocol byte // ProtocolTCP/ProtocolUDP
+	Payload  []byte
+}
+
+// Decode 解析链路层、IPv4/IPv6和TCP/UDP头部，不支持的协议和IP分片返回false
+func Decode(linkType uint32, data []byte) (Frame, bool) {
+	var etherType uint16
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return Frame{}, false
+		}
+		etherType = binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		// 802.1Q VLAN
+		for etherType == 0x8100 && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return Frame{}, false
+		}
+		etherType = binary.BigEndian.Uint16(data[14:])
+		data = data[16:]
+	case LinkTypeNull:
+		if len(data) < 4 {
+			return Frame{}, false
+		}
+		// 协议族为抓包主机的字节序，AF_INET为2，其他按IPv6处理
+		family := binary.LittleEndian.Uint32(data)
+		if family > 0xFFFF {
+			family = binary.BigEndian.Uint32(data)
+		}
+		if family == 2 {
+			etherType = 0x0800
+		} else {
+			etherType = 0x86DD
+		}
+		data = data[4:]
+	case LinkTypeRaw:
+		if len(data) == 0 {
+			return Frame{}, false
+		}
+		etherType = 0x86DD
+		if data[0]>>4 == 4 {
+			etherType = 0x0800
+		}
+	default:
+		return Frame{}, false
+	}
+
+	var frame Frame
+	switch etherType {
+	case 0x0800:
+		if len(data) < 20 || data[0]>>4 != 4 {
+			return Frame{}, false
+		}
+		headerLength := int(data[0]&0x0F) * 4
+		totalLength := int(binary.BigEndian.Uint16(data[2:]))
+		// MF标志或分片偏移不为0
+		if binary.BigEndian.Uint16(data[6:])&0x3FFF != 0 {
+			return Frame{}, false
+		}
+		if headerLength < 20 || totalLength < headerLength || totalLength > len(data) {
+			return Frame{}, false
+		}
+		frame.Protocol = data[9]
+		frame.SrcIP = net.IP(data[12:16])
+		frame.DstIP = net.IP(data[16:20])
+		data = data[headerLength:totalLength]
+	case 0x86DD:
+		if len(data) < 40 || data[0]>>4 != 6 {
+			return Frame{}, false
+		}
+		payloadLength := int(binary.BigEndian.Uint16(data[4:]))
+		if 40+payloadLength > len(data) {
+			return Frame{}, false
+		}
+		// 不处理扩展头
+		frame.Protocol = data[6]
+		frame.SrcIP = net.IP(data[8:24])
+		frame.DstIP = net.IP(data[24:40])
+		data = data[40 : 40+payloadLength]
+	default:
+		return Frame{}, false
+	}
+
+	switch frame.Protocol {
+	case ProtocolUDP:
+		if len(data) < 8 {
+			return Frame{}, false
+		}
+		frame.SrcPort = binary.BigEndian.Uint16(data)
+		frame.DstPort = binary.BigEndian.Uint16(data[2:])
+		frame.Payload = data[8:]
+	case ProtocolTCP:
+		if len(data) < 20 {
+			return Frame{}, false
+		}
+		offset := int(data[12]>>4) * 4
+		if offset < 20 || offset > len(data) {
+			return Frame{}, false
+		}
+		frame.SrcPort = binary.BigEndian.Uint16(data)
+		frame.DstPort = binary.BigEndian.Uint16(data[2:])
+		frame.Payload = data[offset:]
+	default:
+		return Frame{}, false
+	}
+	return frame, true
+}
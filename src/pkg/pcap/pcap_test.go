@@ -0,0 +1,149 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func ipv4UDP(src, dst string, srcPort, dstPort uint16, payload []byte) []byte {
+	udp := binary.BigEndian.AppendUint16(nil, srcPort)
+	udp = binary.BigEndian.AppendUint16(udp, dstPort)
+	udp = binary.BigEndian.AppendUint16(udp, uint16(8+len(payload)))
+	udp = append(udp, 0, 0)
+	udp = append(udp, payload...)
+
+	ip := []byte{0x45, 0}
+	ip = binary.BigEndian.AppendUint16(ip, uint16(20+len(udp)))
+	ip = append(ip, 0, 0, 0x40, 0, 64, ProtocolUDP, 0, 0)
+	ip = append(ip, net.ParseIP(src).To4()...)
+	ip = append(ip, net.ParseIP(dst).To4()...)
+	return append(ip, udp...)
+}
+
+func ipv6TCP(src, dst string, srcPort, dstPort uint16, payload []byte) []byte {
+	tcp := binary.BigEndian.AppendUint16(nil, srcPort)
+	tcp = binary.BigEndian.AppendUint16(tcp, dstPort)
+	tcp = append(tcp, make([]byte, 8)...)
+	tcp = append(tcp, 5<<4, 0x18, 0, 0, 0, 0, 0, 0)
+	tcp = append(tcp, payload...)
+
+	ip := []byte{0x60, 0, 0, 0}
+	ip = binary.BigEndian.AppendUint16(ip, uint16(len(tcp)))
+	ip = append(ip, ProtocolTCP, 64)
+	ip = append(ip, net.ParseIP(src).To16()...)
+	ip = append(ip, net.ParseIP(dst).To16()...)
+	return append(ip, tcp...)
+}
+
+func writePcap(order binary.ByteOrder, magic, linkType uint32, packets []Packet) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	order.PutUint32(header, magic)
+	order.PutUint16(header[4:], 2)
+	order.PutUint16(header[6:], 4)
+	order.PutUint32(header[16:], 65535)
+	order.PutUint32(header[20:], linkType)
+	buf.Write(header)
+	for _, packet := range packets {
+		record := make([]byte, 16)
+		order.PutUint32(record, uint32(packet.Time.Unix()))
+		frac := packet.Time.Nanosecond() / 1000
+		if magic == magicNano {
+			frac = packet.Time.Nanosecond()
+		}
+		order.PutUint32(record[4:], uint32(frac))
+		order.PutUint32(record[8:], uint32(len(packet.Data)))
+		order.PutUint32(record[12:], uint32(len(packet.Data)))
+		buf.Write(record)
+		buf.Write(packet.Data)
+	}
+	return buf.Bytes()
+}
+
+func TestReader_EthernetUDP(t *testing.T) {
+	begin := time.Date(2025, 4, 11, 10, 0, 0, 123456000, time.UTC)
+	ethernet := append(make([]byte, 12), 0x81, 0x00, 0x00, 0x64, 0x08, 0x00) // 带VLAN标签
+	sip := []byte("OPTIONS sip:10.0.0.2 SIP/2.0\r\n\r\n")
+	fragment := ipv4UDP("10.0.0.1", "10.0.0.2", 5060, 5060, sip)
+	fragment[6] = 0x20 // MF
+
+	file := writePcap(binary.LittleEndian, magicMicro, LinkTypeEthernet, []Packet{
+		{Time: begin, Data: append(append([]byte(nil), ethernet...), ipv4UDP("10.0.0.1", "10.0.0.2", 5060, 5080, sip)...)},
+		{Time: begin.Add(time.Second), Data: append(append([]byte(nil), ethernet...), fragment...)},
+	})
+	reader, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.LinkType != LinkTypeEthernet {
+		t.Errorf("链路类型错误：%d", reader.LinkType)
+	}
+
+	packet, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !packet.Time.Equal(begin) {
+		t.Errorf("时间错误：%v", packet.Time)
+	}
+	frame, ok := Decode(reader.LinkType, packet.Data)
+	if !ok || frame.Protocol != ProtocolUDP || frame.SrcIP.String() != "10.0.0.1" || frame.DstPort != 5080 || !bytes.Equal(frame.Payload, sip) {
+		t.Errorf("解析错误：%+v", frame)
+	}
+
+	packet, _ = reader.Next()
+	if _, ok := Decode(reader.LinkType, packet.Data); ok {
+		t.Error("IP分片不应解析")
+	}
+	if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("文件结束应返回io.EOF，得到%v", err)
+	}
+}
+
+func TestReader_BigEndianNanoSLLTCP(t *testing.T) {
+	begin := time.Date(2025, 4, 11, 10, 0, 0, 123456789, time.UTC)
+	sll := make([]byte, 16)
+	binary.BigEndian.PutUint16(sll[14:], 0x86DD)
+	payload := []byte("SIP/2.0 200 OK\r\n\r\n")
+	file := writePcap(binary.BigEndian, magicNano, LinkTypeLinuxSLL, []Packet{
+		{Time: begin, Data: append(sll, ipv6TCP("2001:db8::1", "2001:db8::2", 5061, 40000, payload)...)},
+	})
+
+	reader, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !packet.Time.Equal(begin) {
+		t.Errorf("纳秒时间错误：%v", packet.Time)
+	}
+	frame, ok := Decode(reader.LinkType, packet.Data)
+	if !ok || frame.Protocol != ProtocolTCP || frame.SrcIP.String() != "2001:db8::1" || frame.SrcPort != 5061 || !bytes.Equal(frame.Payload, payload) {
+		t.Errorf("解析错误：%+v", frame)
+	}
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+	pcapng := []byte{0x0a, 0x0d, 0x0d, 0x0a}
+	pcapng = append(pcapng, make([]byte, 20)...)
+	if _, err := NewReader(bytes.NewReader(pcapng)); !errors.Is(err, ErrPcapNG) {
+		t.Errorf("pcapng应返回ErrPcapNG，得到%v", err)
+	}
+	if _, err := NewReader(bytes.NewReader(make([]byte, 24))); err == nil {
+		t.Error("非pcap文件应返回错误")
+	}
+	// 截断的数据包
+	file := writePcap(binary.LittleEndian, magicMicro, LinkTypeRaw, []Packet{{Time: time.Unix(0, 0), Data: make([]byte, 40)}})
+	reader, _ := NewReader(bytes.NewReader(file[:len(file)-10]))
+	if _, err := reader.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("截断的数据包应返回io.ErrUnexpectedEOF，得到%v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+/*
+ Kafka
+
+ Events are produced with acks=all by an idempotent producer, so a batch is
+ acknowledged once all in-sync replicas have it and a retried request does
+ not write a record twice. The partition is chosen by the murmur2 hash of
+ the event key, the same as the Java client, so events of one call stay in
+ order on one partition.
+
+ Connections can use TLS and SASL PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512.
+
+*/
+
+// KafkaSecurity Kafka连接的TLS和SASL认证配置
+type KafkaSecurity struct {
+	TLS bool
+	// SASLMechanism PLAIN、SCRAM-SHA-256、SCRAM-SHA-512，为空时不认证
+	SASLMechanism string
+	User          string
+	Password      string
+}
+
+// KafkaSink 写入事件到Kafka主题，acks=all
+type KafkaSink struct {
+	brokers []string
+	topic   string
+	client  *kgo.Client
+}
+
+// NewKafkaSink brokers为逗号分隔的 host:port 列表
+func NewKafkaSink(brokers, topic string, security KafkaSecurity) (*KafkaSink, error) {
+	var addrs []string
+	for _, broker := range strings.Split(brokers, ",") {
+		broker = strings.TrimSpace(broker)
+		if broker == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			broker = net.JoinHostPort(broker, "9092")
+		}
+		addrs = append(addrs, broker)
+	}
+	if len(addrs) == 0 || topic == "" {
+		return nil, errors.New("Kafka地址或主题为空")
+	}
+
+	options := []kgo.Opt{
+		kgo.SeedBrokers(addrs...),
+		kgo.DefaultProduceTopic(topic),
+		kgo.ClientID("sip-monitor"),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+	}
+	if security.TLS {
+		options = append(options, kgo.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	if security.SASLMechanism != "" {
+		mechanism, err := kafkaSASL(security)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, kgo.SASL(mechanism))
+	}
+	client, err := kgo.NewClient(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaSink{brokers: addrs, topic: topic, client: client}, nil
+}
+
+func kafkaSASL(security KafkaSecurity) (sasl.Mechanism, error) {
+	switch strings.ToUpper(security.SASLMechanism) {
+	case "PLAIN":
+		return plain.Auth{User: security.User, Pass: security.Password}.AsMechanism(), nil
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: security.User, Pass: security.Password}.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: security.User, Pass: security.Password}.AsSha512Mechanism(), nil
+	}
+	return nil, fmt.Errorf("不支持的Kafka SASL认证方式：%s", security.SASLMechanism)
+}
+
+func (s *KafkaSink) Name() string {
+	return "kafka"
+}
+
+func (s *KafkaSink) Endpoint() string {
+	return strings.Join(s.brokers, ",") + "/" + s.topic
+}
+
+// Publish 等待这批事件全部被确认，有Key时按Key选择分区，保证同一呼叫的事件有序
+func (s *KafkaSink) Publish(ctx context.Context, events []Event) error {
+	records := make([]*kgo.Record, 0, len(events))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		record := &kgo.Record{Value: data, Headers: []kgo.RecordHeader{{Key: "type", Value: []byte(event.Type)}}}
+		if event.Key != "" {
+			record.Key = []byte(event.Key)
+		}
+		records = append(records, record)
+	}
+	return s.client.ProduceSync(ctx, records...).FirstErr()
+}
+
+func (s *KafkaSink) Close() error {
+	s.client.Close()
+	return nil
+}
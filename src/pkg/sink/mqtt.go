@@ -0,0 +1,130 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+/*
+ MQTT Version 3.1.1
+
+ Events are published with QoS 1: each PUBLISH carries a packet identifier
+ and is acknowledged by a PUBACK with the same identifier, a batch succeeds
+ once every PUBACK has arrived. The session is clean, so messages that were
+ not acknowledged before a disconnect are sent again from the spool.
+
+ ssl://, tls:// and mqtts:// connect over TLS.
+
+*/
+
+const mqttKeepAlive = 60 * time.Second
+
+// MQTTSink 以QoS 1发布事件到MQTT，主题为 前缀/事件类型
+type MQTTSink struct {
+	url   *url.URL
+	topic string
+
+	mu     sync.Mutex
+	client mqtt.Client
+}
+
+// NewMQTTSink 地址格式为 tcp://[user:pass@]host:1883 或 mqtt://...，TLS使用 ssl://host:8883
+func NewMQTTSink(rawURL, topic string) (*MQTTSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		port = "8883"
+	default:
+		return nil, fmt.Errorf("MQTT地址格式错误：%s", rawURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("MQTT地址格式错误：%s", rawURL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	hostname, _ := os.Hostname()
+	broker := *u
+	broker.User = nil
+	options := mqtt.NewClientOptions().
+		AddBroker(broker.String()).
+		SetClientID(fmt.Sprintf("sip-monitor-%s-%d", hostname, os.Getpid())).
+		SetCleanSession(true).
+		SetKeepAlive(mqttKeepAlive).
+		SetAutoReconnect(false)
+	if u.User != nil {
+		options.SetUsername(u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			options.SetPassword(password)
+		}
+	}
+	return &MQTTSink{url: u, topic: topic, client: mqtt.NewClient(options)}, nil
+}
+
+func (s *MQTTSink) Name() string {
+	return "mqtt"
+}
+
+func (s *MQTTSink) Endpoint() string {
+	return s.url.Redacted() + "/" + s.topic
+}
+
+func (s *MQTTSink) Publish(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.client.IsConnectionOpen() {
+		if err := waitMQTT(ctx, s.client.Connect()); err != nil {
+			return fmt.Errorf("MQTT连接失败：%w", err)
+		}
+	}
+
+	tokens := make([]mqtt.Token, 0, len(events))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, s.client.Publish(s.topic+"/"+event.Type, 1, false, data))
+	}
+	for _, token := range tokens {
+		if err := waitMQTT(ctx, token); err != nil {
+			// 断开连接，未确认的消息不再由客户端重发，整批从缓存重发
+			s.client.Disconnect(0)
+			return err
+		}
+	}
+	return nil
+}
+
+// waitMQTT 等待操作完成，最长到ctx结束
+func waitMQTT(ctx context.Context, token mqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *MQTTSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client.IsConnectionOpen() {
+		s.client.Disconnect(250)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+/*
+ NATS JetStream
+
+ Events are published to JetStream, which answers every message with a
+ PubAck once the message is stored in a stream. A core NATS PUB is only
+ delivered to the subscribers connected at that moment, so it cannot back
+ the at-least-once guarantee of the spool.
+
+ A stream has to capture the subjects before events are published, e.g.
+
+    nats stream add sip-monitor --subjects "sip-monitor.>"
+
+ otherwise publishing fails with "no responders" and the events stay in
+ the spool. The event ID is sent as Nats-Msg-Id, so the stream drops a
+ batch that is sent again within its duplicate window.
+
+*/
+
+// NATSSink 发布事件到NATS JetStream，主题为 前缀.事件类型
+type NATSSink struct {
+	url     *url.URL
+	subject string
+
+	mu   sync.Mutex
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+// NewNATSSink 地址格式为 nats://[user:pass@]host:4222，TLS使用 tls://host:4222
+func NewNATSSink(rawURL, subject string) (*NATSSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+		return nil, fmt.Errorf("NATS地址格式错误：%s", rawURL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &NATSSink{url: u, subject: subject}, nil
+}
+
+func (s *NATSSink) Name() string {
+	return "nats"
+}
+
+func (s *NATSSink) Endpoint() string {
+	return s.url.Redacted() + "/" + s.subject
+}
+
+// Publish 异步发布一批事件，等待每个事件的PubAck
+func (s *NATSSink) Publish(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	futures := make([]jetstream.PubAckFuture, 0, len(events))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		msg := nats.NewMsg(s.subject + "." + event.Type)
+		msg.Data = data
+		future, err := s.js.PublishMsgAsync(msg, jetstream.WithMsgID(event.ID))
+		if err != nil {
+			return err
+		}
+		futures = append(futures, future)
+	}
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			return fmt.Errorf("JetStream未确认事件：%w", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *NATSSink) connect(ctx context.Context) error {
+	options := []nats.Option{nats.Name("sip-monitor")}
+	if deadline, ok := ctx.Deadline(); ok {
+		options = append(options, nats.Timeout(time.Until(deadline)))
+	}
+	conn, err := nats.Connect(s.url.String(), options...)
+	if err != nil {
+		return err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	s.conn, s.js = conn, js
+	return nil
+}
+
+func (s *NATSSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.js = nil, nil
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ Redis Streams
+
+    XADD <stream> [MAXLEN ~ <count>] * id <event id> type <event type> data <event JSON>
+
+ All XADD commands of a batch are pipelined and every reply is checked, an
+ error reply fails the batch. rediss:// connects over TLS.
+
+*/
+
+// RedisStreamSink 以XADD写入事件到Redis Stream
+type RedisStreamSink struct {
+	url    *url.URL
+	stream string
+	maxLen int64
+	client *redis.Client
+}
+
+// NewRedisStreamSink 地址格式为 redis://[user:pass@]host:6379[/db]，TLS使用 rediss://，
+// maxLen大于0时按近似长度裁剪Stream
+func NewRedisStreamSink(rawURL, stream string, maxLen int64) (*RedisStreamSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("Redis地址格式错误：%s", rawURL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	options, err := redis.ParseURL(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("Redis地址格式错误：%w", err)
+	}
+	// 失败的批次由磁盘缓存整批重发，客户端不再重试
+	options.MaxRetries = -1
+	return &RedisStreamSink{url: u, stream: stream, maxLen: maxLen, client: redis.NewClient(options)}, nil
+}
+
+func (s *RedisStreamSink) Name() string {
+	return "redis"
+}
+
+func (s *RedisStreamSink) Endpoint() string {
+	return s.url.Redacted() + "#" + s.stream
+}
+
+func (s *RedisStreamSink) Publish(ctx context.Context, events []Event) error {
+	pipe := s.client.Pipeline()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.stream,
+			MaxLen: s.maxLen,
+			Approx: true,
+			Values: []any{"id", event.ID, "type", event.Type, "data", string(data)},
+		})
+	}
+	// Exec返回第一个失败命令的错误
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStreamSink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,55 @@
+package sink
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// 事件类型
+const (
+	EventCallCompleted = "call.completed"
+	EventRTCPReport    = "rtcp.report"
+	EventAlert         = "alert"
+)
+
+// Event 推送到消息总线的一条事件，Data为事件内容的JSON
+type Event struct {
+	// ID 事件的唯一ID，投递保证至少一次，消费端可按ID去重
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Key 分区键，同一呼叫的事件使用相同的Key，如SIP Call-ID
+	Key  string          `json:"key,omitempty"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+func NewEvent(eventType, key string, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return Event{
+		ID:   hex.EncodeToString(id),
+		Type: eventType,
+		Key:  key,
+		Time: time.Now(),
+		Data: raw,
+	}, nil
+}
+
+// Sink 事件推送的目标
+type Sink interface {
+	// Name 目标类型，如kafka、nats
+	Name() string
+	// Endpoint 目标地址，不含密码，用于日志和区分磁盘缓存目录
+	Endpoint() string
+	// Publish 发送一批事件，返回nil表示全部事件都已被对端确认。
+	// 返回错误时这批事件会被整批重发，对端可能收到重复的事件
+	Publish(ctx context.Context, events []Event) error
+	Close() error
+}
@@ -0,0 +1,401 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+func testEvents(t *testing.T) []Event {
+	t.Helper()
+	var events []Event
+	for i, key := range []string{"call-a", "call-b", ""} {
+		event, err := NewEvent(EventCallCompleted, key, map[string]int{"n": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func listen(t *testing.T, handle func(conn net.Conn)) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+// 收到的消息：主题和事件
+type received struct {
+	mu     sync.Mutex
+	topics []string
+	events []Event
+}
+
+func (r *received) add(topic string, data []byte) {
+	var event Event
+	_ = json.Unmarshal(data, &event)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.topics = append(r.topics, topic)
+	r.events = append(r.events, event)
+}
+
+func (r *received) check(t *testing.T, events []Event, topic func(event Event) string) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) != len(events) {
+		t.Fatalf("应收到%d个事件，得到%d", len(events), len(r.events))
+	}
+	for i, event := range events {
+		if r.events[i].ID != event.ID || string(r.events[i].Data) != string(event.Data) {
+			t.Errorf("第%d个事件错误：%+v", i, r.events[i])
+		}
+		if want := topic(event); r.topics[i] != want {
+			t.Errorf("第%d个事件主题为%s，期望%s", i, r.topics[i], want)
+		}
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got received
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var events []json.RawMessage
+		_ = json.NewDecoder(r.Body).Decode(&events)
+		for _, event := range events {
+			got.add(r.URL.Path, event)
+		}
+	}))
+	defer server.Close()
+
+	events := testEvents(t)
+	s := NewWebhookSink(server.URL + "/cdr")
+	if err := s.Publish(testContext(t), events); err == nil {
+		t.Fatal("非2xx应返回错误")
+	}
+	fail = false
+	if err := s.Publish(testContext(t), events); err != nil {
+		t.Fatal(err)
+	}
+	got.check(t, events, func(Event) string { return "/cdr" })
+}
+
+// runNATSServer 启动开启JetStream和用户名密码认证的NATS服务器
+func runNATSServer(t *testing.T) *server.Server {
+	t.Helper()
+	ns, err := server.NewServer(&server.Options{
+		Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(),
+		Username: "monitor", Password: "secret", NoLog: true, NoSigs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS服务器启动超时")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns
+}
+
+func TestNATSSink(t *testing.T) {
+	ns := runNATSServer(t)
+	conn, err := nats.Connect(ns.ClientURL(), nats.UserInfo("monitor", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	js, _ := jetstream.New(conn)
+	stream, err := js.CreateStream(testContext(t), jetstream.StreamConfig{Name: "pbx", Subjects: []string{"pbx.>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewNATSSink("nats://monitor:secret@"+ns.Addr().String(), "pbx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if strings.Contains(s.Endpoint(), "secret") {
+		t.Errorf("地址中不应包含密码：%s", s.Endpoint())
+	}
+	events := testEvents(t)
+	if err := s.Publish(testContext(t), events[:2]); err != nil {
+		t.Fatal(err)
+	}
+	// 复用连接；整批重发时按事件ID去重
+	if err := s.Publish(testContext(t), events); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := stream.Info(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got received
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq; seq++ {
+		msg, err := stream.GetMsg(testContext(t), seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got.add(msg.Subject, msg.Data)
+	}
+	got.check(t, events, func(event Event) string { return "pbx." + event.Type })
+}
+
+// 没有stream接收主题时JetStream不会确认，事件留在缓存中
+func TestNATSSink_NoStream(t *testing.T) {
+	ns := runNATSServer(t)
+	s, _ := NewNATSSink("nats://monitor:secret@"+ns.Addr().String(), "pbx")
+	defer s.Close()
+	if err := s.Publish(testContext(t), testEvents(t)); err == nil {
+		t.Error("没有stream时应返回错误")
+	}
+
+	bad, _ := NewNATSSink("nats://monitor:wrong@"+ns.Addr().String(), "pbx")
+	defer bad.Close()
+	if err := bad.Publish(testContext(t), testEvents(t)); err == nil {
+		t.Error("认证失败时应返回错误")
+	}
+}
+
+// runMQTTBroker 启动只允许monitor/secret登录的MQTT broker，返回监听地址
+func runMQTTBroker(t *testing.T, got *received) string {
+	t.Helper()
+	broker := mqttserver.New(&mqttserver.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	err := broker.AddHook(new(auth.Hook), &auth.Options{Ledger: &auth.Ledger{
+		Auth: auth.AuthRules{{Username: "monitor", Password: "secret", Allow: true}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	if err := broker.AddListener(listener); err != nil {
+		t.Fatal(err)
+	}
+	err = broker.Subscribe("pbx/events/#", 1, func(cl *mqttserver.Client, sub packets.Subscription, pk packets.Packet) {
+		got.add(pk.TopicName, pk.Payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go broker.Serve()
+	t.Cleanup(func() { broker.Close() })
+	return listener.Address()
+}
+
+func TestMQTTSink(t *testing.T) {
+	var got received
+	addr := runMQTTBroker(t, &got)
+
+	s, err := NewMQTTSink("tcp://monitor:secret@"+addr, "pbx/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if strings.Contains(s.Endpoint(), "secret") {
+		t.Errorf("地址中不应包含密码：%s", s.Endpoint())
+	}
+	events := testEvents(t)
+	if err := s.Publish(testContext(t), events[:2]); err != nil {
+		t.Fatal(err)
+	}
+	// 复用连接
+	if err := s.Publish(testContext(t), events[2:]); err != nil {
+		t.Fatal(err)
+	}
+	got.check(t, events, func(event Event) string { return "pbx/events/" + event.Type })
+}
+
+func TestMQTTSink_Refused(t *testing.T) {
+	var got received
+	addr := runMQTTBroker(t, &got)
+	// 用户名或密码错误
+	s, _ := NewMQTTSink("mqtt://monitor:wrong@"+addr, "pbx")
+	defer s.Close()
+	if err := s.Publish(testContext(t), testEvents(t)); err == nil {
+		t.Error("拒绝连接时应返回错误")
+	}
+}
+
+func TestRedisStreamSink(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("secret")
+
+	s, err := NewRedisStreamSink("redis://:secret@"+m.Addr()+"/2", "pbx:events", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if strings.Contains(s.Endpoint(), "secret") {
+		t.Errorf("地址中不应包含密码：%s", s.Endpoint())
+	}
+	events := testEvents(t)
+	if err := s.Publish(testContext(t), events); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := m.DB(2).Stream("pbx:events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MAXLEN 2 裁剪掉最早的事件
+	var got received
+	for _, entry := range entries {
+		fields := map[string]string{}
+		for i := 0; i+1 < len(entry.Values); i += 2 {
+			fields[entry.Values[i]] = entry.Values[i+1]
+		}
+		if fields["id"] == "" {
+			t.Errorf("缺少事件ID：%v", entry.Values)
+		}
+		got.add("pbx:events:"+fields["type"], []byte(fields["data"]))
+	}
+	got.check(t, events[1:], func(event Event) string { return "pbx:events:" + event.Type })
+}
+
+func TestRedisStreamSink_Error(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.Set("pbx:events", "not a stream")
+	s, _ := NewRedisStreamSink("redis://"+m.Addr(), "pbx:events", 0)
+	defer s.Close()
+	if err := s.Publish(testContext(t), testEvents(t)); err == nil || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Errorf("应返回Redis的错误，得到%v", err)
+	}
+
+	m.RequireAuth("secret")
+	bad, _ := NewRedisStreamSink("redis://:wrong@"+m.Addr(), "other", 0)
+	defer bad.Close()
+	if err := bad.Publish(testContext(t), testEvents(t)); err == nil {
+		t.Error("认证失败时应返回错误")
+	}
+}
+
+// runKafka 启动一个broker的Kafka，主题cdr有两个分区，SCRAM认证
+func runKafka(t *testing.T) *kfake.Cluster {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, "cdr"),
+		kfake.EnableSASL(), kfake.Superuser("SCRAM-SHA-256", "monitor", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+func TestKafkaSink(t *testing.T) {
+	cluster := runKafka(t)
+	security := KafkaSecurity{SASLMechanism: "scram-sha-256", User: "monitor", Password: "secret"}
+	s, err := NewKafkaSink(" "+strings.Join(cluster.ListenAddrs(), ",")+" ,", "cdr", security)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var events []Event
+	for i := 0; i < 6; i++ {
+		event, _ := NewEvent(EventRTCPReport, fmt.Sprintf("call-%d", i%2), i)
+		events = append(events, event)
+	}
+	if err := s.Publish(testContext(t), events); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("cdr"),
+		kgo.SASL(scram.Auth{User: "monitor", Pass: "secret"}.AsSha256Mechanism()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	// 同一Key的事件写入同一分区
+	partitions := make(map[string]int32)
+	got := make(map[string]bool)
+	ctx := testContext(t)
+	for len(got) < len(events) && ctx.Err() == nil {
+		consumer.PollFetches(ctx).EachRecord(func(record *kgo.Record) {
+			var event Event
+			_ = json.Unmarshal(record.Value, &event)
+			got[event.ID] = true
+			if partition, ok := partitions[string(record.Key)]; ok && partition != record.Partition {
+				t.Errorf("%s 写入了分区%d和%d", record.Key, partition, record.Partition)
+			}
+			partitions[string(record.Key)] = record.Partition
+			if len(record.Headers) != 1 || string(record.Headers[0].Value) != EventRTCPReport {
+				t.Errorf("事件类型头错误：%v", record.Headers)
+			}
+		})
+	}
+	if len(got) != len(events) {
+		t.Fatalf("应收到%d个事件，得到%d", len(events), len(got))
+	}
+}
+
+func TestKafkaSink_Error(t *testing.T) {
+	cluster := runKafka(t)
+	if _, err := NewKafkaSink(cluster.ListenAddrs()[0], "cdr", KafkaSecurity{SASLMechanism: "GSSAPI"}); err == nil {
+		t.Error("不支持的认证方式应返回错误")
+	}
+
+	s, err := NewKafkaSink(cluster.ListenAddrs()[0], "cdr", KafkaSecurity{SASLMechanism: "SCRAM-SHA-256", User: "monitor", Password: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Publish(ctx, testEvents(t)); err == nil {
+		t.Error("认证失败时应返回错误")
+	}
+}
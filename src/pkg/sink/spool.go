@@ -0,0 +1,326 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ Spool - an append-only on-disk queue
+
+ Events are appended to numbered segment files, each record framed as:
+
+    +----------------+----------------+------------------+
+    | length uint32  | crc32 uint32   | event JSON       |
+    +----------------+----------------+------------------+
+
+ The read position (segment, offset) is kept in the "cursor" file and only
+ advances after the sink has acknowledged the events, so events that were
+ read but not acknowledged before a restart are sent again. A segment is
+ removed once the cursor has moved past it.
+
+ Writing always starts a new segment after a restart, so a record torn by
+ a crash can only be at the end of an old segment, where the reader treats
+ it as the end of that segment. A write that fails part way is truncated
+ back to the previous size; if that fails too, the segment is sealed and the
+ next append starts a new one, so no record is ever written after torn bytes.
+
+ Every Append is a batch that is fsynced before it returns, and the
+ directory is fsynced when a segment is created, so an appended event
+ survives a power loss. The cursor is not fsynced: losing its last update
+ only sends some acknowledged events again.
+
+*/
+
+const (
+	spoolSegmentSize = 8 << 20
+	spoolCursorFile  = "cursor"
+	spoolSegmentExt  = ".log"
+	spoolHeaderSize  = 8
+)
+
+var ErrSpoolFull = errors.New("事件磁盘缓存已满")
+
+// SpoolPosition 缓存中的读取位置
+type SpoolPosition struct {
+	Segment uint64
+	Offset  int64
+}
+
+// Spool 单个推送目标的磁盘缓存，一个写入方、一个读取方
+type Spool struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	segments []uint64 // 磁盘上的段，升序
+	sizes    map[uint64]int64
+	writer   *os.File
+	torn     bool // 写入段末尾有未能截断的残缺记录，下次写入需新开一段
+	cursor   SpoolPosition
+	notify   chan struct{}
+}
+
+// OpenSpool 打开或创建缓存目录，maxBytes为磁盘占用上限，0为不限制
+func OpenSpool(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		dir:      dir,
+		maxBytes: maxBytes,
+		sizes:    make(map[uint64]int64),
+		notify:   make(chan struct{}, 1),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), spoolSegmentExt)
+		if !ok {
+			continue
+		}
+		seg, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, seg)
+		s.sizes[seg] = info.Size()
+	}
+	slices.Sort(s.segments)
+
+	if data, err := os.ReadFile(filepath.Join(dir, spoolCursorFile)); err == nil {
+		_, _ = fmt.Sscanf(string(data), "%d %d", &s.cursor.Segment, &s.cursor.Offset)
+	}
+	// 删除游标之前的段
+	for len(s.segments) > 0 && s.segments[0] < s.cursor.Segment {
+		s.removeSegment(s.segments[0])
+	}
+	if len(s.segments) == 0 || s.cursor.Segment < s.segments[0] {
+		s.cursor = SpoolPosition{}
+		if len(s.segments) > 0 {
+			s.cursor.Segment = s.segments[0]
+		}
+	}
+
+	next := s.cursor.Segment + 1
+	if len(s.segments) > 0 {
+		next = max(next, s.segments[len(s.segments)-1]+1)
+	}
+	if err := s.openSegment(next); err != nil {
+		return nil, err
+	}
+	if len(s.segments) == 1 {
+		s.cursor = SpoolPosition{Segment: next}
+	}
+	return s, nil
+}
+
+func (s *Spool) segmentPath(seg uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seg, spoolSegmentExt))
+}
+
+func (s *Spool) openSegment(seg uint64) error {
+	file, err := os.OpenFile(s.segmentPath(seg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	// 同步目录，保证断电后新段的目录项存在
+	if err := syncDir(s.dir); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if s.writer != nil {
+		_ = s.writer.Close()
+	}
+	s.writer = file
+	s.torn = false
+	s.segments = append(s.segments, seg)
+	s.sizes[seg] = 0
+	return nil
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func (s *Spool) removeSegment(seg uint64) {
+	_ = os.Remove(s.segmentPath(seg))
+	delete(s.sizes, seg)
+	s.segments = slices.DeleteFunc(s.segments, func(v uint64) bool { return v == seg })
+}
+
+func (s *Spool) writeSegment() uint64 {
+	return s.segments[len(s.segments)-1]
+}
+
+// Append 追加事件，超过磁盘占用上限时返回ErrSpoolFull，不写入任何事件
+func (s *Spool) Append(events []Event) error {
+	var buf []byte
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(data))
+		buf = append(buf, data...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxBytes > 0 && s.sizeLocked()+int64(len(buf)) > s.maxBytes {
+		return ErrSpoolFull
+	}
+	if s.torn || s.sizes[s.writeSegment()] >= spoolSegmentSize {
+		if err := s.openSegment(s.writeSegment() + 1); err != nil {
+			return err
+		}
+	}
+	size := s.sizes[s.writeSegment()]
+	if n, err := s.writer.Write(buf); err != nil {
+		// 只写入了一部分时截断回写入前的大小，读取方只读到记录的大小为止
+		if n > 0 && s.writer.Truncate(size) != nil {
+			s.torn = true
+		}
+		return err
+	}
+	// 每批同步一次磁盘，断电后已返回成功的事件不会丢失
+	if err := s.writer.Sync(); err != nil {
+		if s.writer.Truncate(size) != nil {
+			s.torn = true
+		}
+		return fmt.Errorf("同步事件磁盘缓存失败：%w", err)
+	}
+	s.sizes[s.writeSegment()] = size + int64(len(buf))
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Read 从当前游标读取最多max个事件，不移动游标，返回读取后的位置
+func (s *Spool) Read(max int) ([]Event, SpoolPosition, error) {
+	for {
+		s.mu.Lock()
+		pos := s.cursor
+		end := s.sizes[pos.Segment]
+		sealed := pos.Segment != s.writeSegment()
+		s.mu.Unlock()
+
+		events, next, err := s.readSegment(pos, end, max)
+		if err != nil || len(events) > 0 || !sealed {
+			return events, next, err
+		}
+
+		// 已读完不再写入的段，删除后读下一段
+		s.mu.Lock()
+		s.removeSegment(pos.Segment)
+		s.cursor = SpoolPosition{Segment: s.segments[0]}
+		err = s.saveCursor()
+		s.mu.Unlock()
+		if err != nil {
+			return nil, pos, err
+		}
+	}
+}
+
+func (s *Spool) readSegment(pos SpoolPosition, end int64, max int) ([]Event, SpoolPosition, error) {
+	if pos.Offset >= end {
+		return nil, pos, nil
+	}
+	file, err := os.Open(s.segmentPath(pos.Segment))
+	if err != nil {
+		return nil, pos, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(io.NewSectionReader(file, pos.Offset, end-pos.Offset))
+
+	var events []Event
+	header := make([]byte, spoolHeaderSize)
+	for len(events) < max {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(reader, data); err != nil {
+			break
+		}
+		var event Event
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) || json.Unmarshal(data, &event) != nil {
+			// 损坏的记录之后的内容都无法定位，跳到段尾
+			pos.Offset = end
+			break
+		}
+		events = append(events, event)
+		pos.Offset += int64(spoolHeaderSize + len(data))
+	}
+	return events, pos, nil
+}
+
+// Commit 事件确认后移动游标
+func (s *Spool) Commit(pos SpoolPosition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursor = pos
+	return s.saveCursor()
+}
+
+func (s *Spool) saveCursor() error {
+	path := filepath.Join(s.dir, spoolCursorFile)
+	data := fmt.Sprintf("%d %d", s.cursor.Segment, s.cursor.Offset)
+	if err := os.WriteFile(path+".tmp", []byte(data), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Notify 有新事件写入时可读
+func (s *Spool) Notify() <-chan struct{} {
+	return s.notify
+}
+
+// Pending 尚未确认的字节数
+func (s *Spool) Pending() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sizeLocked() - s.cursor.Offset
+}
+
+func (s *Spool) sizeLocked() int64 {
+	var total int64
+	for _, size := range s.sizes {
+		total += size
+	}
+	return total
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writer.Close()
+}
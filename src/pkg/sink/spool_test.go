@@ -0,0 +1,122 @@
+package sink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func spoolEvents(t *testing.T, from, to int) []Event {
+	t.Helper()
+	var events []Event
+	for i := from; i < to; i++ {
+		event, err := NewEvent(EventCallCompleted, fmt.Sprintf("call-%d", i), i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func readAll(t *testing.T, s *Spool, max int) []Event {
+	t.Helper()
+	var all []Event
+	for {
+		events, next, err := s.Read(max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) == 0 {
+			return all
+		}
+		all = append(all, events...)
+		if err := s.Commit(next); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSpool_ReopenResumesAtCursor(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenSpool(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := spoolEvents(t, 0, 5)
+	if err := s.Append(events); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.Notify():
+	default:
+		t.Error("写入后应有通知")
+	}
+
+	// 确认前两个，第三个读取后未确认
+	read, next, _ := s.Read(2)
+	if len(read) != 2 || read[0].ID != events[0].ID {
+		t.Fatalf("读取错误：%+v", read)
+	}
+	s.Commit(next)
+	read, _, _ = s.Read(1)
+	if read[0].ID != events[2].ID {
+		t.Fatalf("读取错误：%+v", read)
+	}
+	s.Close()
+
+	// 重启后从未确认的事件开始，写入新的段
+	s, err = OpenSpool(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Append(spoolEvents(t, 5, 7)); err != nil {
+		t.Fatal(err)
+	}
+	rest := readAll(t, s, 10)
+	if len(rest) != 5 || rest[0].ID != events[2].ID || rest[4].Key != "call-6" {
+		t.Fatalf("重启后读取错误：%d个 %+v", len(rest), rest)
+	}
+	if s.Pending() != 0 {
+		t.Errorf("全部确认后不应有待发送的数据：%d", s.Pending())
+	}
+	// 读完的旧段被删除
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	if len(segments) != 1 {
+		t.Errorf("应只剩正在写入的段：%v", segments)
+	}
+}
+
+func TestSpool_TornRecordAndLimit(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := OpenSpool(dir, 0)
+	s.Append(spoolEvents(t, 0, 2))
+	s.Close()
+
+	// 模拟崩溃时写了一半的记录
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	file, _ := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0)
+	file.Write([]byte{0, 0, 1, 0, 1, 2})
+	file.Close()
+
+	s, err := OpenSpool(dir, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Append(spoolEvents(t, 2, 3))
+	if got := readAll(t, s, 10); len(got) != 3 || got[2].Key != "call-2" {
+		t.Fatalf("应跳过损坏的记录，得到%+v", got)
+	}
+
+	// 超过上限时拒绝写入
+	var err2 error
+	for i := 0; i < 100 && err2 == nil; i++ {
+		err2 = s.Append(spoolEvents(t, i, i+1))
+	}
+	if err2 != ErrSpoolFull {
+		t.Errorf("超过上限应返回ErrSpoolFull，得到%v", err2)
+	}
+}
@@ -0,0 +1,198 @@
+package siprocket
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ RFC 3261 - 18.3 Framing
+
+ On stream transports (TCP, TLS, SCTP) the message boundaries are given by
+ Content-Length, which is mandatory there. A capture agent reading such a
+ stream may put several messages into one HEP payload, or spread one
+ message over several payloads.
+
+ The Framer keeps the unfinished bytes of every stream and returns the
+ complete messages as they become available. Streams that do not complete
+ their message within the timeout are dropped.
+
+*/
+
+// maxFrameBufferLength limits the bytes kept for a single stream
+const maxFrameBufferLength = 256 * 1024
+
+type Framer struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	streams map[string]*frameBuffer
+
+	now func() time.Time
+}
+
+type frameBuffer struct {
+	data    []byte
+	updated time.Time
+}
+
+func NewFramer(timeout time.Duration) *Framer {
+	return &Framer{
+		timeout: timeout,
+		streams: make(map[string]*frameBuffer),
+		now:     time.Now,
+	}
+}
+
+// Feed appends a payload of the stream identified by key (eg the 5-tuple)
+// and returns every message completed by it, in stream order
+func (f *Framer) Feed(key string, payload []byte) [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data := payload
+	buffer, ok := f.streams[key]
+	if ok {
+		data = append(buffer.data, payload...)
+	}
+
+	messages, rest := SplitMessages(data)
+
+	if len(rest) == 0 || len(rest) > maxFrameBufferLength {
+		delete(f.streams, key)
+		return messages
+	}
+
+	if !ok {
+		buffer = &frameBuffer{}
+		f.streams[key] = buffer
+	}
+	// Copy the rest so the caller can reuse the payload
+	buffer.data = append([]byte(nil), rest...)
+	buffer.updated = f.now()
+	return messages
+}
+
+// Expire drops the partial messages not completed within the timeout
+// and returns the number of streams dropped
+func (f *Framer) Expire() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cutoff := f.now().Add(-f.timeout)
+	expired := 0
+	for key, buffer := range f.streams {
+		if buffer.updated.Before(cutoff) {
+			delete(f.streams, key)
+			expired++
+		}
+	}
+	return expired
+}
+
+// Pending returns the number of streams holding a partial message
+func (f *Framer) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.streams)
+}
+
+// SplitMessages splits data on Content-Length boundaries, rest is an unfinished message
+func SplitMessages(data []byte) (messages [][]byte, rest []byte) {
+	for {
+		// CRLF keep-alives between messages - RFC 5626 section 3.5.1
+		data = bytes.TrimLeft(data, "\r\n")
+		if len(data) == 0 {
+			return messages, nil
+		}
+
+		// Resynchronise on a start line, the capture may begin in the middle of a message
+		start := indexStartLine(data)
+		if start == -1 {
+			return messages, nil
+		}
+		data = data[start:]
+
+		headerEnd := bytes.Index(data, []byte("\r\n\r\n"))
+		if headerEnd == -1 {
+			return messages, data
+		}
+		bodyStart := headerEnd + 4
+
+		// Compared before adding, a huge Content-Length would overflow
+		length := contentLength(data[:headerEnd])
+		if length > len(data)-bodyStart {
+			return messages, data
+		}
+		end := bodyStart + length
+
+		messages = append(messages, data[:end])
+		data = data[end:]
+	}
+}
+
+// indexStartLine returns the offset of the first line that is a SIP request or status line
+func indexStartLine(data []byte) int {
+	for offset := 0; offset < len(data); {
+		eol := bytes.Index(data[offset:], []byte("\r\n"))
+		if eol == -1 {
+			// The line is not complete yet, keep it when it may still become a start line
+			if offset == 0 || isStartLinePrefix(data[offset:]) {
+				return offset
+			}
+			return -1
+		}
+		if isStartLine(data[offset : offset+eol]) {
+			return offset
+		}
+		offset += eol + 2
+	}
+	return -1
+}
+
+// isStartLine reports whether line is "SIP/2.0 code reason" or "METHOD uri SIP/2.0"
+func isStartLine(line []byte) bool {
+	if bytes.HasPrefix(line, []byte("SIP/2.0 ")) {
+		return true
+	}
+	return bytes.HasSuffix(line, []byte(" SIP/2.0")) && bytes.Count(line, []byte(" ")) >= 2
+}
+
+// isStartLinePrefix reports whether an unfinished line may still become a start line
+func isStartLinePrefix(line []byte) bool {
+	return bytes.HasPrefix([]byte("SIP/2.0 "), line) || bytes.HasPrefix(line, []byte("SIP/2.0 ")) || isTokenStart(line)
+}
+
+// isTokenStart reports whether line starts like a request method, upper case letters
+func isTokenStart(line []byte) bool {
+	for i, c := range line {
+		if c == ' ' {
+			return i > 0
+		}
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// contentLength returns the Content-Length of the header block, 0 when absent
+func contentLength(headers []byte) int {
+	for _, line := range bytes.Split(headers, []byte("\r\n")) {
+		colonPos := bytes.IndexByte(line, ':')
+		if colonPos == -1 {
+			continue
+		}
+		name := strings.ToLower(string(bytes.TrimSpace(line[:colonPos])))
+		if name == "content-length" || name == "l" {
+			length, err := strconv.Atoi(string(bytes.TrimSpace(line[colonPos+1:])))
+			if err != nil || length < 0 {
+				return 0
+			}
+			return length
+		}
+	}
+	return 0
+}
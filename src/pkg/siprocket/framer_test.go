@@ -0,0 +1,116 @@
+package siprocket
+
+import (
+	"testing"
+	"time"
+)
+
+const framerInvite = "INVITE sip:bob@biloxi.com SIP/2.0\r\n" +
+	"Via: SIP/2.0/TCP pc33.atlanta.com;branch=z9hG4bK776asdhds\r\n" +
+	"Call-ID: a84b4c76e66710@pc33.atlanta.com\r\n" +
+	"CSeq: 1 INVITE\r\n" +
+	"Content-Type: application/sdp\r\n" +
+	"Content-Length: 29\r\n" +
+	"\r\n" +
+	"v=0\r\n" +
+	"o=- 1 1 IN IP4 1.1.1.1\r\n"
+
+const framerTrying = "SIP/2.0 100 Trying\r\n" +
+	"Via: SIP/2.0/TCP pc33.atlanta.com;branch=z9hG4bK776asdhds\r\n" +
+	"Call-ID: a84b4c76e66710@pc33.atlanta.com\r\n" +
+	"CSeq: 1 INVITE\r\n" +
+	"l: 0\r\n" +
+	"\r\n"
+
+func TestSplitMessages_Multiple(t *testing.T) {
+	// 一个包中包含两条完整消息，以及CRLF保活
+	messages, rest := SplitMessages([]byte("\r\n\r\n" + framerInvite + framerTrying))
+	if len(messages) != 2 {
+		t.Fatalf("消息数量错误，期望2条，得到%d条", len(messages))
+	}
+	if string(messages[0]) != framerInvite || string(messages[1]) != framerTrying {
+		t.Errorf("分帧错误，得到%q", messages)
+	}
+	if len(rest) != 0 {
+		t.Errorf("不应有剩余数据，得到%q", rest)
+	}
+
+	sip := ParseSIP(messages[0])
+	if sip == nil || sip.SDP != nil || sip.CallID != "a84b4c76e66710@pc33.atlanta.com" {
+		t.Errorf("分帧后的消息解析错误")
+	}
+}
+
+func TestSplitMessages_Resync(t *testing.T) {
+	// 采集从消息中间开始，丢弃起始行之前的数据
+	messages, rest := SplitMessages([]byte("a=sendrecv\r\n\r\n" + framerTrying))
+	if len(messages) != 1 || string(messages[0]) != framerTrying {
+		t.Errorf("重新同步错误，得到%q", messages)
+	}
+	if len(rest) != 0 {
+		t.Errorf("不应有剩余数据，得到%q", rest)
+	}
+
+	// 不包含起始行的数据全部丢弃
+	messages, rest = SplitMessages([]byte("a=rtpmap:0 PCMU/8000\r\nm=audio"))
+	if len(messages) != 0 || len(rest) != 0 {
+		t.Errorf("无效数据应丢弃，得到%q %q", messages, rest)
+	}
+}
+
+func TestFramer_Fragmented(t *testing.T) {
+	framer := NewFramer(time.Second)
+
+	// 一条消息分成三个包，最后一个包同时带有下一条消息
+	parts := []string{framerInvite[:10], framerInvite[10:120], framerInvite[120:] + framerTrying[:30]}
+	var messages [][]byte
+	for _, part := range parts {
+		messages = append(messages, framer.Feed("tcp-1", []byte(part))...)
+	}
+	if len(messages) != 1 || string(messages[0]) != framerInvite {
+		t.Fatalf("分片重组错误，得到%q", messages)
+	}
+	if framer.Pending() != 1 {
+		t.Errorf("应有1个未完成的流，得到%d", framer.Pending())
+	}
+
+	// 其他流不受影响
+	other := framer.Feed("tcp-2", []byte(framerTrying))
+	if len(other) != 1 || string(other[0]) != framerTrying {
+		t.Errorf("其他流分帧错误，得到%q", other)
+	}
+
+	messages = framer.Feed("tcp-1", []byte(framerTrying[30:]))
+	if len(messages) != 1 || string(messages[0]) != framerTrying {
+		t.Errorf("后续消息重组错误，得到%q", messages)
+	}
+	if framer.Pending() != 0 {
+		t.Errorf("不应有未完成的流，得到%d", framer.Pending())
+	}
+}
+
+func TestFramer_Timeout(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	framer := NewFramer(5 * time.Second)
+	framer.now = func() time.Time { return now }
+
+	if messages := framer.Feed("tcp-1", []byte(framerInvite[:100])); len(messages) != 0 {
+		t.Fatalf("不完整的消息不应返回，得到%q", messages)
+	}
+
+	now = now.Add(3 * time.Second)
+	if expired := framer.Expire(); expired != 0 {
+		t.Errorf("未超时不应清理，清理了%d个", expired)
+	}
+
+	now = now.Add(3 * time.Second)
+	if expired := framer.Expire(); expired != 1 {
+		t.Errorf("超时应清理1个，清理了%d个", expired)
+	}
+
+	// 超时后剩余部分无法组成消息，下一条完整消息正常返回
+	messages := framer.Feed("tcp-1", []byte(framerInvite[100:]+framerTrying))
+	if len(messages) != 1 || string(messages[0]) != framerTrying {
+		t.Errorf("超时后分帧错误，得到%q", messages)
+	}
+}
@@ -0,0 +1,76 @@
+package siprocket
+
+import (
+	"strings"
+	"testing"
+)
+
+// 语料：完整的INVITE、响应、multipart和各种截断的头部
+var fuzzSeeds = []string{
+	"INVITE sip:1001@10.0.0.2:5060;transport=udp SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776;rport;received=1.2.3.4\r\n" +
+		"From: \"Alice\" <sip:1000@10.0.0.1>;tag=abc\r\n" +
+		"To: <sip:1001@10.0.0.2>\r\n" +
+		"Contact: <sip:1000@10.0.0.1:5060>;expires=60;q=0.5\r\n" +
+		"Call-ID: fuzz@10.0.0.1\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"P-Asserted-Identity: \"Alice\" <sip:+8613800000000@10.0.0.1;user=phone>\r\n" +
+		"Diversion: <sip:1002@10.0.0.2>;reason=unconditional;counter=1\r\n" +
+		"History-Info: <sip:1001@10.0.0.2?Reason=SIP%3Bcause%3D302>;index=1\r\n" +
+		"Content-Type: application/sdp\r\n" +
+		"Content-Length: 100\r\n\r\n" +
+		"v=0\r\no=- 1 1 IN IP4 10.0.0.1\r\ns=-\r\nc=IN IP4 10.0.0.1\r\nt=0 0\r\nm=audio 20000 RTP/AVP 0 8\r\na=rtpmap:0 PCMU/8000\r\na=sendrecv\r\n",
+	"SIP/2.0 180 Ringing\r\nVia: SIP/2.0/TCP h;branch=x\r\nTo: <tel:+861001>;tag=1\r\nFrom: sip:a@b\r\nCall-ID: x\r\nCSeq: 1 INVITE\r\n\r\n",
+	"INVITE sip:1@h SIP/2.0\r\nContent-Type: multipart/mixed;boundary=b\r\n\r\n--b\r\nContent-Type: application/sdp\r\n\r\nv=0\r\n--b\r\nContent-Type: application/isup\r\n\r\n\x01\x00\x60\x01\x0a\x00\x02\x0a\x08\x06\x10\x00\x10\x00\x10\x00\r\n--b--\r\n",
+	"SIP/2.0",
+	"INVITE",
+	"From: <sip:",
+	"To: <",
+	"Via: SIP/2.0/",
+	"Contact: \"",
+	"CSeq: ",
+	"\r\n\r\n",
+	"INVITE sip: SIP/2.0\r\nFrom: ;tag=\r\nTo: \"\r\nVia: ;\r\nContact: <>\r\n\r\nm=\r\nc=\r\na=\r\n",
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg := Parse(data)
+		if len(data) > 0 && (msg == nil || msg.Raw != string(data)) {
+			t.Fatal("非空输入应返回解析结果并保留原始消息")
+		}
+		if msg != nil && len(msg.Headers) > MaxHeaderCount {
+			t.Fatalf("头部数量%d超过限制", len(msg.Headers))
+		}
+		ParseSIP(data)
+	})
+}
+
+func FuzzSplitMessages(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Add([]byte("OPTIONS sip:a SIP/2.0\r\nContent-Length: 9223372036854775807\r\n\r\nx"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		messages, rest := SplitMessages(data)
+		total := len(rest)
+		for _, message := range messages {
+			total += len(message)
+		}
+		if total > len(data) {
+			t.Fatalf("分帧结果比输入长：%d > %d", total, len(data))
+		}
+	})
+}
+
+func TestParse_HeaderLimit(t *testing.T) {
+	msg := "OPTIONS sip:10.0.0.2 SIP/2.0\r\n" + strings.Repeat("Via: SIP/2.0/UDP 10.0.0.1;branch=z9hG4bK1\r\n", MaxHeaderCount+10) +
+		"Call-ID: limit@10.0.0.1\r\n\r\n"
+	result := Parse([]byte(msg))
+	if len(result.Headers) != MaxHeaderCount || len(result.Via) != MaxHeaderCount {
+		t.Errorf("头部数量应限制为%d，得到%d", MaxHeaderCount, len(result.Headers))
+	}
+}
@@ -0,0 +1,281 @@
+package siprocket
+
+import (
+	"fmt"
+	"sip-monitor/src/entity"
+	"strings"
+)
+
+/*
+ ITU-T Q.763 - ISUP formats and codes
+ ITU-T Q.1912.5 - SIP-I, ISUP encapsulated in application/isup bodies
+
+ The encapsulated message starts with the message type code, the circuit
+ identification code is not included.
+
+ IAM  | type | NCI | FCI(2) | CPC | TMR | ptr called | ptr optional | ...
+ REL  | type | ptr cause | ptr optional | ...
+
+ Pointers are counted from the pointer octet itself, a zero optional
+ pointer means no optional part. Optional parameters are name, length,
+ value and end with a zero octet.
+
+ Number parameters (Q.763 3.9 / 3.10):
+    octet 1: odd/even indicator (bit 8), nature of address (bits 1-7)
+    octet 2: INN/NI (bit 8), numbering plan (bits 5-7), presentation (bits 3-4), screening (bits 1-2)
+    octet 3..: address signals, two BCD digits per octet, first digit in bits 1-4
+
+*/
+
+// ISUP message type codes
+const (
+	isupIAM = 0x01
+	isupCON = 0x07
+	isupACM = 0x06
+	isupANM = 0x09
+	isupREL = 0x0c
+	isupRLC = 0x10
+	isupCPG = 0x2c
+)
+
+// ISUP optional parameter codes
+const (
+	isupParamEnd            = 0x00
+	isupParamCallingNumber  = 0x0a
+	isupParamRedirectingNum = 0x0b
+	isupParamOriginalCalled = 0x28
+)
+
+var isupMessageNames = map[byte]string{
+	isupIAM: "IAM",
+	isupCON: "CON",
+	isupACM: "ACM",
+	isupANM: "ANM",
+	isupREL: "REL",
+	isupRLC: "RLC",
+	isupCPG: "CPG",
+}
+
+type IsupMsg struct {
+	MessageType byte
+
+	CalledNumber         isupNumber // IAM called party number
+	CallingNumber        isupNumber // IAM calling party number
+	OriginalCalledNumber isupNumber // IAM original called number
+	RedirectingNumber    isupNumber // IAM redirecting number
+
+	CauseLocation byte // REL cause indicators
+	CauseValue    byte
+
+	Src []byte // Full source if needed
+}
+
+type isupNumber struct {
+	Digits          string
+	NatureOfAddress byte
+	NumberingPlan   byte
+	Presentation    byte
+	Screening       byte
+}
+
+// parseIsup decodes an application/isup body, returns false when the message is truncated
+func parseIsup(v []byte, out *IsupMsg) bool {
+	// Init the output area
+	*out = IsupMsg{}
+
+	// Keep the source line if needed
+	if keep_src {
+		out.Src = v
+	}
+
+	if len(v) == 0 {
+		return false
+	}
+	out.MessageType = v[0]
+
+	switch out.MessageType {
+	case isupIAM:
+		// 5 fixed octets after the type, then the called number and optional pointers
+		if len(v) < 8 {
+			return false
+		}
+		called := isupVariable(v, 6)
+		if called == nil {
+			return false
+		}
+		parseIsupNumber(called, &out.CalledNumber)
+		parseIsupOptional(v, 7, func(name byte, value []byte) {
+			switch name {
+			case isupParamCallingNumber:
+				parseIsupNumber(value, &out.CallingNumber)
+			case isupParamOriginalCalled:
+				parseIsupNumber(value, &out.OriginalCalledNumber)
+			case isupParamRedirectingNum:
+				parseIsupNumber(value, &out.RedirectingNumber)
+			}
+		})
+	case isupREL:
+		if len(v) < 3 {
+			return false
+		}
+		cause := isupVariable(v, 1)
+		if len(cause) < 2 {
+			return false
+		}
+		out.CauseLocation = cause[0] & 0x0f
+		// Octet 1a is present when the extension bit of octet 1 is not set
+		pos := 1
+		if cause[0]&0x80 == 0 {
+			pos = 2
+		}
+		if pos < len(cause) {
+			out.CauseValue = cause[pos] & 0x7f
+		}
+	}
+	return true
+}
+
+// isupVariable returns the mandatory variable parameter referenced by the pointer at pos
+func isupVariable(v []byte, pos int) []byte {
+	if pos >= len(v) || v[pos] == 0 {
+		return nil
+	}
+	start := pos + int(v[pos])
+	if start >= len(v) {
+		return nil
+	}
+	end := start + 1 + int(v[start])
+	if end > len(v) {
+		return nil
+	}
+	return v[start+1 : end]
+}
+
+// parseIsupOptional walks the optional part referenced by the pointer at pos
+func parseIsupOptional(v []byte, pos int, fn func(name byte, value []byte)) {
+	if pos >= len(v) || v[pos] == 0 {
+		return
+	}
+	for i := pos + int(v[pos]); i < len(v); {
+		name := v[i]
+		if name == isupParamEnd || i+1 >= len(v) {
+			return
+		}
+		end := i + 2 + int(v[i+1])
+		if end > len(v) {
+			return
+		}
+		fn(name, v[i+2:end])
+		i = end
+	}
+}
+
+func parseIsupNumber(v []byte, out *isupNumber) {
+	*out = isupNumber{}
+	if len(v) < 2 {
+		return
+	}
+	odd := v[0]&0x80 != 0
+	out.NatureOfAddress = v[0] & 0x7f
+	out.NumberingPlan = (v[1] >> 4) & 0x07
+	out.Presentation = (v[1] >> 2) & 0x03
+	out.Screening = v[1] & 0x03
+
+	var digits strings.Builder
+	signals := v[2:]
+	for i, b := range signals {
+		digits.WriteByte(isupDigit(b & 0x0f))
+		// The filler of an odd number of signals is in the last octet
+		if i == len(signals)-1 && odd {
+			break
+		}
+		if high := b >> 4; high != 0x0f {
+			digits.WriteByte(isupDigit(high))
+		}
+	}
+	out.Digits = strings.TrimRight(digits.String(), "\x00")
+}
+
+func isupDigit(nibble byte) byte {
+	switch {
+	case nibble <= 9:
+		return '0' + nibble
+	case nibble == 0x0b:
+		return '*'
+	case nibble == 0x0c:
+		return '#'
+	case nibble == 0x0f:
+		return 0 // ST, end of pulsing
+	}
+	return 'A' + nibble - 0x0a
+}
+
+// Nature of address indicator - Q.763 3.9 b)
+var isupNatureOfAddress = map[byte]string{
+	1: "subscriber",
+	2: "unknown",
+	3: "national",
+	4: "international",
+	5: "network-specific",
+}
+
+// Release cause values - ITU-T Q.850
+var isupCauseText = map[byte]string{
+	1:   "Unallocated number",
+	2:   "No route to network",
+	3:   "No route to destination",
+	16:  "Normal call clearing",
+	17:  "User busy",
+	18:  "No user responding",
+	19:  "No answer from user",
+	20:  "Subscriber absent",
+	21:  "Call rejected",
+	22:  "Number changed",
+	27:  "Destination out of order",
+	28:  "Invalid number format",
+	29:  "Facility rejected",
+	31:  "Normal, unspecified",
+	34:  "No circuit/channel available",
+	38:  "Network out of order",
+	41:  "Temporary failure",
+	42:  "Switching equipment congestion",
+	44:  "Requested circuit/channel not available",
+	47:  "Resource unavailable, unspecified",
+	50:  "Requested facility not subscribed",
+	55:  "Incoming calls barred within CUG",
+	57:  "Bearer capability not authorized",
+	58:  "Bearer capability not presently available",
+	63:  "Service or option not available",
+	65:  "Bearer capability not implemented",
+	79:  "Service or option not implemented",
+	88:  "Incompatible destination",
+	102: "Recovery on timer expiry",
+	111: "Protocol error, unspecified",
+	127: "Interworking, unspecified",
+}
+
+// summary converts the message into the entity used by the call pipeline
+func (data *IsupMsg) summary() *entity.ISUP {
+	out := &entity.ISUP{
+		MessageType: isupMessageNames[data.MessageType],
+	}
+	if out.MessageType == "" {
+		out.MessageType = fmt.Sprintf("0x%02X", data.MessageType)
+	}
+
+	switch data.MessageType {
+	case isupIAM:
+		out.CalledNumber = data.CalledNumber.Digits
+		out.CalledNature = isupNatureOfAddress[data.CalledNumber.NatureOfAddress]
+		out.CallingNumber = data.CallingNumber.Digits
+		out.CallingNature = isupNatureOfAddress[data.CallingNumber.NatureOfAddress]
+		out.OriginalCalledNumber = data.OriginalCalledNumber.Digits
+		if out.OriginalCalledNumber == "" {
+			out.OriginalCalledNumber = data.RedirectingNumber.Digits
+		}
+	case isupREL:
+		out.Cause = int(data.CauseValue)
+		out.CauseText = isupCauseText[data.CauseValue]
+	}
+	return out
+}
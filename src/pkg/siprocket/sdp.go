@@ -0,0 +1,350 @@
+package siprocket
+
+import (
+	"bytes"
+	"sip-monitor/src/entity"
+	"strconv"
+	"strings"
+)
+
+/*
+ RFC4566 - https://tools.ietf.org/html/rfc4566#section-5
+
+ Session description
+    v=  (protocol version)
+    o=  (originator and session identifier)
+    s=  (session name)
+    c=* (connection information -- not required if included in all media)
+    t=  (time the session is active)
+    a=* (zero or more session attribute lines)
+ Media description, if present
+    m=  (media name and transport address)
+    c=* (connection information -- optional if included at session level)
+    a=* (zero or more media attribute lines)
+
+ Every m= line starts a new media description that runs until the next m=
+ line. Session level c=, direction, ICE credential (a=ice-ufrag, a=ice-pwd)
+ and a=fingerprint attributes apply to every media that does not override
+ them - RFC 8839 section 5.4, RFC 8122 section 5. Firefox, for one, sends
+ the fingerprint only at session level.
+
+*/
+
+type SdpMsg struct {
+	// Flat view of the first media description, kept for simple consumers
+	MediaDesc sdpMediaDesc
+	Attrib    []sdpAttrib // Every a= line, session and media level
+	ConnData  sdpConnData // Session level c=, or the first media c= when absent
+
+	Version  []byte      // v=
+	Origin   sdpOrigin   // o=
+	Session  []byte      // s=
+	SessConn sdpConnData // Session level c=
+	SessAttr []sdpAttrib // Session level a=
+	Media    []sdpMedia  // One entry per m= line
+}
+
+/*
+ 5.2.  Origin ("o=")
+
+    o=<username> <sess-id> <sess-version> <nettype> <addrtype> <unicast-address>
+
+ The sess-version is increased every time the description is modified,
+ a re-INVITE carrying the same version does not change the session.
+*/
+
+type sdpOrigin struct {
+	Username    []byte
+	SessId      []byte
+	SessVersion []byte
+	NetType     []byte
+	AddrType    []byte
+	UnicastAddr []byte
+	Src         []byte // Full source if needed
+}
+
+type sdpMedia struct {
+	Desc     sdpMediaDesc // m=
+	ConnData sdpConnData  // Media level c=, empty when inherited from the session
+	Attrib   []sdpAttrib  // Media level a=
+
+	Codecs    []sdpCodec // Payload formats of the m= line, in offer preference order
+	Ptime     []byte     // a=ptime
+	Rtcp      []byte     // a=rtcp
+	Direction string     // sendrecv, sendonly, recvonly or inactive, inherited from the session
+	Crypto    [][]byte   // a=crypto (SDES-SRTP)
+
+	IceUfrag      []byte   // a=ice-ufrag
+	IcePwd        []byte   // a=ice-pwd
+	IceCandidates [][]byte // a=candidate
+	Fingerprint   []byte   // a=fingerprint (DTLS-SRTP)
+	Setup         []byte   // a=setup
+}
+
+type sdpCodec struct {
+	PayloadType []byte // Payload type from the m= line
+	Name        string // Encoding name from a=rtpmap, or the static payload table
+	ClockRate   []byte
+	Channels    []byte
+	Fmtp        []byte // a=fmtp parameters
+}
+
+// Static RTP payload types - RFC 3551 section 6
+var staticPayloadTypes = map[string][2]string{
+	"0":  {"PCMU", "8000"},
+	"3":  {"GSM", "8000"},
+	"4":  {"G723", "8000"},
+	"5":  {"DVI4", "8000"},
+	"6":  {"DVI4", "16000"},
+	"7":  {"LPC", "8000"},
+	"8":  {"PCMA", "8000"},
+	"9":  {"G722", "8000"},
+	"10": {"L16", "44100"},
+	"11": {"L16", "44100"},
+	"12": {"QCELP", "8000"},
+	"13": {"CN", "8000"},
+	"14": {"MPA", "90000"},
+	"15": {"G728", "8000"},
+	"16": {"DVI4", "11025"},
+	"17": {"DVI4", "22050"},
+	"18": {"G729", "8000"},
+	"25": {"CelB", "90000"},
+	"26": {"JPEG", "90000"},
+	"28": {"nv", "90000"},
+	"31": {"H261", "90000"},
+	"32": {"MPV", "90000"},
+	"33": {"MP2T", "90000"},
+	"34": {"H263", "90000"},
+}
+
+func parseSdp(v []byte, out *SdpMsg) {
+	var media *sdpMedia
+	var session sdpMedia // Session level attributes inherited by the media
+	sessConnSet := false
+
+	for _, line := range bytes.Split(v, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) < 2 || line[1] != '=' {
+			continue // 无效SDP行
+		}
+
+		// SDP行格式为 x=value
+		sdpType := line[0]
+		sdpValue := bytes.TrimSpace(line[2:])
+
+		switch sdpType {
+		case 'v':
+			out.Version = sdpValue
+		case 'o':
+			parseSdpOrigin(sdpValue, &out.Origin)
+		case 's':
+			out.Session = sdpValue
+		case 'm':
+			out.Media = append(out.Media, sdpMedia{})
+			media = &out.Media[len(out.Media)-1]
+			parseSdpMediaDesc(sdpValue, &media.Desc)
+			for _, pt := range bytes.Fields(media.Desc.Fmt) {
+				codec := sdpCodec{PayloadType: pt}
+				if static, ok := staticPayloadTypes[string(pt)]; ok {
+					codec.Name = static[0]
+					codec.ClockRate = []byte(static[1])
+				}
+				media.Codecs = append(media.Codecs, codec)
+			}
+			if len(out.Media) == 1 {
+				out.MediaDesc = media.Desc
+			}
+		case 'c':
+			if media == nil {
+				parseSdpConnectionData(sdpValue, &out.SessConn)
+				out.ConnData = out.SessConn
+				sessConnSet = true
+			} else {
+				parseSdpConnectionData(sdpValue, &media.ConnData)
+				if !sessConnSet && len(out.ConnData.ConnAddr) == 0 {
+					out.ConnData = media.ConnData
+				}
+			}
+		case 'a':
+			var attr sdpAttrib
+			parseSdpAttrib(sdpValue, &attr)
+			out.Attrib = append(out.Attrib, attr)
+			if media == nil {
+				out.SessAttr = append(out.SessAttr, attr)
+				applySdpMediaAttrib(attr, &session)
+				continue
+			}
+			media.Attrib = append(media.Attrib, attr)
+			applySdpMediaAttrib(attr, media)
+		}
+	}
+
+	for i := range out.Media {
+		media = &out.Media[i]
+		// Direction defaults to the session level attribute, then sendrecv - RFC 3264 section 5.1
+		if media.Direction == "" {
+			media.Direction = session.Direction
+		}
+		if media.Direction == "" {
+			media.Direction = "sendrecv"
+		}
+		if len(media.IceUfrag) == 0 {
+			media.IceUfrag = session.IceUfrag
+		}
+		if len(media.IcePwd) == 0 {
+			media.IcePwd = session.IcePwd
+		}
+		if len(media.Fingerprint) == 0 {
+			media.Fingerprint = session.Fingerprint
+		}
+	}
+}
+
+func isSdpDirection(cat string) bool {
+	switch cat {
+	case "sendrecv", "sendonly", "recvonly", "inactive":
+		return true
+	}
+	return false
+}
+
+func applySdpMediaAttrib(attr sdpAttrib, media *sdpMedia) {
+	cat := string(attr.Cat)
+	switch cat {
+	case "rtpmap":
+		// a=rtpmap:<payload type> <encoding name>/<clock rate>[/<encoding parameters>]
+		pt, encoding, _ := bytes.Cut(attr.Val, []byte(" "))
+		codec := media.codec(pt)
+		if codec == nil {
+			return
+		}
+		parts := bytes.Split(bytes.TrimSpace(encoding), []byte("/"))
+		codec.Name = string(parts[0])
+		codec.ClockRate = nil
+		codec.Channels = nil
+		if len(parts) > 1 {
+			codec.ClockRate = parts[1]
+		}
+		if len(parts) > 2 {
+			codec.Channels = parts[2]
+		}
+	case "fmtp":
+		// a=fmtp:<format> <format specific parameters>
+		pt, params, _ := bytes.Cut(attr.Val, []byte(" "))
+		if codec := media.codec(pt); codec != nil {
+			codec.Fmtp = bytes.TrimSpace(params)
+		}
+	case "ptime":
+		media.Ptime = attr.Val
+	case "rtcp":
+		media.Rtcp = attr.Val
+	case "crypto":
+		media.Crypto = append(media.Crypto, attr.Val)
+	case "ice-ufrag":
+		media.IceUfrag = attr.Val
+	case "ice-pwd":
+		media.IcePwd = attr.Val
+	case "candidate":
+		media.IceCandidates = append(media.IceCandidates, attr.Val)
+	case "fingerprint":
+		media.Fingerprint = attr.Val
+	case "setup":
+		media.Setup = attr.Val
+	default:
+		if isSdpDirection(cat) {
+			media.Direction = cat
+		}
+	}
+}
+
+// codec returns the codec of the m= line with the given payload type
+func (media *sdpMedia) codec(pt []byte) *sdpCodec {
+	for i := range media.Codecs {
+		if bytes.Equal(media.Codecs[i].PayloadType, pt) {
+			return &media.Codecs[i]
+		}
+	}
+	return nil
+}
+
+// Addr returns the connection address of the media, falling back to the session level c=
+func (data *SdpMsg) Addr(media *sdpMedia) string {
+	if len(media.ConnData.ConnAddr) > 0 {
+		return string(media.ConnData.ConnAddr)
+	}
+	return string(data.SessConn.ConnAddr)
+}
+
+// Port returns the port of the m= line, 0 means the stream is disabled
+func (media *sdpMedia) Port() int {
+	port, _, _ := bytes.Cut(media.Desc.Port, []byte("/"))
+	n, _ := strconv.Atoi(string(port))
+	return n
+}
+
+// IsSRTP reports whether the media is secured by SDES or DTLS-SRTP
+func (media *sdpMedia) IsSRTP() bool {
+	if len(media.Crypto) > 0 || len(media.Fingerprint) > 0 {
+		return true
+	}
+	return strings.Contains(strings.ToUpper(string(media.Desc.Proto)), "SAVP")
+}
+
+// CodecNames returns the encoding names in preference order
+func (media *sdpMedia) CodecNames() []string {
+	names := make([]string, 0, len(media.Codecs))
+	for _, codec := range media.Codecs {
+		name := codec.Name
+		if name == "" {
+			name = string(codec.PayloadType)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func parseSdpOrigin(v []byte, out *sdpOrigin) {
+	// Init the output area
+	*out = sdpOrigin{}
+
+	// Keep the source line if needed
+	if keep_src {
+		out.Src = v
+	}
+
+	fields := bytes.Fields(v)
+	targets := []*[]byte{&out.Username, &out.SessId, &out.SessVersion, &out.NetType, &out.AddrType, &out.UnicastAddr}
+	for i := 0; i < len(fields) && i < len(targets); i++ {
+		*targets[i] = fields[i]
+	}
+}
+
+// summary converts the description into the entity used by the call pipeline,
+// nil when the message carries no media
+func (data *SdpMsg) summary() *entity.SDP {
+	if len(data.Media) == 0 {
+		return nil
+	}
+	out := &entity.SDP{
+		SessionID:      string(data.Origin.SessId),
+		SessionVersion: string(data.Origin.SessVersion),
+		Media:          make([]entity.SDPMedia, 0, len(data.Media)),
+	}
+	for i := range data.Media {
+		media := &data.Media[i]
+		out.Media = append(out.Media, entity.SDPMedia{
+			MediaType: string(media.Desc.MediaType),
+			Addr:      data.Addr(media),
+			Port:      media.Port(),
+			Proto:     string(media.Desc.Proto),
+			Codecs:    media.CodecNames(),
+			Direction: media.Direction,
+			SRTP:      media.IsSRTP(),
+			ICE:       len(media.IceCandidates) > 0 || len(media.IceUfrag) > 0,
+			DTLS:      len(media.Fingerprint) > 0,
+
+			Candidates: media.candidates(),
+		})
+	}
+	return out
+}
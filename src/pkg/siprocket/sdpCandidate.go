@@ -0,0 +1,79 @@
+package siprocket
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"sip-monitor/src/entity"
+)
+
+/*
+  RFC 8839 - https://www.rfc-editor.org/rfc/rfc8839#section-5.1
+
+  5.1.  "candidate" Attribute
+
+   candidate-attribute   = "candidate" ":" foundation SP component-id SP
+                           transport SP
+                           priority SP
+                           connection-address SP     ;from RFC 4566
+                           port         ;port from RFC 4566
+                           SP cand-type
+                           [SP rel-addr]
+                           [SP rel-port]
+                           *(SP cand-extension)
+
+   cand-type             = "typ" SP candidate-types
+   candidate-types       = "host" / "srflx" / "prflx" / "relay" / token
+
+ eg:
+ a=candidate:842163049 1 udp 1677729535 203.0.113.7 50714 typ srflx raddr 192.168.1.20 rport 50714 generation 0
+
+ WebRTC browsers may replace the host address by an mDNS name such as
+ 4f2a7c1e-....local to hide the local IP.
+
+*/
+
+// parseSdpCandidate parses the value of a=candidate, ok is false when the
+// mandatory fields are missing
+func parseSdpCandidate(v []byte) (candidate entity.ICECandidate, ok bool) {
+	fields := bytes.Fields(v)
+	if len(fields) < 8 || string(fields[6]) != "typ" {
+		return candidate, false
+	}
+	component, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return candidate, false
+	}
+	priority, err := strconv.ParseUint(string(fields[3]), 10, 32)
+	if err != nil {
+		return candidate, false
+	}
+	port, err := strconv.Atoi(string(fields[5]))
+	if err != nil {
+		return candidate, false
+	}
+	return entity.ICECandidate{
+		Foundation: string(fields[0]),
+		Component:  component,
+		Transport:  strings.ToLower(string(fields[2])),
+		Priority:   uint32(priority),
+		Addr:       string(fields[4]),
+		Port:       port,
+		Type:       string(fields[7]),
+	}, true
+}
+
+// candidates returns the parsed a=candidate lines of the media, skipping malformed ones
+func (media *sdpMedia) candidates() []entity.ICECandidate {
+	if len(media.IceCandidates) == 0 {
+		return nil
+	}
+	out := make([]entity.ICECandidate, 0, len(media.IceCandidates))
+	for _, value := range media.IceCandidates {
+		if candidate, ok := parseSdpCandidate(value); ok {
+			out = append(out, candidate)
+		}
+	}
+	return out
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"os"
 	"sip-monitor/src/entity"
 	"strings"
 )
@@ -27,17 +26,22 @@ type SipMsg struct {
 	ContType sipVal
 	ContLen  sipVal
 
-	Sdp SdpMsg
+	// Caller identity headers
+	PAI         []sipIdentity // P-Asserted-Identity
+	RPID        []sipIdentity // Remote-Party-ID
+	Diversion   []sipIdentity // Diversion, the most recent redirection first
+	HistoryInfo []sipIdentity // History-Info, in index order
+	Privacy     []string      // Privacy values: id, header, user, none ...
+
+	Body []sipBodyPart // 消息体，multipart时每个部分一项
+	Sdp  SdpMsg
+	Isup *IsupMsg // SIP-I 封装的ISUP消息
 
 	SessionID string //自定义的Header头
 
-	Raw string
-}
+	Headers []sipHeader // 全部Header头，按接收顺序保存，包括重复的Header
 
-type SdpMsg struct {
-	MediaDesc sdpMediaDesc
-	Attrib    []sdpAttrib
-	ConnData  sdpConnData
+	Raw string
 }
 
 type sipVal struct {
@@ -45,17 +49,11 @@ type sipVal struct {
 	Src   []byte // Full source if needed
 }
 
-var (
-	HeaderNameSessionID = os.Getenv("HEADER_NAME_SESSION_ID")
-)
+// MaxHeaderCount 单个消息最多解析的头部数量，超出的头部忽略，避免异常消息占用大量内存
+const MaxHeaderCount = 256
 
-func init() {
-	if HeaderNameSessionID == "" {
-		HeaderNameSessionID = strings.ToLower("X-JCallID")
-	} else {
-		HeaderNameSessionID = strings.ToLower(HeaderNameSessionID)
-	}
-}
+// HeaderNameSessionID 关联会话的Header头（小写），通过SetSessionIDHeader由配置HeaderSessionIDName设置
+var HeaderNameSessionID = strings.ToLower("X-JCallID")
 
 func (s *sipVal) ToString() string {
 	return string(s.Value)
@@ -84,6 +82,26 @@ func ParseSIP(v []byte) (output *entity.SIP) {
 		Raw: &parse.Raw,
 	}
 
+	if len(parse.Via) > 0 {
+		output.Transport = parse.Via[0].Trans
+	}
+	output.ContactAddr = parse.Contact.addr()
+
+	parse.fillIdentity(output)
+	output.SDP = parse.Sdp.summary()
+	if parse.Isup != nil {
+		output.ISUP = parse.Isup.summary()
+	}
+
+	// Session-Expires: 1800;refresher=uac
+	if sessionExpires := parse.GetHeader("Session-Expires"); sessionExpires != nil {
+		value, _, _ := bytes.Cut(sessionExpires, []byte(";"))
+		output.SessionExpires = BytesToInt(bytes.TrimSpace(value))
+	}
+	output.CustomHeaders = parse.customHeaders()
+	output.CorrelationHeaders = parse.correlationHeaders()
+	output.ICID = parse.icid()
+
 	method := string(parse.Req.Method)
 	if method == "SIP/2.0" {
 		output.Title = string(parse.Req.StatusCode)
@@ -107,7 +125,7 @@ func Parse(v []byte) (output *SipMsg) {
 	// Allow multiple vias and media Attribs
 	via_idx := 0
 	output.Via = make([]sipVia, 0, 8)
-	attr_idx := 0
+	output.Headers = make([]sipHeader, 0, 16)
 	output.Sdp.Attrib = make([]sdpAttrib, 0, 8)
 
 	// 分隔SIP头部和SDP内容
@@ -135,6 +153,9 @@ func Parse(v []byte) (output *SipMsg) {
 			if len(line) == 0 {
 				continue
 			}
+			if len(output.Headers) >= MaxHeaderCount {
+				break
+			}
 
 			// 查找冒号分隔符
 			colonPos := bytes.Index(line, []byte(":"))
@@ -145,6 +166,11 @@ func Parse(v []byte) (output *SipMsg) {
 			headerName := strings.ToLower(string(bytes.TrimSpace(line[:colonPos])))
 			headerVal := bytes.TrimSpace(line[colonPos+1:])
 
+			output.Headers = append(output.Headers, sipHeader{
+				Name:  string(bytes.TrimSpace(line[:colonPos])),
+				Value: headerVal,
+			})
+
 			// 根据头部名称处理
 			switch headerName {
 			case "from", "f":
@@ -172,37 +198,42 @@ func Parse(v []byte) (output *SipMsg) {
 				output.MaxFwd.Value = headerVal
 			case "cseq":
 				parseSipCseq(headerVal, &output.Cseq)
+			case "p-asserted-identity":
+				parseSipIdentities(headerVal, &output.PAI)
+			case "remote-party-id":
+				parseSipIdentities(headerVal, &output.RPID)
+			case "diversion":
+				parseSipIdentities(headerVal, &output.Diversion)
+			case "history-info":
+				parseSipIdentities(headerVal, &output.HistoryInfo)
+			case "privacy":
+				parseSipPrivacy(headerVal, &output.Privacy)
 			case HeaderNameSessionID:
 				output.SessionID = string(headerVal)
 			}
 		}
 	}
 
-	// 处理SDP内容（如果存在）
+	// 处理消息体（如果存在），multipart时按Content-Type找到SDP和ISUP部分
 	if len(parts) > 1 && len(parts[1]) > 0 {
-		sdpContent := parts[1]
-		sdpLines := bytes.Split(sdpContent, []byte("\r\n"))
-
-		for _, line := range sdpLines {
-			line = bytes.TrimSpace(line)
-			if len(line) < 2 || line[1] != '=' {
-				continue // 无效SDP行
-			}
-
-			// SDP行格式为 x=value
-			sdpType := line[0]
-			sdpValue := bytes.TrimSpace(line[2:])
-
-			switch sdpType {
-			case 'm':
-				parseSdpMediaDesc(sdpValue, &output.Sdp.MediaDesc)
-			case 'c':
-				parseSdpConnectionData(sdpValue, &output.Sdp.ConnData)
-			case 'a':
-				var tmpAttrib sdpAttrib
-				output.Sdp.Attrib = append(output.Sdp.Attrib, tmpAttrib)
-				parseSdpAttrib(sdpValue, &output.Sdp.Attrib[attr_idx])
-				attr_idx++
+		output.Body = parseSipBody(output.ContType.Value, parts[1])
+		sdpFound := false
+		for i := range output.Body {
+			part := &output.Body[i]
+			switch part.MediaType() {
+			case "", "application/sdp":
+				// 没有Content-Type时按SDP处理
+				if !sdpFound {
+					parseSdp(part.Body, &output.Sdp)
+					sdpFound = true
+				}
+			case "application/isup":
+				if output.Isup == nil {
+					isup := new(IsupMsg)
+					if parseIsup(part.Body, isup) {
+						output.Isup = isup
+					}
+				}
 			}
 		}
 	}
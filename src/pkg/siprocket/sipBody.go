@@ -0,0 +1,173 @@
+package siprocket
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+)
+
+/*
+ RFC 2046 - https://tools.ietf.org/html/rfc2046#section-5.1 - Multipart Media Type
+ RFC 5621 - Message Body Handling in SIP
+
+ A multipart body is split by a boundary taken from the Content-Type
+ parameters. Every part has its own headers, a blank line and the part
+ body. The last delimiter is followed by "--".
+
+ eg:
+ Content-Type: multipart/mixed;boundary=unique-boundary-1
+
+ --unique-boundary-1
+ Content-Type: application/sdp
+
+ v=0
+ ...
+ --unique-boundary-1
+ Content-Type: application/isup;version=itu-t92+
+ Content-Disposition: signal;handling=optional
+
+ <binary ISUP>
+ --unique-boundary-1--
+
+*/
+
+type sipBodyPart struct {
+	ContentType []byte      // Content-Type of the part, empty when absent
+	Headers     []sipHeader // Part headers in the order received
+	Body        []byte      // Part body, decoded when Content-Transfer-Encoding is base64
+}
+
+// MediaType returns the lower cased type/subtype without parameters
+func (part *sipBodyPart) MediaType() string {
+	return mediaType(part.ContentType)
+}
+
+func mediaType(contentType []byte) string {
+	value, _, _ := bytes.Cut(contentType, []byte(";"))
+	return strings.ToLower(string(bytes.TrimSpace(value)))
+}
+
+// parseSipBody splits the message body into its parts, nested multiparts are flattened
+func parseSipBody(contentType []byte, body []byte) []sipBodyPart {
+	if !strings.HasPrefix(mediaType(contentType), "multipart/") {
+		return []sipBodyPart{{ContentType: contentType, Body: body}}
+	}
+
+	boundary := multipartBoundary(contentType)
+	if boundary == nil {
+		return []sipBodyPart{{ContentType: contentType, Body: body}}
+	}
+
+	var out []sipBodyPart
+	for _, raw := range splitMultipart(body, boundary) {
+		part := parseBodyPart(raw)
+		if strings.HasPrefix(part.MediaType(), "multipart/") {
+			out = append(out, parseSipBody(part.ContentType, part.Body)...)
+			continue
+		}
+		out = append(out, part)
+	}
+	return out
+}
+
+// multipartBoundary returns the boundary parameter of a multipart Content-Type
+func multipartBoundary(contentType []byte) []byte {
+	_, params, _ := bytes.Cut(contentType, []byte(";"))
+	for _, param := range bytes.Split(params, []byte(";")) {
+		name, value := splitParam(param)
+		if name == "boundary" && len(value) > 0 {
+			return value
+		}
+	}
+	return nil
+}
+
+// splitMultipart returns the raw parts between the boundary delimiters
+func splitMultipart(body []byte, boundary []byte) [][]byte {
+	delimiter := append([]byte("--"), boundary...)
+
+	start := bytes.Index(body, delimiter)
+	if start == -1 {
+		return nil
+	}
+	rest := body[start+len(delimiter):]
+
+	var parts [][]byte
+	for {
+		// Close delimiter
+		if bytes.HasPrefix(rest, []byte("--")) {
+			break
+		}
+		// Skip the transport padding up to the end of the delimiter line
+		eol := bytes.IndexByte(rest, '\n')
+		if eol == -1 {
+			break
+		}
+		rest = rest[eol+1:]
+
+		next := bytes.Index(rest, delimiter)
+		if next == -1 {
+			// Truncated body, keep what we have
+			parts = append(parts, rest)
+			break
+		}
+
+		// The line break before the delimiter belongs to the delimiter
+		part := bytes.TrimSuffix(rest[:next], []byte("\n"))
+		part = bytes.TrimSuffix(part, []byte("\r"))
+		parts = append(parts, part)
+		rest = rest[next+len(delimiter):]
+	}
+	return parts
+}
+
+func parseBodyPart(v []byte) sipBodyPart {
+	var part sipBodyPart
+
+	// A part starting with a blank line has no headers
+	var headers, body []byte
+	switch {
+	case bytes.HasPrefix(v, []byte("\r\n")):
+		body = v[2:]
+	case bytes.HasPrefix(v, []byte("\n")):
+		body = v[1:]
+	default:
+		if end := bytes.Index(v, []byte("\r\n\r\n")); end != -1 {
+			headers, body = v[:end], v[end+4:]
+		} else if end := bytes.Index(v, []byte("\n\n")); end != -1 {
+			headers, body = v[:end], v[end+2:]
+		} else {
+			headers = v
+		}
+	}
+
+	base64Encoded := false
+	for _, line := range bytes.Split(headers, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		colonPos := bytes.IndexByte(line, ':')
+		if colonPos == -1 {
+			continue
+		}
+		header := sipHeader{
+			Name:  string(bytes.TrimSpace(line[:colonPos])),
+			Value: bytes.TrimSpace(line[colonPos+1:]),
+		}
+		part.Headers = append(part.Headers, header)
+
+		switch canonicalHeaderName(header.Name) {
+		case "content-type":
+			part.ContentType = header.Value
+		case "content-transfer-encoding":
+			base64Encoded = strings.EqualFold(string(header.Value), "base64")
+		}
+	}
+
+	part.Body = body
+	if base64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(body), nil)))
+		if err == nil {
+			part.Body = decoded
+		}
+	}
+	return part
+}
@@ -0,0 +1,79 @@
+package siprocket
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+/*
+  RFC 7315 - https://www.rfc-editor.org/rfc/rfc7315#section-4.6
+
+  4.6.  The P-Charging-Vector Header Field
+
+   P-Charging-Vector   = "P-Charging-Vector" HCOLON icid-value
+                         *(SEMI charge-params)
+   icid-value          = "icid-value" EQUAL gen-value
+
+ The icid is generated once for the session and copied into every leg by
+ the IMS nodes and most B2BUAs, so legs carrying the same icid belong to
+ the same session.
+
+ eg:
+ P-Charging-Vector: icid-value=1234bc9876e;icid-generated-at=192.0.6.8;orig-ioi=home1.net
+
+ B2BUAs that create a new Call-ID often keep the A-leg Call-ID in a
+ header such as X-Orig-Call-ID, configured with SetCorrelationHeaders.
+
+*/
+
+var (
+	correlationHeaderMutex sync.RWMutex
+	correlationHeaderNames []string
+)
+
+// SetCorrelationHeaders sets the headers copied into entity.SIP.CorrelationHeaders
+func SetCorrelationHeaders(names []string) {
+	correlationHeaderMutex.Lock()
+	defer correlationHeaderMutex.Unlock()
+
+	correlationHeaderNames = correlationHeaderNames[:0]
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			correlationHeaderNames = append(correlationHeaderNames, name)
+		}
+	}
+}
+
+// correlationHeaders returns the first value of each configured correlation
+// header found in the message, keyed by the configured name
+func (data *SipMsg) correlationHeaders() map[string]string {
+	correlationHeaderMutex.RLock()
+	defer correlationHeaderMutex.RUnlock()
+
+	var out map[string]string
+	for _, name := range correlationHeaderNames {
+		value := bytes.TrimSpace(data.GetHeader(name))
+		if len(value) == 0 {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[name] = string(value)
+	}
+	return out
+}
+
+// icid returns the icid-value of P-Charging-Vector, empty when absent
+func (data *SipMsg) icid() string {
+	header := data.GetHeader("P-Charging-Vector")
+	for _, param := range bytes.Split(header, []byte(";")) {
+		name, value, found := bytes.Cut(param, []byte("="))
+		if found && strings.EqualFold(string(bytes.TrimSpace(name)), "icid-value") {
+			return string(bytes.Trim(bytes.TrimSpace(value), `"`))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package siprocket
+
+import (
+	"strings"
+	"sync"
+)
+
+/*
+ RFC 3261 - https://www.ietf.org/rfc/rfc3261.txt - 7.3 Header Fields
+
+ Every header of the message is kept in the order it was received,
+ including repeated headers, so that values not covered by a dedicated
+ parser are still available.
+
+ Compact forms are expanded to their long names for lookups:
+   i: Call-ID, m: Contact, e: Content-Encoding, l: Content-Length,
+   c: Content-Type, f: From, s: Subject, k: Supported, t: To, v: Via
+
+*/
+
+type sipHeader struct {
+	Name  string // Header name as received
+	Value []byte // Header value, surrounding spaces removed
+}
+
+var compactHeaderNames = map[string]string{
+	"i": "call-id",
+	"m": "contact",
+	"e": "content-encoding",
+	"l": "content-length",
+	"c": "content-type",
+	"f": "from",
+	"s": "subject",
+	"k": "supported",
+	"t": "to",
+	"v": "via",
+	"o": "event",
+	"u": "allow-events",
+	"r": "refer-to",
+	"b": "referred-by",
+	"x": "session-expires",
+}
+
+// canonicalHeaderName lower cases a header name and expands the compact form
+func canonicalHeaderName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if long, ok := compactHeaderNames[name]; ok {
+		return long
+	}
+	return name
+}
+
+// GetHeader returns the value of the first header called name, nil if absent
+func (data *SipMsg) GetHeader(name string) []byte {
+	name = canonicalHeaderName(name)
+	for _, header := range data.Headers {
+		if canonicalHeaderName(header.Name) == name {
+			return header.Value
+		}
+	}
+	return nil
+}
+
+// GetHeaders returns the values of every header called name, in message order
+func (data *SipMsg) GetHeaders(name string) [][]byte {
+	name = canonicalHeaderName(name)
+	var values [][]byte
+	for _, header := range data.Headers {
+		if canonicalHeaderName(header.Name) == name {
+			values = append(values, header.Value)
+		}
+	}
+	return values
+}
+
+var (
+	customHeaderMutex sync.RWMutex
+	customHeaderNames []string
+)
+
+// SetSessionIDHeader sets the header used to link the legs of a session
+func SetSessionIDHeader(name string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return
+	}
+	HeaderNameSessionID = strings.ToLower(name)
+}
+
+// SetCustomHeaders sets the headers copied into entity.SIP.CustomHeaders
+func SetCustomHeaders(names []string) {
+	customHeaderMutex.Lock()
+	defer customHeaderMutex.Unlock()
+
+	customHeaderNames = customHeaderNames[:0]
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			customHeaderNames = append(customHeaderNames, name)
+		}
+	}
+}
+
+// customHeaders returns the configured custom headers found in the message,
+// keyed by the configured name. Repeated headers are joined with a comma.
+func (data *SipMsg) customHeaders() map[string]string {
+	customHeaderMutex.RLock()
+	defer customHeaderMutex.RUnlock()
+
+	if len(customHeaderNames) == 0 {
+		return nil
+	}
+
+	var out map[string]string
+	for _, name := range customHeaderNames {
+		values := data.GetHeaders(name)
+		if len(values) == 0 {
+			continue
+		}
+		parts := make([]string, 0, len(values))
+		for _, value := range values {
+			parts = append(parts, string(value))
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[name] = strings.Join(parts, ",")
+	}
+	return out
+}
@@ -0,0 +1,321 @@
+package siprocket
+
+import (
+	"bytes"
+	"net/url"
+	"sip-monitor/src/entity"
+	"strings"
+)
+
+/*
+ RFC 3325 - P-Asserted-Identity
+ draft-ietf-sip-privacy-04 - Remote-Party-ID
+ RFC 3323 - Privacy
+ RFC 5806 - Diversion
+ RFC 7044 - History-Info
+
+ These headers carry the real identities of a call when the From/To
+ URIs are anonymised or the call has been forwarded. They share the
+ name-addr / addr-spec grammar, and may hold several comma separated
+ values or be repeated over several header lines.
+
+ eg:
+ P-Asserted-Identity: "Alice" <sip:+8613800000000@atlanta.com>, <tel:+8613800000000>
+ Remote-Party-ID: "Alice" <sip:alice@atlanta.com>;party=calling;screen=yes;privacy=off
+ Diversion: <sip:1001@biloxi.com>;reason=unconditional;counter=1;privacy=off
+ History-Info: <sip:bob@biloxi.com>;index=1,<sip:carol@chicago.com;cause=302>;index=1.1
+
+*/
+
+type sipIdentity struct {
+	UriType string // Type of URI sip, sips, tel etc
+	Name    []byte // Named portion of URI
+	User    []byte // User part
+	Host    []byte // Host part
+	Port    []byte // Port number
+	Privacy []byte // privacy parameter (Remote-Party-ID, Diversion)
+	Screen  []byte // screen parameter (Remote-Party-ID, Diversion)
+	Party   []byte // party parameter (Remote-Party-ID)
+	Reason  []byte // reason parameter (Diversion) or Reason URI header (History-Info)
+	Counter []byte // counter parameter (Diversion)
+	Index   []byte // index parameter (History-Info)
+	Cause   []byte // cause URI parameter (History-Info)
+	Src     []byte // Full source if needed
+}
+
+// parseSipIdentities parses every comma separated value of an identity header
+// and appends them to out
+func parseSipIdentities(v []byte, out *[]sipIdentity) {
+	for _, item := range splitHeaderValues(v) {
+		var identity sipIdentity
+		parseSipIdentity(item, &identity)
+		*out = append(*out, identity)
+	}
+}
+
+func parseSipIdentity(v []byte, out *sipIdentity) {
+	// Init the output area
+	*out = sipIdentity{}
+
+	// Keep the source line if needed
+	if keep_src {
+		out.Src = v
+	}
+
+	v = bytes.TrimSpace(v)
+
+	var uri, params []byte
+	if lt := indexUnquoted(v, '<'); lt != -1 {
+		// name-addr: [display-name] <uri> *(;param)
+		out.Name = trimDisplayName(v[:lt])
+		rest := v[lt+1:]
+		gt := bytes.IndexByte(rest, '>')
+		if gt == -1 {
+			uri = rest
+		} else {
+			uri = rest[:gt]
+			params = rest[gt+1:]
+		}
+	} else {
+		// addr-spec: uri *(;param), the parameters belong to the header
+		if semi := bytes.IndexByte(v, ';'); semi != -1 {
+			uri = v[:semi]
+			params = v[semi:]
+		} else {
+			uri = v
+		}
+	}
+
+	parseIdentityUri(uri, out)
+
+	for _, param := range bytes.Split(params, []byte(";")) {
+		name, value := splitParam(param)
+		switch name {
+		case "privacy":
+			out.Privacy = value
+		case "screen":
+			out.Screen = value
+		case "party":
+			out.Party = value
+		case "reason":
+			out.Reason = value
+		case "counter":
+			out.Counter = value
+		case "index":
+			out.Index = value
+		}
+	}
+}
+
+// parseIdentityUri splits scheme:user@host:port;uri-params?headers
+func parseIdentityUri(uri []byte, out *sipIdentity) {
+	uri = bytes.TrimSpace(uri)
+
+	colon := bytes.IndexByte(uri, ':')
+	if colon == -1 {
+		return
+	}
+	out.UriType = strings.ToLower(string(uri[:colon]))
+	uri = uri[colon+1:]
+
+	// URI headers, History-Info carries the Reason here
+	if q := bytes.IndexByte(uri, '?'); q != -1 {
+		for _, header := range bytes.Split(uri[q+1:], []byte("&")) {
+			name, value := splitParam(header)
+			if name == "reason" {
+				if unescaped, err := url.QueryUnescape(string(value)); err == nil {
+					value = []byte(unescaped)
+				}
+				out.Reason = value
+			}
+		}
+		uri = uri[:q]
+	}
+
+	// URI parameters
+	if semi := bytes.IndexByte(uri, ';'); semi != -1 {
+		for _, param := range bytes.Split(uri[semi+1:], []byte(";")) {
+			name, value := splitParam(param)
+			if name == "cause" {
+				out.Cause = value
+			}
+		}
+		uri = uri[:semi]
+	}
+
+	// tel URIs have no host part
+	if out.UriType == "tel" {
+		out.User = uri
+		return
+	}
+
+	if at := bytes.LastIndexByte(uri, '@'); at != -1 {
+		out.User = uri[:at]
+		uri = uri[at+1:]
+	}
+
+	// IPv6 references keep their colons
+	if len(uri) > 0 && uri[0] == '[' {
+		if end := bytes.IndexByte(uri, ']'); end != -1 {
+			out.Host = uri[:end+1]
+			if end+1 < len(uri) && uri[end+1] == ':' {
+				out.Port = uri[end+2:]
+			}
+			return
+		}
+	}
+	if c := bytes.IndexByte(uri, ':'); c != -1 {
+		out.Host = uri[:c]
+		out.Port = uri[c+1:]
+		return
+	}
+	out.Host = uri
+}
+
+// splitHeaderValues splits a header on commas that are not inside quotes or <>
+func splitHeaderValues(v []byte) [][]byte {
+	var out [][]byte
+	inQuote := false
+	inAngle := false
+	start := 0
+	for pos := 0; pos < len(v); pos++ {
+		switch v[pos] {
+		case '"':
+			if pos == 0 || v[pos-1] != '\\' {
+				inQuote = !inQuote
+			}
+		case '<':
+			if !inQuote {
+				inAngle = true
+			}
+		case '>':
+			if !inQuote {
+				inAngle = false
+			}
+		case ',':
+			if !inQuote && !inAngle {
+				if item := bytes.TrimSpace(v[start:pos]); len(item) > 0 {
+					out = append(out, item)
+				}
+				start = pos + 1
+			}
+		}
+	}
+	if item := bytes.TrimSpace(v[start:]); len(item) > 0 {
+		out = append(out, item)
+	}
+	return out
+}
+
+// indexUnquoted returns the index of the first c outside of a quoted string
+func indexUnquoted(v []byte, c byte) int {
+	inQuote := false
+	for pos := 0; pos < len(v); pos++ {
+		if v[pos] == '"' && (pos == 0 || v[pos-1] != '\\') {
+			inQuote = !inQuote
+			continue
+		}
+		if v[pos] == c && !inQuote {
+			return pos
+		}
+	}
+	return -1
+}
+
+func trimDisplayName(v []byte) []byte {
+	v = bytes.TrimSpace(v)
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		v = v[1 : len(v)-1]
+	}
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+// splitParam splits name=value, the name is returned in lower case
+func splitParam(v []byte) (string, []byte) {
+	v = bytes.TrimSpace(v)
+	if eq := bytes.IndexByte(v, '='); eq != -1 {
+		value := bytes.Trim(bytes.TrimSpace(v[eq+1:]), "\"")
+		return strings.ToLower(string(bytes.TrimSpace(v[:eq]))), value
+	}
+	return strings.ToLower(string(v)), nil
+}
+
+// parseSipPrivacy splits a Privacy header (priv-value *(";" priv-value)) into its values
+func parseSipPrivacy(v []byte, out *[]string) {
+	for _, item := range bytes.FieldsFunc(v, func(r rune) bool { return r == ';' || r == ',' }) {
+		item = bytes.TrimSpace(item)
+		if len(item) > 0 {
+			*out = append(*out, strings.ToLower(string(item)))
+		}
+	}
+}
+
+// History-Info cause values mapped to Diversion reasons - RFC 4458 section 3.4
+var historyInfoCauseReasons = map[string]string{
+	"302": "unconditional",
+	"404": "unknown",
+	"408": "no-answer",
+	"480": "deflection",
+	"486": "user-busy",
+	"487": "deflection",
+	"503": "unavailable",
+}
+
+// fillIdentity copies the caller identity and redirection information into output
+func (data *SipMsg) fillIdentity(output *entity.SIP) {
+	// Asserted caller: P-Asserted-Identity first, then a calling Remote-Party-ID
+	if len(data.PAI) > 0 {
+		output.AssertedUser = string(data.PAI[0].User)
+		output.AssertedName = string(data.PAI[0].Name)
+	} else {
+		for _, rpid := range data.RPID {
+			party := strings.ToLower(string(rpid.Party))
+			if party == "" || party == "calling" {
+				output.AssertedUser = string(rpid.User)
+				output.AssertedName = string(rpid.Name)
+				if len(rpid.Privacy) > 0 {
+					output.Privacy = strings.ToLower(string(rpid.Privacy))
+				}
+				break
+			}
+		}
+	}
+	if len(data.Privacy) > 0 {
+		output.Privacy = strings.Join(data.Privacy, ";")
+	}
+
+	// Diversion headers are prepended by every redirecting hop, the last one is the original called number
+	if len(data.Diversion) > 0 {
+		original := data.Diversion[len(data.Diversion)-1]
+		output.OriginalCalledUser = string(original.User)
+		output.DiversionReason = strings.ToLower(string(original.Reason))
+		for _, diversion := range data.Diversion {
+			counter := BytesToInt(diversion.Counter)
+			if counter <= 0 {
+				counter = 1
+			}
+			output.RedirectCount += counter
+		}
+		return
+	}
+
+	// History-Info lists the targets in order, a cause parameter marks a retargeting
+	if len(data.HistoryInfo) > 1 {
+		output.OriginalCalledUser = string(data.HistoryInfo[0].User)
+		for _, entry := range data.HistoryInfo {
+			if len(entry.Cause) == 0 {
+				continue
+			}
+			if output.DiversionReason == "" {
+				output.DiversionReason = historyInfoCauseReasons[string(entry.Cause)]
+				if output.DiversionReason == "" {
+					output.DiversionReason = string(entry.Cause)
+				}
+			}
+			output.RedirectCount++
+		}
+	}
+}
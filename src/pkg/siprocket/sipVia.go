@@ -12,7 +12,7 @@ usage of the procedures in [4]).
 */
 
 type sipVia struct {
-	Trans  string // Type of Transport udp, tcp, tls, sctp etc
+	Trans  string // Type of Transport udp, tcp, tls, sctp, ws, wss etc
 	Host   []byte // Host part
 	Port   []byte // Port number
 	Branch []byte //
@@ -75,6 +75,17 @@ func parseSipVia(v []byte, out *sipVia) {
 						pos = pos + 4
 						continue
 					}
+					// RFC 7118 WebSocket, WSS before WS
+					if getString(v, pos, pos+3) == "WSS" {
+						out.Trans = "wss"
+						pos = pos + 3
+						continue
+					}
+					if getString(v, pos, pos+2) == "WS" {
+						out.Trans = "ws"
+						pos = pos + 2
+						continue
+					}
 				}
 				// Look for a Branch identifier
 				if getString(v, pos, pos+7) == "branch=" {
@@ -2311,3 +2311,547 @@ func TestBytesToIntFunctions(t *testing.T) {
 		t.Logf("BytesToInt64(不完整字节): %d", int64Result)
 	})
 }
+
+// 测试主叫身份相关头部：P-Asserted-Identity、Remote-Party-ID、Privacy
+func TestParse_CallerIdentityHeaders(t *testing.T) {
+	sipMsg := "INVITE sip:13900000000@biloxi.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds\r\n" +
+		"To: <sip:13900000000@biloxi.com>\r\n" +
+		"From: \"Anonymous\" <sip:anonymous@anonymous.invalid>;tag=1928301774\r\n" +
+		"Call-ID: a84b4c76e66710@pc33.atlanta.com\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"P-Asserted-Identity: \"Alice, Sales\" <sip:+8613800000000@atlanta.com;user=phone>, <tel:+8613800000000>\r\n" +
+		"Remote-Party-ID: \"Alice\" <sip:alice@atlanta.com>;party=calling;screen=yes;privacy=full\r\n" +
+		"Privacy: id;header\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"
+
+	result := Parse([]byte(sipMsg))
+	if result == nil {
+		t.Fatalf("Parse返回了nil")
+	}
+
+	if len(result.PAI) != 2 {
+		t.Fatalf("P-Asserted-Identity数量错误，期望2个，得到%d个", len(result.PAI))
+	}
+	if string(result.PAI[0].Name) != "Alice, Sales" {
+		t.Errorf("PAI名称错误，期望'Alice, Sales'，得到'%s'", result.PAI[0].Name)
+	}
+	if string(result.PAI[0].User) != "+8613800000000" {
+		t.Errorf("PAI用户错误，期望'+8613800000000'，得到'%s'", result.PAI[0].User)
+	}
+	if string(result.PAI[0].Host) != "atlanta.com" {
+		t.Errorf("PAI主机错误，期望'atlanta.com'，得到'%s'", result.PAI[0].Host)
+	}
+	if result.PAI[1].UriType != "tel" || string(result.PAI[1].User) != "+8613800000000" {
+		t.Errorf("PAI tel URI错误，得到'%s:%s'", result.PAI[1].UriType, result.PAI[1].User)
+	}
+
+	if len(result.RPID) != 1 {
+		t.Fatalf("Remote-Party-ID数量错误，期望1个，得到%d个", len(result.RPID))
+	}
+	if string(result.RPID[0].Party) != "calling" || string(result.RPID[0].Screen) != "yes" || string(result.RPID[0].Privacy) != "full" {
+		t.Errorf("RPID参数错误，得到party='%s' screen='%s' privacy='%s'", result.RPID[0].Party, result.RPID[0].Screen, result.RPID[0].Privacy)
+	}
+
+	if len(result.Privacy) != 2 || result.Privacy[0] != "id" || result.Privacy[1] != "header" {
+		t.Errorf("Privacy错误，期望[id header]，得到%v", result.Privacy)
+	}
+
+	sip := ParseSIP([]byte(sipMsg))
+	if sip.AssertedUser != "+8613800000000" {
+		t.Errorf("AssertedUser错误，期望'+8613800000000'，得到'%s'", sip.AssertedUser)
+	}
+	if sip.AssertedName != "Alice, Sales" {
+		t.Errorf("AssertedName错误，期望'Alice, Sales'，得到'%s'", sip.AssertedName)
+	}
+	if sip.Privacy != "id;header" {
+		t.Errorf("Privacy错误，期望'id;header'，得到'%s'", sip.Privacy)
+	}
+}
+
+// 测试只有Remote-Party-ID时的主叫身份
+func TestParse_RemotePartyIDOnly(t *testing.T) {
+	sipMsg := "INVITE sip:1002@biloxi.com SIP/2.0\r\n" +
+		"From: <sip:anonymous@anonymous.invalid>;tag=1\r\n" +
+		"To: <sip:1002@biloxi.com>\r\n" +
+		"Call-ID: rpid-only\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Remote-Party-ID: <sip:1002@biloxi.com>;party=called\r\n" +
+		"Remote-Party-ID: \"Bob\" <sip:1001@atlanta.com>;party=calling;privacy=full\r\n" +
+		"\r\n"
+
+	sip := ParseSIP([]byte(sipMsg))
+	if sip.AssertedUser != "1001" {
+		t.Errorf("AssertedUser错误，期望'1001'，得到'%s'", sip.AssertedUser)
+	}
+	if sip.AssertedName != "Bob" {
+		t.Errorf("AssertedName错误，期望'Bob'，得到'%s'", sip.AssertedName)
+	}
+	if sip.Privacy != "full" {
+		t.Errorf("Privacy错误，期望'full'，得到'%s'", sip.Privacy)
+	}
+}
+
+// 测试呼叫转移：Diversion
+func TestParse_DiversionHeaders(t *testing.T) {
+	sipMsg := "INVITE sip:1003@biloxi.com SIP/2.0\r\n" +
+		"From: <sip:1001@atlanta.com>;tag=1\r\n" +
+		"To: <sip:1002@biloxi.com>\r\n" +
+		"Call-ID: diversion-test\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Diversion: <sip:1002@biloxi.com>;reason=no-answer;counter=1;privacy=off\r\n" +
+		"Diversion: <sip:1000@biloxi.com>;reason=user-busy;counter=2\r\n" +
+		"\r\n"
+
+	result := Parse([]byte(sipMsg))
+	if len(result.Diversion) != 2 {
+		t.Fatalf("Diversion数量错误，期望2个，得到%d个", len(result.Diversion))
+	}
+	if string(result.Diversion[0].Reason) != "no-answer" || string(result.Diversion[0].Counter) != "1" {
+		t.Errorf("Diversion参数错误，得到reason='%s' counter='%s'", result.Diversion[0].Reason, result.Diversion[0].Counter)
+	}
+
+	sip := ParseSIP([]byte(sipMsg))
+	if sip.OriginalCalledUser != "1000" {
+		t.Errorf("OriginalCalledUser错误，期望'1000'，得到'%s'", sip.OriginalCalledUser)
+	}
+	if sip.DiversionReason != "user-busy" {
+		t.Errorf("DiversionReason错误，期望'user-busy'，得到'%s'", sip.DiversionReason)
+	}
+	if sip.RedirectCount != 3 {
+		t.Errorf("RedirectCount错误，期望3，得到%d", sip.RedirectCount)
+	}
+}
+
+// 测试呼叫转移：History-Info
+func TestParse_HistoryInfoHeaders(t *testing.T) {
+	sipMsg := "INVITE sip:carol@chicago.com SIP/2.0\r\n" +
+		"From: <sip:alice@atlanta.com>;tag=1\r\n" +
+		"To: <sip:bob@biloxi.com>\r\n" +
+		"Call-ID: history-info-test\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"History-Info: <sip:bob@biloxi.com>;index=1,<sip:carol@chicago.com;cause=486?Reason=SIP%3Bcause%3D486%3Btext%3D%22Busy%20Here%22>;index=1.1\r\n" +
+		"\r\n"
+
+	result := Parse([]byte(sipMsg))
+	if len(result.HistoryInfo) != 2 {
+		t.Fatalf("History-Info数量错误，期望2个，得到%d个", len(result.HistoryInfo))
+	}
+	if string(result.HistoryInfo[1].Index) != "1.1" {
+		t.Errorf("History-Info index错误，期望'1.1'，得到'%s'", result.HistoryInfo[1].Index)
+	}
+	if string(result.HistoryInfo[1].Cause) != "486" {
+		t.Errorf("History-Info cause错误，期望'486'，得到'%s'", result.HistoryInfo[1].Cause)
+	}
+	if string(result.HistoryInfo[1].Reason) != "SIP;cause=486;text=\"Busy Here\"" {
+		t.Errorf("History-Info Reason错误，得到'%s'", result.HistoryInfo[1].Reason)
+	}
+	if string(result.HistoryInfo[1].Host) != "chicago.com" {
+		t.Errorf("History-Info主机错误，期望'chicago.com'，得到'%s'", result.HistoryInfo[1].Host)
+	}
+
+	sip := ParseSIP([]byte(sipMsg))
+	if sip.OriginalCalledUser != "bob" {
+		t.Errorf("OriginalCalledUser错误，期望'bob'，得到'%s'", sip.OriginalCalledUser)
+	}
+	if sip.DiversionReason != "user-busy" {
+		t.Errorf("DiversionReason错误，期望'user-busy'，得到'%s'", sip.DiversionReason)
+	}
+	if sip.RedirectCount != 1 {
+		t.Errorf("RedirectCount错误，期望1，得到%d", sip.RedirectCount)
+	}
+}
+
+// 测试通用Header头访问和自定义Header头提取
+func TestParse_GenericHeaders(t *testing.T) {
+	sipMsg := "INVITE sip:bob@biloxi.com SIP/2.0\r\n" +
+		"v: SIP/2.0/UDP pc33.atlanta.com;branch=z9hG4bK776asdhds\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1;branch=z9hG4bK776asdhde\r\n" +
+		"f: <sip:alice@atlanta.com>;tag=1\r\n" +
+		"t: <sip:bob@biloxi.com>\r\n" +
+		"i: generic-headers\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"X-Tenant: acme\r\n" +
+		"X-Route: route-a\r\n" +
+		"x-route: route-b\r\n" +
+		"X-JCallID: session-1\r\n" +
+		"\r\n"
+
+	result := Parse([]byte(sipMsg))
+	if result == nil {
+		t.Fatalf("Parse返回了nil")
+	}
+
+	if len(result.Headers) != 10 {
+		t.Fatalf("Header数量错误，期望10个，得到%d个", len(result.Headers))
+	}
+	if result.Headers[0].Name != "v" || result.Headers[6].Name != "X-Tenant" {
+		t.Errorf("Header顺序错误，得到'%s'，'%s'", result.Headers[0].Name, result.Headers[6].Name)
+	}
+	if vias := result.GetHeaders("Via"); len(vias) != 2 {
+		t.Errorf("Via数量错误，期望2个（包括紧凑形式），得到%d个", len(vias))
+	}
+	if string(result.GetHeader("Call-ID")) != "generic-headers" {
+		t.Errorf("Call-ID错误，得到'%s'", result.GetHeader("Call-ID"))
+	}
+	if routes := result.GetHeaders("X-ROUTE"); len(routes) != 2 || string(routes[1]) != "route-b" {
+		t.Errorf("重复Header错误，得到%q", routes)
+	}
+	if result.GetHeader("X-Missing") != nil {
+		t.Errorf("不存在的Header应当返回nil")
+	}
+
+	SetCustomHeaders([]string{"X-Tenant", " X-Route", "X-Carrier-CallID", ""})
+	defer SetCustomHeaders(nil)
+
+	sip := ParseSIP([]byte(sipMsg))
+	if len(sip.CustomHeaders) != 2 {
+		t.Fatalf("自定义Header数量错误，期望2个，得到%v", sip.CustomHeaders)
+	}
+	if sip.CustomHeaders["X-Tenant"] != "acme" {
+		t.Errorf("X-Tenant错误，得到'%s'", sip.CustomHeaders["X-Tenant"])
+	}
+	if sip.CustomHeaders["X-Route"] != "route-a,route-b" {
+		t.Errorf("X-Route错误，得到'%s'", sip.CustomHeaders["X-Route"])
+	}
+	if sip.SessionID != "session-1" {
+		t.Errorf("SessionID错误，得到'%s'", sip.SessionID)
+	}
+}
+
+// 测试多媒体流SDP解析：会话级/媒体级c=、rtpmap、fmtp、ptime、rtcp、方向、crypto、ICE、o=版本
+func TestParse_MultiMediaSdp(t *testing.T) {
+	sipMsg := "INVITE sip:bob@biloxi.com SIP/2.0\r\n" +
+		"From: <sip:alice@atlanta.com>;tag=1\r\n" +
+		"To: <sip:bob@biloxi.com>\r\n" +
+		"Call-ID: multi-media-sdp\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Content-Type: application/sdp\r\n" +
+		"\r\n" +
+		"v=0\r\n" +
+		"o=alice 2890844526 2890844527 IN IP4 10.0.0.1\r\n" +
+		"s=-\r\n" +
+		"c=IN IP4 10.0.0.1\r\n" +
+		"t=0 0\r\n" +
+		"a=sendrecv\r\n" +
+		"m=audio 49170 RTP/SAVP 0 8 96 101\r\n" +
+		"a=rtpmap:96 opus/48000/2\r\n" +
+		"a=fmtp:96 useinbandfec=1\r\n" +
+		"a=rtpmap:101 telephone-event/8000\r\n" +
+		"a=fmtp:101 0-16\r\n" +
+		"a=ptime:20\r\n" +
+		"a=rtcp:49171\r\n" +
+		"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR\r\n" +
+		"m=video 51372 RTP/AVP 99\r\n" +
+		"c=IN IP4 10.0.0.2\r\n" +
+		"a=rtpmap:99 H264/90000\r\n" +
+		"a=sendonly\r\n" +
+		"a=ice-ufrag:F7gI\r\n" +
+		"a=ice-pwd:x9cml/YzichV2+XlhiMu8g\r\n" +
+		"a=candidate:1 1 UDP 2130706431 10.0.0.2 51372 typ host\r\n"
+
+	result := Parse([]byte(sipMsg))
+	if result == nil {
+		t.Fatalf("Parse返回了nil")
+	}
+	sdp := result.Sdp
+
+	if string(sdp.Origin.SessVersion) != "2890844527" || string(sdp.Origin.UnicastAddr) != "10.0.0.1" {
+		t.Errorf("o=解析错误，得到version='%s' addr='%s'", sdp.Origin.SessVersion, sdp.Origin.UnicastAddr)
+	}
+	if len(sdp.Media) != 2 {
+		t.Fatalf("媒体数量错误，期望2个，得到%d个", len(sdp.Media))
+	}
+
+	audio := &sdp.Media[0]
+	if names := strings.Join(audio.CodecNames(), ","); names != "PCMU,PCMA,opus,telephone-event" {
+		t.Errorf("音频编码错误，得到'%s'", names)
+	}
+	if string(audio.Codecs[2].ClockRate) != "48000" || string(audio.Codecs[2].Channels) != "2" || string(audio.Codecs[2].Fmtp) != "useinbandfec=1" {
+		t.Errorf("opus参数错误，得到%+v", audio.Codecs[2])
+	}
+	if string(audio.Ptime) != "20" || string(audio.Rtcp) != "49171" {
+		t.Errorf("ptime/rtcp错误，得到'%s' '%s'", audio.Ptime, audio.Rtcp)
+	}
+	if audio.Direction != "sendrecv" {
+		t.Errorf("音频方向应继承会话级sendrecv，得到'%s'", audio.Direction)
+	}
+	if !audio.IsSRTP() || len(audio.Crypto) != 1 {
+		t.Errorf("音频应为SRTP")
+	}
+	if sdp.Addr(audio) != "10.0.0.1" || audio.Port() != 49170 {
+		t.Errorf("音频地址错误，得到%s:%d", sdp.Addr(audio), audio.Port())
+	}
+
+	video := &sdp.Media[1]
+	if sdp.Addr(video) != "10.0.0.2" {
+		t.Errorf("视频地址应为媒体级c=，得到'%s'", sdp.Addr(video))
+	}
+	if video.Direction != "sendonly" {
+		t.Errorf("视频方向错误，得到'%s'", video.Direction)
+	}
+	if video.IsSRTP() {
+		t.Errorf("视频不应为SRTP")
+	}
+	if len(video.IceCandidates) != 1 || string(video.IceUfrag) != "F7gI" {
+		t.Errorf("ICE属性错误")
+	}
+
+	// 兼容字段：第一个媒体、会话级c=、全部属性
+	if string(sdp.MediaDesc.MediaType) != "audio" || string(sdp.ConnData.ConnAddr) != "10.0.0.1" {
+		t.Errorf("兼容字段错误")
+	}
+	if len(sdp.Attrib) != 13 {
+		t.Errorf("属性数量错误，期望13个，得到%d个", len(sdp.Attrib))
+	}
+
+	sip := ParseSIP([]byte(sipMsg))
+	if sip.SDP == nil || len(sip.SDP.Media) != 2 {
+		t.Fatalf("SDP摘要错误")
+	}
+	if sip.SDP.MediaTypes() != "audio,video" || sip.SDP.SessionVersion != "2890844527" {
+		t.Errorf("SDP摘要错误，得到%+v", sip.SDP)
+	}
+	if sip.SDP.AudioMedia().PrimaryCodec() != "PCMU" || sip.SDP.AudioMedia().Endpoint() != "10.0.0.1:49170" {
+		t.Errorf("音频摘要错误，得到%+v", sip.SDP.AudioMedia())
+	}
+	if !sip.SDP.Media[1].ICE {
+		t.Errorf("视频应包含ICE")
+	}
+}
+
+func TestParse_MultipartSipI(t *testing.T) {
+	// SIP-I INVITE：multipart/mixed，包含SDP和ISUP IAM
+	iam := "\x01\x00\x20\x01\x0a\x00\x02\x0a" +
+		"\x08\x83\x10\x31\x08\x10\x83\x00\x00" + // 被叫 13800138000，national
+		"\x0a\x08\x03\x13\x70\x55\x21\x43\x65\x87" + // 主叫 075512345678，national
+		"\x00"
+	sipMsg := "INVITE sip:13800138000@10.0.0.2 SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1;branch=z9hG4bK-isup\r\n" +
+		"From: <sip:075512345678@10.0.0.1>;tag=1\r\n" +
+		"To: <sip:13800138000@10.0.0.2>\r\n" +
+		"Call-ID: sipi-1@10.0.0.1\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Content-Type: multipart/mixed;boundary=\"unique-boundary-1\"\r\n" +
+		"\r\n" +
+		"--unique-boundary-1\r\n" +
+		"Content-Type: application/sdp\r\n" +
+		"\r\n" +
+		"v=0\r\n" +
+		"o=- 1 1 IN IP4 10.0.0.1\r\n" +
+		"s=-\r\n" +
+		"c=IN IP4 10.0.0.1\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 20000 RTP/AVP 8\r\n" +
+		"\r\n" +
+		"--unique-boundary-1\r\n" +
+		"Content-Type: application/isup;version=itu-t92+;base=itu-t92+\r\n" +
+		"Content-Disposition: signal;handling=optional\r\n" +
+		"\r\n" +
+		iam + "\r\n" +
+		"--unique-boundary-1--\r\n"
+
+	result := Parse([]byte(sipMsg))
+	if result == nil {
+		t.Fatalf("Parse返回了nil")
+	}
+	if len(result.Body) != 2 {
+		t.Fatalf("消息体部分数量错误，期望2个，得到%d个", len(result.Body))
+	}
+	if result.Body[1].MediaType() != "application/isup" || string(result.Body[1].Body) != iam {
+		t.Errorf("ISUP部分错误，得到%q", result.Body[1].Body)
+	}
+	if string(result.Sdp.ConnData.ConnAddr) != "10.0.0.1" || len(result.Sdp.Media) != 1 {
+		t.Errorf("SDP部分解析错误")
+	}
+	if len(result.Sdp.Attrib) != 0 {
+		t.Errorf("ISUP部分不应解析为SDP属性")
+	}
+
+	sip := ParseSIP([]byte(sipMsg))
+	if sip.SDP == nil || sip.SDP.AudioMedia().PrimaryCodec() != "PCMA" {
+		t.Errorf("SDP摘要错误，得到%+v", sip.SDP)
+	}
+	if sip.ISUP == nil {
+		t.Fatalf("未解析ISUP")
+	}
+	if sip.ISUP.MessageType != "IAM" {
+		t.Errorf("ISUP消息类型错误，得到'%s'", sip.ISUP.MessageType)
+	}
+	if sip.ISUP.CalledNumber != "13800138000" || sip.ISUP.CalledNature != "national" {
+		t.Errorf("被叫号码错误，得到'%s' %s", sip.ISUP.CalledNumber, sip.ISUP.CalledNature)
+	}
+	if sip.ISUP.CallingNumber != "075512345678" || sip.ISUP.CallingNature != "national" {
+		t.Errorf("主叫号码错误，得到'%s' %s", sip.ISUP.CallingNumber, sip.ISUP.CallingNature)
+	}
+}
+
+func TestParseIsupRelease(t *testing.T) {
+	// REL，释放原因17 User busy
+	var msg IsupMsg
+	if !parseIsup([]byte("\x0c\x02\x00\x02\x82\x91"), &msg) {
+		t.Fatalf("REL解析失败")
+	}
+	summary := msg.summary()
+	if summary.MessageType != "REL" || summary.Cause != 17 || summary.CauseText != "User busy" {
+		t.Errorf("REL解析错误，得到%+v", summary)
+	}
+
+	// 截断的消息
+	if parseIsup([]byte("\x01\x00\x20"), &msg) {
+		t.Errorf("截断的IAM应返回false")
+	}
+
+	// base64编码的部分
+	part := parseBodyPart([]byte("Content-Type: application/isup\r\nContent-Transfer-Encoding: base64\r\n\r\nDAIAAoKR\r\n"))
+	if string(part.Body) != "\x0c\x02\x00\x02\x82\x91" {
+		t.Errorf("base64解码错误，得到%q", part.Body)
+	}
+}
+
+func TestParse_WebSocketInvite(t *testing.T) {
+	msg := "INVITE sip:1001@example.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/WSS df7jal23ls0d.invalid;branch=z9hG4bK56sdasks\r\n" +
+		"From: <sip:alice@example.com>;tag=ay4ktx\r\n" +
+		"To: <sip:1001@example.com>\r\n" +
+		"Call-ID: ws-call@df7jal23ls0d.invalid\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Contact: <sip:alice@df7jal23ls0d.invalid;transport=ws;ob>\r\n" +
+		"Content-Type: application/sdp\r\n\r\n" +
+		"v=0\r\no=- 4611731400430051336 2 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n" +
+		"m=audio 50714 UDP/TLS/RTP/SAVPF 111 0\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=rtpmap:111 opus/48000/2\r\n" +
+		"a=ice-ufrag:EsAw\r\na=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\n" +
+		"a=fingerprint:sha-256 D1:2C:BE:AD:C4:F6:64:5C:25:16:11:9C:AF:E7:0F:73:79:36:4E:9C:1E:15:54:39:0C:06:8B:ED:96:86:00:39\r\n" +
+		"a=setup:actpass\r\n" +
+		"a=candidate:1 1 udp 2122260223 4f2a7c1e-5b1d-4a4c-9f7e-3d2c1b0a9e8f.local 50714 typ host generation 0\r\n" +
+		"a=candidate:842163049 1 udp 1686052607 203.0.113.7 50714 typ srflx raddr 0.0.0.0 rport 0 generation 0\r\n" +
+		"a=candidate:3 1 tcp 1518280447 203.0.113.7 9 typ host tcptype active\r\n" +
+		"a=candidate:842163049 2 udp 1686052606 203.0.113.7 50715 typ srflx\r\n" +
+		"a=candidate:bad\r\n" +
+		"a=sendrecv\r\n"
+
+	sip := ParseSIP([]byte(msg))
+	if sip.Transport != "wss" || sip.ContactAddr != "df7jal23ls0d.invalid" {
+		t.Errorf("传输方式或Contact错误：%q %q", sip.Transport, sip.ContactAddr)
+	}
+	if ResolveTransport(6, sip.Transport) != "wss" || ResolveTransport(17, "wss") != "udp" {
+		t.Error("TCP协议号应按Via细化，UDP协议号不应被覆盖")
+	}
+	if got := ResolveContactAddr(sip.ContactAddr, "198.51.100.20:43210"); got != "198.51.100.20:43210" {
+		t.Errorf(".invalid地址应替换为来源地址，得到%q", got)
+	}
+	if got := ResolveContactAddr("10.0.0.1:5060", "198.51.100.20:43210"); got != "10.0.0.1:5060" {
+		t.Errorf("正常地址不应替换，得到%q", got)
+	}
+
+	media := sip.SDP.AudioMedia()
+	if media == nil || !media.ICE || !media.DTLS || !media.SRTP || !sip.SDP.IsWebRTC() {
+		t.Fatalf("应识别为ICE+DTLS媒体：%+v", media)
+	}
+	if len(media.Candidates) != 4 {
+		t.Fatalf("应解析4个候选，得到%d", len(media.Candidates))
+	}
+	if c := media.Candidates[1]; c.Type != "srflx" || c.Addr != "203.0.113.7" || c.Port != 50714 || c.Priority != 1686052607 || c.Component != 1 {
+		t.Errorf("候选解析错误：%+v", c)
+	}
+	// c=0.0.0.0时使用优先级最高的可用候选，忽略mDNS地址
+	if media.Endpoint() != "203.0.113.7:50714" {
+		t.Errorf("媒体地址错误：%s", media.Endpoint())
+	}
+}
+
+// Firefox puts a=fingerprint at session level; ICE credentials may be there too
+func TestParse_SessionLevelFingerprint(t *testing.T) {
+	sdp := "v=0\r\n" +
+		"o=mozilla...THIS_IS_SDPARTA-99.0 6264530282183617522 0 IN IP4 0.0.0.0\r\n" +
+		"s=-\r\nt=0 0\r\n" +
+		"a=fingerprint:sha-256 8F:D3:1A:64:5B:09:E1:2C:7D:90:3A:4F:11:66:B2:C8:0E:57:AD:93:F4:28:6B:71:C5:0D:3E:99:A2:4B:18:E6\r\n" +
+		"a=group:BUNDLE 0 1\r\n" +
+		"a=ice-options:trickle\r\n" +
+		"a=ice-ufrag:6b4c29f1\r\na=ice-pwd:d8a3e2f7c91b40a56e0f3b2d7c8a9e14\r\n" +
+		"a=msid-semantic:WMS *\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 109 0\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=sendrecv\r\n" +
+		"a=mid:0\r\n" +
+		"a=rtpmap:109 opus/48000/2\r\n" +
+		"a=setup:actpass\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 120\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=ice-ufrag:0a1b2c3d\r\n" +
+		"a=fingerprint:sha-1 4A:AD:B9:B1:3F:82:18:3B:54:02:12:DF:3E:5D:49:6B:19:E5:7C:AB\r\n" +
+		"a=mid:1\r\n" +
+		"a=rtpmap:120 VP8/90000\r\n"
+
+	var msg SdpMsg
+	parseSdp([]byte(sdp), &msg)
+	if len(msg.Media) != 2 {
+		t.Fatalf("应有2个媒体，得到%d", len(msg.Media))
+	}
+	audio, video := &msg.Media[0], &msg.Media[1]
+	if !strings.HasPrefix(string(audio.Fingerprint), "sha-256 8F:D3") || string(audio.IceUfrag) != "6b4c29f1" ||
+		string(audio.IcePwd) != "d8a3e2f7c91b40a56e0f3b2d7c8a9e14" {
+		t.Errorf("音频应继承会话级属性：%q %q %q", audio.Fingerprint, audio.IceUfrag, audio.IcePwd)
+	}
+	// 媒体级属性覆盖会话级，未覆盖的仍继承
+	if !strings.HasPrefix(string(video.Fingerprint), "sha-1 4A:AD") || string(video.IceUfrag) != "0a1b2c3d" ||
+		string(video.IcePwd) != "d8a3e2f7c91b40a56e0f3b2d7c8a9e14" {
+		t.Errorf("视频属性错误：%q %q %q", video.Fingerprint, video.IceUfrag, video.IcePwd)
+	}
+
+	summary := msg.summary()
+	for _, media := range summary.Media {
+		if !media.ICE || !media.DTLS || !media.SRTP {
+			t.Errorf("%s应识别为ICE+DTLS媒体：%+v", media.MediaType, media)
+		}
+	}
+	if !summary.IsWebRTC() {
+		t.Error("应识别为WebRTC")
+	}
+}
+
+func TestRegisterTransportProtocolIDs(t *testing.T) {
+	defer delete(transportByProtocolID, 250)
+	defer delete(transportByProtocolID, 251)
+
+	if err := RegisterTransportProtocolIDs("250=ws, 251=WSS"); err != nil {
+		t.Fatal(err)
+	}
+	if TransportByProtocolID(250) != "ws" || TransportByProtocolID(251) != "wss" || !IsMessageTransport(TransportByProtocolID(251)) {
+		t.Error("自定义协议号映射错误")
+	}
+	if IsMessageTransport(TransportByProtocolID(6)) {
+		t.Error("TCP需要分帧")
+	}
+	for _, spec := range []string{"ws", "x=ws", "300=ws", "250="} {
+		if RegisterTransportProtocolIDs(spec) == nil {
+			t.Errorf("%q应返回错误", spec)
+		}
+	}
+}
+
+func TestParse_CorrelationHeaders(t *testing.T) {
+	SetCorrelationHeaders([]string{"X-Orig-Call-ID", " ", "X-Missing"})
+	defer SetCorrelationHeaders(nil)
+
+	msg := "INVITE sip:1001@example.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.2:5060;branch=z9hG4bK776asdhds\r\n" +
+		"From: <sip:alice@example.com>;tag=1928301774\r\n" +
+		"To: <sip:1001@example.com>\r\n" +
+		"Call-ID: b-leg@10.0.0.2\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"X-Orig-Call-ID: a-leg@10.0.0.1\r\n" +
+		"P-Charging-Vector: orig-ioi=home1.net; icid-value=\"1234bc9876e\";icid-generated-at=192.0.6.8\r\n" +
+		"Content-Length: 0\r\n\r\n"
+
+	sip := ParseSIP([]byte(msg))
+	if len(sip.CorrelationHeaders) != 1 || sip.CorrelationHeaders["X-Orig-Call-ID"] != "a-leg@10.0.0.1" {
+		t.Errorf("关联Header错误：%v", sip.CorrelationHeaders)
+	}
+	if sip.ICID != "1234bc9876e" {
+		t.Errorf("icid错误：%q", sip.ICID)
+	}
+}
@@ -0,0 +1,119 @@
+package siprocket
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"sip-monitor/src/entity"
+)
+
+/*
+  RFC 7118 - https://www.rfc-editor.org/rfc/rfc7118
+
+  5.2.  SIP WebSocket Client Considerations
+
+   A SIP WebSocket Client has no way to be reached from outside, so it
+   uses a random domain name with the ".invalid" top level domain
+   (RFC 2606) in the Via sent-by and in the Contact URI:
+
+     Via: SIP/2.0/WSS df7jal23ls0d.invalid;branch=z9hG4bK56sdasks
+     Contact: <sip:alice@df7jal23ls0d.invalid;transport=ws>
+
+   Each SIP message is carried in a single WebSocket message, so the
+   transport keeps the message boundaries like UDP does.
+
+ The HEP IP protocol ID only tells TCP from UDP and SCTP, TLS and
+ WebSocket run over TCP. The transport is refined with the topmost Via,
+ and agents reporting their own protocol IDs for WS/WSS can be mapped
+ with RegisterTransportProtocolID.
+
+*/
+
+// IANA IP protocol numbers
+var transportByProtocolID = map[int]string{
+	6:   entity.TransportTCP,
+	17:  entity.TransportUDP,
+	132: entity.TransportSCTP,
+}
+
+// RegisterTransportProtocolID maps a protocol ID reported by capture agents
+// to a transport. It is not safe for concurrent use and is meant to be
+// called at start up.
+func RegisterTransportProtocolID(id int, transport string) {
+	transportByProtocolID[id] = strings.ToLower(transport)
+}
+
+// RegisterTransportProtocolIDs registers a list such as "250=ws,251=wss"
+func RegisterTransportProtocolIDs(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idText, transport, found := strings.Cut(item, "=")
+		id, err := strconv.Atoi(strings.TrimSpace(idText))
+		transport = strings.TrimSpace(transport)
+		if !found || err != nil || id < 0 || id > 255 || transport == "" {
+			return fmt.Errorf("invalid transport protocol ID %q", item)
+		}
+		RegisterTransportProtocolID(id, transport)
+	}
+	return nil
+}
+
+// TransportByProtocolID returns the transport of a protocol ID, empty when unknown
+func TransportByProtocolID(id int) string {
+	return transportByProtocolID[id]
+}
+
+// ResolveTransport returns the transport of a message. The Via transport
+// is used when the protocol ID is unknown or only says TCP.
+func ResolveTransport(protocolID int, via string) string {
+	transport := TransportByProtocolID(protocolID)
+	if via != "" && (transport == "" || transport == entity.TransportTCP) {
+		return via
+	}
+	return transport
+}
+
+// IsMessageTransport reports whether each packet carries whole SIP
+// messages, as opposed to stream transports that need framing
+func IsMessageTransport(transport string) bool {
+	switch transport {
+	case entity.TransportUDP, entity.TransportWS, entity.TransportWSS:
+		return true
+	}
+	return false
+}
+
+// IsInvalidHost reports whether the host is in the ".invalid" domain used
+// by WebSocket clients
+func IsInvalidHost(host string) bool {
+	return strings.HasSuffix(strings.ToLower(strings.TrimSuffix(host, ".")), ".invalid")
+}
+
+// ResolveContactAddr replaces a Contact address in the ".invalid" domain
+// by the source address the message was actually sent from
+func ResolveContactAddr(contactAddr, srcAddr string) string {
+	host, _, err := net.SplitHostPort(contactAddr)
+	if err != nil {
+		host = contactAddr
+	}
+	if IsInvalidHost(host) {
+		return srcAddr
+	}
+	return contactAddr
+}
+
+// addr returns host[:port] of the Contact URI
+func (contact *sipContact) addr() string {
+	if len(contact.Host) == 0 {
+		return ""
+	}
+	if len(contact.Port) == 0 {
+		return string(contact.Host)
+	}
+	return net.JoinHostPort(string(contact.Host), string(contact.Port))
+}
@@ -30,3 +30,18 @@ func SanitizeRawText(text string) string {
 
 	return result.String()
 }
+
+// TruncateRunes 按字符截断字符串，不会截断多字节字符
+func TruncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	count := 0
+	for i := range s {
+		if count == n {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
@@ -75,3 +75,23 @@ func TestSanitizeRawText(t *testing.T) {
 		}
 	})
 }
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		input    string
+		n        int
+		expected string
+	}{
+		{"", 3, ""},
+		{"abc", 3, "abc"},
+		{"abcdef", 3, "abc"},
+		{"中文字符", 3, "中文字"},
+		{"a中b", 2, "a中"},
+		{"中文", 0, ""},
+	}
+	for _, tt := range tests {
+		if result := TruncateRunes(tt.input, tt.n); result != tt.expected {
+			t.Errorf("TruncateRunes(%q, %d) = %q, want %q", tt.input, tt.n, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ ECMA-376 Office Open XML - SpreadsheetML
+
+ A minimal workbook with a single worksheet:
+
+    [Content_Types].xml
+    _rels/.rels
+    xl/workbook.xml
+    xl/_rels/workbook.xml.rels
+    xl/worksheets/sheet1.xml
+
+ The worksheet is the last entry of the zip archive, so rows can be
+ written straight to the output as they come. Strings are written as
+ inline strings, which avoids keeping a shared string table in memory.
+
+*/
+
+// MaxRows 一个工作表最多的行数
+const MaxRows = 1048576
+
+var ErrTooManyRows = errors.New("超过Excel工作表的最大行数")
+
+// StreamWriter 流式写入只有一个工作表的xlsx文件，行写入后不保留在内存中
+type StreamWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+func NewStreamWriter(w io.Writer, sheetName string) (*StreamWriter, error) {
+	if sheetName == "" {
+		sheetName = "Sheet1"
+	}
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookXML, escape(sheetName))},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+	}
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(fw, file.content); err != nil {
+			return nil, err
+		}
+	}
+
+	fw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(fw)
+	if _, err := sheet.WriteString(sheetHeaderXML); err != nil {
+		return nil, err
+	}
+	return &StreamWriter{zip: zw, sheet: sheet}, nil
+}
+
+// WriteRow 写入一行，数字和布尔值写为对应类型的单元格，时间和其他值写为文本，nil为空单元格
+func (w *StreamWriter) WriteRow(values []any) error {
+	if w.rows >= MaxRows {
+		return ErrTooManyRows
+	}
+	w.rows++
+
+	if _, err := w.sheet.WriteString("<row>"); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := w.writeCell(value); err != nil {
+			return err
+		}
+	}
+	_, err := w.sheet.WriteString("</row>")
+	return err
+}
+
+func (w *StreamWriter) writeCell(value any) error {
+	var cell string
+	switch v := value.(type) {
+	case nil:
+		cell = "<c/>"
+	case int:
+		cell = numberCell(strconv.Itoa(v))
+	case int64:
+		cell = numberCell(strconv.FormatInt(v, 10))
+	case float64:
+		cell = numberCell(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		b := "0"
+		if v {
+			b = "1"
+		}
+		cell = `<c t="b"><v>` + b + `</v></c>`
+	case string:
+		cell = stringCell(v)
+	case time.Time:
+		cell = stringCell(v.Format(time.DateTime))
+	default:
+		cell = stringCell(fmt.Sprint(v))
+	}
+	_, err := w.sheet.WriteString(cell)
+	return err
+}
+
+// Flush 将已写入的行刷新到输出
+func (w *StreamWriter) Flush() error {
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Flush()
+}
+
+// Close 结束工作表并写入zip目录，不关闭底层的Writer
+func (w *StreamWriter) Close() error {
+	if _, err := w.sheet.WriteString(sheetFooterXML); err != nil {
+		return err
+	}
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+func numberCell(v string) string {
+	return `<c t="n"><v>` + v + `</v></c>`
+}
+
+func stringCell(v string) string {
+	if v == "" {
+		return "<c/>"
+	}
+	return `<c t="inlineStr"><is><t xml:space="preserve">` + escape(v) + `</t></is></c>`
+}
+
+// escape 转义XML特殊字符，XML不允许的控制字符替换为U+FFFD
+func escape(v string) string {
+	var buf strings.Builder
+	_ = xml.EscapeText(&buf, []byte(v))
+	return buf.String()
+}
+
+const contentTypesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const rootRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const workbookRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
+
+const sheetHeaderXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetFooterXML = `</sheetData></worksheet>`
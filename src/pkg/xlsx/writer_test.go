@@ -0,0 +1,97 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewStreamWriter(&buf, "CDR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]any{
+		{"id", "from_user", "answered", "create_time"},
+		{int64(1), "张三 <1001>", true, time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)},
+		{2, "", false, nil},
+		{3.5, "a\x01b", nil, "&"},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("不是有效的zip文件：%v", err)
+	}
+	files := map[string]string{}
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[file.Name] = string(content)
+
+		// 每个部件都应是合法的XML
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err != nil {
+				if err != io.EOF {
+					t.Errorf("%s不是合法的XML：%v", file.Name, err)
+				}
+				break
+			}
+		}
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("缺少%s", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `<sheet name="CDR"`) {
+		t.Errorf("工作表名称错误：%s", files["xl/workbook.xml"])
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	if strings.Count(sheet, "<row>") != 4 {
+		t.Errorf("应有4行：%s", sheet)
+	}
+	for _, cell := range []string{
+		`<c t="n"><v>1</v></c>`,
+		`<t xml:space="preserve">张三 &lt;1001&gt;</t>`,
+		`<c t="b"><v>1</v></c>`,
+		`<t xml:space="preserve">2025-04-11 10:00:00</t>`,
+		`<c t="n"><v>3.5</v></c>`,
+		`<t xml:space="preserve">a` + "�" + `b</t>`,
+		`<t xml:space="preserve">&amp;</t>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("缺少单元格%s：%s", cell, sheet)
+		}
+	}
+}
+
+func TestStreamWriter_MaxRows(t *testing.T) {
+	w, err := NewStreamWriter(io.Discard, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.rows = MaxRows
+	if err := w.WriteRow([]any{1}); err != ErrTooManyRows {
+		t.Errorf("超过最大行数应返回ErrTooManyRows，得到%v", err)
+	}
+}
@@ -0,0 +1,750 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sip-monitor/src/config"
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+	"sip-monitor/src/pkg/notify"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AlertService 根据入库的呼叫、RTCP报告和SIP消息在内存中按时间片汇总指标，
+// 定时评估告警规则，状态变化时记录历史并发送通知
+type AlertService struct {
+	logger     *logrus.Logger
+	repository model.Repository
+	notifiers  []*alertNotifier
+	queueDrops func() uint64 // 处理队列累计丢弃的消息数
+	interval   time.Duration
+	listeners  []func(history *entity.AlertHistory)
+
+	mu        sync.Mutex
+	rules     []entity.AlertRule
+	gateways  map[int64]string                // 网关ID -> 名称
+	slots     map[string]map[int64]*alertSlot // 范围 -> 时间片开始时间 -> 指标
+	nodes     map[string]time.Time            // 采集节点最后一次发来消息的时间
+	lastDrops uint64
+	states    map[alertKey]*alertState // 正在触发的告警
+	startedAt time.Time
+
+	now func() time.Time
+}
+
+const (
+	alertSlotSeconds    = 10
+	alertMaxWindow      = 3600
+	alertDefaultWindow  = 600
+	alertScopeGlobal    = "global"
+	alertNotifyTimeout  = 10 * time.Second
+	alertNotifyQueue    = 256
+	alertDefaultEvalGap = 15 * time.Second
+)
+
+// 通知渠道和它的发送队列，每个渠道一个协程按状态变化的顺序发送，
+// 避免同一告警的恢复通知先于触发通知送达
+type alertNotifier struct {
+	notify.Notifier
+	queue chan notify.Message
+}
+
+// 一个时间片内累计的指标
+type alertSlot struct {
+	Attempts     int64
+	Answered     int64
+	ServerErrors int64 // 5xx挂断
+	PDDMsSum     int64
+	PDDCount     int64
+	MosSum       float64
+	MosCount     int64
+	Drops        int64
+}
+
+func (a *alertSlot) merge(b *alertSlot) {
+	a.Attempts += b.Attempts
+	a.Answered += b.Answered
+	a.ServerErrors += b.ServerErrors
+	a.PDDMsSum += b.PDDMsSum
+	a.PDDCount += b.PDDCount
+	a.MosSum += b.MosSum
+	a.MosCount += b.MosCount
+	a.Drops += b.Drops
+}
+
+type alertKey struct {
+	ruleID int64
+	scope  string
+}
+
+type alertState struct {
+	value    float64
+	since    time.Time
+	notified bool // 是否已发送触发通知，静默期间触发的告警在静默结束后补发
+}
+
+// 一次评估得到的指标值
+type alertSample struct {
+	scope string
+	value float64
+}
+
+// 告警状态变化，释放锁之后记录历史并通知
+type alertTransition struct {
+	rule      entity.AlertRule
+	scope     string
+	scopeName string
+	state     string
+	value     float64
+	silenced  bool
+	renotify  bool // 静默结束后补发的触发通知，不再记录历史
+	at        time.Time
+}
+
+var alertMetricNames = map[string]string{
+	entity.AlertMetricASR:        "ASR(%)",
+	entity.AlertMetricMOS:        "平均MOS",
+	entity.AlertMetricPDD:        "平均PDD(毫秒)",
+	entity.AlertMetric5xxRate:    "5xx挂断(次/分钟)",
+	entity.AlertMetricNodeSilent: "静默时长(秒)",
+	entity.AlertMetricQueueDrop:  "队列丢弃消息数",
+}
+
+func NewAlertService(logger *logrus.Logger, repository model.Repository, notifiers []notify.Notifier, queueDrops func() uint64, interval time.Duration) *AlertService {
+	if interval <= 0 {
+		interval = alertDefaultEvalGap
+	}
+	s := &AlertService{
+		logger:     logger,
+		repository: repository,
+		notifiers:  make([]*alertNotifier, 0, len(notifiers)),
+		queueDrops: queueDrops,
+		interval:   interval,
+		gateways:   make(map[int64]string),
+		slots:      make(map[string]map[int64]*alertSlot),
+		nodes:      make(map[string]time.Time),
+		states:     make(map[alertKey]*alertState),
+		now:        time.Now,
+	}
+	for _, notifier := range notifiers {
+		n := &alertNotifier{Notifier: notifier, queue: make(chan notify.Message, alertNotifyQueue)}
+		s.notifiers = append(s.notifiers, n)
+		go s.deliver(n)
+	}
+	s.startedAt = s.now()
+	if queueDrops != nil {
+		s.lastDrops = queueDrops()
+	}
+	if err := s.Reload(); err != nil {
+		logger.WithError(err).Error("加载告警规则失败")
+	}
+	s.ReloadGateways()
+	return s
+}
+
+// NewAlertNotifiers 根据配置创建告警通知渠道
+func NewAlertNotifiers(cfg *config.Config) []notify.Notifier {
+	var notifiers []notify.Notifier
+	for _, url := range splitList(cfg.AlertWebhookURLs) {
+		notifiers = append(notifiers, notify.NewWebhookNotifier(url))
+	}
+	if cfg.AlertSMTPAddr != "" {
+		notifiers = append(notifiers, notify.NewSMTPNotifier(cfg.AlertSMTPAddr, cfg.AlertSMTPUser,
+			cfg.AlertSMTPPassword, cfg.AlertSMTPFrom, splitList(cfg.AlertSMTPTo)))
+	}
+	if cfg.AlertSyslogAddr != "" {
+		notifiers = append(notifiers, notify.NewSyslogNotifier(cfg.AlertSyslogAddr, "sip-monitor"))
+	}
+	return notifiers
+}
+
+// AddHistoryListener 添加告警触发或恢复后的回调，静默的告警同样回调，需在Start之前调用
+func (s *AlertService) AddHistoryListener(listener func(history *entity.AlertHistory)) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// Start 开始定时评估告警规则
+func (s *AlertService) Start() {
+	go s.runner()
+}
+
+func (s *AlertService) runner() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.Evaluate()
+	}
+}
+
+// Reload 重新加载告警规则，已删除或停用的规则的告警状态直接清除
+func (s *AlertService) Reload() error {
+	rules, err := s.repository.AlertRuleList()
+	if err != nil {
+		return err
+	}
+	enabled := make([]entity.AlertRule, 0, len(rules))
+	ids := make(map[int64]struct{}, len(rules))
+	for _, rule := range rules {
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+			ids[rule.ID] = struct{}{}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = enabled
+	for key := range s.states {
+		if _, ok := ids[key.ruleID]; !ok {
+			delete(s.states, key)
+		}
+	}
+	return nil
+}
+
+// ReloadGateways 重新加载网关名称，用于通知内容
+func (s *AlertService) ReloadGateways() {
+	gateways, err := s.repository.GatewayList()
+	if err != nil {
+		s.logger.WithError(err).Error("加载网关列表失败")
+		return
+	}
+	names := make(map[int64]string, len(gateways))
+	for _, gateway := range gateways {
+		names[gateway.ID] = gateway.Name
+	}
+	s.mu.Lock()
+	s.gateways = names
+	s.mu.Unlock()
+}
+
+// OnCallSaved 呼叫写入数据库后累加到全局、入口和出口网关、采集节点的指标
+func (s *AlertService) OnCallSaved(call *entity.Call) {
+	answered := call.AnswerTime != nil || call.TalkDuration > 0
+	serverError := call.HangupCode >= 500 && call.HangupCode < 600
+	pddMs := int64(-1)
+	if call.CreateTime != nil && call.RingingTime != nil && !call.RingingTime.Before(*call.CreateTime) {
+		pddMs = call.RingingTime.Sub(*call.CreateTime).Milliseconds()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for _, scope := range callAlertScopes(call) {
+		slot := s.slot(scope, now)
+		slot.Attempts++
+		if answered {
+			slot.Answered++
+		}
+		if serverError {
+			slot.ServerErrors++
+		}
+		if pddMs >= 0 {
+			slot.PDDMsSum += pddMs
+			slot.PDDCount++
+		}
+	}
+}
+
+// OnRTCPReport 累加呼叫的MOS，取两个方向中较差的一个
+func (s *AlertService) OnRTCPReport(call *entity.Call, report *entity.RtcpReport) {
+	mos := callMos(entity.CallStatRow{AlegMos: report.AlegMos, BlegMos: report.BlegMos})
+	if mos <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for _, scope := range callAlertScopes(call) {
+		slot := s.slot(scope, now)
+		slot.MosSum += mos
+		slot.MosCount++
+	}
+}
+
+// Observe 记录采集节点最后一次发来消息的时间
+func (s *AlertService) Observe(item entity.SIP) {
+	if item.NodeIP == "" {
+		return
+	}
+	s.mu.Lock()
+	s.nodes[item.NodeIP] = s.now()
+	s.mu.Unlock()
+}
+
+// Evaluate 评估所有规则，记录状态变化并通知
+func (s *AlertService) Evaluate() {
+	s.mu.Lock()
+	now := s.now()
+	if s.queueDrops != nil {
+		drops := s.queueDrops()
+		if drops > s.lastDrops {
+			s.slot(alertScopeGlobal, now).Drops += int64(drops - s.lastDrops)
+		}
+		s.lastDrops = drops
+	}
+	s.prune(now)
+
+	var transitions []alertTransition
+	for _, rule := range s.rules {
+		silenced := rule.SilenceUntil != nil && rule.SilenceUntil.After(now)
+		for _, sample := range s.samples(rule, now) {
+			key := alertKey{ruleID: rule.ID, scope: sample.scope}
+			transition := alertTransition{
+				rule:      rule,
+				scope:     sample.scope,
+				scopeName: s.scopeName(sample.scope),
+				value:     sample.value,
+				silenced:  silenced,
+				at:        now,
+			}
+
+			state, firing := s.states[key]
+			if !firing {
+				if compareAlert(sample.value, rule.Operator, rule.Threshold) {
+					s.states[key] = &alertState{value: sample.value, since: now, notified: !silenced}
+					transition.state = entity.AlertStateFiring
+					transitions = append(transitions, transition)
+				}
+				continue
+			}
+
+			state.value = sample.value
+			if !compareAlert(sample.value, rule.Operator, alertRecoverLevel(rule)) {
+				delete(s.states, key)
+				transition.state = entity.AlertStateResolved
+				// 没有发送过触发通知的告警也不发送恢复通知
+				transition.silenced = silenced || !state.notified
+				transitions = append(transitions, transition)
+			}
+		}
+
+		if silenced {
+			continue
+		}
+		// 静默结束时仍在触发的告警补发触发通知
+		for key, state := range s.states {
+			if key.ruleID != rule.ID || state.notified {
+				continue
+			}
+			state.notified = true
+			transitions = append(transitions, alertTransition{
+				rule:      rule,
+				scope:     key.scope,
+				scopeName: s.scopeName(key.scope),
+				state:     entity.AlertStateFiring,
+				value:     state.value,
+				renotify:  true,
+				at:        now,
+			})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, transition := range transitions {
+		s.record(transition)
+	}
+}
+
+// Active 正在触发的告警，按开始时间排序
+func (s *AlertService) Active() []entity.ActiveAlertVO {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	out := make([]entity.ActiveAlertVO, 0, len(s.states))
+	for _, rule := range s.rules {
+		for key, state := range s.states {
+			if key.ruleID != rule.ID {
+				continue
+			}
+			out = append(out, entity.ActiveAlertVO{
+				RuleID:    rule.ID,
+				RuleName:  rule.Name,
+				Metric:    rule.Metric,
+				Scope:     key.scope,
+				Value:     state.value,
+				Threshold: rule.Threshold,
+				Since:     state.since,
+				Silenced:  rule.SilenceUntil != nil && rule.SilenceUntil.After(now),
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Since.Equal(out[j].Since) {
+			return out[i].Since.Before(out[j].Since)
+		}
+		if out[i].RuleID != out[j].RuleID {
+			return out[i].RuleID < out[j].RuleID
+		}
+		return out[i].Scope < out[j].Scope
+	})
+	return out
+}
+
+// samples 计算规则在各范围的指标值，样本不足时不返回，告警状态保持不变。调用方需持有mu
+func (s *AlertService) samples(rule entity.AlertRule, now time.Time) []alertSample {
+	window := alertWindow(rule)
+
+	switch rule.Metric {
+	case entity.AlertMetricNodeSilent:
+		if rule.NodeIP != "" {
+			last, ok := s.nodes[rule.NodeIP]
+			if !ok {
+				last = s.startedAt
+			}
+			return []alertSample{{scope: nodeAlertScope(rule.NodeIP), value: now.Sub(last).Seconds()}}
+		}
+		out := make([]alertSample, 0, len(s.nodes))
+		for ip, last := range s.nodes {
+			out = append(out, alertSample{scope: nodeAlertScope(ip), value: now.Sub(last).Seconds()})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].scope < out[j].scope })
+		return out
+	case entity.AlertMetricQueueDrop:
+		sum := s.windowSum(alertScopeGlobal, now, window)
+		return []alertSample{{scope: alertScopeGlobal, value: float64(sum.Drops)}}
+	}
+
+	scope := ruleAlertScope(rule)
+	sum := s.windowSum(scope, now, window)
+	minSamples := int64(rule.MinSamples)
+	sample := alertSample{scope: scope}
+	switch rule.Metric {
+	case entity.AlertMetricASR:
+		if sum.Attempts == 0 || sum.Attempts < minSamples {
+			return nil
+		}
+		sample.value = float64(sum.Answered) * 100 / float64(sum.Attempts)
+	case entity.AlertMetricPDD:
+		if sum.PDDCount == 0 || sum.PDDCount < minSamples {
+			return nil
+		}
+		sample.value = float64(sum.PDDMsSum) / float64(sum.PDDCount)
+	case entity.AlertMetricMOS:
+		if sum.MosCount == 0 || sum.MosCount < minSamples {
+			return nil
+		}
+		sample.value = sum.MosSum / float64(sum.MosCount)
+	case entity.AlertMetric5xxRate:
+		if sum.Attempts < minSamples {
+			return nil
+		}
+		sample.value = float64(sum.ServerErrors) * 60 / float64(window)
+	default:
+		return nil
+	}
+	return []alertSample{sample}
+}
+
+// slot 返回范围在当前时间片的指标，调用方需持有mu
+func (s *AlertService) slot(scope string, now time.Time) *alertSlot {
+	start := now.Unix() - now.Unix()%alertSlotSeconds
+	slots, ok := s.slots[scope]
+	if !ok {
+		slots = make(map[int64]*alertSlot)
+		s.slots[scope] = slots
+	}
+	slot, ok := slots[start]
+	if !ok {
+		slot = &alertSlot{}
+		slots[start] = slot
+	}
+	return slot
+}
+
+// windowSum 汇总最近window秒内开始的时间片，调用方需持有mu
+func (s *AlertService) windowSum(scope string, now time.Time, window int) alertSlot {
+	var sum alertSlot
+	cutoff := now.Unix() - int64(window)
+	for start, slot := range s.slots[scope] {
+		if start >= cutoff {
+			sum.merge(slot)
+		}
+	}
+	return sum
+}
+
+// prune 删除超过最大评估窗口的时间片和长时间没有消息的采集节点，调用方需持有mu
+func (s *AlertService) prune(now time.Time) {
+	s.pruneNodes(now)
+
+	cutoff := now.Unix() - alertMaxWindow - alertSlotSeconds
+	for scope, slots := range s.slots {
+		for start := range slots {
+			if start < cutoff {
+				delete(slots, start)
+			}
+		}
+		if len(slots) == 0 {
+			delete(s.slots, scope)
+		}
+	}
+}
+
+// pruneNodes 节点没有消息的时间超过最长的规则窗口（节点静默规则为阈值）再加alertMaxWindow后不再跟踪，
+// 节点下线时节点静默告警仍会先触发；规则指定的节点一直保留。调用方需持有mu
+func (s *AlertService) pruneNodes(now time.Time) {
+	longest := float64(alertMaxWindow)
+	pinned := make(map[string]struct{})
+	for _, rule := range s.rules {
+		longest = max(longest, float64(alertWindow(rule)))
+		if rule.Metric == entity.AlertMetricNodeSilent {
+			longest = max(longest, rule.Threshold)
+		}
+		if rule.NodeIP != "" {
+			pinned[rule.NodeIP] = struct{}{}
+		}
+	}
+	cutoff := now.Add(-time.Duration(longest+alertMaxWindow) * time.Second)
+	for ip, last := range s.nodes {
+		if _, ok := pinned[ip]; ok || !last.Before(cutoff) {
+			continue
+		}
+		delete(s.nodes, ip)
+		scope := nodeAlertScope(ip)
+		for key := range s.states {
+			if key.scope == scope {
+				delete(s.states, key)
+			}
+		}
+		s.logger.WithField("node", ip).Warn("采集节点长时间没有消息，不再跟踪")
+	}
+}
+
+// scopeName 范围的显示名称，调用方需持有mu
+func (s *AlertService) scopeName(scope string) string {
+	if scope == alertScopeGlobal {
+		return "全局"
+	}
+	if id, ok := strings.CutPrefix(scope, "gateway:"); ok {
+		gatewayID, _ := strconv.ParseInt(id, 10, 64)
+		if name := s.gateways[gatewayID]; name != "" {
+			return "网关 " + name
+		}
+		return "网关 " + id
+	}
+	if ip, ok := strings.CutPrefix(scope, "node:"); ok {
+		return "节点 " + ip
+	}
+	return scope
+}
+
+// record 保存告警历史，未静默时发送通知；补发的通知只发送通知
+func (s *AlertService) record(t alertTransition) {
+	text := fmt.Sprintf("%s的%s为%.2f，规则条件 %s %g，窗口%d秒",
+		t.scopeName, alertMetricNames[t.rule.Metric], t.value, t.rule.Operator, t.rule.Threshold, alertWindow(t.rule))
+	title := "[告警] " + t.rule.Name
+	if t.state == entity.AlertStateResolved {
+		title = "[恢复] " + t.rule.Name
+		text += "，已恢复"
+	}
+	if t.renotify {
+		text += "，静默结束后仍在告警"
+		s.enqueue(t, title, text)
+		return
+	}
+
+	history := &entity.AlertHistory{
+		RuleID:     t.rule.ID,
+		RuleName:   t.rule.Name,
+		Metric:     t.rule.Metric,
+		Scope:      t.scope,
+		State:      t.state,
+		Value:      t.value,
+		Threshold:  t.rule.Threshold,
+		Message:    text,
+		Silenced:   t.silenced,
+		CreateTime: t.at,
+	}
+	if err := s.repository.CreateAlertHistory(context.Background(), history); err != nil {
+		s.logger.WithError(err).WithField("rule", t.rule.Name).Error("保存告警历史失败")
+	}
+	s.logger.WithFields(logrus.Fields{
+		"rule":     t.rule.Name,
+		"scope":    t.scope,
+		"state":    t.state,
+		"silenced": t.silenced,
+	}).Warn(text)
+	for _, listener := range s.listeners {
+		listener(history)
+	}
+
+	if t.silenced {
+		return
+	}
+	s.enqueue(t, title, text)
+}
+
+// enqueue 将通知放入规则选择的各渠道的发送队列
+func (s *AlertService) enqueue(t alertTransition, title, text string) {
+	msg := notify.Message{
+		Title: title,
+		Text:  text,
+		State: t.state,
+		Labels: map[string]string{
+			"rule_id": strconv.FormatInt(t.rule.ID, 10),
+			"rule":    t.rule.Name,
+			"metric":  t.rule.Metric,
+			"scope":   t.scope,
+		},
+		Time: t.at,
+	}
+	for _, notifier := range s.ruleNotifiers(t.rule) {
+		select {
+		case notifier.queue <- msg:
+		default:
+			s.logger.WithFields(logrus.Fields{"notifier": notifier.Name(), "rule": t.rule.Name}).Error("告警通知队列已满，丢弃通知")
+		}
+	}
+}
+
+// deliver 按入队顺序逐条发送一个渠道的通知
+func (s *AlertService) deliver(notifier *alertNotifier) {
+	for msg := range notifier.queue {
+		s.send(notifier, msg)
+	}
+}
+
+func (s *AlertService) send(notifier notify.Notifier, msg notify.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertNotifyTimeout)
+	defer cancel()
+	if err := notifier.Send(ctx, msg); err != nil {
+		s.logger.WithError(err).WithField("notifier", notifier.Name()).Error("发送告警通知失败")
+	}
+}
+
+// ruleNotifiers 规则选择的通知渠道，未指定时使用全部渠道
+func (s *AlertService) ruleNotifiers(rule entity.AlertRule) []*alertNotifier {
+	names := splitList(rule.Notifiers)
+	if len(names) == 0 {
+		return s.notifiers
+	}
+	var out []*alertNotifier
+	for _, notifier := range s.notifiers {
+		for _, name := range names {
+			if strings.EqualFold(notifier.Name(), name) {
+				out = append(out, notifier)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// 呼叫计入的范围：全局、入口和出口网关、采集节点
+func callAlertScopes(call *entity.Call) []string {
+	scopes := []string{alertScopeGlobal}
+	if call.IngressGatewayID > 0 {
+		scopes = append(scopes, gatewayAlertScope(call.IngressGatewayID))
+	}
+	if call.EgressGatewayID > 0 && call.EgressGatewayID != call.IngressGatewayID {
+		scopes = append(scopes, gatewayAlertScope(call.EgressGatewayID))
+	}
+	if call.NodeIP != "" {
+		scopes = append(scopes, nodeAlertScope(call.NodeIP))
+	}
+	return scopes
+}
+
+func ruleAlertScope(rule entity.AlertRule) string {
+	if rule.GatewayID > 0 {
+		return gatewayAlertScope(rule.GatewayID)
+	}
+	if rule.NodeIP != "" {
+		return nodeAlertScope(rule.NodeIP)
+	}
+	return alertScopeGlobal
+}
+
+func gatewayAlertScope(id int64) string {
+	return "gateway:" + strconv.FormatInt(id, 10)
+}
+
+func nodeAlertScope(ip string) string {
+	return "node:" + ip
+}
+
+func compareAlert(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// alertWindow 规则的评估窗口（秒），未设置时为默认值
+func alertWindow(rule entity.AlertRule) int {
+	if rule.WindowSeconds <= 0 {
+		return alertDefaultWindow
+	}
+	return rule.WindowSeconds
+}
+
+// alertRecoverLevel 恢复的阈值：指标需要越过阈值Hysteresis之后才恢复
+func alertRecoverLevel(rule entity.AlertRule) float64 {
+	switch rule.Operator {
+	case ">", ">=":
+		return rule.Threshold - rule.Hysteresis
+	}
+	return rule.Threshold + rule.Hysteresis
+}
+
+// ValidateAlertRule 检查告警规则
+func ValidateAlertRule(rule entity.AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("规则名称不能为空")
+	}
+	if _, ok := alertMetricNames[rule.Metric]; !ok {
+		return fmt.Errorf("不支持的告警指标：%s", rule.Metric)
+	}
+	switch rule.Operator {
+	case ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("不支持的比较符：%s", rule.Operator)
+	}
+	if rule.Hysteresis < 0 {
+		return fmt.Errorf("恢复回差不能小于0")
+	}
+	if rule.WindowSeconds < 0 || rule.WindowSeconds > alertMaxWindow {
+		return fmt.Errorf("评估窗口应在0到%d秒之间", alertMaxWindow)
+	}
+	if rule.MinSamples < 0 {
+		return fmt.Errorf("最少样本数不能小于0")
+	}
+	if rule.GatewayID > 0 && rule.NodeIP != "" {
+		return fmt.Errorf("网关和采集节点只能指定一个")
+	}
+	switch rule.Metric {
+	case entity.AlertMetricNodeSilent:
+		if rule.GatewayID > 0 {
+			return fmt.Errorf("节点静默规则不能指定网关")
+		}
+	case entity.AlertMetricQueueDrop:
+		if rule.GatewayID > 0 || rule.NodeIP != "" {
+			return fmt.Errorf("队列丢弃规则只支持全局范围")
+		}
+	}
+	for _, name := range splitList(rule.Notifiers) {
+		switch strings.ToLower(name) {
+		case "webhook", "email", "syslog":
+		default:
+			return fmt.Errorf("不支持的通知渠道：%s", name)
+		}
+	}
+	return nil
+}
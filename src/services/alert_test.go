@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/pkg/notify"
+
+	"github.com/sirupsen/logrus"
+)
+
+type alertTestRepository struct {
+	statTestRepository
+	rules []entity.AlertRule
+
+	mu        sync.Mutex
+	histories []entity.AlertHistory
+}
+
+func (r *alertTestRepository) AlertRuleList() ([]entity.AlertRule, error) {
+	return r.rules, nil
+}
+
+func (r *alertTestRepository) CreateAlertHistory(ctx context.Context, history *entity.AlertHistory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.histories = append(r.histories, *history)
+	return nil
+}
+
+func (r *alertTestRepository) lastHistory() entity.AlertHistory {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.histories[len(r.histories)-1]
+}
+
+type chanNotifier struct {
+	name     string
+	messages chan notify.Message
+}
+
+func (n *chanNotifier) Name() string {
+	return n.name
+}
+
+func (n *chanNotifier) Send(ctx context.Context, msg notify.Message) error {
+	n.messages <- msg
+	return nil
+}
+
+func waitMessage(t *testing.T, messages chan notify.Message) notify.Message {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("未收到告警通知")
+	}
+	return notify.Message{}
+}
+
+func expectNoMessage(t *testing.T, messages chan notify.Message) {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		t.Fatalf("不应发送通知，收到%+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// drainMessages 收集一次评估发出的全部通知，按 规则/范围 -> 状态 返回，不依赖通知的先后顺序
+func drainMessages(t *testing.T, messages chan notify.Message) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	msg := waitMessage(t, messages)
+	for {
+		got[msg.Labels["rule"]+"/"+msg.Labels["scope"]] = msg.State
+		select {
+		case msg = <-messages:
+		case <-time.After(50 * time.Millisecond):
+			return got
+		}
+	}
+}
+
+func newTestAlertService(repository *alertTestRepository, notifiers []notify.Notifier, drops func() uint64, now *time.Time) *AlertService {
+	s := NewAlertService(logrus.New(), repository, notifiers, drops, time.Hour)
+	s.now = func() time.Time { return *now }
+	s.startedAt = *now
+	return s
+}
+
+func alertCall(gatewayID int64, answered bool, hangupCode int) *entity.Call {
+	begin := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	ringing := begin.Add(2 * time.Second)
+	call := &entity.Call{NodeIP: "10.1.1.1", IngressGatewayID: gatewayID, CreateTime: &begin, RingingTime: &ringing, HangupCode: hangupCode}
+	if answered {
+		answer := begin.Add(5 * time.Second)
+		call.AnswerTime = &answer
+	}
+	return call
+}
+
+func TestAlertService_ASRHysteresis(t *testing.T) {
+	// Webhook通知发到本地的HTTP服务
+	received := make(chan notify.Message, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg notify.Message
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		received <- msg
+	}))
+	defer server.Close()
+
+	repository := &alertTestRepository{
+		statTestRepository: statTestRepository{gateways: []entity.Gateway{{ID: 1, Name: "carrier-a", Addrs: []string{"10.0.0.1"}}}},
+		rules: []entity.AlertRule{{
+			ID: 1, Name: "网关ASR过低", Enabled: true, Metric: entity.AlertMetricASR, GatewayID: 1,
+			Operator: "<", Threshold: 30, Hysteresis: 15, WindowSeconds: 600, MinSamples: 4,
+		}},
+	}
+	now := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	s := newTestAlertService(repository, []notify.Notifier{notify.NewWebhookNotifier(server.URL)}, nil, &now)
+
+	// 样本不足时不评估
+	for i := 0; i < 3; i++ {
+		s.OnCallSaved(alertCall(1, false, 503))
+	}
+	s.Evaluate()
+	expectNoMessage(t, received)
+
+	// 其他网关的呼叫不影响
+	s.OnCallSaved(alertCall(2, true, 0))
+	s.OnCallSaved(alertCall(1, true, 0))
+	s.Evaluate()
+	msg := waitMessage(t, received)
+	if msg.State != notify.StateFiring || msg.Title != "[告警] 网关ASR过低" || msg.Labels["scope"] != "gateway:1" {
+		t.Errorf("告警通知错误：%+v", msg)
+	}
+	if history := repository.lastHistory(); history.State != entity.AlertStateFiring || history.Value != 25 || history.Silenced {
+		t.Errorf("告警历史错误：%+v", history)
+	}
+	if active := s.Active(); len(active) != 1 || active[0].Scope != "gateway:1" || active[0].Value != 25 {
+		t.Errorf("正在触发的告警错误：%+v", active)
+	}
+
+	// 回到阈值以上但未越过回差，保持触发，不重复通知
+	s.OnCallSaved(alertCall(1, true, 0))
+	s.Evaluate()
+	expectNoMessage(t, received)
+	if len(s.Active()) != 1 {
+		t.Errorf("未越过回差时应保持触发")
+	}
+
+	// ASR 57%，恢复
+	s.OnCallSaved(alertCall(1, true, 0))
+	s.OnCallSaved(alertCall(1, true, 0))
+	s.Evaluate()
+	msg = waitMessage(t, received)
+	if msg.State != notify.StateResolved || msg.Title != "[恢复] 网关ASR过低" {
+		t.Errorf("恢复通知错误：%+v", msg)
+	}
+	if len(s.Active()) != 0 {
+		t.Errorf("恢复后不应有告警")
+	}
+
+	// 窗口过后没有样本，状态不变
+	now = now.Add(20 * time.Minute)
+	s.Evaluate()
+	expectNoMessage(t, received)
+}
+
+func TestAlertService_NodeSilentAndQueueDrop(t *testing.T) {
+	notifier := &chanNotifier{name: "syslog", messages: make(chan notify.Message, 10)}
+	repository := &alertTestRepository{
+		rules: []entity.AlertRule{
+			{ID: 1, Name: "节点静默", Enabled: true, Metric: entity.AlertMetricNodeSilent, Operator: ">", Threshold: 120},
+			{ID: 2, Name: "队列丢弃", Enabled: true, Metric: entity.AlertMetricQueueDrop, Operator: ">", Threshold: 0, WindowSeconds: 60, Notifiers: "syslog"},
+			{ID: 3, Name: "只发邮件", Enabled: true, Metric: entity.AlertMetricQueueDrop, Operator: ">", Threshold: 0, Notifiers: "email"},
+		},
+	}
+	var drops uint64
+	now := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	s := newTestAlertService(repository, []notify.Notifier{notifier}, func() uint64 { return drops }, &now)
+
+	s.Observe(entity.SIP{NodeIP: "10.1.1.1"})
+	s.Observe(entity.SIP{NodeIP: "10.1.1.2"})
+	now = now.Add(time.Minute)
+	s.Observe(entity.SIP{NodeIP: "10.1.1.2"})
+	now = now.Add(90 * time.Second)
+	s.Evaluate()
+	msg := waitMessage(t, notifier.messages)
+	if msg.Labels["rule"] != "节点静默" || msg.Labels["scope"] != "node:10.1.1.1" {
+		t.Errorf("只有节点10.1.1.1静默，得到%+v", msg)
+	}
+
+	// 节点重新发来消息
+	s.Observe(entity.SIP{NodeIP: "10.1.1.1"})
+	drops = 3
+	s.Evaluate()
+	// 规则3只选择了邮件渠道
+	got := drainMessages(t, notifier.messages)
+	want := map[string]string{"节点静默/node:10.1.1.1": notify.StateResolved, "队列丢弃/global": notify.StateFiring}
+	if !maps.Equal(got, want) {
+		t.Errorf("通知错误：%v，期望%v", got, want)
+	}
+	if len(s.Active()) != 2 {
+		t.Errorf("两条队列丢弃规则都应触发，得到%+v", s.Active())
+	}
+
+	// 队列丢弃窗口60秒过后恢复，同时节点10.1.1.2静默超过阈值
+	now = now.Add(2 * time.Minute)
+	s.Evaluate()
+	got = drainMessages(t, notifier.messages)
+	want = map[string]string{"队列丢弃/global": notify.StateResolved, "节点静默/node:10.1.1.2": notify.StateFiring}
+	if !maps.Equal(got, want) {
+		t.Errorf("通知错误：%v，期望%v", got, want)
+	}
+}
+
+func TestAlertService_MOSSilenced(t *testing.T) {
+	notifier := &chanNotifier{name: "webhook", messages: make(chan notify.Message, 10)}
+	now := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	silenceUntil := now.Add(30 * time.Minute)
+	repository := &alertTestRepository{
+		rules: []entity.AlertRule{{
+			ID: 1, Name: "MOS过低", Enabled: true, Metric: entity.AlertMetricMOS, Operator: "<", Threshold: 3.5,
+			SilenceUntil: &silenceUntil,
+		}},
+	}
+	s := newTestAlertService(repository, []notify.Notifier{notifier}, nil, &now)
+
+	s.OnRTCPReport(alertCall(1, true, 0), &entity.RtcpReport{AlegMos: 4.2, BlegMos: 2.8})
+	s.OnRTCPReport(alertCall(1, true, 0), &entity.RtcpReport{AlegMos: 3.6})
+	s.Evaluate()
+
+	// 静默期间只记录历史
+	expectNoMessage(t, notifier.messages)
+	history := repository.lastHistory()
+	if history.State != entity.AlertStateFiring || !history.Silenced || history.Scope != "global" || math.Abs(history.Value-3.2) > 0.001 {
+		t.Errorf("告警历史错误：%+v", history)
+	}
+	if active := s.Active(); len(active) != 1 || !active[0].Silenced {
+		t.Errorf("正在触发的告警应标记为静默：%+v", active)
+	}
+
+	// 删除规则后告警状态清除
+	repository.rules = nil
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Active()) != 0 {
+		t.Errorf("规则删除后不应有告警")
+	}
+}
+
+func TestValidateAlertRule(t *testing.T) {
+	valid := entity.AlertRule{Name: "r", Metric: entity.AlertMetricASR, Operator: "<", Threshold: 30, WindowSeconds: 600, Notifiers: "webhook,email"}
+	if err := ValidateAlertRule(valid); err != nil {
+		t.Errorf("合法的规则返回错误：%v", err)
+	}
+
+	invalid := []func(rule *entity.AlertRule){
+		func(rule *entity.AlertRule) { rule.Name = "" },
+		func(rule *entity.AlertRule) { rule.Metric = "ner" },
+		func(rule *entity.AlertRule) { rule.Operator = "==" },
+		func(rule *entity.AlertRule) { rule.Hysteresis = -1 },
+		func(rule *entity.AlertRule) { rule.WindowSeconds = 7200 },
+		func(rule *entity.AlertRule) { rule.GatewayID, rule.NodeIP = 1, "10.0.0.1" },
+		func(rule *entity.AlertRule) { rule.Metric, rule.GatewayID = entity.AlertMetricQueueDrop, 1 },
+		func(rule *entity.AlertRule) { rule.Metric, rule.GatewayID = entity.AlertMetricNodeSilent, 1 },
+		func(rule *entity.AlertRule) { rule.Notifiers = "sms" },
+	}
+	for i, modify := range invalid {
+		rule := valid
+		modify(&rule)
+		if err := ValidateAlertRule(rule); err == nil {
+			t.Errorf("第%d条非法规则未返回错误：%+v", i, rule)
+		}
+	}
+}
+
+func TestAlertService_PruneNodes(t *testing.T) {
+	notifier := &chanNotifier{name: "syslog", messages: make(chan notify.Message, 10)}
+	repository := &alertTestRepository{
+		rules: []entity.AlertRule{
+			{ID: 1, Name: "节点静默", Enabled: true, Metric: entity.AlertMetricNodeSilent, Operator: ">", Threshold: 120},
+			{ID: 2, Name: "指定节点静默", Enabled: true, Metric: entity.AlertMetricNodeSilent, NodeIP: "10.1.1.2", Operator: ">", Threshold: 7200},
+		},
+	}
+	now := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	s := newTestAlertService(repository, []notify.Notifier{notifier}, nil, &now)
+
+	s.Observe(entity.SIP{NodeIP: "10.1.1.1"})
+	s.Observe(entity.SIP{NodeIP: "10.1.1.2"})
+	now = now.Add(3 * time.Minute)
+	s.Evaluate()
+	got := drainMessages(t, notifier.messages)
+	want := map[string]string{"节点静默/node:10.1.1.1": notify.StateFiring, "节点静默/node:10.1.1.2": notify.StateFiring}
+	if !maps.Equal(got, want) {
+		t.Errorf("通知错误：%v，期望%v", got, want)
+	}
+
+	// 最长的规则为7200秒，再过一小时后不再跟踪节点10.1.1.1，它的告警随之清除；规则指定的节点10.1.1.2保留
+	now = now.Add(3 * time.Hour)
+	s.Evaluate()
+	got = drainMessages(t, notifier.messages)
+	want = map[string]string{"指定节点静默/node:10.1.1.2": notify.StateFiring}
+	if !maps.Equal(got, want) {
+		t.Errorf("通知错误：%v，期望%v", got, want)
+	}
+	s.mu.Lock()
+	_, pruned := s.nodes["10.1.1.1"]
+	_, pinned := s.nodes["10.1.1.2"]
+	s.mu.Unlock()
+	if pruned || !pinned {
+		t.Errorf("节点列表错误：%v", s.nodes)
+	}
+	for _, alert := range s.Active() {
+		if alert.Scope == "node:10.1.1.1" {
+			t.Errorf("不再跟踪的节点不应有告警：%+v", alert)
+		}
+	}
+}
+
+func TestAlertService_RenotifyAfterSilence(t *testing.T) {
+	notifier := &chanNotifier{name: "webhook", messages: make(chan notify.Message, 10)}
+	now := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	silenceUntil := now.Add(10 * time.Minute)
+	repository := &alertTestRepository{
+		rules: []entity.AlertRule{{
+			ID: 1, Name: "MOS过低", Enabled: true, Metric: entity.AlertMetricMOS, Operator: "<", Threshold: 3.5,
+			WindowSeconds: 3600, SilenceUntil: &silenceUntil,
+		}},
+	}
+	s := newTestAlertService(repository, []notify.Notifier{notifier}, nil, &now)
+
+	s.OnRTCPReport(alertCall(1, true, 0), &entity.RtcpReport{AlegMos: 2.8})
+	s.Evaluate()
+	expectNoMessage(t, notifier.messages)
+
+	// 静默结束后仍在触发，补发触发通知，不再记录历史
+	now = silenceUntil.Add(time.Second)
+	s.Evaluate()
+	msg := waitMessage(t, notifier.messages)
+	if msg.State != notify.StateFiring || msg.Labels["scope"] != "global" {
+		t.Errorf("应补发触发通知，得到%+v", msg)
+	}
+	if len(repository.histories) != 1 {
+		t.Errorf("补发通知不应记录历史：%+v", repository.histories)
+	}
+	s.Evaluate()
+	expectNoMessage(t, notifier.messages)
+
+	// 补发后恢复正常发送恢复通知
+	for i := 0; i < 10; i++ {
+		s.OnRTCPReport(alertCall(1, true, 0), &entity.RtcpReport{AlegMos: 4.4})
+	}
+	s.Evaluate()
+	if msg := waitMessage(t, notifier.messages); msg.State != notify.StateResolved {
+		t.Errorf("应发送恢复通知，得到%+v", msg)
+	}
+}
+
+func TestAlertService_ResolvedWhileSilenced(t *testing.T) {
+	notifier := &chanNotifier{name: "webhook", messages: make(chan notify.Message, 10)}
+	now := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	silenceUntil := now.Add(10 * time.Minute)
+	repository := &alertTestRepository{
+		rules: []entity.AlertRule{{
+			ID: 1, Name: "MOS过低", Enabled: true, Metric: entity.AlertMetricMOS, Operator: "<", Threshold: 3.5,
+			WindowSeconds: 3600, SilenceUntil: &silenceUntil,
+		}},
+	}
+	s := newTestAlertService(repository, []notify.Notifier{notifier}, nil, &now)
+
+	s.OnRTCPReport(alertCall(1, true, 0), &entity.RtcpReport{AlegMos: 2.8})
+	s.Evaluate()
+
+	// 静默结束的同一次评估中恢复，没有发过触发通知，也不发送恢复通知
+	for i := 0; i < 10; i++ {
+		s.OnRTCPReport(alertCall(1, true, 0), &entity.RtcpReport{AlegMos: 4.4})
+	}
+	now = silenceUntil.Add(time.Second)
+	s.Evaluate()
+	expectNoMessage(t, notifier.messages)
+	if history := repository.lastHistory(); history.State != entity.AlertStateResolved || !history.Silenced {
+		t.Errorf("告警历史错误：%+v", history)
+	}
+}
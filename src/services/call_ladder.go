@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+	"sip-monitor/src/pkg/ladder"
+	"sip-monitor/src/pkg/siprocket"
+)
+
+// 时序图中SDP摘要最多显示的编码数
+const ladderMaxCodecs = 3
+
+// NewCallLadder 用呼叫腿的SIP消息生成时序图。列为主机IP，属于网关的地址显示网关名称；
+// 从原始报文中解析SDP，携带SDP的消息在箭头下显示媒体地址和编码
+func NewCallLadder(ctx context.Context, repository model.Repository, call *entity.Call, legIDs []string) (*ladder.Diagram, error) {
+	records, err := repository.GetRecordsBySIPCallIDs(ctx, legIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ladder.ErrNoMessages
+	}
+
+	ids := make([]int64, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	raws, err := repository.GetRecordRawsByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	sdps := make(map[int64]string, len(raws))
+	for _, raw := range raws {
+		if sip := siprocket.ParseSIP([]byte(raw.Raw)); sip != nil && sip.SDP != nil {
+			sdps[raw.ID] = sdpSummary(sip.SDP)
+		}
+	}
+
+	gateways, err := repository.GatewayList()
+	if err != nil {
+		return nil, err
+	}
+	resolver := NewGatewayResolver(gateways)
+
+	title := fmt.Sprintf("%s  %s -> %s", call.SIPCallID, call.FromUser, call.ToUser)
+	if call.CreateTime != nil {
+		title += "  " + call.CreateTime.Format(time.DateTime)
+	}
+	diagram := ladder.New(title)
+	named := make(map[string]bool)
+	column := func(addr string) string {
+		host := ladderHost(addr)
+		if !named[host] {
+			if gateway := resolver.Match(addr); gateway != nil {
+				diagram.SetHostName(host, gateway.Name)
+				named[host] = true
+			}
+		}
+		return host
+	}
+
+	for _, record := range records {
+		message := ladder.Message{
+			Time:     record.CreateTime,
+			From:     column(record.SrcAddr),
+			To:       column(record.DstAddr),
+			Label:    record.Method,
+			Response: record.ResponseCode > 0,
+			SDP:      sdps[record.ID],
+			Leg:      record.SIPCallID,
+		}
+		if record.TimestampMicro > 0 {
+			message.Time = time.UnixMicro(record.TimestampMicro)
+		}
+		if message.Response {
+			message.Label = strings.TrimSpace(fmt.Sprintf("%d %s", record.ResponseCode, record.ResponseDesc))
+		}
+		diagram.Add(message)
+	}
+	return diagram, nil
+}
+
+// ladderHost 时序图按IP分列，同一主机不同端口的消息画在同一列
+func ladderHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// sdpSummary 每个媒体流的类型、地址、编码和方向，如 audio 10.0.0.1:4000 PCMA,PCMU sendonly
+func sdpSummary(sdp *entity.SDP) string {
+	medias := make([]string, 0, len(sdp.Media))
+	for i := range sdp.Media {
+		media := &sdp.Media[i]
+		if media.Port == 0 {
+			medias = append(medias, media.MediaType+" rejected")
+			continue
+		}
+		parts := []string{media.MediaType, media.Endpoint()}
+		codecs := media.Codecs
+		if len(codecs) > ladderMaxCodecs {
+			codecs = codecs[:ladderMaxCodecs]
+		}
+		if len(codecs) > 0 {
+			parts = append(parts, strings.Join(codecs, ","))
+		}
+		if media.Direction != "" && media.Direction != "sendrecv" {
+			parts = append(parts, media.Direction)
+		}
+		medias = append(medias, strings.Join(parts, " "))
+	}
+	if len(medias) == 0 {
+		return "no media"
+	}
+	return strings.Join(medias, " | ")
+}
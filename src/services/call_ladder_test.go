@@ -0,0 +1,93 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+	"sip-monitor/src/pkg/ladder"
+)
+
+// 只实现时序图用到的方法
+type ladderTestRepository struct {
+	model.Repository
+	records  []entity.Record
+	raws     []entity.RecordRaw
+	gateways []entity.Gateway
+}
+
+func (r *ladderTestRepository) GetRecordsBySIPCallIDs(ctx context.Context, sipCallIDs []string) ([]entity.Record, error) {
+	var records []entity.Record
+	for _, record := range r.records {
+		for _, id := range sipCallIDs {
+			if record.SIPCallID == id {
+				records = append(records, record)
+			}
+		}
+	}
+	return records, nil
+}
+
+func (r *ladderTestRepository) GetRecordRawsByIDs(ctx context.Context, ids []int64) ([]entity.RecordRaw, error) {
+	return r.raws, nil
+}
+
+func (r *ladderTestRepository) GatewayList() ([]entity.Gateway, error) {
+	return r.gateways, nil
+}
+
+func TestNewCallLadder(t *testing.T) {
+	base := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	invite := "INVITE sip:13800138000@10.0.0.3 SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.2:5060;branch=z9hG4bK776asdhds\r\n" +
+		"From: <sip:1001@10.0.0.2>;tag=1928301774\r\n" +
+		"To: <sip:13800138000@10.0.0.3>\r\n" +
+		"Call-ID: b-leg\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"Content-Type: application/sdp\r\n\r\n" +
+		"v=0\r\no=- 1 1 IN IP4 10.0.0.2\r\ns=-\r\nc=IN IP4 10.0.0.2\r\nt=0 0\r\n" +
+		"m=audio 4000 RTP/AVP 8 0 18 101\r\na=sendonly\r\n"
+
+	repository := &ladderTestRepository{
+		records: []entity.Record{
+			{ID: 1, SIPCallID: "a-leg", Method: "INVITE", SrcAddr: "10.0.0.1:5060", DstAddr: "10.0.0.2:5060", TimestampMicro: base.UnixMicro()},
+			{ID: 2, SIPCallID: "b-leg", Method: "INVITE", SrcAddr: "10.0.0.2:5080", DstAddr: "10.0.0.3:5060", TimestampMicro: base.Add(3 * time.Millisecond).UnixMicro()},
+			{ID: 3, SIPCallID: "b-leg", Method: "486", ResponseCode: 486, ResponseDesc: "Busy Here", SrcAddr: "10.0.0.3:5060", DstAddr: "10.0.0.2:5080", CreateTime: base.Add(time.Second)},
+		},
+		raws:     []entity.RecordRaw{{ID: 2, Raw: invite}},
+		gateways: []entity.Gateway{{Name: "carrier-a", Addrs: []string{"10.0.0.3:5060"}}},
+	}
+	call := &entity.Call{SIPCallID: "a-leg", FromUser: "1001", ToUser: "13800138000"}
+
+	diagram, err := NewCallLadder(context.Background(), repository, call, []string{"a-leg", "b-leg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := diagram.Render(&buf, ladder.FormatMermaid); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"sequenceDiagram",
+		"    title a-leg  1001 -> 13800138000",
+		"    participant H0 as 10.0.0.1",
+		"    participant H1 as 10.0.0.2",
+		"    participant H2 as carrier-a<br/>10.0.0.3",
+		"    Note over H0,H2: [1] a-leg",
+		"    Note over H0,H2: [2] b-leg",
+		"    H0->>H1: [1] INVITE",
+		"    H1->>H2: [2] INVITE (SDP) +3ms<br/>audio 10.0.0.2:4000 PCMA,PCMU,G729 sendonly",
+		"    H2-->>H1: [2] 486 Busy Here +997ms",
+	}
+	if got := strings.TrimSpace(buf.String()); got != strings.Join(want, "\n") {
+		t.Errorf("时序图 =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+
+	if _, err := NewCallLadder(context.Background(), repository, call, []string{"none"}); err != ladder.ErrNoMessages {
+		t.Errorf("没有消息时 err = %v", err)
+	}
+}
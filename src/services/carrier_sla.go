@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"sip-monitor/src/entity"
+)
+
+// CarrierSLA 按天或按月统计运营商的SLA达标情况，列出未达标的指标。
+// MOS需要关联RTCP报告，总是查询呼叫明细
+func (s *StatService) CarrierSLA(ctx context.Context, params entity.CarrierSLADTO) ([]*entity.CarrierSLAVO, error) {
+	interval := entity.StatInterval1d
+	switch params.Period {
+	case "", entity.SLAPeriodDay:
+	case entity.SLAPeriodMonth:
+		interval = entity.StatInterval1mo
+	default:
+		return nil, fmt.Errorf("不支持的考核周期: %s", params.Period)
+	}
+
+	carriers, err := s.repository.CarrierList()
+	if err != nil {
+		return nil, err
+	}
+	carrierByID := make(map[string]*entity.Carrier, len(carriers))
+	for i := range carriers {
+		carrierByID[strconv.FormatInt(carriers[i].ID, 10)] = &carriers[i]
+	}
+
+	// 默认统计最近30天，按考核周期对齐
+	endTime := time.Now()
+	if params.EndTime != nil {
+		endTime = *params.EndTime
+	}
+	beginTime := endTime.AddDate(0, 0, -30)
+	if params.BeginTime != nil {
+		beginTime = *params.BeginTime
+	}
+	beginTime = time.Unix(s.bucketStart(beginTime, interval), 0)
+
+	kpi, err := s.CallKPI(ctx, entity.CallStatDTO{
+		BeginTime: &beginTime,
+		EndTime:   &endTime,
+		GroupBy:   entity.StatGroupCarrier,
+		Interval:  interval,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*entity.CarrierSLAVO, 0, len(kpi))
+	for _, vo := range kpi {
+		carrier, ok := carrierByID[vo.Group]
+		if !ok || (params.CarrierID > 0 && carrier.ID != params.CarrierID) {
+			continue
+		}
+		breaches := checkSLA(carrier, vo)
+		out = append(out, &entity.CarrierSLAVO{
+			CarrierID:   carrier.ID,
+			CarrierName: carrier.Name,
+			Period:      vo.BucketTime,
+			Total:       vo.Total,
+			Answered:    vo.Answered,
+			ASR:         vo.ASR,
+			AvgPDDMs:    vo.AvgPDDMs,
+			AvgMOS:      vo.AvgMOS,
+			MinASR:      carrier.MinASR,
+			MaxPDDMs:    carrier.MaxPDDMs,
+			MinMOS:      carrier.MinMOS,
+			Compliant:   len(breaches) == 0,
+			Breaches:    breaches,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CarrierID != out[j].CarrierID {
+			return out[i].CarrierID < out[j].CarrierID
+		}
+		return out[i].Period.Before(*out[j].Period)
+	})
+	return out, nil
+}
+
+// checkSLA 比较指标和SLA目标，没有数据的指标不考核
+func checkSLA(carrier *entity.Carrier, vo *entity.CallKPIVO) []entity.SLABreach {
+	breaches := make([]entity.SLABreach, 0)
+	if carrier.MinASR > 0 && vo.Total > 0 && vo.ASR < carrier.MinASR {
+		breaches = append(breaches, entity.SLABreach{Metric: entity.SLAMetricASR, Target: carrier.MinASR, Actual: vo.ASR})
+	}
+	if carrier.MaxPDDMs > 0 && vo.AvgPDDMs > carrier.MaxPDDMs {
+		breaches = append(breaches, entity.SLABreach{Metric: entity.SLAMetricPDD, Target: carrier.MaxPDDMs, Actual: vo.AvgPDDMs})
+	}
+	if carrier.MinMOS > 0 && vo.AvgMOS > 0 && vo.AvgMOS < carrier.MinMOS {
+		breaches = append(breaches, entity.SLABreach{Metric: entity.SLAMetricMOS, Target: carrier.MinMOS, Actual: vo.AvgMOS})
+	}
+	return breaches
+}
+
+// CarrierStats 运营商看板，汇总该运营商所有网关的话务，时间粒度默认按小时
+func (s *StatService) CarrierStats(ctx context.Context, carrierID int64, params entity.CallStatDTO) (*entity.CarrierStatsVO, error) {
+	carrier, err := s.repository.CarrierGetByID(carrierID)
+	if err != nil {
+		return nil, err
+	}
+	gateways, err := s.repository.GatewayList()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &entity.CarrierStatsVO{Carrier: carrier, Gateways: make([]entity.Gateway, 0), Series: make([]*entity.CallKPIVO, 0)}
+	for _, gateway := range gateways {
+		if gateway.CarrierID == carrierID {
+			out.Gateways = append(out.Gateways, gateway)
+		}
+	}
+
+	group := strconv.FormatInt(carrierID, 10)
+	params.GroupBy = entity.StatGroupCarrier
+	if params.Interval == "" {
+		params.Interval = entity.StatInterval1h
+	}
+	series, err := s.CallKPI(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, vo := range series {
+		if vo.Group == group {
+			out.Series = append(out.Series, vo)
+		}
+	}
+
+	// 整个时间范围的汇总，用于SLA考核
+	params.Interval = ""
+	summary, err := s.CallKPI(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, vo := range summary {
+		if vo.Group == group {
+			out.Summary = vo
+		}
+	}
+	if out.Summary == nil {
+		out.Summary = &entity.CallKPIVO{Group: group, GroupName: carrier.Name, Source: "calls"}
+	}
+	out.Breaches = checkSLA(carrier, out.Summary)
+	return out, nil
+}
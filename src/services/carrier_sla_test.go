@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sip-monitor/src/entity"
+)
+
+func carrierTestRepository(day time.Time) *statTestRepository {
+	withMos := func(row entity.CallStatRow, aleg, bleg float64) entity.CallStatRow {
+		row.AlegMos, row.BlegMos = aleg, bleg
+		return row
+	}
+	next := day.AddDate(0, 0, 1)
+	return &statTestRepository{
+		carriers: []entity.Carrier{
+			{ID: 1, Name: "carrier-x", MinASR: 60, MaxPDDMs: 3000, MinMOS: 3.5},
+			{ID: 2, Name: "carrier-y", MinASR: 10},
+		},
+		gateways: []entity.Gateway{
+			{ID: 1, Name: "x-1", Addrs: []string{"10.0.0.1"}, CarrierID: 1},
+			{ID: 2, Name: "x-2", Addrs: []string{"10.0.0.2"}, CarrierID: 1},
+			{ID: 3, Name: "y-1", Addrs: []string{"10.0.0.3"}, CarrierID: 2},
+		},
+		rows: []entity.CallStatRow{
+			// 第一天：运营商x达标
+			withMos(statRow(day, 10*time.Hour, 2*time.Second, time.Second, 60*time.Second, 200, "10.0.0.1:5060"), 4.2, 4.0),
+			withMos(statRow(day, 11*time.Hour, 4*time.Second, time.Second, 60*time.Second, 200, "10.0.0.2:5060"), 3.2, 3.0),
+			statRow(day, 12*time.Hour, 3*time.Second, time.Second, 0, 486, "10.0.0.1:5060"),
+			// 第二天：运营商x三项都不达标
+			statRow(next, 10*time.Hour, 5*time.Second, 0, 0, 503, "10.0.0.1:5060"),
+			withMos(statRow(next, 11*time.Hour, 5*time.Second, time.Second, 60*time.Second, 200, "10.0.0.2:5060"), 3.0, 0),
+			statRow(next, 12*time.Hour, time.Second, time.Second, 60*time.Second, 200, "10.0.0.3:5060"),
+			// 不属于任何运营商
+			statRow(next, 13*time.Hour, time.Second, time.Second, 60*time.Second, 200, "10.0.0.9:5060"),
+		},
+	}
+}
+
+func TestStatService_CarrierSLA(t *testing.T) {
+	day := time.Date(2025, 4, 10, 0, 0, 0, 0, time.UTC)
+	s := NewStatService(carrierTestRepository(day))
+	s.location = time.UTC
+
+	end := day.AddDate(0, 0, 2)
+	report, err := s.CarrierSLA(context.Background(), entity.CarrierSLADTO{BeginTime: &day, EndTime: &end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 3 {
+		t.Fatalf("应有3行，得到%d行", len(report))
+	}
+	first, second, other := report[0], report[1], report[2]
+	if first.CarrierID != 1 || !first.Period.Equal(day) || first.Total != 3 || !first.Compliant {
+		t.Errorf("第一天应达标，得到%+v", first)
+	}
+	if first.AvgMOS != 3.5 || first.AvgPDDMs != 3000 {
+		t.Errorf("MOS取较差方向，得到%+v", first)
+	}
+	if second.Compliant || len(second.Breaches) != 3 {
+		t.Fatalf("第二天应有3项不达标，得到%+v", second)
+	}
+	if second.Breaches[0].Metric != entity.SLAMetricASR || second.Breaches[0].Actual != 50 ||
+		second.Breaches[1].Metric != entity.SLAMetricPDD || second.Breaches[2].Metric != entity.SLAMetricMOS {
+		t.Errorf("不达标指标错误，得到%+v", second.Breaches)
+	}
+	if other.CarrierID != 2 || !other.Compliant {
+		t.Errorf("运营商y应达标，得到%+v", other)
+	}
+
+	// 按月考核
+	report, err = s.CarrierSLA(context.Background(), entity.CarrierSLADTO{BeginTime: &day, EndTime: &end, Period: entity.SLAPeriodMonth, CarrierID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].Total != 5 || report[0].ASR != 60 {
+		t.Fatalf("月报错误，得到%+v", report)
+	}
+	if !report[0].Period.Equal(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)) || len(report[0].Breaches) != 2 {
+		t.Errorf("月报应从月初开始并有PDD和MOS不达标，得到%+v", report[0])
+	}
+
+	if _, err = s.CarrierSLA(context.Background(), entity.CarrierSLADTO{Period: "week"}); err == nil {
+		t.Errorf("不支持的考核周期应返回错误")
+	}
+}
+
+func TestStatService_CarrierStats(t *testing.T) {
+	day := time.Date(2025, 4, 10, 0, 0, 0, 0, time.UTC)
+	s := NewStatService(carrierTestRepository(day))
+	s.location = time.UTC
+
+	end := day.AddDate(0, 0, 2)
+	stats, err := s.CarrierStats(context.Background(), 1, entity.CallStatDTO{BeginTime: &day, EndTime: &end, Interval: entity.StatInterval1d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Gateways) != 2 || stats.Summary.Total != 5 || stats.Summary.GroupName != "carrier-x" {
+		t.Errorf("运营商汇总错误，得到%+v", stats.Summary)
+	}
+	if len(stats.Series) != 2 || stats.Series[1].Total != 2 {
+		t.Errorf("按天的序列错误，得到%+v", stats.Series)
+	}
+	if len(stats.Breaches) != 2 {
+		t.Errorf("汇总应有PDD和MOS不达标，得到%+v", stats.Breaches)
+	}
+
+	if _, err = s.CarrierStats(context.Background(), 9, entity.CallStatDTO{}); err == nil {
+		t.Errorf("不存在的运营商应返回错误")
+	}
+}
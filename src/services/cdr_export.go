@@ -0,0 +1,368 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+	"sip-monitor/src/pkg/xlsx"
+)
+
+// 导出时每批读取的呼叫数
+const cdrExportBatchSize = 1000
+
+// 自定义属性列的前缀，如 attr.X-Tenant
+const cdrAttributePrefix = "attr."
+
+// 话单的一列，时间列返回time.Time，由各格式按时区输出
+type cdrColumn struct {
+	Name  string
+	value func(call *entity.Call) any
+}
+
+var cdrColumns = []cdrColumn{
+	{"id", func(call *entity.Call) any { return call.ID }},
+	{"sip_call_id", func(call *entity.Call) any { return call.SIPCallID }},
+	{"session_id", func(call *entity.Call) any { return call.SessionID }},
+	{"node_ip", func(call *entity.Call) any { return call.NodeIP }},
+	{"from_user", func(call *entity.Call) any { return call.FromUser }},
+	{"to_user", func(call *entity.Call) any { return call.ToUser }},
+	{"user_agent", func(call *entity.Call) any { return call.UserAgent }},
+	{"asserted_user", func(call *entity.Call) any { return call.AssertedUser }},
+	{"asserted_name", func(call *entity.Call) any { return call.AssertedName }},
+	{"privacy", func(call *entity.Call) any { return call.Privacy }},
+	{"original_called_user", func(call *entity.Call) any { return call.OriginalCalledUser }},
+	{"diversion_reason", func(call *entity.Call) any { return call.DiversionReason }},
+	{"redirect_count", func(call *entity.Call) any { return call.RedirectCount }},
+	{"media_types", func(call *entity.Call) any { return call.MediaTypes }},
+	{"offer_codecs", func(call *entity.Call) any { return call.OfferCodecs }},
+	{"negotiated_codec", func(call *entity.Call) any { return call.NegotiatedCodec }},
+	{"offer_media_addr", func(call *entity.Call) any { return call.OfferMediaAddr }},
+	{"answer_media_addr", func(call *entity.Call) any { return call.AnswerMediaAddr }},
+	{"srtp", func(call *entity.Call) any { return call.SRTP }},
+	{"media_direction", func(call *entity.Call) any { return call.MediaDirection }},
+	{"isup_called_number", func(call *entity.Call) any { return call.IsupCalledNumber }},
+	{"isup_calling_number", func(call *entity.Call) any { return call.IsupCallingNumber }},
+	{"isup_original_called_number", func(call *entity.Call) any { return call.IsupOriginalCalledNumber }},
+	{"isup_cause", func(call *entity.Call) any { return call.IsupCause }},
+	{"isup_cause_text", func(call *entity.Call) any { return call.IsupCauseText }},
+	{"src_addr", func(call *entity.Call) any { return call.SrcAddr }},
+	{"dst_addr", func(call *entity.Call) any { return call.DstAddr }},
+	{"ingress_gateway_id", func(call *entity.Call) any { return call.IngressGatewayID }},
+	{"egress_gateway_id", func(call *entity.Call) any { return call.EgressGatewayID }},
+	{"direction", func(call *entity.Call) any { return call.Direction }},
+	{"transport", func(call *entity.Call) any { return call.Transport }},
+	{"caller_contact", func(call *entity.Call) any { return call.CallerContact }},
+	{"webrtc", func(call *entity.Call) any { return call.WebRTC }},
+	{"create_time", func(call *entity.Call) any { return call.CreateTime }},
+	{"ringing_time", func(call *entity.Call) any { return call.RingingTime }},
+	{"answer_time", func(call *entity.Call) any { return call.AnswerTime }},
+	{"end_time", func(call *entity.Call) any { return call.EndTime }},
+	{"call_duration", func(call *entity.Call) any { return call.CallDuration }},
+	{"ringing_duration", func(call *entity.Call) any { return call.RingingDuration }},
+	{"talk_duration", func(call *entity.Call) any { return call.TalkDuration }},
+	{"call_status", func(call *entity.Call) any { return call.CallStatus }},
+	{"hangup_code", func(call *entity.Call) any { return call.HangupCode }},
+	{"hangup_cause", func(call *entity.Call) any { return call.HangupCause }},
+	{"hangup_side", func(call *entity.Call) any { return call.HangupSide }},
+}
+
+var cdrDefaultColumns = []string{
+	"id", "sip_call_id", "from_user", "to_user", "asserted_user", "src_addr", "dst_addr",
+	"ingress_gateway_id", "egress_gateway_id", "direction",
+	"create_time", "ringing_time", "answer_time", "end_time", "call_duration", "talk_duration",
+	"hangup_code", "hangup_cause", "hangup_side", "negotiated_codec",
+}
+
+// CDRExporter 按查询条件分批读取呼叫，流式写出CSV、JSON Lines或xlsx格式的话单
+type CDRExporter struct {
+	repository model.Repository
+	format     string
+	columns    []cdrColumn
+	location   *time.Location
+}
+
+// NewCDRExporter columns为逗号分隔的列名，为空时导出默认列；timeZone为空时使用服务器时区
+func NewCDRExporter(repository model.Repository, format, columns, timeZone string) (*CDRExporter, error) {
+	if format == "" {
+		format = entity.ExportFormatCSV
+	}
+	format = strings.ToLower(format)
+	switch format {
+	case entity.ExportFormatCSV, entity.ExportFormatJSONL, entity.ExportFormatXLSX:
+	default:
+		return nil, fmt.Errorf("不支持的导出格式：%s", format)
+	}
+
+	location := time.Local
+	if timeZone != "" {
+		var err error
+		location, err = time.LoadLocation(timeZone)
+		if err != nil {
+			return nil, fmt.Errorf("不支持的时区：%s", timeZone)
+		}
+	}
+
+	names := splitList(columns)
+	if len(names) == 0 {
+		names = cdrDefaultColumns
+	}
+	selected := make([]cdrColumn, 0, len(names))
+	for _, name := range names {
+		column, err := findCDRColumn(name)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, column)
+	}
+
+	return &CDRExporter{
+		repository: repository,
+		format:     format,
+		columns:    selected,
+		location:   location,
+	}, nil
+}
+
+func findCDRColumn(name string) (cdrColumn, error) {
+	if attribute, ok := strings.CutPrefix(name, cdrAttributePrefix); ok && attribute != "" {
+		return cdrColumn{Name: name, value: func(call *entity.Call) any { return call.Attributes[attribute] }}, nil
+	}
+	for _, column := range cdrColumns {
+		if column.Name == name {
+			return column, nil
+		}
+	}
+	return cdrColumn{}, fmt.Errorf("不支持的导出列：%s", name)
+}
+
+// ContentType 导出文件的MIME类型
+func (e *CDRExporter) ContentType() string {
+	switch e.format {
+	case entity.ExportFormatJSONL:
+		return "application/x-ndjson"
+	case entity.ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Extension 导出文件的扩展名
+func (e *CDRExporter) Extension() string {
+	return e.format
+}
+
+// Export 导出符合条件的全部呼叫，忽略分页参数，返回导出的呼叫数。
+// 每批写完后刷新输出，w实现了http.Flusher时同时刷新到客户端
+func (e *CDRExporter) Export(ctx context.Context, params entity.SearchParams, w io.Writer) (int64, error) {
+	writer, err := e.newWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	names := make([]string, 0, len(e.columns))
+	for _, column := range e.columns {
+		names = append(names, column.Name)
+	}
+	if err := writer.WriteHeader(names); err != nil {
+		return 0, err
+	}
+
+	flusher, _ := w.(http.Flusher)
+	var count int64
+	values := make([]any, len(e.columns))
+	err = e.repository.IterateCalls(ctx, params, cdrExportBatchSize, func(calls []entity.Call) error {
+		for i := range calls {
+			for j, column := range e.columns {
+				values[j] = e.normalize(column.value(&calls[i]))
+			}
+			if err := writer.WriteRow(values); err != nil {
+				return err
+			}
+			count++
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, writer.Close()
+}
+
+// normalize 时间转换到导出时区，空时间为nil
+func (e *CDRExporter) normalize(value any) any {
+	if t, ok := value.(*time.Time); ok {
+		if t == nil {
+			return nil
+		}
+		return t.In(e.location)
+	}
+	return value
+}
+
+func (e *CDRExporter) newWriter(w io.Writer) (cdrWriter, error) {
+	switch e.format {
+	case entity.ExportFormatJSONL:
+		return &cdrJSONLWriter{w: bufio.NewWriter(w)}, nil
+	case entity.ExportFormatXLSX:
+		sheet, err := xlsx.NewStreamWriter(w, "CDR")
+		if err != nil {
+			return nil, err
+		}
+		return &cdrXLSXWriter{sheet: sheet}, nil
+	}
+	return &cdrCSVWriter{w: w, csv: csv.NewWriter(w)}, nil
+}
+
+// 各导出格式的写入器
+type cdrWriter interface {
+	WriteHeader(names []string) error
+	WriteRow(values []any) error
+	Flush() error
+	Close() error
+}
+
+type cdrCSVWriter struct {
+	w      io.Writer
+	csv    *csv.Writer
+	record []string
+}
+
+func (c *cdrCSVWriter) WriteHeader(names []string) error {
+	// UTF-8 BOM，Excel直接打开时才能正确识别中文
+	if _, err := io.WriteString(c.w, "\xEF\xBB\xBF"); err != nil {
+		return err
+	}
+	c.record = make([]string, len(names))
+	return c.csv.Write(names)
+}
+
+func (c *cdrCSVWriter) WriteRow(values []any) error {
+	for i, value := range values {
+		c.record[i] = formatCDRValue(value)
+		if _, ok := value.(string); ok {
+			c.record[i] = escapeCSVFormula(c.record[i])
+		}
+	}
+	return c.csv.Write(c.record)
+}
+
+func (c *cdrCSVWriter) Flush() error {
+	c.csv.Flush()
+	return c.csv.Error()
+}
+
+func (c *cdrCSVWriter) Close() error {
+	return c.Flush()
+}
+
+// 每行一个JSON对象，键的顺序与导出列一致，时间为带时区偏移的RFC 3339格式
+type cdrJSONLWriter struct {
+	w     *bufio.Writer
+	names [][]byte
+}
+
+func (j *cdrJSONLWriter) WriteHeader(names []string) error {
+	j.names = make([][]byte, len(names))
+	for i, name := range names {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		j.names[i] = key
+	}
+	return nil
+}
+
+func (j *cdrJSONLWriter) WriteRow(values []any) error {
+	j.w.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		j.w.Write(j.names[i])
+		j.w.WriteByte(':')
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		j.w.Write(data)
+	}
+	j.w.WriteByte('}')
+	return j.w.WriteByte('\n')
+}
+
+func (j *cdrJSONLWriter) Flush() error {
+	return j.w.Flush()
+}
+
+func (j *cdrJSONLWriter) Close() error {
+	return j.w.Flush()
+}
+
+type cdrXLSXWriter struct {
+	sheet *xlsx.StreamWriter
+	row   []any
+}
+
+func (x *cdrXLSXWriter) WriteHeader(names []string) error {
+	row := make([]any, len(names))
+	for i, name := range names {
+		row[i] = name
+	}
+	return x.sheet.WriteRow(row)
+}
+
+func (x *cdrXLSXWriter) WriteRow(values []any) error {
+	return x.sheet.WriteRow(values)
+}
+
+func (x *cdrXLSXWriter) Flush() error {
+	return x.sheet.Flush()
+}
+
+func (x *cdrXLSXWriter) Close() error {
+	return x.sheet.Close()
+}
+
+// escapeCSVFormula 以 = + - @ 开头的文本在Excel中会被当作公式执行，
+// 前面加单引号按文本显示，防止主叫号码、自定义头等外部输入注入公式
+func escapeCSVFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// formatCDRValue 文本格式的单元格，时间为 2006-01-02 15:04:05
+func formatCDRValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.DateTime)
+	}
+	return fmt.Sprint(value)
+}
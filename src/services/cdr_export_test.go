@@ -0,0 +1,197 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+)
+
+type exportTestRepository struct {
+	model.Repository
+	calls   []entity.Call
+	batches int
+}
+
+func (r *exportTestRepository) IterateCalls(ctx context.Context, params entity.SearchParams, batchSize int, fn func(calls []entity.Call) error) error {
+	// 每批两条，检查分批写出
+	for start := 0; start < len(r.calls); start += 2 {
+		end := min(start+2, len(r.calls))
+		r.batches++
+		if err := fn(r.calls[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportTestCalls() []entity.Call {
+	begin := time.Date(2025, 4, 11, 2, 0, 0, 0, time.UTC)
+	answer := begin.Add(5 * time.Second)
+	return []entity.Call{
+		{ID: 1, SIPCallID: "a", FromUser: "1001", ToUser: "1002", CreateTime: &begin, AnswerTime: &answer, TalkDuration: 60,
+			HangupCode: 200, Attributes: map[string]string{"X-Tenant": "租户A"}},
+		{ID: 2, SIPCallID: "b", FromUser: "1003", ToUser: "10,04", CreateTime: &begin, HangupCode: 486, HangupCause: "Busy Here"},
+		{ID: 3, SIPCallID: "c", FromUser: "1005", CreateTime: &begin, SRTP: true},
+	}
+}
+
+func TestCDRExporter_CSV(t *testing.T) {
+	repository := &exportTestRepository{calls: exportTestCalls()}
+	exporter, err := NewCDRExporter(repository, "", "id,from_user,to_user,create_time,answer_time,hangup_code,attr.X-Tenant", "Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	count, err := exporter.Export(context.Background(), entity.SearchParams{}, &buf)
+	if err != nil || count != 3 {
+		t.Fatalf("导出错误：count=%d err=%v", count, err)
+	}
+	if repository.batches != 2 {
+		t.Errorf("应分2批读取，得到%d", repository.batches)
+	}
+
+	data, ok := strings.CutPrefix(buf.String(), "\xEF\xBB\xBF")
+	if !ok {
+		t.Errorf("CSV应以UTF-8 BOM开头")
+	}
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "from_user", "to_user", "create_time", "answer_time", "hangup_code", "attr.X-Tenant"},
+		{"1", "1001", "1002", "2025-04-11 10:00:00", "2025-04-11 10:00:05", "200", "租户A"},
+		{"2", "1003", "10,04", "2025-04-11 10:00:00", "", "486", ""},
+		{"3", "1005", "", "2025-04-11 10:00:00", "", "0", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("应有%d行，得到%d行", len(want), len(records))
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("第%d行错误：得到%v，期望%v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestCDRExporter_CSVFormula(t *testing.T) {
+	begin := time.Date(2025, 4, 11, 2, 0, 0, 0, time.UTC)
+	repository := &exportTestRepository{calls: []entity.Call{
+		{ID: 1, FromUser: "+8613800000000", ToUser: "=HYPERLINK(\"http://evil\")", CreateTime: &begin, HangupCode: -1,
+			Attributes: map[string]string{"X-Tenant": "@SUM(A1)"}},
+		{ID: 2, FromUser: "-1001", ToUser: "10=02", CreateTime: &begin},
+	}}
+	exporter, err := NewCDRExporter(repository, "", "id,from_user,to_user,hangup_code,attr.X-Tenant", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := exporter.Export(context.Background(), entity.SearchParams{}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\xEF\xBB\xBF"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只转义文本，数值列保持原样
+	want := [][]string{
+		{"id", "from_user", "to_user", "hangup_code", "attr.X-Tenant"},
+		{"1", "'+8613800000000", "'=HYPERLINK(\"http://evil\")", "-1", "'@SUM(A1)"},
+		{"2", "'-1001", "10=02", "0", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("应有%d行，得到%d行", len(want), len(records))
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("第%d行错误：得到%v，期望%v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestCDRExporter_JSONL(t *testing.T) {
+	repository := &exportTestRepository{calls: exportTestCalls()}
+	exporter, err := NewCDRExporter(repository, "jsonl", "sip_call_id,create_time,answer_time,srtp", "Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := exporter.Export(context.Background(), entity.SearchParams{}, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("应有3行，得到%q", buf.String())
+	}
+	// 键的顺序与导出列一致
+	if lines[0] != `{"sip_call_id":"a","create_time":"2025-04-11T10:00:00+08:00","answer_time":"2025-04-11T10:00:05+08:00","srtp":false}` {
+		t.Errorf("第一行错误：%s", lines[0])
+	}
+	var row map[string]any
+	if err := json.Unmarshal([]byte(lines[2]), &row); err != nil {
+		t.Fatal(err)
+	}
+	if row["answer_time"] != nil || row["srtp"] != true {
+		t.Errorf("第三行错误：%v", row)
+	}
+}
+
+func TestCDRExporter_XLSX(t *testing.T) {
+	repository := &exportTestRepository{calls: exportTestCalls()}
+	exporter, err := NewCDRExporter(repository, "XLSX", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := exporter.Export(context.Background(), entity.SearchParams{}, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("不是有效的xlsx文件：%v", err)
+	}
+	for _, file := range reader.File {
+		if file.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, _ := file.Open()
+		sheet, _ := io.ReadAll(rc)
+		rc.Close()
+		// 表头和3行话单
+		if n := strings.Count(string(sheet), "<row>"); n != 4 {
+			t.Errorf("应有4行，得到%d", n)
+		}
+		if !strings.Contains(string(sheet), `<t xml:space="preserve">Busy Here</t>`) {
+			t.Errorf("缺少挂断原因：%s", sheet)
+		}
+		return
+	}
+	t.Errorf("缺少工作表")
+}
+
+func TestNewCDRExporter_Invalid(t *testing.T) {
+	cases := []struct {
+		format, columns, timeZone string
+	}{
+		{"pdf", "", ""},
+		{"csv", "id,password", ""},
+		{"csv", "attr.", ""},
+		{"csv", "", "Mars/Olympus"},
+	}
+	for _, c := range cases {
+		if _, err := NewCDRExporter(nil, c.format, c.columns, c.timeZone); err == nil {
+			t.Errorf("%+v 应返回错误", c)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 实时CPS的统计窗口
+const cpsWindow = 10 * time.Second
+
+// 告警恢复需要低于告警阈值的百分点，避免在阈值附近反复告警
+const channelWarnHysteresis = 10
+
+// ConcurrencyService 根据缓存中呼叫的应答和结束，实时统计每个网关、节点的并发和CPS，
+// 并根据已入库呼叫的应答、结束时间重建历史并发
+type ConcurrencyService struct {
+	logger      *logrus.Logger
+	repository  model.Repository
+	stat        *StatService
+	warnPercent int
+	now         func() time.Time
+
+	mu       sync.Mutex
+	gateways []entity.Gateway
+	resolver *statGroupResolver
+	active   map[string]liveCall     // SIP Call-ID -> 通话中的呼叫
+	current  map[liveKey]int64       // 当前并发
+	attempts map[liveKey][]time.Time // 窗口内的呼叫开始时间
+	warned   map[string]bool         // 已告警的网关ID
+}
+
+type liveKey struct {
+	groupBy string
+	group   string
+}
+
+type liveCall struct {
+	gateway string
+	node    string
+}
+
+func NewConcurrencyService(logger *logrus.Logger, repository model.Repository, stat *StatService, warnPercent int) *ConcurrencyService {
+	t := &ConcurrencyService{
+		logger:      logger,
+		repository:  repository,
+		stat:        stat,
+		warnPercent: warnPercent,
+		now:         time.Now,
+		resolver:    newStatGroupResolver(entity.StatGroupGateway, nil, nil),
+		active:      make(map[string]liveCall),
+		current:     make(map[liveKey]int64),
+		attempts:    make(map[liveKey][]time.Time),
+		warned:      make(map[string]bool),
+	}
+	t.ReloadGateways()
+	return t
+}
+
+// ReloadGateways 重新加载网关列表和通道上限
+func (t *ConcurrencyService) ReloadGateways() {
+	gateways, err := t.repository.GatewayList()
+	if err != nil {
+		t.logger.WithError(err).Error("加载网关列表失败")
+		return
+	}
+	t.mu.Lock()
+	t.gateways = gateways
+	t.resolver = newStatGroupResolver(entity.StatGroupGateway, gateways, nil)
+	t.mu.Unlock()
+}
+
+func (t *ConcurrencyService) callKeys(call *entity.Call) (string, []liveKey) {
+	gateway := t.resolver.group(entity.CallStatRow{SrcAddr: call.SrcAddr, DstAddr: call.DstAddr})
+	keys := []liveKey{{groupBy: entity.StatGroupNode, group: call.NodeIP}}
+	if gateway != "" {
+		keys = append(keys, liveKey{groupBy: entity.StatGroupGateway, group: gateway})
+	}
+	return gateway, keys
+}
+
+func (t *ConcurrencyService) OnCallStarted(call *entity.Call) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	_, keys := t.callKeys(call)
+	for _, key := range keys {
+		t.attempts[key] = append(t.pruneAttempts(key, now), now)
+	}
+}
+
+func (t *ConcurrencyService) OnCallAnswered(call *entity.Call) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.active[call.SIPCallID]; ok {
+		return
+	}
+	gateway, keys := t.callKeys(call)
+	t.active[call.SIPCallID] = liveCall{gateway: gateway, node: call.NodeIP}
+	for _, key := range keys {
+		t.current[key]++
+	}
+	if gateway != "" {
+		t.checkChannelLimit(gateway)
+	}
+}
+
+func (t *ConcurrencyService) OnCallEnded(call *entity.Call) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	live, ok := t.active[call.SIPCallID]
+	if !ok {
+		return
+	}
+	delete(t.active, call.SIPCallID)
+	t.release(liveKey{groupBy: entity.StatGroupNode, group: live.node})
+	if live.gateway != "" {
+		t.release(liveKey{groupBy: entity.StatGroupGateway, group: live.gateway})
+		t.checkChannelLimit(live.gateway)
+	}
+}
+
+func (t *ConcurrencyService) release(key liveKey) {
+	t.current[key]--
+	if t.current[key] <= 0 {
+		delete(t.current, key)
+	}
+}
+
+// checkChannelLimit 并发达到通道上限的告警比例时告警一次，降到阈值以下一定比例后恢复
+func (t *ConcurrencyService) checkChannelLimit(group string) {
+	gateway := t.gateway(group)
+	if gateway == nil || gateway.MaxChannels <= 0 || t.warnPercent <= 0 {
+		return
+	}
+	current := t.current[liveKey{groupBy: entity.StatGroupGateway, group: group}]
+	usage := channelUsage(current, gateway.MaxChannels)
+
+	if !t.warned[group] && usage >= float64(t.warnPercent) {
+		t.warned[group] = true
+		t.logger.WithFields(logrus.Fields{
+			"gateway":      gateway.Name,
+			"addr":         gateway.Addrs,
+			"current":      current,
+			"max_channels": gateway.MaxChannels,
+		}).Warn("网关并发接近通道上限")
+	} else if t.warned[group] && usage < float64(t.warnPercent-channelWarnHysteresis) {
+		delete(t.warned, group)
+		t.logger.WithFields(logrus.Fields{
+			"gateway": gateway.Name,
+			"addr":    gateway.Addrs,
+			"current": current,
+		}).Info("网关并发已恢复")
+	}
+}
+
+// gateway 按分组的值（网关ID）查找网关
+func (t *ConcurrencyService) gateway(group string) *entity.Gateway {
+	for i := range t.gateways {
+		if strconv.FormatInt(t.gateways[i].ID, 10) == group {
+			return &t.gateways[i]
+		}
+	}
+	return nil
+}
+
+// pruneAttempts 删除窗口外的呼叫开始时间
+func (t *ConcurrencyService) pruneAttempts(key liveKey, now time.Time) []time.Time {
+	attempts := t.attempts[key]
+	i := 0
+	for i < len(attempts) && now.Sub(attempts[i]) > cpsWindow {
+		i++
+	}
+	attempts = attempts[i:]
+	if len(attempts) == 0 {
+		delete(t.attempts, key)
+	}
+	return attempts
+}
+
+// Live 返回所有网关（包括空闲的）和有话务的节点的当前并发
+func (t *ConcurrencyService) Live() []*entity.ConcurrencyLiveVO {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	keys := make(map[liveKey]bool)
+	for _, gateway := range t.gateways {
+		keys[liveKey{groupBy: entity.StatGroupGateway, group: strconv.FormatInt(gateway.ID, 10)}] = true
+	}
+	for key := range t.current {
+		keys[key] = true
+	}
+	for key := range t.attempts {
+		keys[key] = true
+	}
+
+	out := make([]*entity.ConcurrencyLiveVO, 0, len(keys))
+	for key := range keys {
+		vo := &entity.ConcurrencyLiveVO{
+			GroupBy: key.groupBy,
+			Group:   key.group,
+			Current: t.current[key],
+			CPS:     float64(len(t.pruneAttempts(key, now))) / cpsWindow.Seconds(),
+		}
+		if key.groupBy == entity.StatGroupGateway {
+			if gateway := t.gateway(key.group); gateway != nil {
+				vo.GroupName = gateway.Name
+				vo.MaxChannels = gateway.MaxChannels
+				vo.Usage = channelUsage(vo.Current, gateway.MaxChannels)
+				vo.Warning = t.overWarnLevel(vo.Usage)
+			}
+		}
+		out = append(out, vo)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].GroupBy != out[j].GroupBy {
+			return out[i].GroupBy < out[j].GroupBy
+		}
+		return out[i].Group < out[j].Group
+	})
+	return out
+}
+
+// channelUsage 并发占通道上限的百分比，没有上限时为0
+func channelUsage(current int64, maxChannels int) float64 {
+	if maxChannels <= 0 {
+		return 0
+	}
+	return float64(current) * 100 / float64(maxChannels)
+}
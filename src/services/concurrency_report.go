@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"sip-monitor/src/entity"
+)
+
+// 重建并发时向前多查询的时间，覆盖开始时间之前建立、之后仍在通话的呼叫。
+// 通话中的呼叫在缓存中最多保留15分钟，这里留足余量
+const concurrencyLookback = time.Hour
+
+// 一个分组在一个时间段内的并发统计
+type concurrencyBucket struct {
+	peak     int64
+	area     float64 // 并发数对时间的积分（秒）
+	attempts int64
+	peakCPS  int64
+}
+
+// ConcurrencyReport 按网关或节点、按时间段统计并发和CPS，默认按小时
+func (t *ConcurrencyService) ConcurrencyReport(ctx context.Context, params entity.CallStatDTO) ([]*entity.ConcurrencyVO, error) {
+	if err := validateConcurrencyParams(params); err != nil {
+		return nil, err
+	}
+	if params.Interval == "" {
+		params.Interval = entity.StatInterval1h
+	}
+	beginTime, endTime := statTimeRange(params)
+
+	gateways, err := t.repository.GatewayList()
+	if err != nil {
+		return nil, err
+	}
+	resolver := newStatGroupResolver(params.GroupBy, gateways, nil)
+	maxChannels := make(map[string]int, len(gateways))
+	for _, gateway := range gateways {
+		maxChannels[strconv.FormatInt(gateway.ID, 10)] = gateway.MaxChannels
+	}
+
+	buckets := make(map[kpiKey]*concurrencyBucket)
+	bucket := func(key kpiKey) *concurrencyBucket {
+		b, ok := buckets[key]
+		if !ok {
+			b = &concurrencyBucket{}
+			buckets[key] = b
+		}
+		return b
+	}
+
+	events := make(map[string][]concurrencyEvent)
+	perSecond := make(map[string]map[int64]int64)
+	err = t.repository.IterateCallStatRows(ctx, beginTime.Add(-concurrencyLookback), endTime, func(row entity.CallStatRow) error {
+		if row.CreateTime == nil {
+			return nil
+		}
+		group := resolver.group(row)
+
+		if !row.CreateTime.Before(beginTime) {
+			bucket(kpiKey{bucket: t.stat.bucketStart(*row.CreateTime, params.Interval), group: group}).attempts++
+			if perSecond[group] == nil {
+				perSecond[group] = make(map[int64]int64)
+			}
+			perSecond[group][row.CreateTime.Unix()]++
+		}
+
+		if row.AnswerTime == nil {
+			return nil
+		}
+		end := row.AnswerTime.Add(time.Duration(row.TalkDuration) * time.Second)
+		if row.EndTime != nil {
+			end = *row.EndTime
+		}
+		if end.After(*row.AnswerTime) {
+			events[group] = append(events[group], concurrencyEvent{at: *row.AnswerTime, delta: 1}, concurrencyEvent{at: end, delta: -1})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for group, groupEvents := range events {
+		sort.Slice(groupEvents, func(i, j int) bool {
+			if groupEvents[i].at.Equal(groupEvents[j].at) {
+				return groupEvents[i].delta < groupEvents[j].delta
+			}
+			return groupEvents[i].at.Before(groupEvents[j].at)
+		})
+		var level int64
+		var last time.Time
+		for _, event := range groupEvents {
+			if level > 0 {
+				t.addLevel(group, level, last, event.at, beginTime, endTime, params.Interval, bucket)
+			}
+			level += event.delta
+			last = event.at
+		}
+	}
+
+	for group, seconds := range perSecond {
+		for second, count := range seconds {
+			b := bucket(kpiKey{bucket: t.stat.bucketStart(time.Unix(second, 0), params.Interval), group: group})
+			if count > b.peakCPS {
+				b.peakCPS = count
+			}
+		}
+	}
+
+	out := make([]*entity.ConcurrencyVO, 0, len(buckets))
+	for key, b := range buckets {
+		bucketTime := time.Unix(key.bucket, 0).In(t.stat.location)
+		vo := &entity.ConcurrencyVO{
+			BucketTime:     &bucketTime,
+			Group:          key.group,
+			GroupName:      resolver.name(key.group),
+			PeakConcurrent: b.peak,
+			Attempts:       b.attempts,
+			PeakCPS:        b.peakCPS,
+		}
+		// 第一个和最后一个时间段只统计在查询范围内的部分
+		from, to := maxTime(bucketTime, beginTime), minTime(t.nextBucket(bucketTime, params.Interval), endTime)
+		if seconds := to.Sub(from).Seconds(); seconds > 0 {
+			vo.AvgConcurrent = b.area / seconds
+			vo.AvgCPS = float64(b.attempts) / seconds
+		}
+		if params.GroupBy == entity.StatGroupGateway {
+			vo.MaxChannels = maxChannels[key.group]
+			vo.PeakUsage = channelUsage(vo.PeakConcurrent, vo.MaxChannels)
+			vo.Warning = t.overWarnLevel(vo.PeakUsage)
+		}
+		out = append(out, vo)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].BucketTime.Equal(*out[j].BucketTime) {
+			return out[i].BucketTime.Before(*out[j].BucketTime)
+		}
+		return out[i].Group < out[j].Group
+	})
+	return out, nil
+}
+
+// addLevel 把[from, to)期间的并发数计入经过的每个时间段
+func (t *ConcurrencyService) addLevel(group string, level int64, from, to, beginTime, endTime time.Time, interval string,
+	bucket func(kpiKey) *concurrencyBucket) {
+	from, to = maxTime(from, beginTime), minTime(to, endTime)
+	for start := time.Unix(t.stat.bucketStart(from, interval), 0).In(t.stat.location); start.Before(to); {
+		next := t.nextBucket(start, interval)
+		if seconds := minTime(to, next).Sub(maxTime(from, start)).Seconds(); seconds > 0 {
+			b := bucket(kpiKey{bucket: start.Unix(), group: group})
+			b.area += float64(level) * seconds
+			if level > b.peak {
+				b.peak = level
+			}
+		}
+		start = next
+	}
+}
+
+// BusyHour 每个分组在时间范围内话务量（平均并发）最大的小时
+func (t *ConcurrencyService) BusyHour(ctx context.Context, params entity.CallStatDTO) ([]*entity.BusyHourVO, error) {
+	params.Interval = entity.StatInterval1h
+	series, err := t.ConcurrencyReport(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	busy := make(map[string]*entity.ConcurrencyVO)
+	for _, vo := range series {
+		// 序列按时间排序，话务量相同时取较早的小时
+		if current, ok := busy[vo.Group]; !ok || vo.AvgConcurrent > current.AvgConcurrent {
+			busy[vo.Group] = vo
+		}
+	}
+
+	out := make([]*entity.BusyHourVO, 0, len(busy))
+	for _, vo := range busy {
+		out = append(out, &entity.BusyHourVO{
+			Group:          vo.Group,
+			GroupName:      vo.GroupName,
+			BusyHour:       vo.BucketTime,
+			Erlangs:        vo.AvgConcurrent,
+			PeakConcurrent: vo.PeakConcurrent,
+			Attempts:       vo.Attempts,
+			PeakCPS:        vo.PeakCPS,
+			MaxChannels:    vo.MaxChannels,
+			PeakUsage:      vo.PeakUsage,
+			Warning:        vo.Warning,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Group < out[j].Group
+	})
+	return out, nil
+}
+
+func (t *ConcurrencyService) overWarnLevel(usage float64) bool {
+	return t.warnPercent > 0 && usage >= float64(t.warnPercent)
+}
+
+// nextBucket 返回下一个时间段的开始时间
+func (t *ConcurrencyService) nextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case entity.StatInterval5m:
+		return start.Add(5 * time.Minute)
+	case entity.StatInterval1d:
+		return start.AddDate(0, 0, 1)
+	}
+	return start.Add(time.Hour)
+}
+
+func validateConcurrencyParams(params entity.CallStatDTO) error {
+	switch params.GroupBy {
+	case "", entity.StatGroupGateway, entity.StatGroupNode:
+	default:
+		return fmt.Errorf("并发统计不支持的分组维度: %s", params.GroupBy)
+	}
+	switch params.Interval {
+	case "", entity.StatInterval5m, entity.StatInterval1h, entity.StatInterval1d:
+	default:
+		return fmt.Errorf("不支持的时间粒度: %s", params.Interval)
+	}
+	return nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"sip-monitor/src/entity"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestConcurrencyService_Live(t *testing.T) {
+	repository := &statTestRepository{
+		gateways: []entity.Gateway{{ID: 1, Name: "carrier-a", Addrs: []string{"10.0.0.1"}, MaxChannels: 2}},
+	}
+	c := NewConcurrencyService(logrus.New(), repository, NewStatService(repository), 80)
+	now := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	calls := []*entity.Call{
+		{SIPCallID: "a", NodeIP: "127.0.0.1", SrcAddr: "192.168.1.1:5060", DstAddr: "10.0.0.1:5060"},
+		{SIPCallID: "b", NodeIP: "127.0.0.1", SrcAddr: "10.0.0.1:5060", DstAddr: "192.168.1.1:5060"},
+		{SIPCallID: "c", NodeIP: "127.0.0.1", SrcAddr: "192.168.1.1:5060", DstAddr: "10.0.0.9:5060"},
+	}
+	for _, call := range calls {
+		c.OnCallStarted(call)
+		c.OnCallAnswered(call)
+	}
+	// 重复的应答不重复计数
+	c.OnCallAnswered(calls[0])
+
+	live := c.Live()
+	if len(live) != 2 {
+		t.Fatalf("应有一个网关和一个节点，得到%d行", len(live))
+	}
+	gateway, node := live[0], live[1]
+	if gateway.Group != "1" || gateway.GroupName != "carrier-a" || gateway.Current != 2 || gateway.Usage != 100 || !gateway.Warning {
+		t.Errorf("网关并发错误，得到%+v", gateway)
+	}
+	if node.Group != "127.0.0.1" || node.Current != 3 || math.Abs(node.CPS-0.3) > 0.001 {
+		t.Errorf("节点并发错误，得到%+v", node)
+	}
+	if !c.warned["1"] {
+		t.Errorf("达到告警阈值时应告警")
+	}
+
+	// 降到50%，低于恢复阈值
+	c.OnCallEnded(calls[0])
+	c.OnCallEnded(calls[0])
+	if c.warned["1"] {
+		t.Errorf("并发降低后告警应恢复")
+	}
+
+	// CPS窗口过后
+	now = now.Add(time.Minute)
+	live = c.Live()
+	if live[0].Current != 1 || live[1].Current != 2 || live[1].CPS != 0 {
+		t.Errorf("结束一个呼叫后错误，得到%+v %+v", live[0], live[1])
+	}
+}
+
+func TestConcurrencyService_Report(t *testing.T) {
+	begin := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	repository := &statTestRepository{
+		gateways: []entity.Gateway{{ID: 1, Name: "carrier-a", Addrs: []string{"10.0.0.1"}, MaxChannels: 2}},
+		rows: []entity.CallStatRow{
+			// 开始时间之前建立、之后结束的呼叫
+			statRow(begin, -time.Minute, 10*time.Second, 20*time.Second, 120*time.Second, 200, "10.0.0.1:5060"),
+			statRow(begin, 0, 2*time.Second, 4*time.Second, 60*time.Second, 200, "10.0.0.1:5060"),
+			statRow(begin, 10*time.Second, 4*time.Second, 6*time.Second, 120*time.Second, 200, "10.0.0.1:5060"),
+			statRow(begin, 20*time.Second, 3*time.Second, 1*time.Second, 0, 486, "10.0.0.1:5060"),
+			statRow(begin, 30*time.Second, 3*time.Second, 0, 0, 503, "10.0.0.9:5060"),
+			statRow(begin, 30*time.Second, 3*time.Second, 0, 0, 503, "10.0.0.9:5060"),
+			statRow(begin, 70*time.Minute, 1*time.Second, 2*time.Second, 30*time.Second, 200, "10.0.0.1:5060"),
+		},
+	}
+	stat := NewStatService(repository)
+	stat.location = time.UTC
+	c := NewConcurrencyService(logrus.New(), repository, stat, 80)
+
+	end := begin.Add(2 * time.Hour)
+	params := entity.CallStatDTO{BeginTime: &begin, EndTime: &end, GroupBy: entity.StatGroupGateway}
+	report, err := c.ConcurrencyReport(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 3 {
+		t.Fatalf("应有3行，得到%d行", len(report))
+	}
+	if report[0].Group != "" || report[0].Attempts != 2 || report[0].PeakCPS != 2 || report[0].PeakConcurrent != 0 {
+		t.Errorf("未匹配网关的行错误，得到%+v", report[0])
+	}
+	gateway := report[1]
+	if gateway.Group != "1" || gateway.Attempts != 3 || gateway.PeakConcurrent != 3 || gateway.PeakCPS != 1 {
+		t.Errorf("网关行错误，得到%+v", gateway)
+	}
+	// 开始之前的呼叫只计算10:00之后的90秒
+	if math.Abs(gateway.AvgConcurrent-270.0/3600) > 1e-9 || gateway.PeakUsage != 150 || !gateway.Warning {
+		t.Errorf("网关并发错误，得到%+v", gateway)
+	}
+	if !report[2].BucketTime.Equal(begin.Add(time.Hour)) || report[2].PeakConcurrent != 1 || report[2].Warning {
+		t.Errorf("11点的行错误，得到%+v", report[2])
+	}
+
+	busy, err := c.BusyHour(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(busy) != 2 || busy[1].Group != "1" || !busy[1].BusyHour.Equal(begin) || busy[1].PeakConcurrent != 3 {
+		t.Errorf("忙时错误，得到%+v", busy)
+	}
+
+	if _, err = c.ConcurrencyReport(context.Background(), entity.CallStatDTO{GroupBy: entity.StatGroupCause}); err == nil {
+		t.Errorf("不支持的分组应返回错误")
+	}
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"sip-monitor/src/config"
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 一个会话最多关联的呼叫腿数，防止启发式关联在话务集中时无限扩散
+const maxSessionLegs = 32
+
+// 启发式关联时号码后缀匹配的最短长度，用于忽略+86、0等前缀的差异
+const minNumberSuffixLength = 6
+
+// callIDRule B2BUA在A腿Call-ID前后添加的部分
+type callIDRule struct {
+	prefix bool
+	marker string
+}
+
+// base 去掉B2BUA添加的部分，不匹配时返回空
+func (r callIDRule) base(callID string) string {
+	if r.prefix {
+		if base, ok := strings.CutPrefix(callID, r.marker); ok {
+			return base
+		}
+		return ""
+	}
+	if i := strings.LastIndex(callID, r.marker); i > 0 {
+		return callID[:i]
+	}
+	return ""
+}
+
+// Correlator 关联经过B2BUA的多条呼叫腿。入库时从INVITE中提取关联键，
+// 查询时按配置的策略顺序查找关联的呼叫，得到会话的全部呼叫腿
+type Correlator struct {
+	logger     *logrus.Logger
+	repository model.Repository
+	strategies []string
+	rules      []callIDRule
+	window     time.Duration
+}
+
+func NewCorrelator(logger *logrus.Logger, repository model.Repository, cfg *config.Config) (*Correlator, error) {
+	c := &Correlator{
+		logger:     logger,
+		repository: repository,
+		window:     time.Duration(cfg.CorrelationWindowSeconds) * time.Second,
+	}
+	for _, strategy := range strings.Split(cfg.CorrelationStrategies, ",") {
+		strategy = strings.TrimSpace(strategy)
+		switch strategy {
+		case "":
+			continue
+		case entity.CorrelationSessionID, entity.CorrelationHeader, entity.CorrelationICID, entity.CorrelationCallIDRule, entity.CorrelationHeuristic:
+			if !slices.Contains(c.strategies, strategy) {
+				c.strategies = append(c.strategies, strategy)
+			}
+		default:
+			return nil, fmt.Errorf("不支持的关联策略：%s", strategy)
+		}
+	}
+	for _, item := range strings.Split(cfg.CorrelationCallIDRules, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, marker, _ := strings.Cut(item, ":")
+		if marker == "" || (kind != "prefix" && kind != "suffix") {
+			return nil, fmt.Errorf("Call-ID规则格式错误：%s", item)
+		}
+		c.rules = append(c.rules, callIDRule{prefix: kind == "prefix", marker: marker})
+	}
+	return c, nil
+}
+
+func (c *Correlator) enabled(strategy string) bool {
+	return slices.Contains(c.strategies, strategy)
+}
+
+// LinkKeys 从呼叫的INVITE中提取关联键，随呼叫一起保存
+func (c *Correlator) LinkKeys(item entity.SIP) []entity.CallLink {
+	var links []entity.CallLink
+	add := func(strategy, value string) {
+		if value == "" || value == item.CallID {
+			return
+		}
+		for _, link := range links {
+			if link.Strategy == strategy && link.Value == value {
+				return
+			}
+		}
+		links = append(links, entity.CallLink{Strategy: strategy, Value: value})
+	}
+
+	if c.enabled(entity.CorrelationHeader) {
+		names := make([]string, 0, len(item.CorrelationHeaders))
+		for name := range item.CorrelationHeaders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(entity.CorrelationHeader, item.CorrelationHeaders[name])
+		}
+	}
+	if c.enabled(entity.CorrelationICID) {
+		add(entity.CorrelationICID, item.ICID)
+	}
+	if c.enabled(entity.CorrelationCallIDRule) {
+		for _, rule := range c.rules {
+			add(entity.CorrelationCallIDRule, rule.base(item.CallID))
+		}
+	}
+	return links
+}
+
+// SessionGraph 从呼叫开始逐层查找关联的呼叫腿
+func (c *Correlator) SessionGraph(ctx context.Context, root *entity.Call) (*entity.SessionGraph, error) {
+	calls := map[string]*entity.Call{root.SIPCallID: root}
+	links := make(map[[2]string]entity.SessionLink)
+	level := []*entity.Call{root}
+
+	for len(level) > 0 && len(calls) < maxSessionLegs {
+		var pending []string
+		for _, call := range level {
+			related, err := c.related(ctx, call)
+			if err != nil {
+				return nil, err
+			}
+			for _, link := range related {
+				key := [2]string{min(link.From, link.To), max(link.From, link.To)}
+				if _, ok := links[key]; !ok {
+					links[key] = link
+				}
+				if _, ok := calls[link.To]; !ok && !slices.Contains(pending, link.To) {
+					pending = append(pending, link.To)
+				}
+			}
+		}
+		if len(pending) > maxSessionLegs-len(calls) {
+			pending = pending[:maxSessionLegs-len(calls)]
+		}
+
+		found, err := c.repository.GetCallsBySIPCallIDs(ctx, pending)
+		if err != nil {
+			return nil, err
+		}
+		level = level[:0]
+		for i := range found {
+			if _, ok := calls[found[i].SIPCallID]; !ok {
+				calls[found[i].SIPCallID] = &found[i]
+				level = append(level, &found[i])
+			}
+		}
+	}
+
+	if len(calls) >= maxSessionLegs {
+		c.logger.WithField("sip_call_id", root.SIPCallID).Warn("关联的呼叫腿达到上限，只返回部分呼叫腿")
+	}
+	return buildSessionGraph(root.SIPCallID, calls, links), nil
+}
+
+// related 按策略顺序查找与呼叫直接关联的呼叫，每个呼叫只保留第一个匹配的策略。
+// 返回的关联中From为call，To为关联的Call-ID
+func (c *Correlator) related(ctx context.Context, call *entity.Call) ([]entity.SessionLink, error) {
+	var result []entity.SessionLink
+	add := func(callID, strategy, value string) {
+		if callID == "" || callID == call.SIPCallID {
+			return
+		}
+		for _, link := range result {
+			if link.To == callID {
+				return
+			}
+		}
+		result = append(result, entity.SessionLink{From: call.SIPCallID, To: callID, Strategy: strategy, Value: value})
+	}
+
+	// 自己的关联键，以及其他呼叫中等于自己Call-ID或与自己的键值相同的关联键
+	var own, matched []entity.CallLink
+	var existing []entity.Call
+	if c.enabled(entity.CorrelationHeader) || c.enabled(entity.CorrelationICID) || c.enabled(entity.CorrelationCallIDRule) {
+		var err error
+		own, err = c.repository.GetCallLinksBySIPCallIDs(ctx, []string{call.SIPCallID})
+		if err != nil {
+			return nil, err
+		}
+		values := []string{call.SIPCallID}
+		for _, link := range own {
+			values = append(values, link.Value)
+		}
+		matched, err = c.repository.GetCallLinksByValues(ctx, values)
+		if err != nil {
+			return nil, err
+		}
+		existing, err = c.repository.GetCallsBySIPCallIDs(ctx, values[1:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, strategy := range c.strategies {
+		switch strategy {
+		case entity.CorrelationSessionID:
+			if call.SessionID == "" {
+				continue
+			}
+			ids, err := c.repository.GetCallIDsBySessionID(ctx, call.SessionID)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				add(id, strategy, call.SessionID)
+			}
+
+		case entity.CorrelationHeader, entity.CorrelationICID, entity.CorrelationCallIDRule:
+			// 其他呼叫的关联键指向自己的Call-ID
+			for _, link := range matched {
+				if link.Strategy == strategy && link.Value == call.SIPCallID {
+					add(link.SIPCallID, strategy, link.Value)
+				}
+			}
+			for _, ownLink := range own {
+				if ownLink.Strategy != strategy {
+					continue
+				}
+				// 自己的关联键指向其他呼叫的Call-ID
+				for _, other := range existing {
+					if other.SIPCallID == ownLink.Value {
+						add(other.SIPCallID, strategy, ownLink.Value)
+					}
+				}
+				// 与其他呼叫同一策略的关联键值相同，如同一A腿的多个B腿
+				for _, link := range matched {
+					if link.Strategy == strategy && link.Value == ownLink.Value {
+						add(link.SIPCallID, strategy, ownLink.Value)
+					}
+				}
+			}
+
+		case entity.CorrelationHeuristic:
+			candidates, err := c.heuristicCandidates(ctx, call)
+			if err != nil {
+				return nil, err
+			}
+			for _, candidate := range candidates {
+				add(candidate, strategy, call.FromUser+"->"+call.ToUser)
+			}
+		}
+	}
+	return result, nil
+}
+
+// heuristicCandidates 主被叫号码相同且开始时间相差不超过窗口的呼叫
+func (c *Correlator) heuristicCandidates(ctx context.Context, call *entity.Call) ([]string, error) {
+	if c.window <= 0 || call.CreateTime == nil || call.FromUser == "" || call.ToUser == "" {
+		return nil, nil
+	}
+	begin, end := call.CreateTime.Add(-c.window), call.CreateTime.Add(c.window)
+	calls, _, err := c.repository.GetCallList(ctx, entity.SearchParams{
+		Page:      1,
+		PageSize:  maxSessionLegs,
+		ToUser:    lastDigits(call.ToUser),
+		BeginTime: &begin,
+		EndTime:   &end,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, candidate := range calls {
+		if sameNumber(candidate.FromUser, call.FromUser) && sameNumber(candidate.ToUser, call.ToUser) {
+			ids = append(ids, candidate.SIPCallID)
+		}
+	}
+	return ids, nil
+}
+
+// sameNumber 号码相同，或较短的号码至少6位且为较长号码的后缀（B2BUA增删了+86、0等前缀）
+func sameNumber(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= minNumberSuffixLength && strings.HasSuffix(b, a)
+}
+
+// lastDigits 号码的最后6位，用于模糊查询候选呼叫
+func lastDigits(user string) string {
+	if len(user) <= minNumberSuffixLength {
+		return user
+	}
+	return user[len(user)-minNumberSuffixLength:]
+}
+
+// buildSessionGraph 呼叫腿按开始时间排序，关联的From为较早开始的腿，两端都存在的关联才保留
+func buildSessionGraph(root string, calls map[string]*entity.Call, links map[[2]string]entity.SessionLink) *entity.SessionGraph {
+	graph := &entity.SessionGraph{
+		Root:  root,
+		Legs:  make([]entity.SessionLeg, 0, len(calls)),
+		Links: make([]entity.SessionLink, 0, len(links)),
+	}
+	for _, call := range calls {
+		graph.Legs = append(graph.Legs, entity.SessionLeg{
+			SIPCallID:  call.SIPCallID,
+			FromUser:   call.FromUser,
+			ToUser:     call.ToUser,
+			SrcAddr:    call.SrcAddr,
+			DstAddr:    call.DstAddr,
+			Direction:  call.Direction,
+			CreateTime: call.CreateTime,
+			CallStatus: call.CallStatus,
+			HangupCode: call.HangupCode,
+		})
+	}
+	sort.Slice(graph.Legs, func(i, j int) bool {
+		return legBefore(graph.Legs[i], graph.Legs[j])
+	})
+
+	order := make(map[string]int, len(graph.Legs))
+	for i, leg := range graph.Legs {
+		order[leg.SIPCallID] = i
+	}
+	for _, link := range links {
+		from, okFrom := order[link.From]
+		to, okTo := order[link.To]
+		if !okFrom || !okTo {
+			continue
+		}
+		if from > to {
+			link.From, link.To = link.To, link.From
+		}
+		graph.Links = append(graph.Links, link)
+	}
+	sort.Slice(graph.Links, func(i, j int) bool {
+		a, b := graph.Links[i], graph.Links[j]
+		if order[a.From] != order[b.From] {
+			return order[a.From] < order[b.From]
+		}
+		return order[a.To] < order[b.To]
+	})
+	return graph
+}
+
+func legBefore(a, b entity.SessionLeg) bool {
+	switch {
+	case a.CreateTime == nil || b.CreateTime == nil:
+		if (a.CreateTime == nil) != (b.CreateTime == nil) {
+			return a.CreateTime != nil
+		}
+	case !a.CreateTime.Equal(*b.CreateTime):
+		return a.CreateTime.Before(*b.CreateTime)
+	}
+	return a.SIPCallID < b.SIPCallID
+}
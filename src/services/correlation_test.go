@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"sip-monitor/src/config"
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 只实现呼叫腿关联用到的方法
+type correlationTestRepository struct {
+	model.Repository
+	calls []entity.Call
+	links []entity.CallLink
+}
+
+func (r *correlationTestRepository) add(call entity.Call, links ...entity.CallLink) {
+	r.calls = append(r.calls, call)
+	for _, link := range links {
+		link.SIPCallID = call.SIPCallID
+		r.links = append(r.links, link)
+	}
+}
+
+func (r *correlationTestRepository) GetCallIDsBySessionID(ctx context.Context, sessionID string) ([]string, error) {
+	var ids []string
+	for _, call := range r.calls {
+		if call.SessionID == sessionID {
+			ids = append(ids, call.SIPCallID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *correlationTestRepository) GetCallsBySIPCallIDs(ctx context.Context, sipCallIDs []string) ([]entity.Call, error) {
+	var calls []entity.Call
+	for _, call := range r.calls {
+		for _, id := range sipCallIDs {
+			if call.SIPCallID == id {
+				calls = append(calls, call)
+				break
+			}
+		}
+	}
+	return calls, nil
+}
+
+func (r *correlationTestRepository) GetCallLinksBySIPCallIDs(ctx context.Context, sipCallIDs []string) ([]entity.CallLink, error) {
+	var links []entity.CallLink
+	for _, link := range r.links {
+		for _, id := range sipCallIDs {
+			if link.SIPCallID == id {
+				links = append(links, link)
+				break
+			}
+		}
+	}
+	return links, nil
+}
+
+func (r *correlationTestRepository) GetCallLinksByValues(ctx context.Context, values []string) ([]entity.CallLink, error) {
+	var links []entity.CallLink
+	for _, link := range r.links {
+		for _, value := range values {
+			if link.Value == value {
+				links = append(links, link)
+				break
+			}
+		}
+	}
+	return links, nil
+}
+
+func (r *correlationTestRepository) GetCallList(ctx context.Context, params entity.SearchParams) ([]entity.Call, *entity.Meta, error) {
+	var calls []entity.Call
+	for _, call := range r.calls {
+		if !strings.Contains(call.ToUser, params.ToUser) {
+			continue
+		}
+		if call.CreateTime.Before(*params.BeginTime) || call.CreateTime.After(*params.EndTime) {
+			continue
+		}
+		calls = append(calls, call)
+	}
+	return calls, &entity.Meta{}, nil
+}
+
+func newTestCorrelator(t *testing.T, repository model.Repository, strategies, rules string) *Correlator {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	correlator, err := NewCorrelator(logger, repository, &config.Config{
+		CorrelationStrategies:    strategies,
+		CorrelationCallIDRules:   rules,
+		CorrelationWindowSeconds: 3,
+	})
+	if err != nil {
+		t.Fatalf("NewCorrelator() error = %v", err)
+	}
+	return correlator
+}
+
+func testCall(callID string, at time.Time, from, to string) entity.Call {
+	return entity.Call{SIPCallID: callID, CreateTime: &at, FromUser: from, ToUser: to}
+}
+
+func graphLegIDs(graph *entity.SessionGraph) string {
+	return strings.Join(graph.LegIDs(), ",")
+}
+
+func TestNewCorrelator_InvalidConfig(t *testing.T) {
+	logger := logrus.New()
+	if _, err := NewCorrelator(logger, nil, &config.Config{CorrelationStrategies: "header,unknown"}); err == nil {
+		t.Error("未知策略应返回错误")
+	}
+	if _, err := NewCorrelator(logger, nil, &config.Config{CorrelationCallIDRules: "middle:-x"}); err == nil {
+		t.Error("错误的Call-ID规则应返回错误")
+	}
+}
+
+func TestCorrelator_LinkKeys(t *testing.T) {
+	c := newTestCorrelator(t, nil, "header,icid,call_id_rule", "suffix:-b2b_,prefix:B2B.")
+	links := c.LinkKeys(entity.SIP{
+		CallID:             "B2B.abc-b2b_1",
+		ICID:               "icid-1",
+		CorrelationHeaders: map[string]string{"X-Orig-Call-ID": "abc", "X-Other": "abc"},
+	})
+
+	want := []entity.CallLink{
+		{Strategy: entity.CorrelationHeader, Value: "abc"},
+		{Strategy: entity.CorrelationICID, Value: "icid-1"},
+		{Strategy: entity.CorrelationCallIDRule, Value: "B2B.abc"},
+		{Strategy: entity.CorrelationCallIDRule, Value: "abc-b2b_1"},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("LinkKeys() = %+v, want %+v", links, want)
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Errorf("LinkKeys()[%d] = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+
+	// 未启用的策略不提取
+	c = newTestCorrelator(t, nil, "session_id", "")
+	if links := c.LinkKeys(entity.SIP{CallID: "x", ICID: "icid-1"}); len(links) != 0 {
+		t.Errorf("LinkKeys() = %+v, want empty", links)
+	}
+}
+
+func TestCorrelator_SessionGraph(t *testing.T) {
+	base := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	repository := &correlationTestRepository{}
+	// A腿 -> B2BUA 通过X-Orig-Call-ID -> B腿；B腿和C腿通过icid关联；D腿去掉后缀后与A腿Call-ID相同
+	repository.add(testCall("a-leg", base, "1001", "13800138000"))
+	repository.add(testCall("b-leg", base.Add(100*time.Millisecond), "1001", "013800138000"),
+		entity.CallLink{Strategy: entity.CorrelationHeader, Value: "a-leg"},
+		entity.CallLink{Strategy: entity.CorrelationICID, Value: "icid-1"})
+	repository.add(testCall("c-leg", base.Add(200*time.Millisecond), "1001", "13800138000"),
+		entity.CallLink{Strategy: entity.CorrelationICID, Value: "icid-1"})
+	repository.add(testCall("a-leg-b2b_7", base.Add(300*time.Millisecond), "1001", "8613800138000"),
+		entity.CallLink{Strategy: entity.CorrelationCallIDRule, Value: "a-leg"})
+	// 号码相同但不在时间窗口内
+	repository.add(testCall("later", base.Add(time.Minute), "1001", "13800138000"))
+
+	c := newTestCorrelator(t, repository, "header,icid,call_id_rule", "suffix:-b2b_")
+	graph, err := c.SessionGraph(context.Background(), &repository.calls[2])
+	if err != nil {
+		t.Fatalf("SessionGraph() error = %v", err)
+	}
+	if graph.Root != "c-leg" {
+		t.Errorf("Root = %q, want c-leg", graph.Root)
+	}
+	if got := graphLegIDs(graph); got != "a-leg,b-leg,c-leg,a-leg-b2b_7" {
+		t.Errorf("legs = %s", got)
+	}
+
+	want := []entity.SessionLink{
+		{From: "a-leg", To: "b-leg", Strategy: entity.CorrelationHeader, Value: "a-leg"},
+		{From: "a-leg", To: "a-leg-b2b_7", Strategy: entity.CorrelationCallIDRule, Value: "a-leg"},
+		{From: "b-leg", To: "c-leg", Strategy: entity.CorrelationICID, Value: "icid-1"},
+	}
+	if len(graph.Links) != len(want) {
+		t.Fatalf("links = %+v, want %+v", graph.Links, want)
+	}
+	for i := range want {
+		if graph.Links[i] != want[i] {
+			t.Errorf("links[%d] = %+v, want %+v", i, graph.Links[i], want[i])
+		}
+	}
+}
+
+func TestCorrelator_SessionGraphHeuristic(t *testing.T) {
+	base := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	repository := &correlationTestRepository{}
+	repository.add(testCall("a-leg", base, "1001", "13800138000"))
+	repository.add(testCall("b-leg", base.Add(time.Second), "1001", "+8613800138000"))
+	// 主叫不同
+	repository.add(testCall("other", base.Add(time.Second), "1002", "13800138000"))
+	// 超出时间窗口
+	repository.add(testCall("later", base.Add(10*time.Second), "1001", "13800138000"))
+
+	c := newTestCorrelator(t, repository, "header,heuristic", "")
+	graph, err := c.SessionGraph(context.Background(), &repository.calls[0])
+	if err != nil {
+		t.Fatalf("SessionGraph() error = %v", err)
+	}
+	if got := graphLegIDs(graph); got != "a-leg,b-leg" {
+		t.Errorf("legs = %s, want a-leg,b-leg", got)
+	}
+	if len(graph.Links) != 1 || graph.Links[0].Strategy != entity.CorrelationHeuristic {
+		t.Errorf("links = %+v", graph.Links)
+	}
+
+	// 未启用启发式关联时只有自己
+	c = newTestCorrelator(t, repository, "header", "")
+	graph, err = c.SessionGraph(context.Background(), &repository.calls[0])
+	if err != nil {
+		t.Fatalf("SessionGraph() error = %v", err)
+	}
+	if got := graphLegIDs(graph); got != "a-leg" {
+		t.Errorf("legs = %s, want a-leg", got)
+	}
+}
+
+func TestSameNumber(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"13800138000", "13800138000", true},
+		{"13800138000", "+8613800138000", true},
+		{"013800138000", "13800138000", true},
+		{"1001", "21001", false},
+		{"13800138000", "13800138001", false},
+	}
+	for _, tt := range tests {
+		if got := sameNumber(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameNumber(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sip-monitor/src/entity"
+)
+
+// 重复消息的处理方式
+const (
+	DedupModeDrop = "drop" // 只保留第一份
+	DedupModeMark = "mark" // 保留第一份，并记录上报了同一消息的全部节点，入库延迟一个时间窗口
+)
+
+type dedupKey [sha1.Size]byte
+
+type dedupEntry struct {
+	key     dedupKey
+	arrived time.Time
+	capture int64 // 抓包时间（微秒）
+	item    entity.SIP
+	nodes   []string
+}
+
+// Deduplicator 多个采集节点（如SBC和代理）上报同一跳的同一条SIP消息时只保留一份。
+// SIP内容和5元组相同、抓包时间相差不超过窗口的消息视为重复；
+// 同一节点的重传间隔至少500ms（RFC 3261 T1），窗口应小于这个值。
+type Deduplicator struct {
+	window time.Duration
+	mark   bool
+
+	mu      sync.Mutex
+	entries map[dedupKey][]*dedupEntry
+	queue   []*dedupEntry // 按到达顺序，用于过期和mark模式下的释放
+
+	checked atomic.Uint64
+	hits    atomic.Uint64
+}
+
+// NewDeduplicator 窗口小于等于0时返回nil，表示不去重
+func NewDeduplicator(window time.Duration, mode string) (*Deduplicator, error) {
+	if window <= 0 {
+		return nil, nil
+	}
+	switch mode {
+	case "", DedupModeDrop, DedupModeMark:
+	default:
+		return nil, fmt.Errorf("不支持的去重方式：%s", mode)
+	}
+	return &Deduplicator{
+		window:  window,
+		mark:    mode == DedupModeMark,
+		entries: make(map[dedupKey][]*dedupEntry),
+	}, nil
+}
+
+// TickInterval 调用Release的间隔
+func (d *Deduplicator) TickInterval() time.Duration {
+	return max(d.window/4, 10*time.Millisecond)
+}
+
+// Offer 返回true时消息可以直接处理；重复消息和mark模式下暂存的消息返回false，
+// 暂存的消息在窗口结束后由Release返回
+func (d *Deduplicator) Offer(item entity.SIP) bool {
+	return d.offer(item, time.Now())
+}
+
+func (d *Deduplicator) offer(item entity.SIP, now time.Time) bool {
+	d.checked.Add(1)
+	key := dedupHash(item)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, entry := range d.entries[key] {
+		if diff := item.TimestampMicro - entry.capture; diff <= d.window.Microseconds() && diff >= -d.window.Microseconds() {
+			d.hits.Add(1)
+			if d.mark {
+				entry.nodes = appendNode(entry.nodes, item.NodeIP)
+			}
+			return false
+		}
+	}
+
+	entry := &dedupEntry{key: key, arrived: now, capture: item.TimestampMicro}
+	if d.mark {
+		entry.item = item
+		entry.nodes = []string{item.NodeIP}
+	}
+	d.entries[key] = append(d.entries[key], entry)
+	d.queue = append(d.queue, entry)
+	return !d.mark
+}
+
+// Release 清理窗口外的记录，mark模式下按到达顺序返回到期的消息，多个节点上报时填写SeenBy
+func (d *Deduplicator) Release(now time.Time) []entity.SIP {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var released []entity.SIP
+	expired := 0
+	for _, entry := range d.queue {
+		if now.Sub(entry.arrived) < d.window {
+			break
+		}
+		expired++
+		if d.mark {
+			item := entry.item
+			if len(entry.nodes) > 1 {
+				item.SeenBy = entry.nodes
+			}
+			released = append(released, item)
+		}
+		d.removeEntry(entry)
+	}
+	if expired > 0 {
+		d.queue = append(d.queue[:0:0], d.queue[expired:]...)
+	}
+	return released
+}
+
+func (d *Deduplicator) removeEntry(entry *dedupEntry) {
+	list := d.entries[entry.key]
+	for i, e := range list {
+		if e == entry {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(d.entries, entry.key)
+	} else {
+		d.entries[entry.key] = list
+	}
+}
+
+// IngestStats 检查的消息数、重复数和命中率(%)
+func (d *Deduplicator) IngestStats() map[string]float64 {
+	checked, hits := d.checked.Load(), d.hits.Load()
+	rate := 0.0
+	if checked > 0 {
+		rate = float64(hits) * 100 / float64(checked)
+	}
+	return map[string]float64{
+		"dedup_checked":  float64(checked),
+		"dedup_hits":     float64(hits),
+		"dedup_hit_rate": rate,
+	}
+}
+
+// dedupHash SIP原文和5元组的哈希
+func dedupHash(item entity.SIP) dedupKey {
+	h := sha1.New()
+	h.Write([]byte(strconv.Itoa(item.Protocol)))
+	h.Write([]byte{0})
+	h.Write([]byte(item.SrcAddr))
+	h.Write([]byte{0})
+	h.Write([]byte(item.DstAddr))
+	h.Write([]byte{0})
+	if item.Raw != nil {
+		h.Write([]byte(*item.Raw))
+	}
+	var key dedupKey
+	h.Sum(key[:0])
+	return key
+}
+
+func appendNode(nodes []string, node string) []string {
+	for _, n := range nodes {
+		if n == node {
+			return nodes
+		}
+	}
+	return append(nodes, node)
+}
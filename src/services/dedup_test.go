@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"sip-monitor/src/entity"
+)
+
+func dedupItem(node string, captureMicro int64, raw string) entity.SIP {
+	return entity.SIP{
+		NodeIP:         node,
+		CallID:         "dedup@10.0.0.1",
+		Protocol:       17,
+		SrcAddr:        "10.0.0.1:5060",
+		DstAddr:        "10.0.0.2:5060",
+		TimestampMicro: captureMicro,
+		Raw:            &raw,
+	}
+}
+
+func TestDeduplicator_Drop(t *testing.T) {
+	d, err := NewDeduplicator(200*time.Millisecond, DedupModeDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	invite := "INVITE sip:1001@10.0.0.2 SIP/2.0\r\nCall-ID: dedup@10.0.0.1\r\n\r\n"
+	begin := now.UnixMicro()
+
+	if !d.offer(dedupItem("192.168.0.1", begin, invite), now) {
+		t.Fatal("第一份应通过")
+	}
+	// 另一个节点抓到的同一条消息
+	if d.offer(dedupItem("192.168.0.2", begin+80, invite), now.Add(5*time.Millisecond)) {
+		t.Error("窗口内的重复消息应丢弃")
+	}
+	// 不同5元组
+	other := dedupItem("192.168.0.2", begin+100, invite)
+	other.DstAddr = "10.0.0.3:5060"
+	if !d.offer(other, now.Add(6*time.Millisecond)) {
+		t.Error("5元组不同时不是重复消息")
+	}
+	// 500ms后的重传
+	if !d.offer(dedupItem("192.168.0.1", begin+500000, invite), now.Add(500*time.Millisecond)) {
+		t.Error("窗口外的重传不应丢弃")
+	}
+	if released := d.Release(now.Add(time.Second)); released != nil {
+		t.Errorf("drop模式不应释放消息：%d", len(released))
+	}
+	if len(d.entries) != 0 || len(d.queue) != 0 {
+		t.Errorf("过期记录未清理：%d %d", len(d.entries), len(d.queue))
+	}
+
+	stats := d.IngestStats()
+	if stats["dedup_checked"] != 4 || stats["dedup_hits"] != 1 || stats["dedup_hit_rate"] != 25 {
+		t.Errorf("计数错误：%v", stats)
+	}
+}
+
+func TestDeduplicator_Mark(t *testing.T) {
+	d, _ := NewDeduplicator(100*time.Millisecond, DedupModeMark)
+	now := time.Now()
+	begin := now.UnixMicro()
+	ringing := "SIP/2.0 180 Ringing\r\nCall-ID: dedup@10.0.0.1\r\n\r\n"
+	ok := "SIP/2.0 200 OK\r\nCall-ID: dedup@10.0.0.1\r\n\r\n"
+
+	if d.offer(dedupItem("192.168.0.1", begin, ringing), now) {
+		t.Error("mark模式的消息应暂存")
+	}
+	d.offer(dedupItem("192.168.0.2", begin+50, ringing), now.Add(2*time.Millisecond))
+	d.offer(dedupItem("192.168.0.1", begin+1000, ok), now.Add(3*time.Millisecond))
+
+	if released := d.Release(now.Add(50 * time.Millisecond)); len(released) != 0 {
+		t.Fatalf("窗口结束前不应释放：%d", len(released))
+	}
+	released := d.Release(now.Add(200 * time.Millisecond))
+	if len(released) != 2 {
+		t.Fatalf("应释放2条消息，得到%d", len(released))
+	}
+	if *released[0].Raw != ringing || len(released[0].SeenBy) != 2 || released[0].SeenBy[1] != "192.168.0.2" {
+		t.Errorf("第一条消息应记录两个节点：%v", released[0].SeenBy)
+	}
+	if released[1].SeenBy != nil {
+		t.Errorf("只有一个节点时SeenBy应为空：%v", released[1].SeenBy)
+	}
+}
+
+func TestNewDeduplicator(t *testing.T) {
+	if d, err := NewDeduplicator(0, DedupModeDrop); d != nil || err != nil {
+		t.Error("窗口为0时不去重")
+	}
+	if _, err := NewDeduplicator(time.Second, "merge"); err == nil {
+		t.Error("不支持的去重方式应返回错误")
+	}
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"sip-monitor/src/config"
+	"sip-monitor/src/entity"
+	"sip-monitor/src/pkg/sink"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// 每次从磁盘缓存读取并发送的最大事件数
+	eventPublishBatch = 100
+	// 等待写入磁盘缓存的事件队列长度，每次最多合并写入eventSpoolBatch个事件
+	eventQueueSize  = 10000
+	eventSpoolBatch = 500
+	// 单次发送的超时
+	eventPublishTimeout = 15 * time.Second
+	// 发送失败后的重试间隔，指数增长到上限
+	eventRetryMinDelay = time.Second
+	eventRetryMaxDelay = time.Minute
+)
+
+// EventPublisher 将入库的呼叫、RTCP报告和告警实时推送到消息总线。
+// 事件经队列由一个协程按顺序写入每个推送目标各自的磁盘缓存，监听器不等待磁盘写入；
+// 再由后台协程发送，对端确认后才移出缓存；目标不可用时事件留在磁盘上并不断重试，保证至少投递一次
+type EventPublisher struct {
+	logger  *logrus.Logger
+	types   map[string]struct{}
+	workers []*eventWorker
+	queue   chan sink.Event
+	wg      sync.WaitGroup
+	stop    chan struct{}
+}
+
+type eventWorker struct {
+	sink  sink.Sink
+	spool *sink.Spool
+}
+
+// NewEventPublisher types为需要推送的事件类型，逗号分隔，为空时推送全部类型；
+// 每个目标在spoolDir下有独立的缓存目录，磁盘占用上限为spoolMaxBytes
+func NewEventPublisher(logger *logrus.Logger, sinks []sink.Sink, types, spoolDir string, spoolMaxBytes int64) (*EventPublisher, error) {
+	p := &EventPublisher{
+		logger: logger,
+		queue:  make(chan sink.Event, eventQueueSize),
+		stop:   make(chan struct{}),
+	}
+	if names := splitList(types); len(names) > 0 {
+		p.types = make(map[string]struct{})
+		for _, name := range names {
+			switch name {
+			case sink.EventCallCompleted, sink.EventRTCPReport, sink.EventAlert:
+				p.types[name] = struct{}{}
+			default:
+				return nil, fmt.Errorf("不支持的事件类型：%s", name)
+			}
+		}
+	}
+
+	for _, target := range sinks {
+		spool, err := sink.OpenSpool(filepath.Join(spoolDir, eventSpoolName(target)), spoolMaxBytes)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.workers = append(p.workers, &eventWorker{sink: target, spool: spool})
+	}
+	p.wg.Add(1)
+	go p.spoolEvents()
+	for _, worker := range p.workers {
+		p.wg.Add(1)
+		go p.run(worker)
+	}
+	return p, nil
+}
+
+// NewEventSinks 根据配置创建推送目标
+func NewEventSinks(cfg *config.Config) ([]sink.Sink, error) {
+	var sinks []sink.Sink
+	if cfg.EventKafkaBrokers != "" {
+		kafka, err := sink.NewKafkaSink(cfg.EventKafkaBrokers, cfg.EventKafkaTopic, sink.KafkaSecurity{
+			TLS:           cfg.EventKafkaTLS,
+			SASLMechanism: cfg.EventKafkaSASLMechanism,
+			User:          cfg.EventKafkaUser,
+			Password:      cfg.EventKafkaPassword,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, kafka)
+	}
+	if cfg.EventNATSURL != "" {
+		nats, err := sink.NewNATSSink(cfg.EventNATSURL, cfg.EventNATSSubject)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, nats)
+	}
+	if cfg.EventMQTTURL != "" {
+		mqtt, err := sink.NewMQTTSink(cfg.EventMQTTURL, cfg.EventMQTTTopic)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, mqtt)
+	}
+	if cfg.EventRedisURL != "" {
+		redis, err := sink.NewRedisStreamSink(cfg.EventRedisURL, cfg.EventRedisStream, cfg.EventRedisMaxLen)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, redis)
+	}
+	for _, url := range splitList(cfg.EventWebhookURLs) {
+		sinks = append(sinks, sink.NewWebhookSink(url))
+	}
+	return sinks, nil
+}
+
+// eventSpoolName 缓存目录名，由目标类型和地址决定，调整配置顺序不影响已缓存的事件
+func eventSpoolName(target sink.Sink) string {
+	h := fnv.New32a()
+	h.Write([]byte(target.Endpoint()))
+	return fmt.Sprintf("%s-%08x", target.Name(), h.Sum32())
+}
+
+// OnCallSaved 呼叫入库后推送，作为SaveService的呼叫监听器
+func (p *EventPublisher) OnCallSaved(call *entity.Call) {
+	p.publish(sink.EventCallCompleted, call.SIPCallID, call)
+}
+
+// OnRTCPReport RTCP报告入库后推送，作为SaveService的报告监听器
+func (p *EventPublisher) OnRTCPReport(call *entity.Call, report *entity.RtcpReport) {
+	p.publish(sink.EventRTCPReport, call.SIPCallID, report)
+}
+
+// OnAlert 告警触发或恢复时推送，包括静默期间的告警
+func (p *EventPublisher) OnAlert(history *entity.AlertHistory) {
+	p.publish(sink.EventAlert, fmt.Sprintf("alert-%d", history.RuleID), history)
+}
+
+func (p *EventPublisher) publish(eventType, key string, data any) {
+	if p.types != nil {
+		if _, ok := p.types[eventType]; !ok {
+			return
+		}
+	}
+	event, err := sink.NewEvent(eventType, key, data)
+	if err != nil {
+		p.logger.WithError(err).WithField("type", eventType).Error("事件编码失败")
+		return
+	}
+	// 监听器在SaveService持有缓存锁时调用，队列满时丢弃，不阻塞SIP入库
+	select {
+	case p.queue <- event:
+	default:
+		p.logger.WithField("type", eventType).Error("事件队列已满，丢弃")
+	}
+}
+
+// spoolEvents 按入队顺序将事件写入所有磁盘缓存，队列中已有的事件合并为一批写入，每批同步一次磁盘
+func (p *EventPublisher) spoolEvents() {
+	defer p.wg.Done()
+	for {
+		select {
+		case event := <-p.queue:
+			p.appendSpools(p.collectEvents(event))
+		case <-p.stop:
+			// 停止前把队列中剩余的事件写入磁盘
+			for {
+				select {
+				case event := <-p.queue:
+					p.appendSpools(p.collectEvents(event))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *EventPublisher) collectEvents(first sink.Event) []sink.Event {
+	events := []sink.Event{first}
+	for len(events) < eventSpoolBatch {
+		select {
+		case event := <-p.queue:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+	return events
+}
+
+func (p *EventPublisher) appendSpools(events []sink.Event) {
+	for _, worker := range p.workers {
+		if err := worker.spool.Append(events); err != nil {
+			p.logger.WithError(err).WithFields(logrus.Fields{
+				"sink":     worker.sink.Name(),
+				"endpoint": worker.sink.Endpoint(),
+				"count":    len(events),
+			}).Error("事件写入磁盘缓存失败，丢弃")
+		}
+	}
+}
+
+func (p *EventPublisher) run(worker *eventWorker) {
+	defer p.wg.Done()
+	logger := p.logger.WithFields(logrus.Fields{
+		"sink":     worker.sink.Name(),
+		"endpoint": worker.sink.Endpoint(),
+	})
+	delay := eventRetryMinDelay
+	for {
+		events, next, err := worker.spool.Read(eventPublishBatch)
+		if err != nil {
+			logger.WithError(err).Error("读取事件磁盘缓存失败")
+			if !p.sleep(delay) {
+				return
+			}
+			continue
+		}
+		if len(events) == 0 {
+			select {
+			case <-worker.spool.Notify():
+				continue
+			case <-p.stop:
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+		err = worker.sink.Publish(ctx, events)
+		cancel()
+		if err != nil {
+			logger.WithError(err).WithFields(logrus.Fields{
+				"count":   len(events),
+				"pending": worker.spool.Pending(),
+				"retry":   delay.String(),
+			}).Warn("推送事件失败，稍后重试")
+			if !p.sleep(delay) {
+				return
+			}
+			delay = min(delay*2, eventRetryMaxDelay)
+			continue
+		}
+		if delay > eventRetryMinDelay {
+			logger.Info("推送事件恢复")
+			delay = eventRetryMinDelay
+		}
+
+		if err := worker.spool.Commit(next); err != nil {
+			logger.WithError(err).Error("保存事件缓存位置失败")
+		}
+	}
+}
+
+// sleep 等待重试，停止时返回false
+func (p *EventPublisher) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// Close 将队列中的事件写入磁盘后停止发送并关闭缓存和连接，未发送的事件留在磁盘上，下次启动后继续发送
+func (p *EventPublisher) Close() error {
+	close(p.stop)
+	p.wg.Wait()
+	var errs []error
+	for _, worker := range p.workers {
+		errs = append(errs, worker.spool.Close(), worker.sink.Close())
+	}
+	return errors.Join(errs...)
+}
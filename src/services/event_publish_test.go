@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/pkg/sink"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 前failures次发送失败的推送目标
+type flakySink struct {
+	mu        sync.Mutex
+	failures  int
+	attempts  int
+	delivered []sink.Event
+	done      chan struct{}
+	want      int
+}
+
+func (s *flakySink) Name() string     { return "flaky" }
+func (s *flakySink) Endpoint() string { return "test" }
+func (s *flakySink) Close() error     { return nil }
+
+func (s *flakySink) Publish(ctx context.Context, events []sink.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.attempts <= s.failures {
+		return errors.New("连接被拒绝")
+	}
+	s.delivered = append(s.delivered, events...)
+	if len(s.delivered) >= s.want && s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	return nil
+}
+
+func (s *flakySink) wait(t *testing.T) []sink.Event {
+	t.Helper()
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("事件未送达")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sink.Event(nil), s.delivered...)
+}
+
+func TestEventPublisher_RetryUntilDelivered(t *testing.T) {
+	target := &flakySink{failures: 1, want: 2, done: make(chan struct{})}
+	p, err := NewEventPublisher(logrus.New(), []sink.Sink{target}, "call.completed, alert", t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.OnCallSaved(&entity.Call{SIPCallID: "abc@10.0.0.1", HangupCode: 200})
+	// 未选择的事件类型不推送
+	p.OnRTCPReport(&entity.Call{SIPCallID: "abc@10.0.0.1"}, &entity.RtcpReport{AlegMos: 4.1})
+	p.OnAlert(&entity.AlertHistory{RuleID: 3, State: entity.AlertStateFiring})
+
+	delivered := target.wait(t)
+	if len(delivered) != 2 {
+		t.Fatalf("应送达2个事件，得到%+v", delivered)
+	}
+	if delivered[0].Type != sink.EventCallCompleted || delivered[0].Key != "abc@10.0.0.1" {
+		t.Errorf("呼叫事件错误：%+v", delivered[0])
+	}
+	if delivered[1].Type != sink.EventAlert || delivered[1].Key != "alert-3" {
+		t.Errorf("告警事件错误：%+v", delivered[1])
+	}
+	if target.attempts < 2 {
+		t.Errorf("失败后应重试，共发送%d次", target.attempts)
+	}
+}
+
+func TestEventPublisher_SpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	down := &flakySink{failures: 1 << 30}
+	p, err := NewEventPublisher(logrus.New(), []sink.Sink{down}, "", dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.OnCallSaved(&entity.Call{SIPCallID: "a"})
+	p.OnCallSaved(&entity.Call{SIPCallID: "b"})
+	p.Close()
+
+	// 目标恢复后，重启前缓存的事件继续发送
+	up := &flakySink{want: 2, done: make(chan struct{})}
+	p, err = NewEventPublisher(logrus.New(), []sink.Sink{up}, "", dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	delivered := up.wait(t)
+	if len(delivered) != 2 || delivered[0].Key != "a" || delivered[1].Key != "b" {
+		t.Errorf("缓存的事件错误：%+v", delivered)
+	}
+}
+
+func TestNewEventPublisher_InvalidType(t *testing.T) {
+	if _, err := NewEventPublisher(logrus.New(), nil, "call.completed,cdr", t.TempDir(), 0); err == nil {
+		t.Error("不支持的事件类型应返回错误")
+	}
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// IngestFilter 入库前的过滤：REGISTER、NOTIFY和配置DiscardMethods丢弃的方法，以及数据库中的过滤规则，
+// 规则通过接口修改后调用Reload立即生效
+type IngestFilter struct {
+	logger     *logrus.Logger
+	repository model.Repository
+
+	mu             sync.RWMutex
+	discardMethods map[string]struct{}
+	rules          []*filterRule
+}
+
+// 编译后的过滤规则
+type filterRule struct {
+	rule entity.FilterRule
+
+	methods       map[string]struct{}
+	responseCodes []string
+	srcNets       []*net.IPNet
+	dstNets       []*net.IPNet
+	userAgent     *regexp.Regexp
+	nodeIDs       map[string]struct{}
+}
+
+func NewIngestFilter(logger *logrus.Logger, repository model.Repository, discardMethods string) *IngestFilter {
+	f := &IngestFilter{
+		logger:         logger,
+		repository:     repository,
+		discardMethods: discardMethodSet(discardMethods),
+	}
+	if err := f.Reload(); err != nil {
+		logger.WithError(err).Error("加载入库过滤规则失败")
+	}
+	return f
+}
+
+// Reload 从数据库重新加载过滤规则，无效的规则跳过
+func (f *IngestFilter) Reload() error {
+	rules, err := f.repository.FilterRuleList()
+	if err != nil {
+		return err
+	}
+
+	compiled := make([]*filterRule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		c, err := compileFilterRule(rule)
+		if err != nil {
+			f.logger.WithError(err).WithField("rule_id", rule.ID).Warn("入库过滤规则无效，已跳过")
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+
+	f.mu.Lock()
+	f.rules = compiled
+	f.mu.Unlock()
+	return nil
+}
+
+// Evaluate 返回消息命中的动作，未命中时返回空字符串
+func (f *IngestFilter) Evaluate(item *entity.SIP) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if _, ok := f.discardMethods[item.CSeqMethod]; ok {
+		return entity.FilterActionDrop
+	}
+
+	for _, rule := range f.rules {
+		if !rule.match(item) {
+			continue
+		}
+		if rule.rule.Action == entity.FilterActionSample {
+			// 按Call-ID采样，同一个呼叫的消息要么全部保留要么全部丢弃
+			if sampleBucket(item.CallID) < rule.rule.SampleRate {
+				return ""
+			}
+			return entity.FilterActionDrop
+		}
+		return rule.rule.Action
+	}
+	return ""
+}
+
+// ValidateFilterRule 检查规则的动作、网段和正则是否有效
+func ValidateFilterRule(rule entity.FilterRule) error {
+	_, err := compileFilterRule(rule)
+	return err
+}
+
+func compileFilterRule(rule entity.FilterRule) (*filterRule, error) {
+	switch rule.Action {
+	case entity.FilterActionDrop, entity.FilterActionMetadata:
+	case entity.FilterActionSample:
+		if rule.SampleRate < 0 || rule.SampleRate > 100 {
+			return nil, fmt.Errorf("采样比例必须在0-100之间: %d", rule.SampleRate)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的动作: %s", rule.Action)
+	}
+
+	c := &filterRule{
+		rule:          rule,
+		methods:       splitUpperSet(rule.Methods),
+		responseCodes: splitList(strings.ToLower(rule.ResponseCodes)),
+		nodeIDs:       make(map[string]struct{}),
+	}
+	for _, nodeID := range splitList(rule.NodeID) {
+		c.nodeIDs[nodeID] = struct{}{}
+	}
+
+	var err error
+	if c.srcNets, err = parseCIDRs(rule.SrcCIDR); err != nil {
+		return nil, err
+	}
+	if c.dstNets, err = parseCIDRs(rule.DstCIDR); err != nil {
+		return nil, err
+	}
+	if rule.UserAgent != "" {
+		if c.userAgent, err = regexp.Compile(rule.UserAgent); err != nil {
+			return nil, fmt.Errorf("User-Agent正则无效: %w", err)
+		}
+	}
+	if _, err = path.Match(rule.FromUser, ""); err != nil {
+		return nil, fmt.Errorf("主叫匹配格式无效: %w", err)
+	}
+	if _, err = path.Match(rule.ToUser, ""); err != nil {
+		return nil, fmt.Errorf("被叫匹配格式无效: %w", err)
+	}
+	return c, nil
+}
+
+func (r *filterRule) match(item *entity.SIP) bool {
+	if len(r.methods) > 0 {
+		if _, ok := r.methods[item.CSeqMethod]; !ok {
+			return false
+		}
+	}
+	if len(r.responseCodes) > 0 && !matchResponseCode(r.responseCodes, item.ResponseCode) {
+		return false
+	}
+	if len(r.srcNets) > 0 && !containsAddr(r.srcNets, item.SrcAddr) {
+		return false
+	}
+	if len(r.dstNets) > 0 && !containsAddr(r.dstNets, item.DstAddr) {
+		return false
+	}
+	if r.userAgent != nil && !r.userAgent.MatchString(item.UserAgent) {
+		return false
+	}
+	if r.rule.FromUser != "" {
+		if ok, _ := path.Match(r.rule.FromUser, item.FromUser); !ok {
+			return false
+		}
+	}
+	if r.rule.ToUser != "" {
+		if ok, _ := path.Match(r.rule.ToUser, item.ToUser); !ok {
+			return false
+		}
+	}
+	if len(r.nodeIDs) > 0 {
+		if _, ok := r.nodeIDs[item.NodeID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchResponseCode 匹配响应码，支持 486 和 4xx 两种形式，请求消息的响应码为0不会命中
+func matchResponseCode(codes []string, code int) bool {
+	if code <= 0 {
+		return false
+	}
+	value := strconv.Itoa(code)
+	for _, pattern := range codes {
+		if pattern == value {
+			return true
+		}
+		if len(pattern) == 3 && strings.HasSuffix(pattern, "xx") && pattern[0] == value[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAddr 判断 ip:port 是否在网段中
+func containsAddr(nets []*net.IPNet, addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDRs 解析逗号分隔的网段，单个IP按/32或/128处理
+func parseCIDRs(value string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的IP: %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段: %s", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// sampleBucket 把Call-ID映射到0-99
+func sampleBucket(callID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(callID))
+	return int(h.Sum32() % 100)
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// 注册和通知消息始终不入库，DiscardMethods只能在此之外增加丢弃的方法
+var implicitDiscardMethods = []string{"REGISTER", "NOTIFY"}
+
+func discardMethodSet(value string) map[string]struct{} {
+	out := splitUpperSet(value)
+	for _, method := range implicitDiscardMethods {
+		out[method] = struct{}{}
+	}
+	return out
+}
+
+func splitUpperSet(value string) map[string]struct{} {
+	out := make(map[string]struct{})
+	for _, item := range splitList(value) {
+		out[strings.ToUpper(item)] = struct{}{}
+	}
+	return out
+}
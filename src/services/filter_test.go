@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+
+	"sip-monitor/src/entity"
+)
+
+func newTestIngestFilter(t *testing.T, discardMethods string, rules ...entity.FilterRule) *IngestFilter {
+	f := &IngestFilter{discardMethods: discardMethodSet(discardMethods)}
+	for _, rule := range rules {
+		c, err := compileFilterRule(rule)
+		if err != nil {
+			t.Fatalf("规则编译失败: %v", err)
+		}
+		f.rules = append(f.rules, c)
+	}
+	return f
+}
+
+func TestIngestFilter_DiscardMethods(t *testing.T) {
+	f := newTestIngestFilter(t, "options, register")
+
+	if action := f.Evaluate(&entity.SIP{CSeqMethod: "OPTIONS", Title: "200"}); action != entity.FilterActionDrop {
+		t.Errorf("OPTIONS应被丢弃，得到'%s'", action)
+	}
+	if action := f.Evaluate(&entity.SIP{CSeqMethod: "REGISTER"}); action != entity.FilterActionDrop {
+		t.Errorf("REGISTER应被丢弃，得到'%s'", action)
+	}
+	if action := f.Evaluate(&entity.SIP{CSeqMethod: "INVITE"}); action != "" {
+		t.Errorf("INVITE不应命中，得到'%s'", action)
+	}
+
+	// 只配置OPTIONS时REGISTER和NOTIFY仍然丢弃
+	f = newTestIngestFilter(t, "OPTIONS")
+	for _, method := range []string{"OPTIONS", "REGISTER", "NOTIFY"} {
+		if action := f.Evaluate(&entity.SIP{CSeqMethod: method}); action != entity.FilterActionDrop {
+			t.Errorf("%s应被丢弃，得到'%s'", method, action)
+		}
+	}
+}
+
+func TestIngestFilter_Rules(t *testing.T) {
+	f := newTestIngestFilter(t, "",
+		entity.FilterRule{ID: 1, Methods: "INVITE", ResponseCodes: "4xx,503", SrcCIDR: "10.0.0.0/8", Action: entity.FilterActionMetadata},
+		entity.FilterRule{ID: 2, UserAgent: "(?i)friendly-scanner|sipvicious", Action: entity.FilterActionDrop},
+		entity.FilterRule{ID: 3, FromUser: "400*", NodeID: "2001", Action: entity.FilterActionDrop},
+		entity.FilterRule{ID: 4, DstCIDR: "192.168.1.10", Action: entity.FilterActionSample, SampleRate: 0},
+	)
+
+	cases := []struct {
+		name string
+		item entity.SIP
+		want string
+	}{
+		{"响应码和网段命中", entity.SIP{CSeqMethod: "INVITE", ResponseCode: 486, SrcAddr: "10.1.2.3:5060"}, entity.FilterActionMetadata},
+		{"响应码未命中", entity.SIP{CSeqMethod: "INVITE", ResponseCode: 200, SrcAddr: "10.1.2.3:5060"}, ""},
+		{"网段未命中", entity.SIP{CSeqMethod: "INVITE", ResponseCode: 503, SrcAddr: "172.16.0.1:5060"}, ""},
+		{"User-Agent正则", entity.SIP{CSeqMethod: "OPTIONS", UserAgent: "Friendly-Scanner"}, entity.FilterActionDrop},
+		{"主叫通配符和节点", entity.SIP{CSeqMethod: "INVITE", FromUser: "4008001234", NodeID: "2001"}, entity.FilterActionDrop},
+		{"节点未命中", entity.SIP{CSeqMethod: "INVITE", FromUser: "4008001234", NodeID: "2002"}, ""},
+		{"采样0%全部丢弃", entity.SIP{CSeqMethod: "BYE", DstAddr: "192.168.1.10:5060"}, entity.FilterActionDrop},
+	}
+	for _, c := range cases {
+		if got := f.Evaluate(&c.item); got != c.want {
+			t.Errorf("%s: 期望'%s'，得到'%s'", c.name, c.want, got)
+		}
+	}
+}
+
+func TestIngestFilter_SampleByCallID(t *testing.T) {
+	f := newTestIngestFilter(t, "", entity.FilterRule{Action: entity.FilterActionSample, SampleRate: 50})
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		callID := "call-" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		first := f.Evaluate(&entity.SIP{CallID: callID, Title: "INVITE"})
+		// 同一个呼叫的所有消息结果一致
+		if second := f.Evaluate(&entity.SIP{CallID: callID, Title: "BYE"}); second != first {
+			t.Fatalf("同一呼叫的采样结果不一致")
+		}
+		if first == "" {
+			kept++
+		}
+	}
+	if kept < 400 || kept > 600 {
+		t.Errorf("50%%采样保留数量异常: %d", kept)
+	}
+}
+
+func TestValidateFilterRule(t *testing.T) {
+	invalid := []entity.FilterRule{
+		{Action: "unknown"},
+		{Action: entity.FilterActionSample, SampleRate: 101},
+		{Action: entity.FilterActionDrop, SrcCIDR: "10.0.0.0/33"},
+		{Action: entity.FilterActionDrop, UserAgent: "("},
+		{Action: entity.FilterActionDrop, ToUser: "["},
+	}
+	for _, rule := range invalid {
+		if ValidateFilterRule(rule) == nil {
+			t.Errorf("规则应无效: %+v", rule)
+		}
+	}
+	if err := ValidateFilterRule(entity.FilterRule{Action: entity.FilterActionDrop, SrcCIDR: "10.0.0.1, 2001:db8::/32"}); err != nil {
+		t.Errorf("规则应有效: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"sip-monitor/src/entity"
+
+	"github.com/sirupsen/logrus"
+)
+
+// gatewayPattern 网关的一条地址规则：IP或CIDR，可选端口或端口范围
+type gatewayPattern struct {
+	prefix  netip.Prefix
+	portMin int // 0表示不限端口
+	portMax int
+}
+
+// parseGatewayPatterns 解析网关的地址规则，每条为IP或CIDR，可选端口或端口范围，如
+// 10.0.0.1、10.0.0.2:5060、10.0.1.0/24:5060-5080、[2001:db8::/32]:5060
+func parseGatewayPatterns(addrs []string) ([]gatewayPattern, error) {
+	patterns := make([]gatewayPattern, 0, len(addrs))
+	for _, item := range addrs {
+		pattern, err := parseGatewayPattern(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func parseGatewayPattern(item string) (gatewayPattern, error) {
+	var pattern gatewayPattern
+	host, ports := item, ""
+	if strings.HasPrefix(item, "[") {
+		end := strings.Index(item, "]")
+		if end == -1 {
+			return pattern, fmt.Errorf("网关地址格式错误: %s", item)
+		}
+		host = item[1:end]
+		if rest := item[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return pattern, fmt.Errorf("网关地址格式错误: %s", item)
+			}
+			ports = rest[1:]
+		}
+	} else if strings.Count(item, ":") == 1 {
+		// 只有一个冒号是IPv4加端口，多个冒号是不带端口的IPv6
+		host, ports, _ = strings.Cut(item, ":")
+	}
+
+	if strings.Contains(host, "/") {
+		prefix, err := netip.ParsePrefix(host)
+		if err != nil {
+			return pattern, fmt.Errorf("网关地址格式错误: %s", item)
+		}
+		pattern.prefix = prefix.Masked()
+	} else {
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			return pattern, fmt.Errorf("网关地址格式错误: %s", item)
+		}
+		ip = ip.Unmap()
+		pattern.prefix = netip.PrefixFrom(ip, ip.BitLen())
+	}
+
+	if ports != "" {
+		minPort, maxPort, isRange := strings.Cut(ports, "-")
+		var err error
+		if pattern.portMin, err = parsePort(minPort); err != nil {
+			return pattern, fmt.Errorf("网关端口格式错误: %s", item)
+		}
+		pattern.portMax = pattern.portMin
+		if isRange {
+			if pattern.portMax, err = parsePort(maxPort); err != nil || pattern.portMax < pattern.portMin {
+				return pattern, fmt.Errorf("网关端口格式错误: %s", item)
+			}
+		}
+	}
+	return pattern, nil
+}
+
+func parsePort(v string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", v)
+	}
+	return port, nil
+}
+
+// ValidateGatewayAddrs 逐条检查网关的地址规则
+func ValidateGatewayAddrs(addrs []string) error {
+	if len(addrs) == 0 {
+		return fmt.Errorf("网关地址不能为空")
+	}
+	for _, addr := range addrs {
+		if utf8.RuneCountInString(addr) > entity.GatewayAddrMaxLen {
+			return fmt.Errorf("网关地址超过%d个字符: %s", entity.GatewayAddrMaxLen, addr)
+		}
+		if _, err := parseGatewayPattern(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p gatewayPattern) match(ip netip.Addr, port int) bool {
+	if !p.prefix.Contains(ip) {
+		return false
+	}
+	return p.portMin == 0 || (port >= p.portMin && port <= p.portMax)
+}
+
+type compiledGateway struct {
+	gateway  entity.Gateway
+	patterns []gatewayPattern
+}
+
+// GatewayResolver 按网关的地址规则匹配呼叫的入口、出口网关，创建后只读，可以并发使用
+type GatewayResolver struct {
+	gateways []compiledGateway
+}
+
+// NewGatewayResolver 地址规则错误的网关会被忽略
+func NewGatewayResolver(gateways []entity.Gateway) *GatewayResolver {
+	r := &GatewayResolver{}
+	for _, gateway := range gateways {
+		patterns, err := parseGatewayPatterns(gateway.Addrs)
+		if err != nil {
+			logrus.WithError(err).WithField("gateway", gateway.Name).Warn("网关地址规则错误，已忽略")
+			continue
+		}
+		r.gateways = append(r.gateways, compiledGateway{gateway: gateway, patterns: patterns})
+	}
+	return r
+}
+
+// Match 返回地址（ip或ip:port）所属的第一个网关，没有时返回nil
+func (r *GatewayResolver) Match(addr string) *entity.Gateway {
+	if r == nil || addr == "" {
+		return nil
+	}
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, portText = strings.Trim(addr, "[]"), ""
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil
+	}
+	ip = ip.Unmap()
+	port, _ := strconv.Atoi(portText)
+
+	for i := range r.gateways {
+		for _, pattern := range r.gateways[i].patterns {
+			if pattern.match(ip, port) {
+				return &r.gateways[i].gateway
+			}
+		}
+	}
+	return nil
+}
+
+// Classify 根据源、目的地址匹配入口和出口网关并判断方向：
+// 目的是网关为呼出，否则来源是网关为呼入，都不是网关为内部呼叫
+func (r *GatewayResolver) Classify(srcAddr, dstAddr string) (ingress, egress *entity.Gateway, direction string) {
+	ingress, egress = r.Match(srcAddr), r.Match(dstAddr)
+	switch {
+	case egress != nil:
+		direction = entity.DirectionOutbound
+	case ingress != nil:
+		direction = entity.DirectionInbound
+	default:
+		direction = entity.DirectionInternal
+	}
+	return ingress, egress, direction
+}
+
+// Primary 返回呼叫统计归属的网关：呼出为出口网关，呼入为入口网关
+func (r *GatewayResolver) Primary(srcAddr, dstAddr string) (*entity.Gateway, string) {
+	ingress, egress, direction := r.Classify(srcAddr, dstAddr)
+	if egress != nil {
+		return egress, direction
+	}
+	return ingress, direction
+}
+
+// Gateways 返回地址规则有效的网关
+func (r *GatewayResolver) Gateways() []entity.Gateway {
+	gateways := make([]entity.Gateway, 0, len(r.gateways))
+	for _, gateway := range r.gateways {
+		gateways = append(gateways, gateway.gateway)
+	}
+	return gateways
+}
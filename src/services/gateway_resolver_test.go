@@ -0,0 +1,75 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"sip-monitor/src/entity"
+)
+
+func TestGatewayResolver_Match(t *testing.T) {
+	resolver := NewGatewayResolver([]entity.Gateway{
+		{ID: 1, Name: "carrier-a", Addrs: []string{"10.0.0.1", "10.0.0.2:5060"}},
+		{ID: 2, Name: "carrier-b", Addrs: []string{"172.16.0.0/16:5060-5080"}},
+		{ID: 3, Name: "carrier-v6", Addrs: []string{"[2001:db8::/32]:5060", "2001:db9::1"}},
+		{ID: 4, Name: "broken", Addrs: []string{"carrier.example.com"}},
+	})
+
+	cases := []struct {
+		addr string
+		id   int64
+	}{
+		{"10.0.0.1:5060", 1},
+		{"10.0.0.1:40000", 1}, // 不限端口
+		{"10.0.0.1", 1},
+		{"10.0.0.2:5060", 1},
+		{"10.0.0.2:5061", 0},
+		{"172.16.9.9:5070", 2},
+		{"172.16.9.9:5081", 0},
+		{"172.17.0.1:5060", 0},
+		{"[2001:db8::10]:5060", 3},
+		{"[2001:db8::10]:5062", 0},
+		{"[2001:db9::1]:5062", 3},
+		{"", 0},
+		{"not-an-ip:5060", 0},
+	}
+	for _, c := range cases {
+		var id int64
+		if gateway := resolver.Match(c.addr); gateway != nil {
+			id = gateway.ID
+		}
+		if id != c.id {
+			t.Errorf("%s 应匹配网关%d，得到%d", c.addr, c.id, id)
+		}
+	}
+	if len(resolver.Gateways()) != 3 {
+		t.Errorf("地址规则错误的网关应被忽略")
+	}
+
+	ingress, egress, direction := resolver.Classify("192.168.1.1:5060", "10.0.0.1:5060")
+	if ingress != nil || egress == nil || egress.ID != 1 || direction != entity.DirectionOutbound {
+		t.Errorf("呼出判断错误: %v %v %s", ingress, egress, direction)
+	}
+	ingress, egress, direction = resolver.Classify("172.16.0.5:5060", "192.168.1.1:5060")
+	if ingress == nil || ingress.ID != 2 || egress != nil || direction != entity.DirectionInbound {
+		t.Errorf("呼入判断错误: %v %v %s", ingress, egress, direction)
+	}
+	if _, _, direction = resolver.Classify("192.168.1.1:5060", "192.168.1.2:5060"); direction != entity.DirectionInternal {
+		t.Errorf("内部呼叫判断错误: %s", direction)
+	}
+}
+
+func TestValidateGatewayAddrs(t *testing.T) {
+	for _, addrs := range [][]string{{"10.0.0.1"}, {"10.0.0.0/8:5060"}, {"10.0.0.1:5060-5080", "[::1]:5060"}, {"2001:db8::1"}} {
+		if err := ValidateGatewayAddrs(addrs); err != nil {
+			t.Errorf("%v 应合法: %v", addrs, err)
+		}
+	}
+	long := "[2001:db8::1%" + strings.Repeat("x", 60) + "]"
+	for _, addrs := range [][]string{nil, {""}, {"10.0.0.1, 10.0.0.2"}, {"10.0.0.1", "10.0.0.300"}, {"10.0.0.1:70000"},
+		{"10.0.0.1:5080-5060"}, {"10.0.0.0/33"}, {"[::1"}, {"host.example.com"}, {long}} {
+		if err := ValidateGatewayAddrs(addrs); err == nil {
+			t.Errorf("%v 应不合法", addrs)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sip-monitor/src/pkg/hep"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// 每个上游的发送队列长度，队列满时丢弃
+	hepRelayQueueSize = 10000
+	// TCP连接断开后重连的最小间隔，期间的消息丢弃
+	hepRelayRedialGap = 5 * time.Second
+	hepRelayWriteTime = 3 * time.Second
+	// 丢弃统计的日志间隔
+	hepRelayStatGap = time.Minute
+)
+
+// HepForwarder 接收到的HEP消息的转发，在解析SIP之前调用
+type HepForwarder interface {
+	Forward(nodeIP string, msg *hep.HepMsg)
+}
+
+// HepRelay 将接收到的HEP消息重新编码为HEP3，转发到一个或多个上游采集器（Homer、其他sip-monitor）。
+// 转发是尽力而为的：上游不可用或超过速率限制时丢弃并计数，不影响本地入库
+type HepRelay struct {
+	logger  *logrus.Logger
+	targets []*hepRelayTarget
+}
+
+// 一个上游采集器及其过滤条件
+type hepRelayTarget struct {
+	network   string // udp/tcp
+	addr      string
+	captureID uint32 // 非0时替换采集节点ID
+	authKey   string // 替换认证密钥，为空时不带密钥
+
+	types          map[byte]struct{}   // 协议类型，为空时全部转发
+	methods        map[string]struct{} // 只转发这些CSeq方法的SIP消息
+	excludeMethods map[string]struct{}
+	nodes          map[string]struct{} // 只转发这些采集节点IP的消息
+
+	limiter *rateLimiter
+	queue   chan []byte
+	dropped atomic.Uint64
+}
+
+var hepRelayTypes = map[string]byte{
+	"sip":  hep.ProtocolTypeSIP,
+	"rtcp": hep.ProtocolTypeRTCP,
+	"rtp":  hep.ProtocolTypeRTP,
+	"sdp":  hep.ProtocolTypeSDP,
+}
+
+// NewHepRelay targets为分号分隔的上游地址，每个地址的参数用URL查询串表示，如：
+//
+//	udp://homer:9060?capture_id=2001&auth_key=secret&rate=1000&types=sip,rtcp&exclude_methods=OPTIONS;tcp://10.0.0.9:9061?nodes=10.1.1.1
+//
+// rate为每秒最多转发的消息数，methods/exclude_methods按CSeq方法过滤SIP消息，nodes按采集节点IP过滤
+func NewHepRelay(logger *logrus.Logger, targets string) (*HepRelay, error) {
+	r := &HepRelay{logger: logger}
+	for _, spec := range strings.Split(targets, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		target, err := parseHepRelayTarget(spec)
+		if err != nil {
+			return nil, err
+		}
+		r.targets = append(r.targets, target)
+	}
+	for _, target := range r.targets {
+		go r.send(target)
+	}
+	if len(r.targets) > 0 {
+		go r.logDropped()
+	}
+	return r, nil
+}
+
+func parseHepRelayTarget(spec string) (*hepRelayTarget, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("HEP转发地址格式错误：%s", spec)
+	}
+	if (u.Scheme != "udp" && u.Scheme != "tcp") || u.Port() == "" {
+		return nil, fmt.Errorf("HEP转发地址格式错误，应为 udp://host:port 或 tcp://host:port：%s", spec)
+	}
+	query := u.Query()
+	target := &hepRelayTarget{
+		network:        u.Scheme,
+		addr:           u.Host,
+		authKey:        query.Get("auth_key"),
+		methods:        splitUpperSet(query.Get("methods")),
+		excludeMethods: splitUpperSet(query.Get("exclude_methods")),
+		nodes:          make(map[string]struct{}),
+		queue:          make(chan []byte, hepRelayQueueSize),
+	}
+	if value := query.Get("capture_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("HEP转发capture_id错误：%s", value)
+		}
+		target.captureID = uint32(id)
+	}
+	if value := query.Get("rate"); value != "" {
+		rate, err := strconv.Atoi(value)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("HEP转发rate错误：%s", value)
+		}
+		if rate > 0 {
+			target.limiter = newRateLimiter(rate)
+		}
+	}
+	if names := splitList(query.Get("types")); len(names) > 0 {
+		target.types = make(map[byte]struct{})
+		for _, name := range names {
+			protocolType, ok := hepRelayTypes[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("HEP转发types不支持：%s", name)
+			}
+			target.types[protocolType] = struct{}{}
+		}
+	}
+	for _, node := range splitList(query.Get("nodes")) {
+		target.nodes[node] = struct{}{}
+	}
+	return target, nil
+}
+
+// Forward 按各上游的过滤条件和速率限制放入发送队列，不阻塞接收
+func (r *HepRelay) Forward(nodeIP string, msg *hep.HepMsg) {
+	var method string
+	for _, target := range r.targets {
+		if !target.match(nodeIP, msg, &method) {
+			continue
+		}
+		if target.limiter != nil && !target.limiter.Allow(time.Now()) {
+			target.dropped.Add(1)
+			continue
+		}
+
+		relayed := *msg
+		if target.captureID != 0 {
+			relayed.CaptureAgentID = target.captureID
+		}
+		relayed.AuthenticateKey = target.authKey
+		select {
+		case target.queue <- hep.Encode(&relayed):
+		default:
+			target.dropped.Add(1)
+		}
+	}
+}
+
+// match method在第一次需要时从SIP消息中取出，多个上游共用
+func (t *hepRelayTarget) match(nodeIP string, msg *hep.HepMsg, method *string) bool {
+	if len(t.nodes) > 0 {
+		if _, ok := t.nodes[nodeIP]; !ok {
+			return false
+		}
+	}
+	if len(t.types) > 0 {
+		if _, ok := t.types[msg.ProtocolType]; !ok {
+			return false
+		}
+	}
+	if msg.ProtocolType != hep.ProtocolTypeSIP || (len(t.methods) == 0 && len(t.excludeMethods) == 0) {
+		return true
+	}
+	if *method == "" {
+		*method = sipCSeqMethod(msg.Body)
+	}
+	if len(t.methods) > 0 {
+		if _, ok := t.methods[*method]; !ok {
+			return false
+		}
+	}
+	_, excluded := t.excludeMethods[*method]
+	return !excluded
+}
+
+func (r *HepRelay) send(target *hepRelayTarget) {
+	logger := r.logger.WithField("upstream", target.network+"://"+target.addr)
+	var conn net.Conn
+	var lastDial time.Time
+	for packet := range target.queue {
+		if conn == nil {
+			if time.Since(lastDial) < hepRelayRedialGap {
+				target.dropped.Add(1)
+				continue
+			}
+			lastDial = time.Now()
+			var err error
+			conn, err = net.DialTimeout(target.network, target.addr, hepRelayWriteTime)
+			if err != nil {
+				logger.WithError(err).Warn("连接HEP上游失败")
+				target.dropped.Add(1)
+				continue
+			}
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(hepRelayWriteTime))
+		if _, err := conn.Write(packet); err != nil {
+			target.dropped.Add(1)
+			// UDP的写错误（如ICMP不可达）不需要重连
+			if target.network == "tcp" {
+				logger.WithError(err).Warn("发送HEP到上游失败，断开重连")
+				_ = conn.Close()
+				conn = nil
+			}
+		}
+	}
+}
+
+func (r *HepRelay) logDropped() {
+	ticker := time.NewTicker(hepRelayStatGap)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, target := range r.targets {
+			if dropped := target.dropped.Swap(0); dropped > 0 {
+				r.logger.WithFields(logrus.Fields{
+					"upstream": target.network + "://" + target.addr,
+					"dropped":  dropped,
+				}).Warn("HEP转发丢弃消息")
+			}
+		}
+	}
+}
+
+// sipCSeqMethod 取SIP消息CSeq头中的方法，取不到时返回空字符串
+func sipCSeqMethod(body []byte) string {
+	for len(body) > 0 {
+		line := body
+		if i := bytes.IndexByte(body, '\n'); i >= 0 {
+			line, body = body[:i], body[i+1:]
+		} else {
+			body = nil
+		}
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			// 头部结束
+			break
+		}
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok || !strings.EqualFold(string(bytes.TrimSpace(name)), "CSeq") {
+			continue
+		}
+		fields := strings.Fields(string(value))
+		if len(fields) == 2 {
+			return strings.ToUpper(fields[1])
+		}
+		return ""
+	}
+	return ""
+}
+
+// rateLimiter 令牌桶，每秒补充rate个令牌，最多积累rate个
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int) *rateLimiter {
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate)}
+}
+
+func (l *rateLimiter) Allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"sip-monitor/src/pkg/hep"
+
+	"github.com/sirupsen/logrus"
+)
+
+func relaySIP(method string) *hep.HepMsg {
+	body := method + " sip:1002@10.0.0.2 SIP/2.0\r\nCall-ID: a@10.0.0.1\r\nCSeq: 1 " + method + "\r\n\r\n"
+	return &hep.HepMsg{
+		IPProtocolID:          17,
+		IP4SourceAddress:      "10.0.0.1",
+		IP4DestinationAddress: "10.0.0.2",
+		SourcePort:            5060,
+		DestinationPort:       5060,
+		ProtocolType:          hep.ProtocolTypeSIP,
+		CaptureAgentID:        1,
+		AuthenticateKey:       "local-key",
+		Body:                  []byte(body),
+	}
+}
+
+func readRelayed(t *testing.T, conn *net.UDPConn) *hep.HepMsg {
+	t.Helper()
+	buf := make([]byte, 65535)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("未收到转发的消息：%v", err)
+	}
+	msg, err := hep.NewHepMsg(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestHepRelay_UDPFiltersAndRewrite(t *testing.T) {
+	upstream, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+
+	relay, err := NewHepRelay(logrus.New(), "udp://"+upstream.LocalAddr().String()+
+		"?capture_id=2001&auth_key=central&types=sip&exclude_methods=options&nodes=192.168.1.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relay.Forward("192.168.1.10", relaySIP("OPTIONS"))
+	relay.Forward("192.168.1.11", relaySIP("INVITE"))
+	relay.Forward("192.168.1.10", &hep.HepMsg{ProtocolType: hep.ProtocolTypeRTCP, Body: []byte{0x80, 0xc8}})
+	relay.Forward("192.168.1.10", relaySIP("INVITE"))
+
+	// 只有最后一条符合条件
+	msg := readRelayed(t, upstream)
+	if sipCSeqMethod(msg.Body) != "INVITE" || msg.CaptureAgentID != 2001 || msg.AuthenticateKey != "central" {
+		t.Errorf("转发的消息错误：%+v", msg)
+	}
+	if msg.IP4SourceAddress != "10.0.0.1" || msg.DestinationPort != 5060 {
+		t.Errorf("地址应保持不变：%+v", msg)
+	}
+	_ = upstream.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, err := upstream.Read(make([]byte, 65535)); err == nil {
+		t.Errorf("不应再收到消息，收到%d字节", n)
+	}
+}
+
+func TestHepRelay_TCPRateLimit(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan *hep.HepMsg, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		// TCP上的HEP3包按包头中的长度分帧
+		for {
+			header := make([]byte, 6)
+			if _, err := io.ReadFull(reader, header); err != nil {
+				return
+			}
+			packet := make([]byte, binary.BigEndian.Uint16(header[4:]))
+			copy(packet, header)
+			if _, err := io.ReadFull(reader, packet[6:]); err != nil {
+				return
+			}
+			msg, _ := hep.NewHepMsg(packet)
+			received <- msg
+		}
+	}()
+
+	relay, err := NewHepRelay(logrus.New(), " ; tcp://"+listener.Addr().String()+"?rate=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		relay.Forward("192.168.1.10", relaySIP("INVITE"))
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			// 未配置auth_key时不带本地的密钥
+			if msg.AuthenticateKey != "" || msg.CaptureAgentID != 1 {
+				t.Errorf("转发的消息错误：%+v", msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("未收到转发的消息")
+		}
+	}
+	select {
+	case <-received:
+		t.Error("超过速率限制的消息应丢弃")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if dropped := relay.targets[0].dropped.Load(); dropped != 3 {
+		t.Errorf("应丢弃3条，得到%d", dropped)
+	}
+}
+
+func TestNewHepRelay_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"http://homer:9060",
+		"udp://homer",
+		"udp://homer:9060?rate=fast",
+		"udp://homer:9060?capture_id=-1",
+		"udp://homer:9060?types=sip,isup",
+	} {
+		if _, err := NewHepRelay(logrus.New(), spec); err == nil {
+			t.Errorf("%s 应返回错误", spec)
+		}
+	}
+}
+
+func TestSipCSeqMethod(t *testing.T) {
+	cases := map[string]string{
+		"SIP/2.0 200 OK\r\nVia: SIP/2.0/UDP 10.0.0.1\r\ncseq : 102 invite\r\n\r\n": "INVITE",
+		"BYE sip:a@b SIP/2.0\nCSeq: 3 BYE\n\n":                                     "BYE",
+		"INVITE sip:a@b SIP/2.0\r\n\r\nCSeq: 1 INVITE\r\n":                         "",
+	}
+	for body, want := range cases {
+		if got := sipCSeqMethod([]byte(body)); got != want {
+			t.Errorf("%q 得到%q，期望%q", body, got, want)
+		}
+	}
+}
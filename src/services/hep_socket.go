@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"sip-monitor/src/entity"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// 读取socket连续出错时的退避间隔，指数增长到上限
+const (
+	hepReadErrorMinDelay = time.Millisecond
+	hepReadErrorMaxDelay = time.Second
+)
+
+// batchReader ipv4和ipv6的PacketConn都支持批量读取，Linux下为recvmmsg，其他系统每次读一个包
+type batchReader interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// hepSocket 一个HEP接收socket，Linux下多个socket通过SO_REUSEPORT绑定同一端口，由内核按来源分配
+type hepSocket struct {
+	conn   *net.UDPConn
+	reader batchReader
+	// 内核因接收缓冲区满丢弃的包数（SO_RXQ_OVFL），内核在每个包上带的是累计值
+	drops atomic.Uint64
+}
+
+// listenHepSockets 打开count个socket。端口为0时后续socket绑定第一个socket分配到的端口
+func listenHepSockets(port, count, receiveBuffer int) ([]*hepSocket, error) {
+	listenConfig := hepListenConfig()
+	sockets := make([]*hepSocket, 0, count)
+	address := ":" + strconv.Itoa(port)
+	for i := 0; i < count; i++ {
+		packetConn, err := listenConfig.ListenPacket(context.Background(), "udp", address)
+		if err != nil {
+			closeHepSockets(sockets)
+			return nil, err
+		}
+		conn := packetConn.(*net.UDPConn)
+		if receiveBuffer > 0 {
+			if err := setReceiveBuffer(conn, receiveBuffer); err != nil {
+				conn.Close()
+				closeHepSockets(sockets)
+				return nil, err
+			}
+		}
+		local := conn.LocalAddr().(*net.UDPAddr)
+		address = ":" + strconv.Itoa(local.Port)
+
+		socket := &hepSocket{conn: conn}
+		if local.IP.To4() != nil {
+			socket.reader = ipv4.NewPacketConn(conn)
+		} else {
+			socket.reader = ipv6.NewPacketConn(conn)
+		}
+		sockets = append(sockets, socket)
+	}
+	return sockets, nil
+}
+
+func closeHepSockets(sockets []*hepSocket) {
+	for _, socket := range sockets {
+		socket.conn.Close()
+	}
+}
+
+// readHepSocket 批量读取socket上的包，读到的buffer交给handle，handle负责归还到pool。
+// socket关闭后返回nil
+func (h *HepServer) readHepSocket(socket *hepSocket, handle func(buf *[]byte, n int, ip string)) error {
+	batch := max(h.cfg.UDPBatchSize, 1)
+	messages := make([]ipv4.Message, batch)
+	buffers := make([]*[]byte, batch)
+	for i := range messages {
+		buffers[i] = h.buffers.Get().(*[]byte)
+		messages[i].Buffers = [][]byte{*buffers[i]}
+		if hepSocketOOBSize > 0 {
+			messages[i].OOB = make([]byte, hepSocketOOBSize)
+		}
+	}
+	defer func() {
+		for _, buf := range buffers {
+			h.buffers.Put(buf)
+		}
+	}()
+
+	var delay time.Duration
+	for {
+		n, err := socket.reader.ReadBatch(messages, 0)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			h.readErrors.Add(1)
+			// 连续出错时退避，避免持续的错误占满CPU和日志；日志只在开始出错和退避到上限后每次记录
+			if delay == 0 {
+				delay = hepReadErrorMinDelay
+			} else {
+				delay = min(delay*2, hepReadErrorMaxDelay)
+			}
+			if delay == hepReadErrorMinDelay || delay == hepReadErrorMaxDelay {
+				h.logger.WithError(err).WithField("read_errors", h.readErrors.Load()).Error("read udp error")
+			}
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		for i := 0; i < n; i++ {
+			message := &messages[i]
+			if drops, ok := parseSocketDrops(message.OOB[:message.NN]); ok {
+				socket.drops.Store(uint64(drops))
+			}
+			h.received.Add(1)
+
+			var ip string
+			if addr, ok := message.Addr.(*net.UDPAddr); ok {
+				ip = addr.IP.String()
+			}
+			if message.N < entity.MinRawPacketLength {
+				h.shortPackets.Add(1)
+				h.logger.WithFields(logrus.Fields{
+					"setting_length":  entity.MinRawPacketLength,
+					"received_length": message.N,
+					"remote_addr":     ip,
+				}).Warn("HepServerListener less then MinRawPacketLength")
+				continue
+			}
+
+			// 读到数据的buffer交给handle，换一个新的继续读
+			handle(buffers[i], message.N, ip)
+			buffers[i] = h.buffers.Get().(*[]byte)
+			message.Buffers[0] = *buffers[i]
+		}
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package services
+
+import (
+	"encoding/binary"
+	"net"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// 每个包的控制消息只有SO_RXQ_OVFL的4字节计数
+var hepSocketOOBSize = unix.CmsgSpace(4)
+
+// hepSocketCount 0为CPU核数
+func hepSocketCount(readers int) int {
+	if readers <= 0 {
+		return runtime.NumCPU()
+	}
+	return readers
+}
+
+// hepListenConfig 绑定前开启SO_REUSEPORT，并开启SO_RXQ_OVFL获取内核的丢包计数
+func hepListenConfig() net.ListenConfig {
+	return net.ListenConfig{
+		Control: func(network, address string, conn syscall.RawConn) error {
+			var sockErr error
+			err := conn.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+				if sockErr == nil {
+					// 内核不支持时只是没有丢包计数
+					_ = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RXQ_OVFL, 1)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+}
+
+// setReceiveBuffer 先用SO_RCVBUFFORCE突破net.core.rmem_max（需要CAP_NET_ADMIN），失败时用SO_RCVBUF
+func setReceiveBuffer(conn *net.UDPConn, size int) error {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		if unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, size) != nil {
+			sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF, size)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// receiveBufferSize 内核实际使用的接收缓冲区大小（内核会将设置值翻倍）
+func receiveBufferSize(conn *net.UDPConn) int {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	var size int
+	_ = rawConn.Control(func(fd uintptr) {
+		size, _ = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+	})
+	return size
+}
+
+// parseSocketDrops 从控制消息中取出SO_RXQ_OVFL的累计丢包数
+func parseSocketDrops(oob []byte) (uint32, bool) {
+	if len(oob) == 0 {
+		return 0, false
+	}
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, false
+	}
+	for _, message := range messages {
+		if message.Header.Level == unix.SOL_SOCKET && message.Header.Type == unix.SO_RXQ_OVFL && len(message.Data) >= 4 {
+			return binary.NativeEndian.Uint32(message.Data), true
+		}
+	}
+	return 0, false
+}
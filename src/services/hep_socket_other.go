@@ -0,0 +1,32 @@
+//go:build !linux
+
+package services
+
+import (
+	"net"
+)
+
+// 其他系统不读取控制消息
+var hepSocketOOBSize = 0
+
+// hepSocketCount 没有SO_REUSEPORT的负载分配，只用一个socket
+func hepSocketCount(readers int) int {
+	return 1
+}
+
+func hepListenConfig() net.ListenConfig {
+	return net.ListenConfig{}
+}
+
+func setReceiveBuffer(conn *net.UDPConn, size int) error {
+	return conn.SetReadBuffer(size)
+}
+
+// receiveBufferSize 无法读取时返回0
+func receiveBufferSize(conn *net.UDPConn) int {
+	return 0
+}
+
+func parseSocketDrops(oob []byte) (uint32, bool) {
+	return 0, false
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sip-monitor/src/config"
+	"sip-monitor/src/entity"
+	"sip-monitor/src/pkg/hep"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/net/ipv4"
+)
+
+func newTestHepServer(tb testing.TB, readers int) *HepServer {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	cfg := &config.Config{UDPReaders: readers, UDPBatchSize: 32, UDPReceiveBufferBytes: 4 << 20, MaxPacketLength: 4096}
+	h, err := NewHepServer(logger, cfg, nil, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(h.Close)
+	return h
+}
+
+func testHepPacket(n int) []byte {
+	return hep.Encode(&hep.HepMsg{
+		IPProtocolID:          17,
+		IP4SourceAddress:      "10.0.0.1",
+		IP4DestinationAddress: "10.0.0.2",
+		SourcePort:            5060,
+		DestinationPort:       5060,
+		ProtocolType:          hep.ProtocolTypeSIP,
+		Body:                  []byte(fmt.Sprintf("OPTIONS sip:10.0.0.2 SIP/2.0\r\nCall-ID: %d@10.0.0.1\r\n\r\n", n)),
+	})
+}
+
+// dialHepServer 多个来源端口，SO_REUSEPORT按来源分配到不同socket
+func dialHepServer(tb testing.TB, h *HepServer, count int) []*net.UDPConn {
+	port := h.sockets[0].conn.LocalAddr().(*net.UDPAddr).Port
+	conns := make([]*net.UDPConn, count)
+	for i := range conns {
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		tb.Cleanup(func() { conn.Close() })
+		conns[i] = conn
+	}
+	return conns
+}
+
+func TestHepServer_ReadHepSocket(t *testing.T) {
+	h := newTestHepServer(t, 2)
+	if len(h.sockets) != hepSocketCount(2) {
+		t.Fatalf("socket数量错误：%d", len(h.sockets))
+	}
+
+	var mu sync.Mutex
+	received := make(map[string]string)
+	var wg sync.WaitGroup
+	for _, socket := range h.sockets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.readHepSocket(socket, func(buf *[]byte, n int, ip string) {
+				msg, err := hep.NewHepMsg((*buf)[:n])
+				h.buffers.Put(buf)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				received[string(msg.Body)] = ip
+				mu.Unlock()
+			})
+		}()
+	}
+
+	const total = 100
+	conns := dialHepServer(t, h, 4)
+	for i := 0; i < total; i++ {
+		conns[i%len(conns)].Write(testHepPacket(i))
+	}
+	conns[0].Write([]byte("HEP3"))
+
+	deadline := time.Now().Add(3 * time.Second)
+	for h.received.Load() < total+1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	h.Close()
+	wg.Wait()
+
+	if len(received) != total {
+		t.Fatalf("应收到%d个包，得到%d", total, len(received))
+	}
+	for body, ip := range received {
+		if ip != "127.0.0.1" || !bytes.HasPrefix([]byte(body), []byte("OPTIONS")) {
+			t.Errorf("包内容或来源错误：%s %q", ip, body)
+		}
+	}
+	stats := h.IngestStats()
+	if stats["hep_received"] != total+1 || stats["hep_short_packets"] != 1 || stats["hep_read_errors"] != 0 {
+		t.Errorf("计数错误：%v", stats)
+	}
+}
+
+// benchmarkReceive 发送方持续发包直到接收方收到b.N个包
+func benchmarkReceive(b *testing.B, port int, senders int, received *atomic.Int64) {
+	packet := testHepPacket(0)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		if err != nil {
+			b.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					conn.Write(packet)
+				}
+			}
+		}()
+	}
+
+	b.ResetTimer()
+	start := time.Now()
+	for received.Load() < int64(b.N) {
+		time.Sleep(time.Millisecond)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "pps")
+	close(done)
+	wg.Wait()
+}
+
+// BenchmarkHepReceive 对比原来的单socket ReadFromUDP循环和多socket批量读取
+func BenchmarkHepReceive(b *testing.B) {
+	b.Run("ReadFromUDP", func(b *testing.B) {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		conn.SetReadBuffer(4 << 20)
+		var received atomic.Int64
+		go func() {
+			data := make([]byte, 4096)
+			for {
+				if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+					return
+				}
+				n, _, err := conn.ReadFromUDP(data)
+				if err != nil {
+					return
+				}
+				raw := make([]byte, n)
+				copy(raw, data[:n])
+				received.Add(1)
+			}
+		}()
+		benchmarkReceive(b, conn.LocalAddr().(*net.UDPAddr).Port, 4, &received)
+		conn.Close()
+	})
+
+	for _, readers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("ReadBatch/sockets=%d", readers), func(b *testing.B) {
+			h := newTestHepServer(b, readers)
+			var received atomic.Int64
+			for _, socket := range h.sockets {
+				go h.readHepSocket(socket, func(buf *[]byte, n int, ip string) {
+					h.buffers.Put(buf)
+					received.Add(1)
+				})
+			}
+			benchmarkReceive(b, h.sockets[0].conn.LocalAddr().(*net.UDPAddr).Port, 4, &received)
+		})
+	}
+}
+
+// 两个读协程同时分配TCP流的前后两半，工作协程并发处理时每个流仍按顺序重组
+func TestHepServer_DispatchStreamInOrder(t *testing.T) {
+	h := newTestHepServer(t, 1)
+	const streams = 200
+	h.saveService = &SaveService{SaveToDBQueue: make(chan entity.SIP, 2*streams)}
+	stopWorkers := h.startWorkers()
+
+	half := func(stream int, body string) []byte {
+		return hep.Encode(&hep.HepMsg{
+			IPProtocolID:          6,
+			IP4SourceAddress:      "10.0.0.1",
+			IP4DestinationAddress: "10.0.0.2",
+			SourcePort:            uint16(10000 + stream),
+			DestinationPort:       5060,
+			ProtocolType:          hep.ProtocolTypeSIP,
+			Body:                  []byte(body),
+		})
+	}
+	feed := func(packet []byte) {
+		buf := h.buffers.Get().(*[]byte)
+		n := copy(*buf, packet)
+		h.dispatch(buf, n, "127.0.0.1")
+	}
+
+	var wg sync.WaitGroup
+	for reader := 0; reader < 2; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for stream := reader; stream < streams; stream += 2 {
+				msg := fmt.Sprintf("OPTIONS sip:10.0.0.2 SIP/2.0\r\nCall-ID: %d@10.0.0.1\r\nCSeq: 1 OPTIONS\r\nContent-Length: 0\r\n\r\n", stream)
+				feed(half(stream, msg[:20]))
+				feed(half(stream, msg[20:]))
+			}
+		}()
+	}
+	wg.Wait()
+	stopWorkers()
+
+	close(h.saveService.SaveToDBQueue)
+	received := make(map[string]bool)
+	for sip := range h.saveService.SaveToDBQueue {
+		received[sip.CallID] = true
+	}
+	if len(received) != streams {
+		t.Fatalf("应重组%d条消息，得到%d", streams, len(received))
+	}
+	if pending := h.framer.Pending(); pending != 0 {
+		t.Errorf("不应有未完成的流，得到%d", pending)
+	}
+}
+
+// 两个IPv6对端使用相同的端口，交替发来的分段不能拼到同一个流里
+func TestHepServer_DispatchIPv6Streams(t *testing.T) {
+	h := newTestHepServer(t, 1)
+	h.saveService = &SaveService{SaveToDBQueue: make(chan entity.SIP, 4)}
+	stopWorkers := h.startWorkers()
+
+	peers := []string{"2001:db8::1", "2001:db8::2"}
+	segment := func(peer string, body string) {
+		packet := hep.Encode(&hep.HepMsg{
+			IPProtocolFamily:      0x0a,
+			IPProtocolID:          6,
+			IP6SourceAddress:      peer,
+			IP6DestinationAddress: "2001:db8::100",
+			SourcePort:            5061,
+			DestinationPort:       5061,
+			ProtocolType:          hep.ProtocolTypeSIP,
+			Body:                  []byte(body),
+		})
+		buf := h.buffers.Get().(*[]byte)
+		n := copy(*buf, packet)
+		h.dispatch(buf, n, "127.0.0.1")
+	}
+	msgs := make([]string, len(peers))
+	for i, peer := range peers {
+		msgs[i] = fmt.Sprintf("OPTIONS sip:[2001:db8::100] SIP/2.0\r\nCall-ID: %s\r\nCSeq: 1 OPTIONS\r\nContent-Length: 0\r\n\r\n", peer)
+	}
+	for i, peer := range peers {
+		segment(peer, msgs[i][:20])
+	}
+	for i, peer := range peers {
+		segment(peer, msgs[i][20:])
+	}
+	stopWorkers()
+
+	close(h.saveService.SaveToDBQueue)
+	received := make(map[string]string)
+	for sip := range h.saveService.SaveToDBQueue {
+		received[sip.CallID] = sip.SrcAddr
+	}
+	want := map[string]string{"2001:db8::1": "[2001:db8::1]:5061", "2001:db8::2": "[2001:db8::2]:5061"}
+	if len(received) != len(want) {
+		t.Fatalf("应重组%d条消息，得到%v", len(want), received)
+	}
+	for callID, addr := range want {
+		if received[callID] != addr {
+			t.Errorf("%s 的来源地址应为%s，得到%q", callID, addr, received[callID])
+		}
+	}
+}
+
+// errorReader 先返回errors次读取错误，之后返回socket已关闭
+type errorReader struct {
+	errors int
+}
+
+func (r *errorReader) ReadBatch(ms []ipv4.Message, flags int) (int, error) {
+	if r.errors == 0 {
+		return 0, net.ErrClosed
+	}
+	r.errors--
+	return 0, errors.New("connection refused")
+}
+
+func TestHepServer_ReadErrorBackoff(t *testing.T) {
+	h := newTestHepServer(t, 1)
+	logger, hook := test.NewNullLogger()
+	h.logger = logger
+
+	start := time.Now()
+	err := h.readHepSocket(&hepSocket{reader: &errorReader{errors: 6}}, func(buf *[]byte, n int, ip string) {
+		t.Error("读取出错时不应处理数据")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.readErrors.Load(); got != 6 {
+		t.Errorf("读取错误数为%d，应为6", got)
+	}
+	// 退避 1+2+4+8+16+32ms
+	if elapsed := time.Since(start); elapsed < 63*time.Millisecond {
+		t.Errorf("连续出错应退避，用时%s", elapsed)
+	}
+	if got := len(hook.AllEntries()); got != 1 {
+		t.Errorf("连续出错只应记录一次日志，记录了%d次", got)
+	}
+}
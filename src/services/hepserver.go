@@ -1,13 +1,17 @@
 package services
 
 import (
+	"encoding/binary"
 	"fmt"
+	"hash/maphash"
 	"net"
+	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"sip-monitor/src/config"
-	"sip-monitor/src/entity"
 	"sip-monitor/src/pkg/hep"
 	"sip-monitor/src/pkg/rtcp"
 	"sip-monitor/src/pkg/siprocket"
@@ -15,98 +19,212 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// 每个工作协程的队列长度，队列满时读协程阻塞，由内核接收缓冲区缓存
+const hepWorkerQueueSize = 1024
+
+// 按流分配工作协程的哈希种子
+var hepShardSeed = maphash.MakeSeed()
+
+// hepPacket 读协程解析了HEP头的包，处理完成后buf归还到pool
+type hepPacket struct {
+	buf    *[]byte
+	hepMsg *hep.HepMsg
+	ip     string
+}
+
 type HepServer struct {
 	logger      *logrus.Logger
-	conn        *net.UDPConn
+	sockets     []*hepSocket
+	buffers     sync.Pool
 	cfg         *config.Config
 	saveService *SaveService
 	rtcpService *rtcp.RTCPReportService
+	framer      *siprocket.Framer
+	forwarders  []HepForwarder
+	workers     []chan hepPacket
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	received     atomic.Uint64
+	shortPackets atomic.Uint64
+	readErrors   atomic.Uint64
 }
 
 func NewHepServer(logger *logrus.Logger, cfg *config.Config, saveService *SaveService, rtcpService *rtcp.RTCPReportService) (*HepServer, error) {
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: cfg.UDPListenPort})
+	sockets, err := listenHepSockets(cfg.UDPListenPort, hepSocketCount(cfg.UDPReaders), cfg.UDPReceiveBufferBytes)
 	if err != nil {
 		logger.WithError(err).Error("HepServerListener Udp Service listen report udp fail")
 		return nil, err
 	}
-	return &HepServer{
-		conn:        conn,
+	if cfg.StreamTimeoutSeconds <= 0 {
+		cfg.StreamTimeoutSeconds = 10
+	}
+	if cfg.MaxPacketLength <= 0 {
+		cfg.MaxPacketLength = 4096
+	}
+	h := &HepServer{
+		sockets:     sockets,
 		logger:      logger,
 		cfg:         cfg,
 		saveService: saveService,
 		rtcpService: rtcpService,
-	}, nil
+		framer:      siprocket.NewFramer(time.Duration(cfg.StreamTimeoutSeconds) * time.Second),
+		done:        make(chan struct{}),
+	}
+	workers := cfg.HEPWorkers
+	if workers <= 0 {
+		workers = 2 * runtime.NumCPU()
+	}
+	h.workers = make([]chan hepPacket, workers)
+	for i := range h.workers {
+		h.workers[i] = make(chan hepPacket, hepWorkerQueueSize)
+	}
+	h.buffers.New = func() any {
+		buf := make([]byte, cfg.MaxPacketLength)
+		return &buf
+	}
+	return h, nil
 }
 
+// AddForwarder 添加HEP消息的转发，需在Start前调用
+func (h *HepServer) AddForwarder(forwarder HepForwarder) {
+	h.forwarders = append(h.forwarders, forwarder)
+}
+
+// Start 每个socket一个读协程，读协程解析HEP头后按流分配给工作协程，Close后返回。
+// SO_REUSEPORT按来源地址分配socket，同一采集节点的包在同一个读协程中按到达顺序分配
 func (h *HepServer) Start() error {
-	defer h.conn.Close()
-	h.logger.Info("HepServerListener")
+	h.logger.WithFields(logrus.Fields{
+		"port":           h.sockets[0].conn.LocalAddr().(*net.UDPAddr).Port,
+		"sockets":        len(h.sockets),
+		"workers":        len(h.workers),
+		"receive_buffer": receiveBufferSize(h.sockets[0].conn),
+	}).Info("HepServerListener")
+
+	go h.expireStreams()
+	stopWorkers := h.startWorkers()
 
-	if h.cfg.MaxPacketLength <= 0 {
-		h.cfg.MaxPacketLength = 4096
+	var wg sync.WaitGroup
+	for _, socket := range h.sockets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.readHepSocket(socket, h.dispatch)
+		}()
 	}
-	var data = make([]byte, h.cfg.MaxPacketLength)
-	var raw []byte
-	for {
-		err := h.conn.SetDeadline(time.Now().Add(time.Duration(h.cfg.MaxReadTimeoutSeconds) * time.Second))
-		if err != nil {
-			return err
-		}
-		n, remoteAddr, err := h.conn.ReadFromUDP(data)
-		if err != nil {
-			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
-				continue
-			} else {
-				h.logger.WithFields(logrus.Fields{
-					"remote_addr": remoteAddr.IP.String(),
-				}).WithError(err).Error("read udp error")
+	wg.Wait()
+	stopWorkers()
+	return nil
+}
+
+// startWorkers 启动工作协程，返回的函数在全部读协程退出后调用，处理完队列中的包后返回
+func (h *HepServer) startWorkers() (stop func()) {
+	var wg sync.WaitGroup
+	for _, queue := range h.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for packet := range queue {
+				h.handleHepMsg(packet.hepMsg, packet.ip)
+				h.buffers.Put(packet.buf)
 			}
+		}()
+	}
+	return func() {
+		for _, queue := range h.workers {
+			close(queue)
 		}
+		wg.Wait()
+	}
+}
 
-		if n < entity.MinRawPacketLength {
+// dispatch 在读协程中解析HEP头，同一个流的包交给同一个工作协程，
+// 保证TCP/TLS流的分段按到达顺序送入Framer
+func (h *HepServer) dispatch(buf *[]byte, n int, ip string) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.buffers.Put(buf)
 			h.logger.WithFields(logrus.Fields{
-				"setting_length":  entity.MinRawPacketLength,
-				"received_length": n,
-				"remote_addr":     remoteAddr.IP.String(),
-			}).Warn("HepServerListener less then MinRawPacketLength")
-			continue
+				"panic":       r,
+				"remote_addr": ip,
+			}).Error("parse hep packet panic")
 		}
+	}()
 
-		raw = make([]byte, n)
+	hepMsg, err := hep.NewHepMsg((*buf)[:n])
+	if err != nil || len(hepMsg.Body) == 0 {
+		if err != nil {
+			h.logger.WithError(err).WithField("remote_addr", ip).Debug("parse hep packet fail")
+		}
+		h.buffers.Put(buf)
+		return
+	}
+	h.workers[streamShard(ip, hepMsg, len(h.workers))] <- hepPacket{buf: buf, hepMsg: hepMsg, ip: ip}
+}
 
-		copy(raw, data[:n])
+// Close 关闭全部socket
+func (h *HepServer) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+		closeHepSockets(h.sockets)
+	})
+}
 
-		go h.ParseSIPMsg(raw, remoteAddr.IP.String())
+// IngestStats 接收的包数、内核接收缓冲区满丢弃的包数（仅Linux）、过短的包数和读错误数
+func (h *HepServer) IngestStats() map[string]float64 {
+	var drops uint64
+	for _, socket := range h.sockets {
+		drops += socket.drops.Load()
+	}
+	return map[string]float64{
+		"hep_sockets":       float64(len(h.sockets)),
+		"hep_received":      float64(h.received.Load()),
+		"hep_socket_drops":  float64(drops),
+		"hep_short_packets": float64(h.shortPackets.Load()),
+		"hep_read_errors":   float64(h.readErrors.Load()),
 	}
 }
 
-func (h *HepServer) ParseSIPMsg(b []byte, ip string) {
+// handleHepMsg 处理一个HEP包，返回后包的buffer会被复用，解析结果不能引用hepMsg.Body
+func (h *HepServer) handleHepMsg(hepMsg *hep.HepMsg, ip string) {
 	defer func() {
 		// 发生宕机时，获取panic传递的上下文并打印
-		err := recover()
-		if err != nil {
-			h.logger.WithError(err.(error)).Error("parse save err")
+		if r := recover(); r != nil {
+			h.logger.WithFields(logrus.Fields{
+				"panic":       r,
+				"remote_addr": ip,
+			}).Error("parse save err")
 		}
 	}()
 
-	hepMsg, err := hep.NewHepMsg(b)
-	if err != nil {
-		return
+	for _, forwarder := range h.forwarders {
+		forwarder.Forward(ip, hepMsg)
 	}
-	if len(hepMsg.Body) <= 0 {
+
+	if hepMsg.ProtocolType == hep.ProtocolTypeRTCP {
+		if len(hepMsg.Body) < h.cfg.MinPacketLength {
+			return
+		}
+		h.rtcpService.ReceiveRTCPPacket(ip, hepMsg)
 		return
 	}
 
-	if len(hepMsg.Body) < h.cfg.MinPacketLength {
+	// UDP和WebSocket每个包就是一条消息，流式传输一个包可能包含多条或半条消息
+	if hepMsg.IPProtocolID == 0 || siprocket.IsMessageTransport(siprocket.TransportByProtocolID(int(hepMsg.IPProtocolID))) {
+		h.handleSIPMsg(hepMsg.Body, ip, hepMsg)
 		return
 	}
+	for _, payload := range h.framer.Feed(streamKey(ip, hepMsg), hepMsg.Body) {
+		h.handleSIPMsg(payload, ip, hepMsg)
+	}
+}
 
-	if hepMsg.ProtocolType == hep.ProtocolTypeRTCP {
-		h.rtcpService.ReceiveRTCPPacket(ip, hepMsg)
+func (h *HepServer) handleSIPMsg(payload []byte, ip string, hepMsg *hep.HepMsg) {
+	if len(payload) < h.cfg.MinPacketLength {
 		return
 	}
 
-	sip := siprocket.ParseSIP(hepMsg.Body)
+	sip := siprocket.ParseSIP(payload)
 	if sip == nil {
 		return
 	}
@@ -115,12 +233,68 @@ func (h *HepServer) ParseSIPMsg(b []byte, ip string) {
 	sip.TimestampMicro = sip.CreateTime.Add(time.Microsecond * time.Duration(hepMsg.TimestampMicro)).UnixMicro()
 
 	sip.Protocol = int(hepMsg.IPProtocolID)
+	sip.Transport = siprocket.ResolveTransport(sip.Protocol, sip.Transport)
 
-	sip.SrcAddr = fmt.Sprintf("%s:%d", hepMsg.IP4SourceAddress, hepMsg.SourcePort)
-	sip.DstAddr = fmt.Sprintf("%s:%d", hepMsg.IP4DestinationAddress, hepMsg.DestinationPort)
+	srcIP, dstIP := hepIPs(hepMsg)
+	sip.SrcAddr = net.JoinHostPort(srcIP, strconv.Itoa(int(hepMsg.SourcePort)))
+	sip.DstAddr = net.JoinHostPort(dstIP, strconv.Itoa(int(hepMsg.DestinationPort)))
+	sip.ContactAddr = siprocket.ResolveContactAddr(sip.ContactAddr, sip.SrcAddr)
 
-	sip.NodeID = strconv.Itoa(int(hepMsg.CaptureAgentID))
+	sip.NodeID = strconv.FormatUint(uint64(hepMsg.CaptureAgentID), 10)
 	sip.NodeIP = ip
+	sip.NodeName = hepMsg.NodeName
+	sip.HepMeta = hepMsg.Metadata()
 
-	h.saveService.SaveToDBQueue <- *sip
+	h.saveService.Enqueue(*sip)
+}
+
+// hepIPs 消息的源和目的IP，IPv6消息只带IPv6地址
+func hepIPs(hepMsg *hep.HepMsg) (src, dst string) {
+	if hepMsg.IP6SourceAddress != "" {
+		return hepMsg.IP6SourceAddress, hepMsg.IP6DestinationAddress
+	}
+	return hepMsg.IP4SourceAddress, hepMsg.IP4DestinationAddress
+}
+
+// 流的标识：采集节点 + 5元组
+func streamKey(ip string, hepMsg *hep.HepMsg) string {
+	src, dst := hepIPs(hepMsg)
+	return fmt.Sprintf("%s|%d|%s|%s", ip, hepMsg.IPProtocolID,
+		net.JoinHostPort(src, strconv.Itoa(int(hepMsg.SourcePort))), net.JoinHostPort(dst, strconv.Itoa(int(hepMsg.DestinationPort))))
+}
+
+// streamShard 流分配到的工作协程，与streamKey使用相同的字段
+func streamShard(ip string, hepMsg *hep.HepMsg, shards int) int {
+	var hash maphash.Hash
+	hash.SetSeed(hepShardSeed)
+	var ports [5]byte
+	ports[0] = hepMsg.IPProtocolID
+	binary.BigEndian.PutUint16(ports[1:], hepMsg.SourcePort)
+	binary.BigEndian.PutUint16(ports[3:], hepMsg.DestinationPort)
+	src, dst := hepIPs(hepMsg)
+	hash.WriteString(ip)
+	hash.WriteString(src)
+	hash.WriteString(dst)
+	hash.Write(ports[:])
+	return int(hash.Sum64() % uint64(shards))
+}
+
+// 定时清理超时未完成的流消息
+func (h *HepServer) expireStreams() {
+	ticker := time.NewTicker(time.Duration(h.cfg.StreamTimeoutSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+		if expired := h.framer.Expire(); expired > 0 {
+			h.logger.WithFields(logrus.Fields{
+				"expired": expired,
+				"pending": h.framer.Pending(),
+			}).Warn("丢弃超时未完成的TCP/TLS SIP消息")
+		}
+	}
 }
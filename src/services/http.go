@@ -8,15 +8,50 @@ import (
 )
 
 type HandleHttp struct {
-	logger     *logrus.Logger
-	cfg        *config.Config
-	repository model.Repository
+	logger       *logrus.Logger
+	cfg          *config.Config
+	repository   model.Repository
+	ingestFilter *IngestFilter
+	trunkHealth  *TrunkHealthService
+	statService  *StatService
+	concurrency  *ConcurrencyService
+	alert        *AlertService
+	correlator   *Correlator
+
+	gatewayReloaders []GatewayReloader
+	ingestStats      []IngestStatsSource
+}
+
+// GatewayReloader 网关修改后需要重新加载网关列表的服务
+type GatewayReloader interface {
+	ReloadGateways()
+}
+
+// IngestStatsSource 接收链路中提供计数的服务，名称不能重复
+type IngestStatsSource interface {
+	IngestStats() map[string]float64
 }
 
-func NewHandleHttp(logger *logrus.Logger, cfg *config.Config, repository model.Repository) *HandleHttp {
+func NewHandleHttp(logger *logrus.Logger, cfg *config.Config, repository model.Repository, ingestFilter *IngestFilter, trunkHealth *TrunkHealthService, statService *StatService, concurrency *ConcurrencyService, alert *AlertService, correlator *Correlator) *HandleHttp {
 	return &HandleHttp{
-		logger:     logger,
-		cfg:        cfg,
-		repository: repository,
+		logger:       logger,
+		cfg:          cfg,
+		repository:   repository,
+		ingestFilter: ingestFilter,
+		trunkHealth:  trunkHealth,
+		statService:  statService,
+		concurrency:  concurrency,
+		alert:        alert,
+		correlator:   correlator,
 	}
 }
+
+// AddGatewayReloader 注册网关修改后需要刷新的服务
+func (h *HandleHttp) AddGatewayReloader(reloader GatewayReloader) {
+	h.gatewayReloaders = append(h.gatewayReloaders, reloader)
+}
+
+// AddIngestStatsSource 注册 /api/stat/ingest 输出的计数
+func (h *HandleHttp) AddIngestStatsSource(source IngestStatsSource) {
+	h.ingestStats = append(h.ingestStats, source)
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/pkg/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *HandleHttp) AlertRuleList(c *gin.Context) {
+	rules, err := h.repository.AlertRuleList()
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, rules)
+}
+
+func (h *HandleHttp) AlertRuleGetByID(c *gin.Context) {
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	rule, err := h.repository.AlertRuleGetByID(idInt)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, rule)
+}
+
+func (h *HandleHttp) AlertRuleCreate(c *gin.Context) {
+	var req entity.AlertRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if err := h.validateAlertRule(&req); err != nil {
+		util.SendMessage(c, err.Error())
+		return
+	}
+	now := time.Now()
+	req.ID = 0
+	req.SilenceUntil = nil
+	req.CreateAt = &now
+	req.UpdateAt = &now
+	if err := h.repository.AlertRuleCreate(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	h.reloadAlertRules()
+	util.SendSuccessWithData(c, req)
+}
+
+func (h *HandleHttp) AlertRuleUpdate(c *gin.Context) {
+	var req entity.AlertRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if err := h.validateAlertRule(&req); err != nil {
+		util.SendMessage(c, err.Error())
+		return
+	}
+	now := time.Now()
+	req.ID = idInt
+	req.UpdateAt = &now
+	if err := h.repository.AlertRuleUpdate(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	h.reloadAlertRules()
+	util.SendSuccess(c)
+}
+
+func (h *HandleHttp) AlertRuleDelete(c *gin.Context) {
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if err := h.repository.AlertRuleDelete(idInt); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	h.reloadAlertRules()
+	util.SendSuccess(c)
+}
+
+// AlertRuleSilence 静默告警规则，静默期间状态变化只记录历史不通知
+func (h *HandleHttp) AlertRuleSilence(c *gin.Context) {
+	var req entity.AlertSilenceDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if req.Minutes < 0 {
+		util.SendMessage(c, "静默时长不能小于0")
+		return
+	}
+
+	var until *time.Time
+	if req.Minutes > 0 {
+		t := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+		until = &t
+	}
+	if err := h.repository.AlertRuleSilence(idInt, until); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	h.reloadAlertRules()
+	util.SendSuccessWithData(c, gin.H{"silence_until": until})
+}
+
+// AlertActive 正在触发的告警
+func (h *HandleHttp) AlertActive(c *gin.Context) {
+	util.SendSuccessWithData(c, h.alert.Active())
+}
+
+// AlertHistory 告警历史
+func (h *HandleHttp) AlertHistory(c *gin.Context) {
+	var request entity.AlertHistoryDTO
+	if err := c.ShouldBindQuery(&request); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	histories, meta, err := h.repository.GetAlertHistoryList(c, request)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if histories == nil {
+		histories = make([]entity.AlertHistory, 0)
+	}
+	util.SendItems(c, nil, histories, meta)
+}
+
+// validateAlertRule 检查规则并补全默认的评估窗口，指定的网关需存在
+func (h *HandleHttp) validateAlertRule(rule *entity.AlertRule) error {
+	if rule.WindowSeconds == 0 {
+		rule.WindowSeconds = alertDefaultWindow
+	}
+	if err := ValidateAlertRule(*rule); err != nil {
+		return err
+	}
+	if rule.GatewayID > 0 {
+		gateway, err := h.repository.GatewayGetByID(rule.GatewayID)
+		if err != nil || gateway == nil {
+			return fmt.Errorf("网关不存在")
+		}
+	}
+	return nil
+}
+
+// 规则修改后重新加载，使其立即生效
+func (h *HandleHttp) reloadAlertRules() {
+	if h.alert == nil {
+		return
+	}
+	if err := h.alert.Reload(); err != nil {
+		h.logger.WithError(err).Error("重新加载告警规则失败")
+	}
+}
@@ -1,7 +1,12 @@
 package services
 
 import (
+	"bytes"
+	"fmt"
+	"net/http"
+
 	"sip-monitor/src/entity"
+	"sip-monitor/src/pkg/ladder"
 	"sip-monitor/src/pkg/util"
 
 	"github.com/gin-gonic/gin"
@@ -15,11 +20,44 @@ func (h *HandleHttp) CallList(c *gin.Context) {
 	util.SendItems(c, nil, records, meta)
 }
 
+// CallExport 按呼叫列表的查询条件流式导出全部话单，不分页
+func (h *HandleHttp) CallExport(c *gin.Context) {
+	var request entity.CallExportDTO
+	if err := c.ShouldBind(&request); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if request.BeginTime == nil || request.EndTime == nil {
+		util.SendMessage(c, "导出话单需要指定开始和结束时间")
+		return
+	}
+	exporter, err := NewCDRExporter(h.repository, request.Format, request.Columns, request.TimeZone)
+	if err != nil {
+		util.SendMessage(c, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("cdr-%s-%s.%s", request.BeginTime.Format("20060102150405"),
+		request.EndTime.Format("20060102150405"), exporter.Extension())
+	c.Header("Content-Type", exporter.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	count, err := exporter.Export(c, request.SearchParams, c.Writer)
+	if err != nil {
+		// 响应已经开始发送，只能中断
+		h.logger.WithError(err).WithField("count", count).Error("导出话单失败")
+		c.Abort()
+		return
+	}
+	h.logger.WithField("count", count).Info("导出话单完成")
+}
+
 func (h *HandleHttp) CallDetails(c *gin.Context) {
 	sipCallID := c.Query("sip_call_id")
 
 	callItem, err := h.repository.GetCallBySIPCallID(c, sipCallID)
-	if err != nil {
+	if err != nil || callItem == nil {
 		util.SendResponse(c, nil, entity.CallDetailsVO{})
 		return
 	}
@@ -29,26 +67,72 @@ func (h *HandleHttp) CallDetails(c *gin.Context) {
 	vo.Records = make([]entity.Record, 0)
 	vo.Relevants = make([]entity.Record, 0)
 	vo.RTCPPackets = make([]*entity.RtcpReportRaw, 0)
+	vo.Events = make([]entity.CallEvent, 0)
 
 	vo.Records, _ = h.repository.GetRecordsBySIPCallIDs(c, []string{sipCallID})
+	if events, err := h.repository.GetCallEventsBySIPCallID(c, sipCallID); err == nil && events != nil {
+		vo.Events = events
+	}
 
-	if callItem.SessionID == "" {
+	vo.RtcpReport, _ = h.repository.GetRtcpReportBySIPCallID(c, sipCallID)
+
+	vo.RTCPPackets, _ = h.repository.GetRtcpReportRawByBySIPCallID(c, sipCallID)
+
+	graph, err := h.correlator.SessionGraph(c, callItem)
+	if err != nil {
+		h.logger.WithError(err).WithField("sip_call_id", sipCallID).Error("查询关联的呼叫腿失败")
 		util.SendResponse(c, nil, vo)
 		return
 	}
+	vo.Graph = graph
+	if len(graph.Legs) > 1 {
+		vo.Relevants, _ = h.repository.GetRecordsBySIPCallIDs(c, graph.LegIDs())
+	}
+
+	util.SendResponse(c, nil, vo)
+}
 
-	sipCallIDs, err := h.repository.GetCallIDsBySessionID(c, callItem.SessionID)
+// CallLadder 输出呼叫的时序图，related为true时包含关联的呼叫腿，用于贴到工单、邮件和聊天中
+func (h *HandleHttp) CallLadder(c *gin.Context) {
+	var request entity.CallLadderDTO
+	if err := c.ShouldBind(&request); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	format, err := ladder.ParseFormat(request.Format)
 	if err != nil {
-		util.SendResponse(c, nil, vo)
+		util.SendMessage(c, err.Error())
+		return
+	}
+	callItem, err := h.repository.GetCallBySIPCallID(c, request.SIPCallID)
+	if err != nil || callItem == nil {
+		util.SendMessage(c, "呼叫不存在")
 		return
 	}
-	vo.Relevants, _ = h.repository.GetRecordsBySIPCallIDs(c, sipCallIDs)
-
-	vo.RtcpReport, _ = h.repository.GetRtcpReportBySIPCallID(c, sipCallID)
 
-	vo.RTCPPackets, _ = h.repository.GetRtcpReportRawByBySIPCallID(c, sipCallID)
+	legIDs := []string{callItem.SIPCallID}
+	if request.Related {
+		graph, err := h.correlator.SessionGraph(c, callItem)
+		if err != nil {
+			util.SendError(c, err)
+			return
+		}
+		legIDs = graph.LegIDs()
+	}
+	diagram, err := NewCallLadder(c, h.repository, callItem, legIDs)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
 
-	util.SendResponse(c, nil, vo)
+	var buf bytes.Buffer
+	if err := diagram.Render(&buf, format); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	filename := "ladder." + format.Extension()
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	c.Data(http.StatusOK, format.ContentType(), buf.Bytes())
 }
 
 func (h *HandleHttp) RecordRaw(c *gin.Context) {
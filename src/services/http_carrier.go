@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/pkg/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *HandleHttp) CarrierList(c *gin.Context) {
+	carriers, err := h.repository.CarrierList()
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, carriers)
+}
+
+func (h *HandleHttp) CarrierGetByID(c *gin.Context) {
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	carrier, err := h.repository.CarrierGetByID(idInt)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, carrier)
+}
+
+func (h *HandleHttp) CarrierCreate(c *gin.Context) {
+	var req entity.Carrier
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if err := validateCarrier(req); err != nil {
+		util.SendMessage(c, err.Error())
+		return
+	}
+	now := time.Now()
+	req.ID = 0
+	req.CreateAt = &now
+	req.UpdateAt = &now
+	if err := h.repository.CarrierCreate(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, req)
+}
+
+func (h *HandleHttp) CarrierUpdate(c *gin.Context) {
+	var req entity.Carrier
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if err := validateCarrier(req); err != nil {
+		util.SendMessage(c, err.Error())
+		return
+	}
+	now := time.Now()
+	req.ID = idInt
+	req.UpdateAt = &now
+	if err := h.repository.CarrierUpdate(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, req)
+}
+
+func (h *HandleHttp) CarrierDelete(c *gin.Context) {
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if err := h.repository.CarrierDelete(idInt); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	// 网关的运营商归属已解除
+	h.reloadGateways()
+	util.SendSuccess(c)
+}
+
+// CarrierStats 运营商看板
+func (h *HandleHttp) CarrierStats(c *gin.Context) {
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	var request entity.CallStatDTO
+	if err := c.ShouldBindJSON(&request); err != nil {
+		util.SendError(c, err)
+		return
+	}
+
+	stats, err := h.statService.CarrierStats(c, idInt, request)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, stats)
+}
+
+// CarrierSLA 运营商SLA达标报表
+func (h *HandleHttp) CarrierSLA(c *gin.Context) {
+	var request entity.CarrierSLADTO
+	if err := c.ShouldBindJSON(&request); err != nil {
+		util.SendError(c, err)
+		return
+	}
+
+	report, err := h.statService.CarrierSLA(c, request)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, report)
+}
+
+func validateCarrier(carrier entity.Carrier) error {
+	if carrier.Name == "" {
+		return fmt.Errorf("运营商名称不能为空")
+	}
+	if carrier.MinASR < 0 || carrier.MinASR > 100 {
+		return fmt.Errorf("最低应答率应在0到100之间")
+	}
+	if carrier.MaxPDDMs < 0 {
+		return fmt.Errorf("最大接续时延不能小于0")
+	}
+	if carrier.MinMOS < 0 || carrier.MinMOS > 5 {
+		return fmt.Errorf("最低MOS应在0到5之间")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"strconv"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/pkg/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *HandleHttp) FilterRuleList(c *gin.Context) {
+	rules, err := h.repository.FilterRuleList()
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, rules)
+}
+
+func (h *HandleHttp) FilterRuleGetByID(c *gin.Context) {
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	rule, err := h.repository.FilterRuleGetByID(idInt)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, rule)
+}
+
+func (h *HandleHttp) FilterRuleCreate(c *gin.Context) {
+	var req entity.FilterRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if err := ValidateFilterRule(req); err != nil {
+		util.SendMessage(c, err.Error())
+		return
+	}
+	now := time.Now()
+	req.ID = 0
+	req.CreateAt = &now
+	req.UpdateAt = &now
+	if err := h.repository.FilterRuleCreate(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	h.reloadIngestFilter()
+	util.SendSuccessWithData(c, req)
+}
+
+func (h *HandleHttp) FilterRuleUpdate(c *gin.Context) {
+	var req entity.FilterRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if err := ValidateFilterRule(req); err != nil {
+		util.SendMessage(c, err.Error())
+		return
+	}
+	now := time.Now()
+	req.ID = idInt
+	req.UpdateAt = &now
+	if err := h.repository.FilterRuleUpdate(&req); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	h.reloadIngestFilter()
+	util.SendSuccess(c)
+}
+
+func (h *HandleHttp) FilterRuleDelete(c *gin.Context) {
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if err := h.repository.FilterRuleDelete(idInt); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	h.reloadIngestFilter()
+	util.SendSuccess(c)
+}
+
+// 规则修改后重新加载，使其立即生效
+func (h *HandleHttp) reloadIngestFilter() {
+	if h.ingestFilter == nil {
+		return
+	}
+	if err := h.ingestFilter.Reload(); err != nil {
+		h.logger.WithError(err).Error("重新加载入库过滤规则失败")
+	}
+}
@@ -2,7 +2,9 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"sip-monitor/src/entity"
@@ -18,15 +20,26 @@ func (h *HandleHttp) GatewayCreate(c *gin.Context) {
 		util.SendError(c, err)
 		return
 	}
+	req.Addrs = trimGatewayAddrs(req.Addrs)
+	if err := h.validateGateway(req); err != nil {
+		util.SendMessage(c, err.Error())
+		return
+	}
 	now := time.Now()
 	gateway := &entity.Gateway{
-		Name:     req.Name,
-		Addr:     req.Addr,
-		Remark:   req.Remark,
-		CreateAt: &now,
-		UpdateAt: &now,
+		Name:        req.Name,
+		Addrs:       req.Addrs,
+		Remark:      req.Remark,
+		MaxChannels: req.MaxChannels,
+		CarrierID:   req.CarrierID,
+		CreateAt:    &now,
+		UpdateAt:    &now,
+	}
+	if err := h.repository.GatewayCreate(gateway); err != nil {
+		util.SendError(c, err)
+		return
 	}
-	h.repository.GatewayCreate(gateway)
+	h.reloadGateways()
 	util.SendSuccess(c)
 }
 
@@ -36,6 +49,11 @@ func (h *HandleHttp) GatewayUpdate(c *gin.Context) {
 		util.SendError(c, err)
 		return
 	}
+	req.Addrs = trimGatewayAddrs(req.Addrs)
+	if err := h.validateGateway(req); err != nil {
+		util.SendMessage(c, err.Error())
+		return
+	}
 	id := c.Param("id")
 	idInt, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
@@ -46,10 +64,16 @@ func (h *HandleHttp) GatewayUpdate(c *gin.Context) {
 	var gateway entity.Gateway
 	gateway.ID = idInt
 	gateway.Name = req.Name
-	gateway.Addr = req.Addr
+	gateway.Addrs = req.Addrs
 	gateway.Remark = req.Remark
+	gateway.MaxChannels = req.MaxChannels
+	gateway.CarrierID = req.CarrierID
 	gateway.UpdateAt = &now
-	h.repository.GatewayUpdate(&gateway)
+	if err := h.repository.GatewayUpdate(&gateway); err != nil {
+		util.SendError(c, err)
+		return
+	}
+	h.reloadGateways()
 	util.SendSuccess(c)
 }
 
@@ -90,5 +114,36 @@ func (h *HandleHttp) GatewayDelete(c *gin.Context) {
 		return
 	}
 	h.repository.GatewayDelete(idInt)
+	h.reloadGateways()
 	util.SendSuccess(c)
 }
+
+// 网关修改后刷新依赖网关列表的服务
+func (h *HandleHttp) reloadGateways() {
+	for _, reloader := range h.gatewayReloaders {
+		reloader.ReloadGateways()
+	}
+}
+
+// trimGatewayAddrs 去掉地址规则两端的空白和空规则
+func trimGatewayAddrs(addrs []string) []string {
+	out := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+func (h *HandleHttp) validateGateway(gateway entity.Gateway) error {
+	if err := ValidateGatewayAddrs(gateway.Addrs); err != nil {
+		return err
+	}
+	if gateway.CarrierID > 0 {
+		if _, err := h.repository.CarrierGetByID(gateway.CarrierID); err != nil {
+			return fmt.Errorf("运营商不存在: %d", gateway.CarrierID)
+		}
+	}
+	return nil
+}
@@ -14,22 +14,74 @@ func (h *HandleHttp) CallStat(c *gin.Context) {
 		return
 	}
 
-	callStat, err := h.repository.GetCallStat(c, request)
+	callStat, err := h.statService.CallStat(c, request)
 	if err != nil {
 		util.SendError(c, err)
 		return
 	}
-	//查询出所有gateway, 并构建map，key为addr，value为name
-	gatewayMap := make(map[string]string)
-	gateways, _ := h.repository.GatewayList()
-	for _, gateway := range gateways {
-		gatewayMap[gateway.Addr] = gateway.Name
+	util.SendSuccessWithData(c, callStat)
+}
+
+// CallKPI 话务KPI统计，支持分组和时间粒度
+func (h *HandleHttp) CallKPI(c *gin.Context) {
+	var request entity.CallStatDTO
+	if err := c.ShouldBindJSON(&request); err != nil {
+		util.SendError(c, err)
+		return
+	}
+
+	kpi, err := h.statService.CallKPI(c, request)
+	if err != nil {
+		util.SendError(c, err)
+		return
 	}
+	util.SendSuccessWithData(c, kpi)
+}
 
-	//将gatewayMap中的name替换为gatewayMap[stat.IP]
-	for _, stat := range callStat {
-		stat.Gateway = gatewayMap[stat.IP]
+// ConcurrencyReport 按网关或节点统计各时间段的并发和CPS
+func (h *HandleHttp) ConcurrencyReport(c *gin.Context) {
+	var request entity.CallStatDTO
+	if err := c.ShouldBindJSON(&request); err != nil {
+		util.SendError(c, err)
+		return
 	}
 
-	util.SendSuccessWithData(c, callStat)
+	report, err := h.concurrency.ConcurrencyReport(c, request)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, report)
+}
+
+// BusyHour 忙时报表
+func (h *HandleHttp) BusyHour(c *gin.Context) {
+	var request entity.CallStatDTO
+	if err := c.ShouldBindJSON(&request); err != nil {
+		util.SendError(c, err)
+		return
+	}
+
+	report, err := h.concurrency.BusyHour(c, request)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, report)
+}
+
+// ConcurrencyLive 当前各网关、节点的并发和CPS
+func (h *HandleHttp) ConcurrencyLive(c *gin.Context) {
+	util.SendSuccessWithData(c, h.concurrency.Live())
+}
+
+// IngestStats 接收链路的计数，如队列丢弃数、去重命中率
+func (h *HandleHttp) IngestStats(c *gin.Context) {
+	stats := make(map[string]float64)
+	for _, source := range h.ingestStats {
+		for name, value := range source.IngestStats() {
+			stats[name] = value
+		}
+	}
+	util.SendSuccessWithData(c, stats)
 }
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"strconv"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/pkg/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *HandleHttp) TrunkStatus(c *gin.Context) {
+	util.SendSuccessWithData(c, h.trunkHealth.Status())
+}
+
+func (h *HandleHttp) TrunkUptime(c *gin.Context) {
+	gateway, beginTime, endTime, ok := h.trunkQuery(c)
+	if !ok {
+		return
+	}
+	uptime, err := h.trunkHealth.Uptime(c, gateway, beginTime, endTime)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	util.SendSuccessWithData(c, uptime)
+}
+
+func (h *HandleHttp) TrunkHistory(c *gin.Context) {
+	gateway, beginTime, endTime, ok := h.trunkQuery(c)
+	if !ok {
+		return
+	}
+	histories, err := h.repository.GetTrunkStateHistory(c, gateway.ID, beginTime, endTime)
+	if err != nil {
+		util.SendError(c, err)
+		return
+	}
+	if histories == nil {
+		histories = make([]entity.TrunkStateHistory, 0)
+	}
+	util.SendSuccessWithData(c, histories)
+}
+
+// trunkQuery 解析网关ID和时间段，默认最近24小时
+func (h *HandleHttp) trunkQuery(c *gin.Context) (*entity.Gateway, time.Time, time.Time, bool) {
+	var params entity.CallStatDTO
+	if err := c.ShouldBindQuery(&params); err != nil {
+		util.SendError(c, err)
+		return nil, time.Time{}, time.Time{}, false
+	}
+	idInt, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.SendError(c, err)
+		return nil, time.Time{}, time.Time{}, false
+	}
+	gateway, err := h.repository.GatewayGetByID(idInt)
+	if err != nil {
+		util.SendError(c, err)
+		return nil, time.Time{}, time.Time{}, false
+	}
+	if gateway == nil {
+		util.SendMessage(c, "网关不存在")
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	endTime := time.Now()
+	if params.EndTime != nil {
+		endTime = *params.EndTime
+	}
+	beginTime := endTime.Add(-24 * time.Hour)
+	if params.BeginTime != nil {
+		beginTime = *params.BeginTime
+	}
+	return gateway, beginTime, endTime, true
+}
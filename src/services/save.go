@@ -2,7 +2,9 @@ package services
 
 import (
 	"context"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"sip-monitor/src/entity"
@@ -17,26 +19,148 @@ type SaveService struct {
 	logger          *logrus.Logger
 	repository      model.Repository
 	callRecordCache map[string]*entity.Call
+	mediaSessions   map[string]*mediaSession
 	cacheMutex      sync.RWMutex
 	SaveToDBQueue   chan entity.SIP
 	rtcpService     *rtcp.RTCPReportService
+	ingestFilter    *IngestFilter
+	dedup           *Deduplicator
+	correlator      *Correlator
+	observers       []SIPObserver
+	callListeners   []func(call *entity.Call)
+	stateListeners  []CallStateListener
+	reportListeners []func(call *entity.Call, report *entity.RtcpReport)
+
+	// 队列满时丢弃的消息数
+	dropped atomic.Uint64
+
+	// 写入呼叫时标记入口、出口网关和方向
+	gatewayMutex sync.RWMutex
+	gateways     *GatewayResolver
 }
 
-func NewSaveService(logger *logrus.Logger, repository model.Repository, rtcpService *rtcp.RTCPReportService) *SaveService {
+// CallStateListener 接收缓存中呼叫的状态变化，在持有缓存锁时同步调用，实现中不能阻塞
+type CallStateListener interface {
+	OnCallStarted(call *entity.Call)
+	OnCallAnswered(call *entity.Call)
+	// 呼叫结束或超时移出缓存
+	OnCallEnded(call *entity.Call)
+}
+
+// SIPObserver 在入库过滤之前观察每一条SIP消息，如中继健康检查需要被丢弃的OPTIONS
+type SIPObserver interface {
+	Observe(item entity.SIP)
+}
+
+// dedup为nil时不去重
+func NewSaveService(logger *logrus.Logger, repository model.Repository, rtcpService *rtcp.RTCPReportService, ingestFilter *IngestFilter, dedup *Deduplicator, correlator *Correlator) *SaveService {
 	s := &SaveService{
 		logger:          logger,
 		repository:      repository,
 		callRecordCache: make(map[string]*entity.Call),
+		mediaSessions:   make(map[string]*mediaSession),
 		cacheMutex:      sync.RWMutex{},
 		SaveToDBQueue:   make(chan entity.SIP, 20000),
 		rtcpService:     rtcpService,
+		ingestFilter:    ingestFilter,
+		dedup:           dedup,
+		correlator:      correlator,
 	}
+	s.ReloadGateways()
 	s.InitSaveToDBRunner()
 	// 启动处理队列的任务
 	go s.SaveToDBRunner()
 	return s
 }
 
+// ReloadGateways 重新加载网关地址规则
+func (s *SaveService) ReloadGateways() {
+	gateways, err := s.repository.GatewayList()
+	if err != nil {
+		logrus.WithError(err).Error("加载网关列表失败")
+		return
+	}
+	resolver := NewGatewayResolver(gateways)
+	s.gatewayMutex.Lock()
+	s.gateways = resolver
+	s.gatewayMutex.Unlock()
+}
+
+// tagGateways 根据源、目的地址标记呼叫的入口、出口网关和方向
+func (s *SaveService) tagGateways(record *entity.Call) {
+	s.gatewayMutex.RLock()
+	resolver := s.gateways
+	s.gatewayMutex.RUnlock()
+
+	ingress, egress, direction := resolver.Classify(record.SrcAddr, record.DstAddr)
+	if ingress != nil {
+		record.IngressGatewayID = ingress.ID
+	}
+	if egress != nil {
+		record.EgressGatewayID = egress.ID
+	}
+	record.Direction = direction
+}
+
+// AddObserver 添加SIP消息观察者，需在开始接收消息前调用
+func (s *SaveService) AddObserver(observer SIPObserver) {
+	s.observers = append(s.observers, observer)
+}
+
+// AddCallListener 添加呼叫写入数据库后的回调，需在开始接收消息前调用。
+// 回调在保存路径上同步执行，不能阻塞太久
+func (s *SaveService) AddCallListener(listener func(call *entity.Call)) {
+	s.callListeners = append(s.callListeners, listener)
+}
+
+// AddCallStateListener 添加呼叫状态监听，需在开始接收消息前调用
+func (s *SaveService) AddCallStateListener(listener CallStateListener) {
+	s.stateListeners = append(s.stateListeners, listener)
+}
+
+// AddReportListener 添加RTCP报告保存后的回调，需在开始接收消息前调用
+func (s *SaveService) AddReportListener(listener func(call *entity.Call, report *entity.RtcpReport)) {
+	s.reportListeners = append(s.reportListeners, listener)
+}
+
+// Enqueue 将消息放入处理队列，队列满时丢弃并计数，避免阻塞接收
+func (s *SaveService) Enqueue(item entity.SIP) bool {
+	select {
+	case s.SaveToDBQueue <- item:
+		return true
+	default:
+		s.dropped.Add(1)
+		return false
+	}
+}
+
+// DroppedCount 队列满时累计丢弃的消息数
+func (s *SaveService) DroppedCount() uint64 {
+	return s.dropped.Load()
+}
+
+// IngestStats 处理队列和去重的计数
+func (s *SaveService) IngestStats() map[string]float64 {
+	stats := map[string]float64{
+		"queue_length":  float64(len(s.SaveToDBQueue)),
+		"queue_dropped": float64(s.dropped.Load()),
+	}
+	if s.dedup != nil {
+		for name, value := range s.dedup.IngestStats() {
+			stats[name] = value
+		}
+	}
+	return stats
+}
+
+// 呼叫已写入数据库并移出缓存，回调中不会再有并发修改。
+// 在保存路径上同步调用，事件按入库顺序写入推送缓存，入库成功的呼叫不会因进程退出而漏推
+func (s *SaveService) notifyCallSaved(call *entity.Call) {
+	for _, listener := range s.callListeners {
+		listener(call)
+	}
+}
+
 // 定时将缓存刷新到数据库
 func (s *SaveService) InitSaveToDBRunner() {
 	// 启动周期性刷新缓存到数据库的任务
@@ -85,7 +209,7 @@ func (s *SaveService) FlushCacheToDB() {
 				}
 			}
 
-			go s.dealRTCPReport(callID)
+			go s.dealRTCPReport(callID, *record)
 
 			// 使用内部函数进行更新，便于测试
 			err := s.repository.CreateCall(ctx, record)
@@ -94,7 +218,8 @@ func (s *SaveService) FlushCacheToDB() {
 			} else {
 				count++
 				// 从缓存中删除已保存的记录
-				delete(s.callRecordCache, callID)
+				s.removeFromCache(callID)
+				s.notifyCallSaved(record)
 			}
 		}
 	}
@@ -105,14 +230,44 @@ func (s *SaveService) FlushCacheToDB() {
 }
 
 func (s *SaveService) SaveToDBRunner() {
-	for item := range s.SaveToDBQueue {
-		s.SaveOptimized(item)
+	if s.dedup == nil {
+		for item := range s.SaveToDBQueue {
+			s.SaveOptimized(item)
+		}
+		return
+	}
+
+	// 去重在入库过滤和呼叫处理之前，mark模式下的消息在窗口结束后处理
+	ticker := time.NewTicker(s.dedup.TickInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case item, ok := <-s.SaveToDBQueue:
+			if !ok {
+				return
+			}
+			if s.dedup.Offer(item) {
+				s.SaveOptimized(item)
+			}
+		case now := <-ticker.C:
+			for _, item := range s.dedup.Release(now) {
+				s.SaveOptimized(item)
+			}
+		}
 	}
 }
 
 func (s *SaveService) SaveOptimized(item entity.SIP) {
-	// 忽略注册和通知消息
-	if item.CSeqMethod == "REGISTER" || item.CSeqMethod == "NOTIFY" {
+	for _, observer := range s.observers {
+		observer.Observe(item)
+	}
+
+	// 入库过滤：REGISTER、NOTIFY、DiscardMethods配置的方法和过滤规则
+	action := ""
+	if s.ingestFilter != nil {
+		action = s.ingestFilter.Evaluate(&item)
+	}
+	if action == entity.FilterActionDrop {
 		return
 	}
 
@@ -125,13 +280,19 @@ func (s *SaveService) SaveOptimized(item entity.SIP) {
 		// 将SIP转换为Record
 		record := entity.Record{
 			NodeIP:         item.NodeIP,
+			NodeID:         item.NodeID,
+			NodeName:       item.NodeName,
+			HepMeta:        item.HepMeta,
+			SeenBy:         strings.Join(item.SeenBy, ","),
 			SIPCallID:      item.CallID,
 			Method:         item.Title,
+			ResponseCode:   item.ResponseCode,
 			ResponseDesc:   item.ResponseDesc,
 			ToUser:         item.ToUser,
 			FromUser:       item.FromUser,
 			SrcAddr:        item.SrcAddr,
 			DstAddr:        item.DstAddr,
+			Transport:      item.Transport,
 			CreateTime:     item.CreateTime,
 			TimestampMicro: item.TimestampMicro,
 		}
@@ -142,6 +303,11 @@ func (s *SaveService) SaveOptimized(item entity.SIP) {
 			return
 		}
 
+		// 只保留元数据时不保存原始报文
+		if action == entity.FilterActionMetadata {
+			return
+		}
+
 		// 清理Raw文本中的不支持字符
 		sanitizedRaw := ""
 		if item.Raw != nil {
@@ -184,16 +350,44 @@ func (s *SaveService) updateCallRecordInCache(item entity.SIP) {
 			record.ToUser = item.ToUser
 			record.FromUser = item.FromUser
 			record.UserAgent = item.UserAgent
+			// 主叫身份和转移信息来自对端的Header，按字段长度截断
+			record.AssertedUser = columnText(item.AssertedUser, 120)
+			record.AssertedName = columnText(item.AssertedName, 120)
+			record.Privacy = columnText(item.Privacy, 60)
+			record.OriginalCalledUser = columnText(item.OriginalCalledUser, 120)
+			record.DiversionReason = columnText(item.DiversionReason, 30)
+			record.RedirectCount = item.RedirectCount
 			record.SrcAddr = item.SrcAddr
 			record.DstAddr = item.DstAddr
+			record.Transport = item.Transport
+			record.CallerContact = item.ContactAddr
 			record.TimestampMicro = item.TimestampMicro
 			record.CreateTime = &item.CreateTime
+			s.tagGateways(record)
+			mergeCallAttributes(record, item.CustomHeaders)
+			mergeCallISUP(record, item.ISUP)
+			mergeCallWebRTC(record, item)
+			if s.correlator != nil {
+				record.Links = s.correlator.LinkKeys(item)
+			}
 
 			s.callRecordCache[callID] = record
+			for _, listener := range s.stateListeners {
+				listener.OnCallStarted(record)
+			}
+			s.applySDPNegotiation(record, item)
+			s.trackMediaEvents(record, item)
 		}
 		return
 	}
 
+	// 后续消息（如200 OK）中出现的自定义Header头也记录到属性中
+	mergeCallAttributes(record, item.CustomHeaders)
+	mergeCallISUP(record, item.ISUP)
+	mergeCallWebRTC(record, item)
+	s.applySDPNegotiation(record, item)
+	s.trackMediaEvents(record, item)
+
 	// 对于已存在的记录，更新相关字段
 	switch item.CSeqMethod {
 	case "INVITE", "BYE", "ACK", "CANCEL", "UPDATE":
@@ -212,6 +406,9 @@ func (s *SaveService) updateCallRecordInCache(item entity.SIP) {
 				answerTime := item.CreateTime
 				record.AnswerTime = &answerTime
 				record.CallStatus = 2
+				for _, listener := range s.stateListeners {
+					listener.OnCallAnswered(record)
+				}
 			} else if item.CSeqMethod == "BYE" && record.EndTime == nil {
 				endTime := item.CreateTime
 				record.EndTime = &endTime
@@ -256,20 +453,83 @@ func (s *SaveService) updateCallRecordInCache(item entity.SIP) {
 				record.TalkDuration = int(record.EndTime.Sub(*record.AnswerTime) / time.Second)
 			}
 		}
-		go s.dealRTCPReport(callID)
+		go s.dealRTCPReport(callID, *record)
 
 		err := s.repository.CreateCall(ctx, record)
 		if err != nil {
 			logrus.WithError(err).Error("更新SIP呼叫记录失败")
 		} else {
 			// 从缓存中删除已保存的记录
-			delete(s.callRecordCache, callID)
+			s.removeFromCache(callID)
+			s.notifyCallSaved(record)
+		}
+	}
+}
+
+// 从缓存中删除呼叫及其关联的状态，调用方需持有cacheMutex
+func (s *SaveService) removeFromCache(callID string) {
+	if record, ok := s.callRecordCache[callID]; ok {
+		for _, listener := range s.stateListeners {
+			listener.OnCallEnded(record)
+		}
+	}
+	delete(s.callRecordCache, callID)
+	delete(s.mediaSessions, callID)
+}
+
+// 呼叫的任一侧使用WS/WSS传输或ICE+DTLS的SDP时标记为WebRTC呼叫
+func mergeCallWebRTC(record *entity.Call, item entity.SIP) {
+	if !record.WebRTC && (entity.IsWebSocketTransport(item.Transport) || item.SDP.IsWebRTC()) {
+		record.WebRTC = true
+	}
+}
+
+// 记录SIP-I消息体中IAM的号码和REL的释放原因，只保留第一次出现的值
+func mergeCallISUP(record *entity.Call, isup *entity.ISUP) {
+	if isup == nil {
+		return
+	}
+	switch isup.MessageType {
+	case "IAM":
+		if record.IsupCalledNumber == "" {
+			record.IsupCalledNumber = isup.CalledNumber
+			record.IsupCalledNature = isup.CalledNature
+			record.IsupCallingNumber = isup.CallingNumber
+			record.IsupCallingNature = isup.CallingNature
+			record.IsupOriginalCalledNumber = isup.OriginalCalledNumber
+		}
+	case "REL":
+		if record.IsupCause == 0 {
+			record.IsupCause = isup.Cause
+			record.IsupCauseText = isup.CauseText
 		}
 	}
 }
 
+// 合并自定义Header头到呼叫属性，已存在的属性不覆盖，名称和值按字段长度截断
+func mergeCallAttributes(record *entity.Call, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	if record.Attributes == nil {
+		record.Attributes = make(map[string]string, len(headers))
+	}
+	for name, value := range headers {
+		name = columnText(name, entity.CallAttributeNameMaxLen)
+		value = columnText(value, entity.CallAttributeValueMaxLen)
+		if _, ok := record.Attributes[name]; !ok {
+			record.Attributes[name] = value
+		}
+	}
+}
+
+// columnText 按字段长度截断并替换非法UTF-8字符，否则MySQL严格模式下写入失败，整个呼叫回滚后会被反复重试
+func columnText(s string, n int) string {
+	return util.TruncateRunes(strings.ToValidUTF8(s, "?"), n)
+}
+
 // 处理RTCP报告
-func (s *SaveService) dealRTCPReport(callID string) {
+func (s *SaveService) dealRTCPReport(callID string, call entity.Call) {
 	report := s.rtcpService.GetCallRTCPReportByCallID(callID)
 	if report == nil {
 		return
@@ -336,6 +596,9 @@ func (s *SaveService) dealRTCPReport(callID string) {
 			"report": rtcpReport,
 		}).WithError(err).Error("保存RTCP报告失败")
 	}
+	for _, listener := range s.reportListeners {
+		listener(&call, rtcpReport)
+	}
 
 	if len(rtcpReportRaws) > 0 {
 		err := s.repository.CreateRtcpReportRaws(ctx, rtcpReportRaws)
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"sip-monitor/src/entity"
+)
+
+// 每个呼叫最多记录的事件数，防止异常的re-INVITE风暴占用过多内存
+const maxCallEvents = 200
+
+// 呼叫的媒体协商状态，只在内存缓存中存在，呼叫写入数据库后删除
+type mediaSession struct {
+	offer            *entity.SDP // 首次offer
+	offerFromRequest bool        // offer是否在请求中（INVITE），否则为延迟offer（200 OK中）
+	answered         bool        // 是否已收到answer
+
+	lastSDP    map[string]*entity.SDP // 每个发送方最后一次的SDP，key为发送地址
+	earlyMedia bool                   // 是否已出现早期媒体
+	held       bool                   // 当前是否处于保持状态
+	t38        bool                   // 是否已切换到T.38
+}
+
+// 获取呼叫的媒体状态，不存在时创建，调用方需持有cacheMutex
+func (s *SaveService) getMediaSession(callID string) *mediaSession {
+	session, ok := s.mediaSessions[callID]
+	if !ok {
+		session = &mediaSession{lastSDP: make(map[string]*entity.SDP)}
+		s.mediaSessions[callID] = session
+	}
+	return session
+}
+
+// 记录SDP offer/answer的协商结果，只处理初始INVITE事务
+func (s *SaveService) applySDPNegotiation(record *entity.Call, item entity.SIP) {
+	if item.SDP == nil || len(item.SDP.Media) == 0 {
+		return
+	}
+	if item.CSeqMethod != "INVITE" && item.CSeqMethod != "ACK" {
+		return
+	}
+
+	session := s.getMediaSession(item.CallID)
+
+	media := item.SDP.AudioMedia()
+	if media == nil {
+		media = &item.SDP.Media[0]
+	}
+
+	// 第一个SDP为offer
+	if session.offer == nil {
+		if item.CSeqMethod == "ACK" {
+			return
+		}
+		session.offer = item.SDP
+		session.offerFromRequest = item.IsRequest
+
+		// SDP来自对端，按字段长度截断
+		record.MediaTypes = columnText(item.SDP.MediaTypes(), 30)
+		record.OfferCodecs = columnText(strings.Join(media.Codecs, ","), 255)
+		record.OfferMediaAddr = columnText(media.Endpoint(), 50)
+		record.SRTP = media.SRTP
+		return
+	}
+
+	// answer与offer方向相反：INVITE中的offer由响应应答，200 OK中的延迟offer由ACK应答
+	if session.answered || item.IsRequest == session.offerFromRequest {
+		return
+	}
+	session.answered = true
+
+	record.NegotiatedCodec = columnText(media.PrimaryCodec(), 30)
+	record.AnswerMediaAddr = columnText(media.Endpoint(), 50)
+	record.MediaDirection = columnText(media.Direction, 10)
+	record.SRTP = record.SRTP && media.SRTP
+}
+
+// 比较同一发送方前后的SDP，生成早期媒体、保持/恢复、编码变更、媒体地址变更、会话刷新、T.38等事件
+func (s *SaveService) trackMediaEvents(record *entity.Call, item entity.SIP) {
+	session := s.getMediaSession(item.CallID)
+	inDialog := record.AnswerTime != nil
+	midDialogRequest := inDialog && item.IsRequest && (item.Title == "INVITE" || item.Title == "UPDATE")
+
+	hasSDP := item.SDP != nil && len(item.SDP.Media) > 0
+
+	// 应答前180/183携带SDP即为早期媒体
+	if !inDialog && hasSDP && !session.earlyMedia && item.CSeqMethod == "INVITE" &&
+		(item.Title == "180" || item.Title == "183") {
+		session.earlyMedia = true
+		addCallEvent(record, item, entity.CallEventEarlyMedia, item.SDP.AudioMedia().Endpoint())
+	}
+
+	if !hasSDP {
+		// 不带SDP的UPDATE，或带Session-Expires的re-INVITE，只用于刷新会话定时器
+		if midDialogRequest && (item.Title == "UPDATE" || item.SessionExpires > 0) {
+			addCallEvent(record, item, entity.CallEventSessionRefresh, sessionExpiresDetail(item.SessionExpires))
+		}
+		return
+	}
+
+	previous := session.lastSDP[item.SrcAddr]
+	session.lastSDP[item.SrcAddr] = item.SDP
+
+	// 应答前的SDP只作为比较的基准
+	if !inDialog {
+		return
+	}
+
+	// o=行的版本未变化说明SDP没有修改，re-INVITE/UPDATE仅用于会话刷新
+	if previous != nil && previous.SessionID == item.SDP.SessionID && previous.SessionVersion == item.SDP.SessionVersion {
+		if midDialogRequest {
+			addCallEvent(record, item, entity.CallEventSessionRefresh, sessionExpiresDetail(item.SessionExpires))
+		}
+		return
+	}
+
+	if !session.t38 {
+		for _, media := range item.SDP.Media {
+			if media.MediaType == "image" && media.Port > 0 && strings.EqualFold(media.Proto, "udptl") {
+				session.t38 = true
+				addCallEvent(record, item, entity.CallEventT38, media.Endpoint())
+				break
+			}
+		}
+	}
+
+	current := item.SDP.AudioMedia()
+	if current == nil {
+		return
+	}
+
+	// 保持/恢复只看请求中的offer，应答方的recvonly不代表保持
+	if midDialogRequest {
+		held := isHoldMedia(current)
+		if held && !session.held {
+			addCallEvent(record, item, entity.CallEventHold, holdDetail(current))
+		} else if !held && session.held {
+			addCallEvent(record, item, entity.CallEventResume, current.Direction)
+		}
+		session.held = held
+	}
+
+	last := previous.AudioMedia()
+	if last == nil {
+		return
+	}
+
+	lastCodec, currentCodec := last.PrimaryCodec(), current.PrimaryCodec()
+	if lastCodec != "" && currentCodec != "" && lastCodec != currentCodec {
+		addCallEvent(record, item, entity.CallEventCodecChange, lastCodec+" -> "+currentCodec)
+	}
+
+	// c=0.0.0.0 的保持、端口为0的关闭（如切换到T.38）不算媒体地址变更
+	if !isHoldMedia(last) && !isHoldMedia(current) && last.Port > 0 && current.Port > 0 &&
+		last.Endpoint() != current.Endpoint() {
+		addCallEvent(record, item, entity.CallEventMediaAddrChange, last.Endpoint()+" -> "+current.Endpoint())
+	}
+}
+
+// 判断媒体是否为保持状态：sendonly/inactive，或RFC 2543风格的c=0.0.0.0。
+// ICE协商时c=0.0.0.0表示候选地址通过trickle ICE另行发送，不是保持
+func isHoldMedia(media *entity.SDPMedia) bool {
+	return media.Direction == "sendonly" || media.Direction == "inactive" || isZeroAddrHold(media)
+}
+
+func isZeroAddrHold(media *entity.SDPMedia) bool {
+	return media.Addr == "0.0.0.0" && !media.ICE
+}
+
+func holdDetail(media *entity.SDPMedia) string {
+	if isZeroAddrHold(media) {
+		return "c=0.0.0.0"
+	}
+	return media.Direction
+}
+
+func sessionExpiresDetail(sessionExpires int) string {
+	if sessionExpires <= 0 {
+		return ""
+	}
+	return "Session-Expires: " + strconv.Itoa(sessionExpires)
+}
+
+func addCallEvent(record *entity.Call, item entity.SIP, eventType string, detail string) {
+	if len(record.Events) >= maxCallEvents {
+		return
+	}
+	record.Events = append(record.Events, entity.CallEvent{
+		SIPCallID:      record.SIPCallID,
+		EventType:      eventType,
+		Method:         item.Title,
+		Detail:         detail,
+		SrcAddr:        item.SrcAddr,
+		DstAddr:        item.DstAddr,
+		CreateTime:     item.CreateTime,
+		TimestampMicro: item.TimestampMicro,
+	})
+}
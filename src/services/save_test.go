@@ -2,10 +2,27 @@ package services
 
 import (
 	"encoding/json"
+	"reflect"
 	"sip-monitor/src/entity"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
 )
 
+// 只在内存缓存中处理呼叫，不启动入库协程
+func newTestSaveService() *SaveService {
+	return &SaveService{
+		logger:          logrus.New(),
+		callRecordCache: make(map[string]*entity.Call),
+		mediaSessions:   make(map[string]*mediaSession),
+		gateways:        NewGatewayResolver(nil),
+	}
+}
+
 // 测试被叫返回486 CallID:c3a31dd0-911c-123e-0e90-00163e0fafd1
 func TestSaveService_Save486(t *testing.T) {
 	//todo:: 486 Busy Here
@@ -182,3 +199,285 @@ func TestSaveService_Save487(t *testing.T) {
 func TestSaveService_NormalCall(t *testing.T) {
 	//todo:: 正常通话
 }
+
+// 超长的自定义Header头按字段长度截断，不截断多字节字符
+func TestMergeCallAttributes_Truncate(t *testing.T) {
+	name := strings.Repeat("X", 70)
+	record := &entity.Call{Attributes: map[string]string{"X-Keep": "old"}}
+	mergeCallAttributes(record, map[string]string{
+		"X-Keep": "new",
+		name:     strings.Repeat("中", 300),
+		"X-Bad":  "a\xffb",
+	})
+
+	if record.Attributes["X-Keep"] != "old" {
+		t.Errorf("已存在的属性被覆盖：%q", record.Attributes["X-Keep"])
+	}
+	value, ok := record.Attributes[name[:entity.CallAttributeNameMaxLen]]
+	if !ok {
+		t.Fatalf("属性名没有截断到%d个字符：%v", entity.CallAttributeNameMaxLen, record.Attributes)
+	}
+	if !utf8.ValidString(value) || utf8.RuneCountInString(value) != entity.CallAttributeValueMaxLen {
+		t.Errorf("属性值截断后有%d个字符", utf8.RuneCountInString(value))
+	}
+	if record.Attributes["X-Bad"] != "a?b" {
+		t.Errorf("非法UTF-8字符没有替换：%q", record.Attributes["X-Bad"])
+	}
+}
+
+// 主叫身份和转移相关的Header按字段长度截断，超长时不能导致呼叫写入失败
+func TestSaveService_TruncateIdentityHeaders(t *testing.T) {
+	s := newTestSaveService()
+	s.updateCallRecordInCache(entity.SIP{
+		CallID: "identity", Title: "INVITE", CSeqMethod: "INVITE", IsRequest: true,
+		AssertedUser:       strings.Repeat("1", 200),
+		AssertedName:       strings.Repeat("张", 200),
+		Privacy:            strings.Repeat("id;", 40),
+		OriginalCalledUser: strings.Repeat("2", 200),
+		DiversionReason:    "unconditional\xff" + strings.Repeat("x", 40),
+	})
+	record := s.callRecordCache["identity"]
+	if record == nil {
+		t.Fatal("INVITE应创建呼叫")
+	}
+	for name, c := range map[string]struct {
+		value string
+		max   int
+	}{
+		"asserted_user":        {record.AssertedUser, 120},
+		"asserted_name":        {record.AssertedName, 120},
+		"privacy":              {record.Privacy, 60},
+		"original_called_user": {record.OriginalCalledUser, 120},
+		"diversion_reason":     {record.DiversionReason, 30},
+	} {
+		if !utf8.ValidString(c.value) || utf8.RuneCountInString(c.value) != c.max {
+			t.Errorf("%s 应截断到%d个字符，得到%q", name, c.max, c.value)
+		}
+	}
+	if !strings.HasPrefix(record.DiversionReason, "unconditional?") {
+		t.Errorf("非法UTF-8字符没有替换：%q", record.DiversionReason)
+	}
+}
+
+// offer中的编码和媒体类型列表按字段长度截断
+func TestApplySDPNegotiation_Truncate(t *testing.T) {
+	s := newTestSaveService()
+	media := entity.SDPMedia{MediaType: "audio", Addr: "10.0.0.1", Port: 4000, Direction: "sendrecv"}
+	for i := 0; i < 100; i++ {
+		media.Codecs = append(media.Codecs, "telephone-event")
+	}
+	sdp := &entity.SDP{Media: []entity.SDPMedia{media}}
+	for i := 0; i < 10; i++ {
+		sdp.Media = append(sdp.Media, entity.SDPMedia{MediaType: "application", Port: 5000})
+	}
+	s.updateCallRecordInCache(entity.SIP{CallID: "codecs", Title: "INVITE", CSeqMethod: "INVITE", IsRequest: true, SDP: sdp})
+
+	record := s.callRecordCache["codecs"]
+	if len(record.OfferCodecs) != 255 || len(record.MediaTypes) != 30 {
+		t.Errorf("应截断到字段长度，得到offer_codecs %d个字符，media_types %d个字符", len(record.OfferCodecs), len(record.MediaTypes))
+	}
+}
+
+func testSDP(version string, media ...entity.SDPMedia) *entity.SDP {
+	return &entity.SDP{SessionID: "1001", SessionVersion: version, Media: media}
+}
+
+func testAudio(addr string, direction, codec string) entity.SDPMedia {
+	return entity.SDPMedia{MediaType: "audio", Addr: addr, Port: 4000, Proto: "RTP/AVP", Codecs: []string{codec}, Direction: direction}
+}
+
+func TestTrackMediaEvents(t *testing.T) {
+	const caller, callee = "10.0.0.1:5060", "10.0.0.2:5060"
+	offer := testSDP("1", testAudio("10.0.0.1", "sendrecv", "PCMU"))
+	answer := testSDP("1", testAudio("10.0.0.2", "sendrecv", "PCMU"))
+	invite := entity.SIP{Title: "INVITE", CSeqMethod: "INVITE", IsRequest: true, SrcAddr: caller, DstAddr: callee, SDP: offer}
+	ok := entity.SIP{Title: "200", CSeqMethod: "INVITE", SrcAddr: callee, DstAddr: caller, SDP: answer}
+	reinvite := func(sdp *entity.SDP) entity.SIP {
+		return entity.SIP{Title: "INVITE", CSeqMethod: "INVITE", IsRequest: true, SrcAddr: caller, DstAddr: callee, SDP: sdp}
+	}
+
+	type step struct {
+		item     entity.SIP
+		answered bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		want  []string
+	}{
+		{
+			name: "183早期媒体",
+			steps: []step{
+				{item: invite},
+				{item: entity.SIP{Title: "183", CSeqMethod: "INVITE", SrcAddr: callee, DstAddr: caller, SDP: answer}},
+				{item: entity.SIP{Title: "180", CSeqMethod: "INVITE", SrcAddr: callee, DstAddr: caller, SDP: answer}},
+				{item: ok, answered: true},
+			},
+			want: []string{entity.CallEventEarlyMedia},
+		},
+		{
+			name: "sendonly保持",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: reinvite(testSDP("2", testAudio("10.0.0.1", "sendonly", "PCMU"))), answered: true},
+			},
+			want: []string{entity.CallEventHold},
+		},
+		{
+			name: "inactive保持",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: reinvite(testSDP("2", testAudio("10.0.0.1", "inactive", "PCMU"))), answered: true},
+			},
+			want: []string{entity.CallEventHold},
+		},
+		{
+			name: "c=0.0.0.0保持，不算媒体地址变更",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: reinvite(testSDP("2", testAudio("0.0.0.0", "sendrecv", "PCMU"))), answered: true},
+			},
+			want: []string{entity.CallEventHold},
+		},
+		{
+			name: "保持后恢复",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: reinvite(testSDP("2", testAudio("10.0.0.1", "sendonly", "PCMU"))), answered: true},
+				{item: reinvite(testSDP("3", testAudio("10.0.0.1", "sendrecv", "PCMU"))), answered: true},
+			},
+			want: []string{entity.CallEventHold, entity.CallEventResume},
+		},
+		{
+			name: "应答方recvonly不算保持",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: entity.SIP{Title: "200", CSeqMethod: "INVITE", SrcAddr: callee, DstAddr: caller,
+					SDP: testSDP("2", testAudio("10.0.0.2", "recvonly", "PCMU"))}, answered: true},
+			},
+		},
+		{
+			name: "通话中编码变更",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: reinvite(testSDP("2", testAudio("10.0.0.1", "sendrecv", "G729"))), answered: true},
+			},
+			want: []string{entity.CallEventCodecChange},
+		},
+		{
+			name: "媒体地址变更",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: reinvite(testSDP("2", testAudio("10.0.0.9", "sendrecv", "PCMU"))), answered: true},
+			},
+			want: []string{entity.CallEventMediaAddrChange},
+		},
+		{
+			name: "o=版本未变的会话刷新",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: reinvite(testSDP("1", testAudio("10.0.0.9", "sendonly", "G729"))), answered: true},
+			},
+			want: []string{entity.CallEventSessionRefresh},
+		},
+		{
+			name: "不带SDP的UPDATE会话刷新",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: entity.SIP{Title: "UPDATE", CSeqMethod: "UPDATE", IsRequest: true, SrcAddr: caller, DstAddr: callee, SessionExpires: 1800}, answered: true},
+			},
+			want: []string{entity.CallEventSessionRefresh},
+		},
+		{
+			name: "切换到T.38",
+			steps: []step{
+				{item: invite}, {item: ok},
+				{item: reinvite(testSDP("2",
+					entity.SDPMedia{MediaType: "audio", Addr: "10.0.0.1", Port: 0, Proto: "RTP/AVP", Codecs: []string{"PCMU"}},
+					entity.SDPMedia{MediaType: "image", Addr: "10.0.0.1", Port: 5000, Proto: "udptl", Codecs: []string{"t38"}},
+				)), answered: true},
+			},
+			want: []string{entity.CallEventT38},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSaveService()
+			record := &entity.Call{SIPCallID: "media"}
+			for _, st := range tt.steps {
+				if st.answered && record.AnswerTime == nil {
+					now := time.Now()
+					record.AnswerTime = &now
+				}
+				st.item.CallID = "media"
+				s.trackMediaEvents(record, st.item)
+			}
+			var got []string
+			for _, event := range record.Events {
+				got = append(got, event.EventType)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("事件为%v，应为%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySDPNegotiation(t *testing.T) {
+	offer := testSDP("1", testAudio("10.0.0.1", "sendrecv", "PCMU"), entity.SDPMedia{MediaType: "video", Addr: "10.0.0.1", Port: 4002})
+	offer.Media[0].Codecs = []string{"PCMU", "PCMA", "telephone-event"}
+	answer := testSDP("1", testAudio("10.0.0.2", "sendrecv", "PCMA"))
+	reoffer := testSDP("2", testAudio("10.0.0.9", "sendonly", "G729"))
+
+	tests := []struct {
+		name  string
+		items []entity.SIP
+		want  entity.Call
+	}{
+		{
+			name: "INVITE中的offer由200应答",
+			items: []entity.SIP{
+				{CSeqMethod: "INVITE", IsRequest: true, SDP: offer},
+				{CSeqMethod: "INVITE", SDP: answer},
+				{CSeqMethod: "INVITE", IsRequest: true, SDP: reoffer},
+			},
+			want: entity.Call{MediaTypes: "audio,video", OfferCodecs: "PCMU,PCMA,telephone-event", OfferMediaAddr: "10.0.0.1:4000",
+				NegotiatedCodec: "PCMA", AnswerMediaAddr: "10.0.0.2:4000", MediaDirection: "sendrecv"},
+		},
+		{
+			name: "200中的延迟offer由ACK应答",
+			items: []entity.SIP{
+				{CSeqMethod: "ACK", IsRequest: true, SDP: answer},
+				{CSeqMethod: "INVITE", SDP: offer},
+				{CSeqMethod: "INVITE", SDP: reoffer},
+				{CSeqMethod: "ACK", IsRequest: true, SDP: answer},
+			},
+			want: entity.Call{MediaTypes: "audio,video", OfferCodecs: "PCMU,PCMA,telephone-event", OfferMediaAddr: "10.0.0.1:4000",
+				NegotiatedCodec: "PCMA", AnswerMediaAddr: "10.0.0.2:4000", MediaDirection: "sendrecv"},
+		},
+		{
+			name: "非INVITE事务不参与协商",
+			items: []entity.SIP{
+				{CSeqMethod: "UPDATE", IsRequest: true, SDP: offer},
+				{CSeqMethod: "UPDATE", SDP: answer},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSaveService()
+			record := &entity.Call{}
+			for _, item := range tt.items {
+				item.CallID = "negotiation"
+				s.applySDPNegotiation(record, item)
+			}
+			got := entity.Call{MediaTypes: record.MediaTypes, OfferCodecs: record.OfferCodecs, OfferMediaAddr: record.OfferMediaAddr,
+				NegotiatedCodec: record.NegotiatedCodec, AnswerMediaAddr: record.AnswerMediaAddr, MediaDirection: record.MediaDirection}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("协商结果为%+v，应为%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,460 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StatService 话务KPI统计：ASR、NER、ACD、PDD、振铃时长和并发峰值，
+// 按网关/源/目的/节点/挂断码分组，按5m/1h/1d分时间段
+type StatService struct {
+	repository model.Repository
+	location   *time.Location
+
+	// 写入汇总表时匹配网关用
+	mu       sync.RWMutex
+	resolver *GatewayResolver
+
+	// 实时并发，记录各粒度时间段的峰值，定时写入并发峰值汇总
+	peakMu  sync.Mutex
+	active  map[string][]liveKey // SIP Call-ID -> 呼叫计入的分组
+	current map[liveKey]int64
+	peaks   map[peakKey]int64
+}
+
+func NewStatService(repository model.Repository) *StatService {
+	s := &StatService{
+		repository: repository,
+		location:   time.Local,
+		active:     make(map[string][]liveKey),
+		current:    make(map[liveKey]int64),
+		peaks:      make(map[peakKey]int64),
+	}
+	s.ReloadGateways()
+	go s.runner()
+	return s
+}
+
+// ReloadGateways 重新加载网关列表
+func (s *StatService) ReloadGateways() {
+	gateways, err := s.repository.GatewayList()
+	if err != nil {
+		logrus.WithError(err).Error("加载网关列表失败")
+		return
+	}
+	s.mu.Lock()
+	s.resolver = NewGatewayResolver(gateways)
+	s.mu.Unlock()
+}
+
+// 计入NER的用户侧失败：忙、无应答、主叫取消、拒接
+var effectiveHangupCodes = map[int]struct{}{
+	480: {},
+	486: {},
+	487: {},
+	600: {},
+	603: {},
+}
+
+// kpiAccumulator 累加一个分组一个时间段的指标，只保存总和以便合并
+type kpiAccumulator struct {
+	Total          int64
+	Answered       int64
+	Effective      int64
+	TalkSeconds    int64
+	PDDMsSum       int64
+	PDDCount       int64
+	RingMsSum      int64
+	RingCount      int64
+	PeakConcurrent int64
+	MosSum         float64
+	MosCount       int64
+}
+
+func (a *kpiAccumulator) add(row entity.CallStatRow) {
+	a.Total++
+
+	answered := row.AnswerTime != nil || row.TalkDuration > 0
+	if answered {
+		a.Answered++
+		a.Effective++
+		a.TalkSeconds += int64(row.TalkDuration)
+	} else if _, ok := effectiveHangupCodes[row.HangupCode]; ok {
+		a.Effective++
+	}
+
+	if row.CreateTime != nil && row.RingingTime != nil && !row.RingingTime.Before(*row.CreateTime) {
+		a.PDDMsSum += row.RingingTime.Sub(*row.CreateTime).Milliseconds()
+		a.PDDCount++
+
+		ringEnd := row.AnswerTime
+		if ringEnd == nil {
+			ringEnd = row.EndTime
+		}
+		if ringEnd != nil && !ringEnd.Before(*row.RingingTime) {
+			a.RingMsSum += ringEnd.Sub(*row.RingingTime).Milliseconds()
+			a.RingCount++
+		}
+	}
+
+	if mos := callMos(row); mos > 0 {
+		a.MosSum += mos
+		a.MosCount++
+	}
+}
+
+// callMos 呼叫的MOS取两个方向中较差的一个，没有RTCP报告时为0
+func callMos(row entity.CallStatRow) float64 {
+	mos := row.AlegMos
+	if row.BlegMos > 0 && (mos <= 0 || row.BlegMos < mos) {
+		mos = row.BlegMos
+	}
+	return mos
+}
+
+func (a *kpiAccumulator) addRollup(rollup entity.CallRollup) {
+	a.merge(&kpiAccumulator{
+		Total:       rollup.Total,
+		Answered:    rollup.Answered,
+		Effective:   rollup.Effective,
+		TalkSeconds: rollup.TalkSeconds,
+		PDDMsSum:    rollup.PDDMsSum,
+		PDDCount:    rollup.PDDCount,
+		RingMsSum:   rollup.RingMsSum,
+		RingCount:   rollup.RingCount,
+		MosSum:      rollup.MosSum,
+		MosCount:    rollup.MosCount,
+	})
+}
+
+func (a *kpiAccumulator) merge(b *kpiAccumulator) {
+	a.Total += b.Total
+	a.Answered += b.Answered
+	a.Effective += b.Effective
+	a.TalkSeconds += b.TalkSeconds
+	a.PDDMsSum += b.PDDMsSum
+	a.PDDCount += b.PDDCount
+	a.RingMsSum += b.RingMsSum
+	a.RingCount += b.RingCount
+	a.MosSum += b.MosSum
+	a.MosCount += b.MosCount
+	if b.PeakConcurrent > a.PeakConcurrent {
+		a.PeakConcurrent = b.PeakConcurrent
+	}
+}
+
+func (a *kpiAccumulator) fill(vo *entity.CallKPIVO) {
+	vo.Total = a.Total
+	vo.Answered = a.Answered
+	vo.Effective = a.Effective
+	vo.TalkSeconds = a.TalkSeconds
+	vo.PeakConcurrent = a.PeakConcurrent
+	if a.Total > 0 {
+		vo.ASR = float64(a.Answered) * 100 / float64(a.Total)
+		vo.NER = float64(a.Effective) * 100 / float64(a.Total)
+	}
+	if a.Answered > 0 {
+		vo.ACD = float64(a.TalkSeconds) / float64(a.Answered)
+	}
+	if a.PDDCount > 0 {
+		vo.AvgPDDMs = float64(a.PDDMsSum) / float64(a.PDDCount)
+	}
+	if a.RingCount > 0 {
+		vo.AvgRingSeconds = float64(a.RingMsSum) / float64(a.RingCount) / 1000
+	}
+	if a.MosCount > 0 {
+		vo.AvgMOS = a.MosSum / float64(a.MosCount)
+	}
+}
+
+type kpiKey struct {
+	bucket int64 // 时间段开始的Unix时间，不分时间段时为0
+	group  string
+}
+
+// groupResolver 加载分组需要的网关和运营商
+func (s *StatService) groupResolver(groupBy string) (*statGroupResolver, error) {
+	gateways, err := s.repository.GatewayList()
+	if err != nil {
+		return nil, err
+	}
+	var carriers []entity.Carrier
+	if groupBy == entity.StatGroupCarrier {
+		if carriers, err = s.repository.CarrierList(); err != nil {
+			return nil, err
+		}
+	}
+	return newStatGroupResolver(groupBy, gateways, carriers), nil
+}
+
+// 并发计算用的呼叫开始/结束事件
+type concurrencyEvent struct {
+	at    time.Time
+	delta int64
+}
+
+// CallKPI 计算时间段内的KPI
+func (s *StatService) CallKPI(ctx context.Context, params entity.CallStatDTO) ([]*entity.CallKPIVO, error) {
+	return s.callKPI(ctx, params, true)
+}
+
+// CallStat 按网关统计呼叫数和挂断码分布。起止时间与汇总粒度对齐时读汇总表，
+// 否则按目的地址查询明细，再按网关地址规则匹配所属网关
+func (s *StatService) CallStat(ctx context.Context, params entity.CallStatDTO) ([]*entity.CallStatVO, error) {
+	gateways, err := s.repository.GatewayList()
+	if err != nil {
+		return nil, err
+	}
+
+	if params.BeginTime != nil && params.EndTime != nil {
+		granularity := s.pickRollup(entity.CallStatDTO{GroupBy: entity.StatGroupGateway}, *params.BeginTime, *params.EndTime)
+		if granularity != "" {
+			stats, err := s.callStatFromRollups(ctx, granularity, *params.BeginTime, *params.EndTime, gateways)
+			if err != nil || len(stats) > 0 {
+				return stats, err
+			}
+		}
+	}
+
+	stats, err := s.repository.GetCallStat(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	resolver := NewGatewayResolver(gateways)
+	for _, stat := range stats {
+		if gateway := resolver.Match(stat.IP); gateway != nil {
+			stat.Gateway = gateway.Name
+		}
+	}
+	return stats, nil
+}
+
+// callKPI allowRollup为false时总是查询明细，用于需要MOS、并发峰值的统计
+func (s *StatService) callKPI(ctx context.Context, params entity.CallStatDTO, allowRollup bool) ([]*entity.CallKPIVO, error) {
+	if err := validateStatParams(params); err != nil {
+		return nil, err
+	}
+	beginTime, endTime := statTimeRange(params)
+
+	resolver, err := s.groupResolver(params.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	// 汇总表覆盖查询时直接使用，没有汇总数据（如尚未回填）时再查明细
+	if granularity := s.pickRollup(params, beginTime, endTime); granularity != "" {
+		kpi, err := s.callKPIFromRollups(ctx, params, granularity, beginTime, endTime, resolver)
+		if err != nil || len(kpi) > 0 {
+			return kpi, err
+		}
+	}
+
+	accumulators := make(map[kpiKey]*kpiAccumulator)
+	events := make(map[string][]concurrencyEvent)
+
+	err = s.repository.IterateCallStatRows(ctx, beginTime, endTime, func(row entity.CallStatRow) error {
+		if row.CreateTime == nil {
+			return nil
+		}
+		group := resolver.group(row)
+		key := kpiKey{bucket: s.bucketStart(*row.CreateTime, params.Interval), group: group}
+		acc, ok := accumulators[key]
+		if !ok {
+			acc = &kpiAccumulator{}
+			accumulators[key] = acc
+		}
+		acc.add(row)
+
+		end := *row.CreateTime
+		if row.EndTime != nil && row.EndTime.After(end) {
+			end = *row.EndTime
+		}
+		events[group] = append(events[group], concurrencyEvent{at: *row.CreateTime, delta: 1}, concurrencyEvent{at: end, delta: -1})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.applyConcurrencyPeaks(accumulators, events, params.Interval)
+
+	out := make([]*entity.CallKPIVO, 0, len(accumulators))
+	for key, acc := range accumulators {
+		vo := &entity.CallKPIVO{Group: key.group, GroupName: resolver.name(key.group), Source: "calls"}
+		if params.Interval != "" {
+			bucketTime := time.Unix(key.bucket, 0).In(s.location)
+			vo.BucketTime = &bucketTime
+		}
+		acc.fill(vo)
+		out = append(out, vo)
+	}
+	sortCallKPI(out)
+	return out, nil
+}
+
+// applyConcurrencyPeaks 按时间顺序扫描呼叫的开始和结束，记录每个时间段的最大并发
+func (s *StatService) applyConcurrencyPeaks(accumulators map[kpiKey]*kpiAccumulator, events map[string][]concurrencyEvent, interval string) {
+	for group, groupEvents := range events {
+		sortConcurrencyEvents(groupEvents)
+
+		var current int64
+		for _, event := range groupEvents {
+			current += event.delta
+			acc, ok := accumulators[kpiKey{bucket: s.bucketStart(event.at, interval), group: group}]
+			if ok && current > acc.PeakConcurrent {
+				acc.PeakConcurrent = current
+			}
+		}
+	}
+}
+
+// sortConcurrencyEvents 按时间排序，同一时刻先结束再开始，首尾相接的呼叫不算并发
+func sortConcurrencyEvents(events []concurrencyEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+}
+
+// bucketStart 返回时间所在时间段的开始时间
+func (s *StatService) bucketStart(t time.Time, interval string) int64 {
+	t = t.In(s.location)
+	switch interval {
+	case entity.StatInterval5m:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()-t.Minute()%5, 0, 0, s.location).Unix()
+	case entity.StatInterval1h:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.location).Unix()
+	case entity.StatInterval1d:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location).Unix()
+	case entity.StatInterval1mo:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.location).Unix()
+	}
+	return 0
+}
+
+func validateStatParams(params entity.CallStatDTO) error {
+	switch params.GroupBy {
+	case "", entity.StatGroupGateway, entity.StatGroupCarrier, entity.StatGroupSrc, entity.StatGroupDst, entity.StatGroupNode, entity.StatGroupCause:
+	default:
+		return fmt.Errorf("不支持的分组维度: %s", params.GroupBy)
+	}
+	switch params.Interval {
+	case "", entity.StatInterval5m, entity.StatInterval1h, entity.StatInterval1d, entity.StatInterval1mo:
+	default:
+		return fmt.Errorf("不支持的时间粒度: %s", params.Interval)
+	}
+	return nil
+}
+
+// statTimeRange 默认统计最近24小时
+func statTimeRange(params entity.CallStatDTO) (time.Time, time.Time) {
+	endTime := time.Now()
+	if params.EndTime != nil {
+		endTime = *params.EndTime
+	}
+	beginTime := endTime.Add(-24 * time.Hour)
+	if params.BeginTime != nil {
+		beginTime = *params.BeginTime
+	}
+	return beginTime, endTime
+}
+
+func sortCallKPI(out []*entity.CallKPIVO) {
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].BucketTime != nil && out[j].BucketTime != nil && !out[i].BucketTime.Equal(*out[j].BucketTime) {
+			return out[i].BucketTime.Before(*out[j].BucketTime)
+		}
+		return out[i].Group < out[j].Group
+	})
+}
+
+// statGroupResolver 计算呼叫所属的分组
+type statGroupResolver struct {
+	groupBy  string
+	gateways *GatewayResolver
+	byID     map[int64]*entity.Gateway
+	names    map[string]string
+}
+
+func newStatGroupResolver(groupBy string, gateways []entity.Gateway, carriers []entity.Carrier) *statGroupResolver {
+	r := &statGroupResolver{
+		groupBy:  groupBy,
+		gateways: NewGatewayResolver(gateways),
+		byID:     make(map[int64]*entity.Gateway, len(gateways)),
+		names:    make(map[string]string),
+	}
+	for i := range gateways {
+		r.byID[gateways[i].ID] = &gateways[i]
+	}
+	switch groupBy {
+	case entity.StatGroupGateway:
+		for _, gateway := range gateways {
+			r.names[strconv.FormatInt(gateway.ID, 10)] = gateway.Name
+		}
+	case entity.StatGroupCarrier:
+		for _, carrier := range carriers {
+			r.names[strconv.FormatInt(carrier.ID, 10)] = carrier.Name
+		}
+	}
+	return r
+}
+
+func (r *statGroupResolver) group(row entity.CallStatRow) string {
+	switch r.groupBy {
+	case entity.StatGroupGateway, entity.StatGroupCarrier:
+		// 呼出按出口网关，呼入按入口网关
+		gateway, _ := r.gateways.Primary(row.SrcAddr, row.DstAddr)
+		return r.gatewayGroup(gateway)
+	case entity.StatGroupSrc:
+		return addrHost(row.SrcAddr)
+	case entity.StatGroupDst:
+		return addrHost(row.DstAddr)
+	case entity.StatGroupNode:
+		return row.NodeIP
+	case entity.StatGroupCause:
+		return strconv.Itoa(row.HangupCode)
+	}
+	return ""
+}
+
+// gatewayGroup 网关所在的分组：按网关分组为网关ID，按运营商分组为运营商ID
+// 网关地址可以包含多个模式且会被修改，不能作为分组的值
+func (r *statGroupResolver) gatewayGroup(gateway *entity.Gateway) string {
+	if gateway == nil {
+		return ""
+	}
+	switch r.groupBy {
+	case entity.StatGroupGateway:
+		return strconv.FormatInt(gateway.ID, 10)
+	case entity.StatGroupCarrier:
+		if gateway.CarrierID > 0 {
+			return strconv.FormatInt(gateway.CarrierID, 10)
+		}
+	}
+	return ""
+}
+
+func (r *statGroupResolver) name(group string) string {
+	return r.names[group]
+}
+
+// addrHost 返回 ip:port 中的IP
+func addrHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
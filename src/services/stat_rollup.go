@@ -0,0 +1,493 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sip-monitor/src/entity"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 汇总表的粒度，从粗到细
+var rollupGranularities = []string{entity.RollupDay, entity.RollupHour, entity.RollupMinute}
+
+// ApplyCall 呼叫写入数据库后累加到汇总表
+func (s *StatService) ApplyCall(call *entity.Call) {
+	row := callStatRow(call)
+	if row.CreateTime == nil {
+		return
+	}
+
+	s.mu.RLock()
+	rollups := s.callRollups(row, s.resolver)
+	s.mu.RUnlock()
+
+	if err := s.repository.IncrCallRollups(context.Background(), rollups); err != nil {
+		logrus.WithError(err).WithField("sip_call_id", call.SIPCallID).Error("更新呼叫汇总失败")
+	}
+}
+
+// ApplyReport RTCP报告保存后把呼叫的MOS累加到汇总表
+func (s *StatService) ApplyReport(call *entity.Call, report *entity.RtcpReport) {
+	row := callStatRow(call)
+	row.AlegMos, row.BlegMos = report.AlegMos, report.BlegMos
+	mos := callMos(row)
+	if row.CreateTime == nil || mos <= 0 {
+		return
+	}
+
+	s.mu.RLock()
+	rollups := s.rollupKeys(row, s.resolver)
+	s.mu.RUnlock()
+	for i := range rollups {
+		rollups[i].MosSum = mos
+		rollups[i].MosCount = 1
+	}
+
+	if err := s.repository.IncrCallRollups(context.Background(), rollups); err != nil {
+		logrus.WithError(err).WithField("sip_call_id", call.SIPCallID).Error("更新呼叫汇总MOS失败")
+	}
+}
+
+func callStatRow(call *entity.Call) entity.CallStatRow {
+	return entity.CallStatRow{
+		CreateTime:   call.CreateTime,
+		RingingTime:  call.RingingTime,
+		AnswerTime:   call.AnswerTime,
+		EndTime:      call.EndTime,
+		TalkDuration: call.TalkDuration,
+		HangupCode:   call.HangupCode,
+		SrcAddr:      call.SrcAddr,
+		DstAddr:      call.DstAddr,
+		NodeIP:       call.NodeIP,
+	}
+}
+
+// callRollups 计算一个呼叫在各粒度汇总中的增量
+func (s *StatService) callRollups(row entity.CallStatRow, resolver *GatewayResolver) []entity.CallRollup {
+	var acc kpiAccumulator
+	acc.add(row)
+
+	rollups := s.rollupKeys(row, resolver)
+	for i := range rollups {
+		rollup := &rollups[i]
+		rollup.Total = acc.Total
+		rollup.Answered = acc.Answered
+		rollup.Effective = acc.Effective
+		rollup.TalkSeconds = acc.TalkSeconds
+		rollup.PDDMsSum = acc.PDDMsSum
+		rollup.PDDCount = acc.PDDCount
+		rollup.RingMsSum = acc.RingMsSum
+		rollup.RingCount = acc.RingCount
+		rollup.MosSum = acc.MosSum
+		rollup.MosCount = acc.MosCount
+	}
+	return rollups
+}
+
+// rollupKeys 返回呼叫在各粒度中所属的汇总行，不含累加值
+func (s *StatService) rollupKeys(row entity.CallStatRow, resolver *GatewayResolver) []entity.CallRollup {
+	var gatewayID int64
+	gateway, direction := resolver.Primary(row.SrcAddr, row.DstAddr)
+	if gateway != nil {
+		gatewayID = gateway.ID
+	}
+	rollups := make([]entity.CallRollup, 0, len(rollupGranularities))
+	for _, granularity := range rollupGranularities {
+		rollups = append(rollups, entity.CallRollup{
+			Granularity: granularity,
+			BucketTime:  time.Unix(s.rollupBucket(*row.CreateTime, granularity), 0),
+			GatewayID:   gatewayID,
+			Direction:   direction,
+			HangupClass: entity.HangupClass(row.HangupCode),
+		})
+	}
+	return rollups
+}
+
+// rollupBucket 返回时间在汇总粒度中的时间段开始
+func (s *StatService) rollupBucket(t time.Time, granularity string) int64 {
+	if granularity == entity.RollupMinute {
+		t = t.In(s.location)
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, s.location).Unix()
+	}
+	return s.bucketStart(t, granularity)
+}
+
+// pickRollup 选择能满足查询的最粗的汇总粒度：分组维度在汇总表中，
+// 查询的时间粒度是汇总粒度的整数倍，且起止时间与汇总粒度对齐。返回空表示需要查询明细
+func (s *StatService) pickRollup(params entity.CallStatDTO, beginTime, endTime time.Time) string {
+	switch params.GroupBy {
+	case "", entity.StatGroupGateway, entity.StatGroupCarrier:
+	default:
+		return ""
+	}
+	for _, granularity := range rollupGranularities {
+		if !rollupFitsInterval(granularity, params.Interval) {
+			continue
+		}
+		if s.rollupBucket(beginTime, granularity) == beginTime.Unix() && s.rollupBucket(endTime, granularity) == endTime.Unix() {
+			return granularity
+		}
+	}
+	return ""
+}
+
+func rollupFitsInterval(granularity string, interval string) bool {
+	switch interval {
+	case entity.StatInterval5m:
+		return granularity == entity.RollupMinute
+	case entity.StatInterval1h:
+		return granularity != entity.RollupDay
+	}
+	return true
+}
+
+// callKPIFromRollups 从汇总表计算KPI，并发峰值取同一粒度的并发峰值汇总
+func (s *StatService) callKPIFromRollups(ctx context.Context, params entity.CallStatDTO, granularity string, beginTime, endTime time.Time,
+	resolver *statGroupResolver) ([]*entity.CallKPIVO, error) {
+	rollups, err := s.repository.GetCallRollups(ctx, granularity, beginTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	accumulators := make(map[kpiKey]*kpiAccumulator)
+	for _, rollup := range rollups {
+		key := kpiKey{bucket: s.bucketStart(rollup.BucketTime, params.Interval)}
+		key.group = resolver.gatewayGroup(resolver.byID[rollup.GatewayID])
+		acc, ok := accumulators[key]
+		if !ok {
+			acc = &kpiAccumulator{}
+			accumulators[key] = acc
+		}
+		acc.addRollup(rollup)
+	}
+
+	peaks, err := s.repository.GetConcurrencyRollups(ctx, granularity, params.GroupBy, beginTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, peak := range peaks {
+		acc, ok := accumulators[kpiKey{bucket: s.bucketStart(peak.BucketTime, params.Interval), group: peak.GroupKey}]
+		if ok && peak.Peak > acc.PeakConcurrent {
+			acc.PeakConcurrent = peak.Peak
+		}
+	}
+
+	out := make([]*entity.CallKPIVO, 0, len(accumulators))
+	for key, acc := range accumulators {
+		vo := &entity.CallKPIVO{Group: key.group, GroupName: resolver.name(key.group), Source: "rollup:" + granularity}
+		if params.Interval != "" {
+			bucketTime := time.Unix(key.bucket, 0).In(s.location)
+			vo.BucketTime = &bucketTime
+		}
+		acc.fill(vo)
+		out = append(out, vo)
+	}
+	sortCallKPI(out)
+	return out, nil
+}
+
+// callStatFromRollups 从汇总表按网关统计呼叫数和挂断码分布，IP为逗号连接的网关地址规则
+func (s *StatService) callStatFromRollups(ctx context.Context, granularity string, beginTime, endTime time.Time,
+	gateways []entity.Gateway) ([]*entity.CallStatVO, error) {
+	rollups, err := s.repository.GetCallRollups(ctx, granularity, beginTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[int64]*entity.CallStatVO)
+	for _, rollup := range rollups {
+		stat, ok := stats[rollup.GatewayID]
+		if !ok {
+			stat = &entity.CallStatVO{}
+			for _, gateway := range gateways {
+				if gateway.ID == rollup.GatewayID {
+					stat.IP = strings.Join(gateway.Addrs, ",")
+					stat.Gateway = gateway.Name
+				}
+			}
+			stats[rollup.GatewayID] = stat
+		}
+		stat.Total += int(rollup.Total)
+		stat.Answered += int(rollup.Answered)
+		switch rollup.HangupClass {
+		case "0":
+			stat.HangupCode0Count += int(rollup.Total)
+		case "1xx":
+			stat.HangupCode1XXCount += int(rollup.Total)
+		case "2xx":
+			stat.HangupCode2XXCount += int(rollup.Total)
+		case "3xx":
+			stat.HangupCode3XXCount += int(rollup.Total)
+		case "4xx":
+			stat.HangupCode4XXCount += int(rollup.Total)
+		case "5xx":
+			stat.HangupCode5XXCount += int(rollup.Total)
+		}
+	}
+
+	out := make([]*entity.CallStatVO, 0, len(stats))
+	for _, stat := range stats {
+		out = append(out, stat)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].IP < out[j].IP
+	})
+	return out, nil
+}
+
+// Backfill 根据呼叫明细重建时间段内的汇总，时间段按天对齐，逐天处理，返回处理的呼叫数。
+// 回填先删除再重新写入每天的汇总，与运行中的服务同时写入同一天会重复或丢失计数，
+// 因此只允许回填今天之前的日期
+func (s *StatService) Backfill(ctx context.Context, beginTime, endTime time.Time) (int64, error) {
+	today := time.Unix(s.bucketStart(time.Now(), entity.StatInterval1d), 0)
+	if endTime.After(today) {
+		return 0, fmt.Errorf("只能回填今天之前的日期，结束时间应不晚于%s", today.In(s.location).Format(time.DateOnly))
+	}
+
+	s.mu.RLock()
+	resolver := s.resolver
+	s.mu.RUnlock()
+
+	var count int64
+	// 前一天开始、仍在通话的呼叫，按分组保存结束时间
+	open := make(map[liveKey][]time.Time)
+	day := time.Unix(s.bucketStart(beginTime, entity.StatInterval1d), 0).In(s.location)
+	for day.Before(endTime) {
+		next := day.AddDate(0, 0, 1)
+
+		if err := s.repository.DeleteCallRollups(ctx, day, next); err != nil {
+			return count, err
+		}
+
+		// 在内存中合并同一汇总行，减少写入次数
+		merged := make(map[entity.CallRollup]*entity.CallRollup)
+		events := make(map[liveKey][]concurrencyEvent)
+		err := s.repository.IterateCallStatRows(ctx, day, next, func(row entity.CallStatRow) error {
+			if row.CreateTime == nil {
+				return nil
+			}
+			count++
+
+			end := *row.CreateTime
+			if row.EndTime != nil && row.EndTime.After(end) {
+				end = *row.EndTime
+			}
+			for _, group := range concurrencyGroups(row.SrcAddr, row.DstAddr, resolver) {
+				events[group] = append(events[group], concurrencyEvent{at: *row.CreateTime, delta: 1}, concurrencyEvent{at: end, delta: -1})
+			}
+
+			for _, rollup := range s.callRollups(row, resolver) {
+				key := entity.CallRollup{
+					Granularity: rollup.Granularity,
+					BucketTime:  rollup.BucketTime,
+					GatewayID:   rollup.GatewayID,
+					Direction:   rollup.Direction,
+					HangupClass: rollup.HangupClass,
+				}
+				if existing, ok := merged[key]; ok {
+					mergeRollup(existing, rollup)
+				} else {
+					rollup := rollup
+					merged[key] = &rollup
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+
+		rollups := make([]entity.CallRollup, 0, len(merged))
+		for _, rollup := range merged {
+			rollups = append(rollups, *rollup)
+		}
+		if err := s.repository.IncrCallRollups(ctx, rollups); err != nil {
+			return count, err
+		}
+
+		peaks := make(map[peakKey]int64)
+		open = s.backfillPeaks(open, events, next, peaks)
+		if err := s.repository.MaxConcurrencyRollups(ctx, peakRollups(peaks)); err != nil {
+			return count, err
+		}
+		day = next
+	}
+	return count, nil
+}
+
+func mergeRollup(a *entity.CallRollup, b entity.CallRollup) {
+	a.Total += b.Total
+	a.Answered += b.Answered
+	a.Effective += b.Effective
+	a.TalkSeconds += b.TalkSeconds
+	a.PDDMsSum += b.PDDMsSum
+	a.PDDCount += b.PDDCount
+	a.RingMsSum += b.RingMsSum
+	a.RingCount += b.RingCount
+	a.MosSum += b.MosSum
+	a.MosCount += b.MosCount
+}
+
+// backfillPeaks 按时间顺序扫描一天内各分组呼叫的开始和结束，记录各粒度时间段的并发峰值。
+// open为之前开始、仍在通话的呼叫的结束时间，返回到第二天仍在通话的呼叫的结束时间
+func (s *StatService) backfillPeaks(open map[liveKey][]time.Time, events map[liveKey][]concurrencyEvent,
+	next time.Time, peaks map[peakKey]int64) map[liveKey][]time.Time {
+	for group, ends := range open {
+		for _, end := range ends {
+			events[group] = append(events[group], concurrencyEvent{at: end, delta: -1})
+		}
+	}
+
+	stillOpen := make(map[liveKey][]time.Time)
+	for group, groupEvents := range events {
+		sortConcurrencyEvents(groupEvents)
+		current := int64(len(open[group]))
+		for _, event := range groupEvents {
+			current += event.delta
+			if !event.at.Before(next) {
+				// 当天开始的呼叫都已扫描，剩下的只有结束
+				stillOpen[group] = append(stillOpen[group], event.at)
+				continue
+			}
+			s.recordPeak(peaks, group, current, event.at)
+		}
+	}
+	return stillOpen
+}
+
+// 实时并发峰值写入汇总表的间隔
+const peakFlushInterval = 10 * time.Second
+
+type peakKey struct {
+	granularity string
+	bucket      int64
+	group       liveKey
+}
+
+// concurrencyGroups 呼叫计入并发峰值汇总的分组：全部、所属网关和网关的运营商，
+// 与明细统计一致，未匹配网关或运营商的呼叫计入空分组
+func concurrencyGroups(srcAddr, dstAddr string, resolver *GatewayResolver) []liveKey {
+	var gatewayGroup, carrierGroup string
+	if gateway, _ := resolver.Primary(srcAddr, dstAddr); gateway != nil {
+		gatewayGroup = strconv.FormatInt(gateway.ID, 10)
+		if gateway.CarrierID > 0 {
+			carrierGroup = strconv.FormatInt(gateway.CarrierID, 10)
+		}
+	}
+	return []liveKey{
+		{},
+		{groupBy: entity.StatGroupGateway, group: gatewayGroup},
+		{groupBy: entity.StatGroupCarrier, group: carrierGroup},
+	}
+}
+
+// recordPeak 更新分组在各粒度时间段中的并发峰值
+func (s *StatService) recordPeak(peaks map[peakKey]int64, group liveKey, current int64, at time.Time) {
+	if current <= 0 {
+		return
+	}
+	for _, granularity := range rollupGranularities {
+		key := peakKey{granularity: granularity, bucket: s.rollupBucket(at, granularity), group: group}
+		if current > peaks[key] {
+			peaks[key] = current
+		}
+	}
+}
+
+func peakRollups(peaks map[peakKey]int64) []entity.ConcurrencyRollup {
+	rollups := make([]entity.ConcurrencyRollup, 0, len(peaks))
+	for key, peak := range peaks {
+		rollups = append(rollups, entity.ConcurrencyRollup{
+			Granularity: key.granularity,
+			BucketTime:  time.Unix(key.bucket, 0),
+			GroupBy:     key.group.groupBy,
+			GroupKey:    key.group.group,
+			Peak:        peak,
+		})
+	}
+	return rollups
+}
+
+// OnCallStarted 呼叫开始时计入并发，与明细统计一致，并发按呼叫开始到结束计算
+func (s *StatService) OnCallStarted(call *entity.Call) {
+	s.mu.RLock()
+	groups := concurrencyGroups(call.SrcAddr, call.DstAddr, s.resolver)
+	s.mu.RUnlock()
+
+	at := time.Now()
+	if call.CreateTime != nil {
+		at = *call.CreateTime
+	}
+
+	s.peakMu.Lock()
+	defer s.peakMu.Unlock()
+	if _, ok := s.active[call.SIPCallID]; ok {
+		return
+	}
+	s.active[call.SIPCallID] = groups
+	for _, group := range groups {
+		s.current[group]++
+		s.recordPeak(s.peaks, group, s.current[group], at)
+	}
+}
+
+func (s *StatService) OnCallAnswered(call *entity.Call) {}
+
+func (s *StatService) OnCallEnded(call *entity.Call) {
+	at := time.Now()
+	if call.EndTime != nil {
+		at = *call.EndTime
+	}
+
+	s.peakMu.Lock()
+	defer s.peakMu.Unlock()
+	groups, ok := s.active[call.SIPCallID]
+	if !ok {
+		return
+	}
+	delete(s.active, call.SIPCallID)
+	for _, group := range groups {
+		s.current[group]--
+		s.recordPeak(s.peaks, group, s.current[group], at)
+		if s.current[group] <= 0 {
+			delete(s.current, group)
+		}
+	}
+}
+
+func (s *StatService) runner() {
+	ticker := time.NewTicker(peakFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.flushPeaks()
+	}
+}
+
+// flushPeaks 将记录的实时并发峰值写入汇总表，失败时留到下次写入
+func (s *StatService) flushPeaks() {
+	s.peakMu.Lock()
+	peaks := s.peaks
+	s.peaks = make(map[peakKey]int64)
+	s.peakMu.Unlock()
+	if len(peaks) == 0 {
+		return
+	}
+
+	if err := s.repository.MaxConcurrencyRollups(context.Background(), peakRollups(peaks)); err != nil {
+		logrus.WithError(err).Error("写入并发峰值汇总失败")
+		s.peakMu.Lock()
+		for key, peak := range peaks {
+			if peak > s.peaks[key] {
+				s.peaks[key] = peak
+			}
+		}
+		s.peakMu.Unlock()
+	}
+}
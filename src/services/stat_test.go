@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+)
+
+type statTestRepository struct {
+	model.Repository
+	gateways []entity.Gateway
+	rows     []entity.CallStatRow
+	rollups  []entity.CallRollup
+	peaks    []entity.ConcurrencyRollup
+	carriers []entity.Carrier
+}
+
+func (r *statTestRepository) CarrierList() ([]entity.Carrier, error) {
+	return r.carriers, nil
+}
+
+func (r *statTestRepository) CarrierGetByID(id int64) (*entity.Carrier, error) {
+	for i := range r.carriers {
+		if r.carriers[i].ID == id {
+			return &r.carriers[i], nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *statTestRepository) IncrCallRollups(ctx context.Context, rollups []entity.CallRollup) error {
+	for _, rollup := range rollups {
+		found := false
+		for i := range r.rollups {
+			existing := &r.rollups[i]
+			if existing.Granularity == rollup.Granularity && existing.BucketTime.Equal(rollup.BucketTime) &&
+				existing.GatewayID == rollup.GatewayID && existing.Direction == rollup.Direction && existing.HangupClass == rollup.HangupClass {
+				mergeRollup(existing, rollup)
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.rollups = append(r.rollups, rollup)
+		}
+	}
+	return nil
+}
+
+func (r *statTestRepository) GetCallRollups(ctx context.Context, granularity string, beginTime, endTime time.Time) ([]entity.CallRollup, error) {
+	var out []entity.CallRollup
+	for _, rollup := range r.rollups {
+		if rollup.Granularity == granularity && !rollup.BucketTime.Before(beginTime) && rollup.BucketTime.Before(endTime) {
+			out = append(out, rollup)
+		}
+	}
+	return out, nil
+}
+
+func (r *statTestRepository) DeleteCallRollups(ctx context.Context, beginTime, endTime time.Time) error {
+	kept := r.rollups[:0]
+	for _, rollup := range r.rollups {
+		if rollup.BucketTime.Before(beginTime) || !rollup.BucketTime.Before(endTime) {
+			kept = append(kept, rollup)
+		}
+	}
+	r.rollups = kept
+
+	keptPeaks := r.peaks[:0]
+	for _, peak := range r.peaks {
+		if peak.BucketTime.Before(beginTime) || !peak.BucketTime.Before(endTime) {
+			keptPeaks = append(keptPeaks, peak)
+		}
+	}
+	r.peaks = keptPeaks
+	return nil
+}
+
+func (r *statTestRepository) MaxConcurrencyRollups(ctx context.Context, rollups []entity.ConcurrencyRollup) error {
+	for _, rollup := range rollups {
+		found := false
+		for i := range r.peaks {
+			existing := &r.peaks[i]
+			if existing.Granularity == rollup.Granularity && existing.BucketTime.Equal(rollup.BucketTime) &&
+				existing.GroupBy == rollup.GroupBy && existing.GroupKey == rollup.GroupKey {
+				existing.Peak = max(existing.Peak, rollup.Peak)
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.peaks = append(r.peaks, rollup)
+		}
+	}
+	return nil
+}
+
+func (r *statTestRepository) GetConcurrencyRollups(ctx context.Context, granularity, groupBy string, beginTime, endTime time.Time) ([]entity.ConcurrencyRollup, error) {
+	var out []entity.ConcurrencyRollup
+	for _, peak := range r.peaks {
+		if peak.Granularity == granularity && peak.GroupBy == groupBy && !peak.BucketTime.Before(beginTime) && peak.BucketTime.Before(endTime) {
+			out = append(out, peak)
+		}
+	}
+	return out, nil
+}
+
+func (r *statTestRepository) GetCallStat(ctx context.Context, params entity.CallStatDTO) ([]*entity.CallStatVO, error) {
+	return []*entity.CallStatVO{{IP: "10.0.0.1:5060", Total: len(r.rows)}}, nil
+}
+
+func (r *statTestRepository) GatewayList() ([]entity.Gateway, error) {
+	return r.gateways, nil
+}
+
+func (r *statTestRepository) IterateCallStatRows(ctx context.Context, beginTime, endTime time.Time, fn func(row entity.CallStatRow) error) error {
+	for _, row := range r.rows {
+		if row.CreateTime.Before(beginTime) || !row.CreateTime.Before(endTime) {
+			continue
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func statRow(begin time.Time, offset, pdd, ring, talk time.Duration, code int, dst string) entity.CallStatRow {
+	create := begin.Add(offset)
+	row := entity.CallStatRow{CreateTime: &create, HangupCode: code, SrcAddr: "192.168.1.1:5060", DstAddr: dst, NodeIP: "127.0.0.1"}
+	ringing := create.Add(pdd)
+	row.RingingTime = &ringing
+	end := ringing.Add(ring)
+	if talk > 0 {
+		answer := end
+		row.AnswerTime = &answer
+		end = answer.Add(talk)
+		row.TalkDuration = int(talk / time.Second)
+	}
+	row.EndTime = &end
+	return row
+}
+
+func TestStatService_CallKPI(t *testing.T) {
+	begin := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	repository := &statTestRepository{
+		gateways: []entity.Gateway{{ID: 1, Name: "carrier-a", Addrs: []string{"10.0.0.1"}}},
+		rows: []entity.CallStatRow{
+			// 10点：两个应答（重叠）、一个忙、一个503
+			statRow(begin, 0, 2*time.Second, 4*time.Second, 60*time.Second, 200, "10.0.0.1:5060"),
+			statRow(begin, 10*time.Second, 4*time.Second, 6*time.Second, 120*time.Second, 200, "10.0.0.1:5060"),
+			statRow(begin, 20*time.Second, 3*time.Second, 1*time.Second, 0, 486, "10.0.0.1:5060"),
+			statRow(begin, 30*time.Second, 3*time.Second, 0, 0, 503, "10.0.0.9:5060"),
+			// 11点：一个应答
+			statRow(begin, 70*time.Minute, 1*time.Second, 2*time.Second, 30*time.Second, 200, "10.0.0.1:5060"),
+		},
+	}
+	s := NewStatService(repository)
+	s.location = time.UTC
+
+	end := begin.Add(2 * time.Hour)
+	kpi, err := s.CallKPI(context.Background(), entity.CallStatDTO{BeginTime: &begin, EndTime: &end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kpi) != 1 {
+		t.Fatalf("不分组时应只有1行，得到%d行", len(kpi))
+	}
+	all := kpi[0]
+	if all.Total != 5 || all.Answered != 3 || all.Effective != 4 {
+		t.Errorf("呼叫数错误，得到%+v", all)
+	}
+	if all.ASR != 60 || all.NER != 80 || all.ACD != 70 {
+		t.Errorf("ASR/NER/ACD错误，得到%v %v %v", all.ASR, all.NER, all.ACD)
+	}
+	if math.Abs(all.AvgPDDMs-2600) > 0.001 || math.Abs(all.AvgRingSeconds-2.6) > 0.001 {
+		t.Errorf("PDD/振铃时长错误，得到%v %v", all.AvgPDDMs, all.AvgRingSeconds)
+	}
+	if all.PeakConcurrent != 3 {
+		t.Errorf("并发峰值错误，期望3，得到%d", all.PeakConcurrent)
+	}
+
+	// 按网关、按小时
+	kpi, err = s.CallKPI(context.Background(), entity.CallStatDTO{BeginTime: &begin, EndTime: &end, GroupBy: entity.StatGroupGateway, Interval: entity.StatInterval1h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kpi) != 3 {
+		t.Fatalf("应有3行，得到%d行", len(kpi))
+	}
+	if kpi[0].Group != "" || kpi[0].Total != 1 || !kpi[0].BucketTime.Equal(begin) {
+		t.Errorf("未匹配网关的行错误，得到%+v", kpi[0])
+	}
+	if kpi[1].Group != "1" || kpi[1].GroupName != "carrier-a" || kpi[1].Total != 3 || kpi[1].PeakConcurrent != 3 {
+		t.Errorf("网关行错误，得到%+v", kpi[1])
+	}
+	if !kpi[2].BucketTime.Equal(begin.Add(time.Hour)) || kpi[2].Total != 1 || kpi[2].ASR != 100 {
+		t.Errorf("11点的行错误，得到%+v", kpi[2])
+	}
+
+	if _, err = s.CallKPI(context.Background(), entity.CallStatDTO{GroupBy: "region"}); err == nil {
+		t.Errorf("不支持的分组应返回错误")
+	}
+}
+
+func TestStatService_Rollup(t *testing.T) {
+	begin := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	repository := &statTestRepository{
+		gateways: []entity.Gateway{{ID: 1, Name: "carrier-a", Addrs: []string{"10.0.0.1"}}},
+		rows: []entity.CallStatRow{
+			statRow(begin, 0, 2*time.Second, 4*time.Second, 60*time.Second, 200, "10.0.0.1:5060"),
+			statRow(begin, 10*time.Second, 4*time.Second, 6*time.Second, 120*time.Second, 200, "10.0.0.1:5060"),
+			statRow(begin, 20*time.Second, 3*time.Second, 1*time.Second, 0, 486, "10.0.0.1:5060"),
+			statRow(begin, 30*time.Second, 3*time.Second, 0, 0, 503, "10.0.0.9:5060"),
+			statRow(begin, 70*time.Minute, 1*time.Second, 2*time.Second, 30*time.Second, 200, "10.0.0.1:5060"),
+		},
+	}
+	repository.rows[0].AlegMos = 4.2
+	repository.rows[1].BlegMos = 3.8
+	s := NewStatService(repository)
+	s.location = time.UTC
+
+	// 回填前的旧汇总会被清除
+	repository.rollups = []entity.CallRollup{{Granularity: entity.RollupHour, BucketTime: begin, Total: 100}}
+	count, err := s.Backfill(context.Background(), begin, begin.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("应回填当天5个呼叫，得到%d", count)
+	}
+
+	end := begin.Add(2 * time.Hour)
+	kpi, err := s.CallKPI(context.Background(), entity.CallStatDTO{BeginTime: &begin, EndTime: &end, GroupBy: entity.StatGroupGateway, Interval: entity.StatInterval1h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kpi) != 3 {
+		t.Fatalf("应有3行，得到%d行", len(kpi))
+	}
+	for _, vo := range kpi {
+		if vo.Source != "rollup:1h" {
+			t.Errorf("整点查询应使用小时汇总，得到%s", vo.Source)
+		}
+	}
+	if kpi[1].Group != "1" || kpi[1].GroupName != "carrier-a" || kpi[1].Total != 3 || kpi[1].Answered != 2 || kpi[1].ACD != 90 {
+		t.Errorf("网关行错误，得到%+v", kpi[1])
+	}
+	// 并发峰值和MOS与按明细统计一致
+	if kpi[1].PeakConcurrent != 3 || math.Abs(kpi[1].AvgMOS-4) > 1e-9 {
+		t.Errorf("汇总的并发峰值或MOS错误，得到%+v", kpi[1])
+	}
+
+	// 新呼叫实时累加
+	s.ApplyCall(&entity.Call{
+		CreateTime: kpi[2].BucketTime, EndTime: kpi[2].BucketTime, HangupCode: 404,
+		SrcAddr: "192.168.1.1:5060", DstAddr: "10.0.0.1:5060",
+	})
+	kpi, err = s.CallKPI(context.Background(), entity.CallStatDTO{BeginTime: &begin, EndTime: &end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kpi) != 1 || kpi[0].Total != 6 || kpi[0].Answered != 3 {
+		t.Fatalf("累加后的汇总错误，得到%+v", kpi)
+	}
+
+	// 非整点的时间段查询明细
+	from := begin.Add(15 * time.Second)
+	kpi, err = s.CallKPI(context.Background(), entity.CallStatDTO{BeginTime: &from, EndTime: &end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kpi) != 1 || kpi[0].Source != "calls" || kpi[0].Total != 3 {
+		t.Errorf("非整点查询应使用明细，得到%+v", kpi)
+	}
+
+	if s.pickRollup(entity.CallStatDTO{GroupBy: entity.StatGroupCause}, begin, end) != "" {
+		t.Errorf("汇总表不支持按原因分组")
+	}
+	if s.pickRollup(entity.CallStatDTO{Interval: entity.StatInterval5m}, begin, end) != entity.RollupMinute {
+		t.Errorf("5分钟粒度应使用分钟汇总")
+	}
+}
+
+func TestStatService_CallStat(t *testing.T) {
+	begin := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	repository := &statTestRepository{
+		gateways: []entity.Gateway{{ID: 1, Name: "carrier-a", Addrs: []string{"10.0.0.1"}}},
+		rows: []entity.CallStatRow{
+			statRow(begin, 0, 2*time.Second, 4*time.Second, 60*time.Second, 200, "10.0.0.1:5060"),
+			statRow(begin, 10*time.Second, 3*time.Second, 1*time.Second, 0, 486, "10.0.0.1:5060"),
+			statRow(begin, 20*time.Second, 3*time.Second, 0, 0, 503, "10.0.0.9:5060"),
+		},
+	}
+	s := NewStatService(repository)
+	s.location = time.UTC
+	if _, err := s.Backfill(context.Background(), begin, begin.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	end := begin.Add(time.Hour)
+	stats, err := s.CallStat(context.Background(), entity.CallStatDTO{BeginTime: &begin, EndTime: &end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("应有未匹配网关和一个网关两行，得到%d行", len(stats))
+	}
+	gateway := stats[1]
+	if gateway.IP != "10.0.0.1" || gateway.Gateway != "carrier-a" || gateway.Total != 2 || gateway.Answered != 1 ||
+		gateway.HangupCode2XXCount != 1 || gateway.HangupCode4XXCount != 1 {
+		t.Errorf("网关行错误，得到%+v", gateway)
+	}
+	if stats[0].Total != 1 || stats[0].HangupCode5XXCount != 1 {
+		t.Errorf("未匹配网关的行错误，得到%+v", stats[0])
+	}
+
+	// 非整点查询明细，按目的地址匹配网关
+	from := begin.Add(time.Second)
+	stats, err = s.CallStat(context.Background(), entity.CallStatDTO{BeginTime: &from, EndTime: &end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Gateway != "carrier-a" || stats[0].Total != 3 {
+		t.Errorf("非整点查询应使用明细，得到%+v", stats)
+	}
+}
+
+func TestStatService_LivePeaks(t *testing.T) {
+	begin := time.Date(2025, 4, 11, 10, 0, 0, 0, time.UTC)
+	repository := &statTestRepository{gateways: []entity.Gateway{{ID: 1, Name: "carrier-a", Addrs: []string{"10.0.0.1"}, CarrierID: 7}}}
+	s := NewStatService(repository)
+	s.location = time.UTC
+
+	call := func(id string, offset, duration time.Duration) *entity.Call {
+		create, end := begin.Add(offset), begin.Add(offset+duration)
+		return &entity.Call{SIPCallID: id, CreateTime: &create, HangupCode: 200, SrcAddr: "192.168.1.1:5060", DstAddr: "10.0.0.1:5060", EndTime: &end}
+	}
+	a, b, c := call("a", 0, 20*time.Second), call("b", 10*time.Second, 30*time.Second), call("c", 30*time.Second, 5*time.Second)
+	s.OnCallStarted(a)
+	s.OnCallStarted(b)
+	s.OnCallStarted(b) // 重复的开始不重复计数
+	s.OnCallEnded(a)
+	s.OnCallStarted(c)
+	s.OnCallEnded(b)
+	s.OnCallEnded(c)
+	for _, call := range []*entity.Call{a, b, c} {
+		s.ApplyCall(call)
+	}
+	s.ApplyReport(a, &entity.RtcpReport{AlegMos: 4.4, BlegMos: 3.6})
+	s.ApplyReport(b, &entity.RtcpReport{})
+	s.flushPeaks()
+
+	if len(s.current) != 0 || len(s.active) != 0 {
+		t.Errorf("呼叫结束后应清除实时并发，得到%v", s.current)
+	}
+	end := begin.Add(time.Hour)
+	for _, groupBy := range []string{"", entity.StatGroupGateway, entity.StatGroupCarrier} {
+		kpi, err := s.CallKPI(context.Background(), entity.CallStatDTO{BeginTime: &begin, EndTime: &end, GroupBy: groupBy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kpi) != 1 || kpi[0].Source != "rollup:1h" || kpi[0].Total != 3 || kpi[0].PeakConcurrent != 2 || math.Abs(kpi[0].AvgMOS-3.6) > 1e-9 {
+			t.Errorf("按%q分组的汇总错误，得到%+v", groupBy, kpi)
+		}
+	}
+}
+
+func TestStatService_BackfillRefusesToday(t *testing.T) {
+	repository := &statTestRepository{
+		rollups: []entity.CallRollup{{Granularity: entity.RollupHour, BucketTime: time.Now(), Total: 100}},
+	}
+	s := NewStatService(repository)
+
+	begin := time.Now().AddDate(0, 0, -2)
+	if _, err := s.Backfill(context.Background(), begin, time.Now()); err == nil {
+		t.Fatal("回填今天的汇总应返回错误")
+	}
+	if len(repository.rollups) != 1 {
+		t.Errorf("拒绝回填时不应删除汇总：%+v", repository.rollups)
+	}
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+	"sip-monitor/src/pkg/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TrunkHealthService 根据网关与对端之间的OPTIONS请求和响应判断中继状态，
+// 计算往返时延、响应码和连续失败次数，状态变化时记录历史并通知监听者
+type TrunkHealthService struct {
+	logger           *logrus.Logger
+	repository       model.Repository
+	timeout          time.Duration // OPTIONS无响应超时时间
+	failureThreshold int           // 连续失败多少次判定为down
+
+	mu        sync.Mutex
+	gateways  []entity.Gateway
+	resolver  *GatewayResolver
+	status    map[int64]*entity.TrunkStatus
+	pending   map[string]*optionsProbe
+	listeners []func(entity.TrunkStateHistory)
+
+	now func() time.Time
+}
+
+// 等待响应的OPTIONS请求
+type optionsProbe struct {
+	gatewayID int64
+	sentMicro int64     // 请求的抓包时间
+	seenAt    time.Time // 收到请求的本地时间，用于超时判断
+}
+
+// 时延的指数加权平均系数
+const trunkLatencyAlpha = 0.2
+
+func NewTrunkHealthService(logger *logrus.Logger, repository model.Repository, timeout time.Duration, failureThreshold int) *TrunkHealthService {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if failureThreshold <= 0 {
+		failureThreshold = 3
+	}
+	s := &TrunkHealthService{
+		logger:           logger,
+		repository:       repository,
+		timeout:          timeout,
+		failureThreshold: failureThreshold,
+		status:           make(map[int64]*entity.TrunkStatus),
+		pending:          make(map[string]*optionsProbe),
+		now:              time.Now,
+	}
+	s.ReloadGateways()
+	go s.runner()
+	return s
+}
+
+// 定时检查超时的OPTIONS，并定期刷新网关列表
+func (s *TrunkHealthService) runner() {
+	sweepTicker := time.NewTicker(time.Second)
+	reloadTicker := time.NewTicker(time.Minute)
+	defer sweepTicker.Stop()
+	defer reloadTicker.Stop()
+
+	for {
+		select {
+		case <-sweepTicker.C:
+			s.Sweep()
+		case <-reloadTicker.C:
+			s.ReloadGateways()
+		}
+	}
+}
+
+// OnStateChange 注册状态变化的监听者
+func (s *TrunkHealthService) OnStateChange(fn func(entity.TrunkStateHistory)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// ReloadGateways 重新加载网关列表，保留已有网关的状态
+func (s *TrunkHealthService) ReloadGateways() {
+	gateways, err := s.repository.GatewayList()
+	if err != nil {
+		s.logger.WithError(err).Error("加载网关列表失败")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gateways = gateways
+	s.resolver = NewGatewayResolver(gateways)
+	status := make(map[int64]*entity.TrunkStatus, len(gateways))
+	for _, gateway := range gateways {
+		current, ok := s.status[gateway.ID]
+		if !ok {
+			current = &entity.TrunkStatus{GatewayID: gateway.ID, State: entity.TrunkStateUnknown}
+		}
+		current.GatewayName = gateway.Name
+		current.GatewayAddr = strings.Join(gateway.Addrs, ",")
+		status[gateway.ID] = current
+	}
+	s.status = status
+}
+
+// Observe 处理一条SIP消息，只关心OPTIONS
+func (s *TrunkHealthService) Observe(item entity.SIP) {
+	if item.CSeqMethod != "OPTIONS" {
+		return
+	}
+	key := item.CallID + ":" + strconv.Itoa(item.CSeqNumber)
+
+	s.mu.Lock()
+	if item.IsRequest {
+		// 重传的请求以第一次为准
+		if _, ok := s.pending[key]; !ok {
+			if gateway := s.matchGateway(item.DstAddr, item.SrcAddr); gateway != nil {
+				s.pending[key] = &optionsProbe{gatewayID: gateway.ID, sentMicro: item.TimestampMicro, seenAt: s.now()}
+			}
+		}
+		s.mu.Unlock()
+		return
+	}
+
+	probe, ok := s.pending[key]
+	if !ok || item.ResponseCode < 200 {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.pending, key)
+
+	latencyMs := int((item.TimestampMicro - probe.sentMicro) / 1000)
+	if latencyMs < 0 {
+		latencyMs = 0
+	}
+	// 任何非5xx/6xx/408的响应都说明对端可达，如 200、403、404、405
+	success := item.ResponseCode < 500 && item.ResponseCode != 408
+	reason := fmt.Sprintf("%d %s", item.ResponseCode, item.ResponseDesc)
+	change := s.recordResult(probe.gatewayID, success, item.ResponseCode, latencyMs, reason)
+	s.mu.Unlock()
+
+	s.publish(change)
+}
+
+// Sweep 超时未响应的OPTIONS按失败处理
+func (s *TrunkHealthService) Sweep() {
+	var changes []*entity.TrunkStateHistory
+
+	s.mu.Lock()
+	cutoff := s.now().Add(-s.timeout)
+	for key, probe := range s.pending {
+		if probe.seenAt.After(cutoff) {
+			continue
+		}
+		delete(s.pending, key)
+		if change := s.recordResult(probe.gatewayID, false, 0, 0, "timeout"); change != nil {
+			changes = append(changes, change)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, change := range changes {
+		s.publish(change)
+	}
+}
+
+// recordResult 更新网关状态，状态变化时返回变化记录，调用方需持有mu
+func (s *TrunkHealthService) recordResult(gatewayID int64, success bool, code int, latencyMs int, reason string) *entity.TrunkStateHistory {
+	status, ok := s.status[gatewayID]
+	if !ok {
+		return nil
+	}
+
+	now := s.now()
+	status.Probes++
+	status.LastResponseCode = code
+	status.LastCheckTime = &now
+
+	newState := status.State
+	if success {
+		status.ConsecutiveFailures = 0
+		status.LastLatencyMs = latencyMs
+		if status.AvgLatencyMs == 0 {
+			status.AvgLatencyMs = float64(latencyMs)
+		} else {
+			status.AvgLatencyMs = trunkLatencyAlpha*float64(latencyMs) + (1-trunkLatencyAlpha)*status.AvgLatencyMs
+		}
+		newState = entity.TrunkStateUp
+	} else {
+		status.FailedProbes++
+		status.ConsecutiveFailures++
+		if status.ConsecutiveFailures >= s.failureThreshold {
+			newState = entity.TrunkStateDown
+		}
+	}
+
+	if newState == status.State {
+		return nil
+	}
+	change := &entity.TrunkStateHistory{
+		GatewayID:           status.GatewayID,
+		GatewayName:         status.GatewayName,
+		GatewayAddr:         util.TruncateRunes(status.GatewayAddr, 255),
+		PrevState:           status.State,
+		State:               newState,
+		Reason:              reason,
+		LatencyMs:           latencyMs,
+		ConsecutiveFailures: status.ConsecutiveFailures,
+		CreateTime:          now,
+	}
+	status.State = newState
+	status.LastChangeTime = &now
+	return change
+}
+
+// publish 保存状态变化并通知监听者
+func (s *TrunkHealthService) publish(change *entity.TrunkStateHistory) {
+	if change == nil {
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"gateway":    change.GatewayName,
+		"addr":       change.GatewayAddr,
+		"prev_state": change.PrevState,
+		"state":      change.State,
+		"reason":     change.Reason,
+	}).Warn("中继状态变化")
+
+	if err := s.repository.CreateTrunkStateHistory(context.Background(), change); err != nil {
+		s.logger.WithError(err).Error("保存中继状态变化失败")
+	}
+
+	s.mu.Lock()
+	listeners := append([]func(entity.TrunkStateHistory){}, s.listeners...)
+	s.mu.Unlock()
+	for _, listener := range listeners {
+		listener(*change)
+	}
+}
+
+// Status 返回所有网关的当前状态，按网关ID排序
+func (s *TrunkHealthService) Status() []entity.TrunkStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]entity.TrunkStatus, 0, len(s.status))
+	for _, status := range s.status {
+		out = append(out, *status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GatewayID < out[j].GatewayID })
+	return out
+}
+
+// Uptime 根据状态变化历史计算网关在时间段内的可用率
+func (s *TrunkHealthService) Uptime(ctx context.Context, gateway *entity.Gateway, beginTime, endTime time.Time) (*entity.TrunkUptimeVO, error) {
+	if now := s.now(); endTime.After(now) {
+		endTime = now
+	}
+	initial := entity.TrunkStateUnknown
+	last, err := s.repository.GetLastTrunkStateBefore(ctx, gateway.ID, beginTime)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil {
+		initial = last.State
+	}
+	histories, err := s.repository.GetTrunkStateHistory(ctx, gateway.ID, beginTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	uptime := computeTrunkUptime(beginTime, endTime, initial, histories)
+	uptime.GatewayID = gateway.ID
+	uptime.GatewayName = gateway.Name
+	return uptime, nil
+}
+
+// computeTrunkUptime 累计各状态持续的时间，initial为时间段开始时的状态
+func computeTrunkUptime(beginTime, endTime time.Time, initial string, histories []entity.TrunkStateHistory) *entity.TrunkUptimeVO {
+	uptime := &entity.TrunkUptimeVO{BeginTime: beginTime, EndTime: endTime, Changes: len(histories)}
+
+	add := func(state string, from, to time.Time) {
+		seconds := int64(to.Sub(from) / time.Second)
+		if seconds <= 0 {
+			return
+		}
+		switch state {
+		case entity.TrunkStateUp:
+			uptime.UpSeconds += seconds
+		case entity.TrunkStateDown:
+			uptime.DownSeconds += seconds
+		default:
+			uptime.UnknownSeconds += seconds
+		}
+	}
+
+	state, cursor := initial, beginTime
+	for _, history := range histories {
+		add(state, cursor, history.CreateTime)
+		state, cursor = history.State, history.CreateTime
+	}
+	add(state, cursor, endTime)
+
+	if known := uptime.UpSeconds + uptime.DownSeconds; known > 0 {
+		uptime.UptimePercent = float64(uptime.UpSeconds) * 100 / float64(known)
+	}
+	return uptime
+}
+
+// matchGateway 返回第一个地址属于网关的网关，调用方需持有mu
+func (s *TrunkHealthService) matchGateway(addrs ...string) *entity.Gateway {
+	for _, addr := range addrs {
+		if gateway := s.resolver.Match(addr); gateway != nil {
+			return gateway
+		}
+	}
+	return nil
+}
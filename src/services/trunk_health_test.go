@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"sip-monitor/src/entity"
+	"sip-monitor/src/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 只实现中继健康检查用到的方法
+type trunkTestRepository struct {
+	model.Repository
+	gateways  []entity.Gateway
+	histories []entity.TrunkStateHistory
+}
+
+func (r *trunkTestRepository) GatewayList() ([]entity.Gateway, error) {
+	return r.gateways, nil
+}
+
+func (r *trunkTestRepository) CreateTrunkStateHistory(ctx context.Context, history *entity.TrunkStateHistory) error {
+	r.histories = append(r.histories, *history)
+	return nil
+}
+
+func newTestTrunkHealth(repository *trunkTestRepository, now *time.Time) *TrunkHealthService {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &TrunkHealthService{
+		logger:           logger,
+		repository:       repository,
+		timeout:          5 * time.Second,
+		failureThreshold: 2,
+		status:           make(map[int64]*entity.TrunkStatus),
+		pending:          make(map[string]*optionsProbe),
+		now:              func() time.Time { return *now },
+	}
+	s.ReloadGateways()
+	return s
+}
+
+func optionsMsg(callID string, code int, src, dst string, micro int64) entity.SIP {
+	item := entity.SIP{CallID: callID, CSeqMethod: "OPTIONS", CSeqNumber: 1, SrcAddr: src, DstAddr: dst, TimestampMicro: micro}
+	if code == 0 {
+		item.IsRequest = true
+		item.Title = "OPTIONS"
+	} else {
+		item.ResponseCode = code
+		item.Title = "200"
+	}
+	return item
+}
+
+func TestTrunkHealth_StateChanges(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	repository := &trunkTestRepository{gateways: []entity.Gateway{
+		{ID: 1, Name: "carrier-a", Addrs: []string{"10.0.0.1"}},
+		{ID: 2, Name: "carrier-b", Addrs: []string{"10.0.0.2:5080"}},
+	}}
+	s := newTestTrunkHealth(repository, &now)
+
+	var events []entity.TrunkStateHistory
+	s.OnStateChange(func(change entity.TrunkStateHistory) {
+		events = append(events, change)
+	})
+
+	// 探测网关，响应时延 35ms
+	s.Observe(optionsMsg("opt-1", 0, "192.168.1.1:5060", "10.0.0.1:5060", 1000000))
+	s.Observe(optionsMsg("opt-1", 200, "10.0.0.1:5060", "192.168.1.1:5060", 1035000))
+
+	status := s.Status()
+	if status[0].State != entity.TrunkStateUp || status[0].LastLatencyMs != 35 || status[0].LastResponseCode != 200 {
+		t.Errorf("网关状态错误，得到%+v", status[0])
+	}
+	if status[1].State != entity.TrunkStateUnknown {
+		t.Errorf("未探测的网关应为unknown，得到%s", status[1].State)
+	}
+
+	// 端口不匹配的地址不属于网关2
+	s.Observe(optionsMsg("opt-x", 0, "192.168.1.1:5060", "10.0.0.2:5060", 1000000))
+	if len(s.pending) != 0 {
+		t.Errorf("端口不匹配不应记录探测")
+	}
+
+	// 连续两次超时判定为down
+	for i, callID := range []string{"opt-2", "opt-3"} {
+		s.Observe(optionsMsg(callID, 0, "192.168.1.1:5060", "10.0.0.1:5060", 2000000))
+		now = now.Add(6 * time.Second)
+		s.Sweep()
+		if i == 0 && s.Status()[0].State != entity.TrunkStateUp {
+			t.Errorf("一次超时不应判定为down")
+		}
+	}
+	status = s.Status()
+	if status[0].State != entity.TrunkStateDown || status[0].ConsecutiveFailures != 2 || status[0].FailedProbes != 2 {
+		t.Errorf("网关应为down，得到%+v", status[0])
+	}
+
+	// 网关主动探测我们，503表示失败，之后的200恢复
+	s.Observe(optionsMsg("opt-4", 0, "10.0.0.1:5060", "192.168.1.1:5060", 3000000))
+	s.Observe(optionsMsg("opt-4", 503, "192.168.1.1:5060", "10.0.0.1:5060", 3001000))
+	s.Observe(optionsMsg("opt-5", 0, "10.0.0.1:5060", "192.168.1.1:5060", 4000000))
+	s.Observe(optionsMsg("opt-5", 200, "192.168.1.1:5060", "10.0.0.1:5060", 4002000))
+
+	if len(events) != 3 || len(repository.histories) != 3 {
+		t.Fatalf("应有3次状态变化，得到%d次", len(events))
+	}
+	expected := [][2]string{
+		{entity.TrunkStateUnknown, entity.TrunkStateUp},
+		{entity.TrunkStateUp, entity.TrunkStateDown},
+		{entity.TrunkStateDown, entity.TrunkStateUp},
+	}
+	for i, event := range events {
+		if event.PrevState != expected[i][0] || event.State != expected[i][1] {
+			t.Errorf("第%d次状态变化错误，得到%s -> %s", i+1, event.PrevState, event.State)
+		}
+	}
+	if events[1].Reason != "timeout" {
+		t.Errorf("down的原因应为timeout，得到%s", events[1].Reason)
+	}
+}
+
+func TestComputeTrunkUptime(t *testing.T) {
+	begin := time.Unix(1700000000, 0)
+	end := begin.Add(100 * time.Second)
+	histories := []entity.TrunkStateHistory{
+		{State: entity.TrunkStateDown, CreateTime: begin.Add(60 * time.Second)},
+		{State: entity.TrunkStateUp, CreateTime: begin.Add(70 * time.Second)},
+	}
+
+	uptime := computeTrunkUptime(begin, end, entity.TrunkStateUp, histories)
+	if uptime.UpSeconds != 90 || uptime.DownSeconds != 10 || uptime.UptimePercent != 90 || uptime.Changes != 2 {
+		t.Errorf("可用率计算错误，得到%+v", uptime)
+	}
+
+	// 开始时状态未知，未知时间不计入可用率
+	uptime = computeTrunkUptime(begin, end, entity.TrunkStateUnknown, histories[1:])
+	if uptime.UnknownSeconds != 70 || uptime.UpSeconds != 30 || uptime.UptimePercent != 100 {
+		t.Errorf("可用率计算错误，得到%+v", uptime)
+	}
+}
@@ -3,7 +3,7 @@
 export interface Gateway {
   id: number
   name: string
-  addr: string
+  addrs: string[]
   remark: string
   create_at: string
   update_at: string
@@ -1,5 +1,5 @@
 import { useEffect, useState } from 'react'
-import { Table, Button, Modal, Form, Input, message, Popconfirm, Space } from 'antd'
+import { Table, Button, Modal, Form, Input, message, Popconfirm, Select, Space, Tag } from 'antd'
 import type { ColumnsType } from 'antd/es/table'
 import { Gateway } from '@/apis/gateway'
 import { gatewayApi } from '@/apis/api'
@@ -77,7 +77,14 @@ const GatewayList = () => {
     },
     {
       title: '地址',
-      dataIndex: 'addr',
+      dataIndex: 'addrs',
+      render: (_, record) => (
+        <>
+          {(record.addrs || []).map((addr) => (
+            <Tag key={addr}>{addr}</Tag>
+          ))}
+        </>
+      ),
     },
     {
       title: '备注',
@@ -144,11 +151,12 @@ const GatewayList = () => {
             <Input />
           </Form.Item>
           <Form.Item
-            name="addr"
+            name="addrs"
             label="地址"
-            rules={[{ required: true, message: '请输入地址' }]}
+            tooltip="IP、IP:端口、网段或端口范围，如 10.0.0.0/8:5060-5080，回车或逗号分隔多个"
+            rules={[{ required: true, type: 'array', min: 1, message: '请输入地址' }]}
           >
-            <Input />
+            <Select mode="tags" open={false} tokenSeparators={[',', ' ']} placeholder="10.0.0.1:5060" />
           </Form.Item>
           <Form.Item name="remark" label="备注">
             <Input.TextArea />